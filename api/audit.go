@@ -15,11 +15,14 @@ type QueryFilter struct {
 
 // AuditStats provides summary statistics for the dashboard.
 type AuditStats struct {
-	TotalRequests int            `json:"total_requests"`
-	AllowCount    int            `json:"allow_count"`
-	DenyCount     int            `json:"deny_count"`
-	AskCount      int            `json:"ask_count"`
-	LogCount      int            `json:"log_count"`
-	ByMethod      map[string]int `json:"by_method"`
-	ByTool        map[string]int `json:"by_tool"`
+	TotalRequests    int            `json:"total_requests"`
+	AllowCount       int            `json:"allow_count"`
+	DenyCount        int            `json:"deny_count"`
+	AskCount         int            `json:"ask_count"`
+	LogCount         int            `json:"log_count"`
+	ThrottledCount   int            `json:"throttled_count"`    // requests delayed by rate limits
+	RateLimitedCount int            `json:"rate_limited_count"` // requests denied by rate limits
+	TotalDelay       time.Duration  `json:"total_delay"`
+	ByMethod         map[string]int `json:"by_method"`
+	ByTool           map[string]int `json:"by_tool"`
 }
@@ -30,12 +30,53 @@ type AuditRecord struct {
 	Direction Direction       `json:"direction"`
 	Method    string          `json:"method,omitempty"`
 	Tool      string          `json:"tool,omitempty"`
+	Session   string          `json:"session,omitempty"`
+	Server    string          `json:"server,omitempty"` // route of a multi-server HTTP proxy
 	Arguments json.RawMessage `json:"arguments,omitempty"`
 	Verdict   Verdict         `json:"verdict"`
 	Rule      string          `json:"rule,omitempty"`
 	Message   string          `json:"message,omitempty"`
+	Tags      []string        `json:"tags,omitempty"`
 	RawSize   int             `json:"raw_size,omitempty"`
 	Duration  time.Duration   `json:"duration,omitempty"`
+	Delay     time.Duration   `json:"delay,omitempty"`     // time held by rate limit throttling
+	Principal *Principal      `json:"principal,omitempty"` // authenticated caller (HTTP proxy)
+
+	// Request/response correlation. A request and its response share
+	// CorrelationID; the response record carries the rest.
+	CorrelationID string        `json:"correlation_id,omitempty"`
+	Latency       time.Duration `json:"latency,omitempty"` // request in to response out
+	ErrorCode     int           `json:"error_code,omitempty"`
+	ErrorMessage  string        `json:"error_message,omitempty"`
+	ResultSize    int           `json:"result_size,omitempty"`
+}
+
+// Principal is the authenticated caller of the HTTP proxy: the subject of
+// a bearer token and the scopes and groups it grants, and the client
+// certificate it connected with.
+type Principal struct {
+	Subject string   `json:"subject"`
+	Scopes  []string `json:"scopes,omitempty"`
+	Groups  []string `json:"groups,omitempty"`
+	Method  string   `json:"method"` // token | jwt | mtls
+
+	// The verified client certificate's subject DN and SANs (DNS names,
+	// emails, URIs, IP addresses), when the client used mTLS.
+	CertSubject string   `json:"cert_subject,omitempty"`
+	CertSANs    []string `json:"cert_sans,omitempty"`
+}
+
+// SessionInfo describes a client session of the HTTP proxy, identified by
+// its Mcp-Session-Id.
+type SessionInfo struct {
+	ID         string    `json:"id"`
+	ClientName string    `json:"client_name,omitempty"`
+	Server     string    `json:"server,omitempty"`
+	Created    time.Time `json:"created"`
+	LastSeen   time.Time `json:"last_seen"`
+	Requests   int       `json:"requests"`
+	Denied     int       `json:"denied"`
+	Streams    int       `json:"streams"` // open GET streams
 }
 
 // CheckRequest is used by the CLI `check` command and SDK API.
@@ -0,0 +1,66 @@
+package cli
+
+import (
+	"path/filepath"
+
+	"github.com/tkingovr/agent-guard/internal/audit"
+	"github.com/tkingovr/agent-guard/internal/config"
+	"github.com/tkingovr/agent-guard/internal/filter"
+	"github.com/tkingovr/agent-guard/internal/policy"
+)
+
+// newChainConfig assembles the filter chain configuration shared by the
+// proxy, serve, and httpproxy commands.
+func newChainConfig(cfg *config.Config, engine policy.Engine, store audit.Store) (filter.ChainConfig, error) {
+	secretOpts, err := filter.SecretScannerOptionsFromPolicy(cfg.SecretSettings)
+	if err != nil {
+		return filter.ChainConfig{}, err
+	}
+
+	canary, err := filter.CanaryFromPolicy(cfg.Canary)
+	if err != nil {
+		return filter.ChainConfig{}, err
+	}
+	if canary != nil {
+		logger.Info("host canary enabled", "fingerprints", canary.Size())
+	}
+
+	honeytokens, err := filter.HoneytokensFromPolicy(cfg.Honeytokens, filepath.Join(cfg.LogDir, "honeytokens.json"))
+	if err != nil {
+		return filter.ChainConfig{}, err
+	}
+
+	// Hashed capture is keyed per install, so the audit log alone can't
+	// confirm a guessed argument
+	redaction := filter.RedactionConfigFromPolicy(cfg.Redaction)
+	if redaction != nil {
+		redaction.HashKey, err = filter.LoadRedactionKey(filepath.Join(cfg.LogDir, "redaction.key"))
+		if err != nil {
+			return filter.ChainConfig{}, err
+		}
+	}
+
+	rateLimit := filter.RateLimitConfigFromPolicy(cfg.RateLimit, cfg.PolicyFile.Rules...)
+	if rateLimit != nil && cfg.RateLimit != nil && cfg.RateLimit.Persist {
+		rateLimit.StateFile = filepath.Join(cfg.LogDir, "ratelimit.json")
+	}
+
+	return filter.ChainConfig{
+		Engine:           engine,
+		AuditStore:       store,
+		Logger:           logger,
+		SecretScanner:    cfg.SecretScanner,
+		EntropyThreshold: cfg.EntropyThreshold,
+		SecretOptions:    secretOpts,
+		RateLimit:        rateLimit,
+		InjectionScanner: cfg.InjectionScanner,
+		ResultScanner:    cfg.ResultScanner,
+		Redaction:        redaction,
+		Canary:           canary,
+		Honeytokens:      honeytokens,
+		Concurrency:      filter.ConcurrencyFromPolicy(cfg.Concurrency),
+		LoopDetection:    filter.LoopConfigFromPolicy(cfg.LoopDetection),
+		Budget:           filter.BudgetFromPolicy(cfg.Budget),
+		OnFilterError:    cfg.OnFilterError,
+	}, nil
+}
@@ -0,0 +1,136 @@
+package cli
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/spf13/cobra"
+	"github.com/tkingovr/agent-guard/internal/approval"
+	"github.com/tkingovr/agent-guard/internal/audit"
+	"github.com/tkingovr/agent-guard/internal/config"
+	"github.com/tkingovr/agent-guard/internal/dashboard"
+	"github.com/tkingovr/agent-guard/internal/filter"
+	"github.com/tkingovr/agent-guard/internal/gateway"
+	"github.com/tkingovr/agent-guard/internal/policy"
+	"github.com/tkingovr/agent-guard/internal/tlsconfig"
+)
+
+var gatewayDashboard bool
+
+var gatewayCmd = &cobra.Command{
+	Use:   "gateway",
+	Short: "Merge several MCP servers into one stdio MCP server",
+	Long: `Start a gateway that presents the MCP servers in the policy's servers
+setting to the AI host as a single stdio MCP server. Each server is
+spawned (command) or reached over Streamable HTTP (url).
+
+Tools and prompts are named <server>.<name>, e.g. github.create_issue,
+and list requests are merged across servers. Every call goes through one
+policy and one audit log; rules match a server with "server:" and the tool
+by its own name. With --dashboard, the web dashboard runs alongside it.`,
+	Example: `  agentguard gateway -c gateway.yaml
+  agentguard gateway -c gateway.yaml --dashboard`,
+	Args: cobra.NoArgs,
+	RunE: runGateway,
+}
+
+func init() {
+	gatewayCmd.Flags().BoolVar(&gatewayDashboard, "dashboard", false, "also start the web dashboard (at dashboard_addr)")
+	rootCmd.AddCommand(gatewayCmd)
+}
+
+func runGateway(cmd *cobra.Command, args []string) error {
+	if cfgFile == "" {
+		return fmt.Errorf("--config is required: its servers setting lists the MCP servers")
+	}
+	cfg, err := config.Load(cfgFile)
+	if err != nil {
+		return fmt.Errorf("loading config: %w", err)
+	}
+	if len(cfg.Servers) == 0 {
+		return fmt.Errorf("%s has no servers", cfgFile)
+	}
+
+	engine, err := policy.NewYAMLEngine(cfgFile)
+	if err != nil {
+		return fmt.Errorf("creating policy engine: %w", err)
+	}
+
+	auditStore, err := audit.NewJSONLStore(cfg.LogDir)
+	if err != nil {
+		return fmt.Errorf("creating audit store: %w", err)
+	}
+	defer auditStore.Close()
+
+	aq := approval.NewQueue(cfg.ApprovalTimeout)
+
+	chainCfg, err := newChainConfig(cfg, engine, auditStore)
+	if err != nil {
+		return fmt.Errorf("building filter chain: %w", err)
+	}
+
+	var upstreams []*gateway.Upstream
+	for _, s := range cfg.Servers {
+		upstream := s.UpstreamTLS
+		if upstream == nil {
+			upstream = cfg.UpstreamTLS
+		}
+		var tlsConfig *tls.Config
+		if upstream != nil && s.URL != "" {
+			tlsConfig, err = tlsconfig.Client(upstream, logger)
+			if err != nil {
+				return fmt.Errorf("server %q: configuring upstream TLS: %w", s.Name, err)
+			}
+		}
+		upstreams = append(upstreams, gateway.NewUpstream(s, tlsConfig, logger))
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		<-sigCh
+		logger.Info("shutting down gateway")
+		cancel()
+	}()
+
+	if gatewayDashboard {
+		var dashOpts []dashboard.Option
+		if chainCfg.Concurrency != nil {
+			dashOpts = append(dashOpts, dashboard.WithInFlight(chainCfg.Concurrency.InFlight))
+		}
+		if chainCfg.Budget != nil {
+			dashOpts = append(dashOpts, dashboard.WithBudgets(chainCfg.Budget.Usage))
+		}
+		dash := dashboard.NewServer(cfg.DashboardAddr, auditStore, aq, engine, logger, dashOpts...)
+		go func() {
+			if err := dash.ListenAndServe(ctx); err != nil {
+				logger.Error("dashboard error", "error", err)
+			}
+		}()
+		logger.Info("dashboard started", "addr", cfg.DashboardAddr)
+	} else {
+		logger.Warn("dashboard not running: calls a policy asks about wait out approval_timeout and are denied; start with --dashboard to approve them",
+			"approval_timeout", cfg.ApprovalTimeout)
+	}
+
+	logger.Info("starting gateway",
+		"servers", len(upstreams),
+		"policy", cfgFile,
+	)
+
+	gw := gateway.New(upstreams,
+		filter.BuildInboundChain(chainCfg),
+		filter.BuildOutboundChain(chainCfg),
+		logger,
+		gateway.WithApprovalQueue(aq),
+		gateway.WithVersion(version),
+	)
+	return gw.Run(ctx, os.Stdin, os.Stdout)
+}
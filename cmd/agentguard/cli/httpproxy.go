@@ -2,37 +2,56 @@ package cli
 
 import (
 	"context"
+	"crypto/tls"
 	"fmt"
+	"maps"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"slices"
 	"syscall"
 
+	"github.com/tkingovr/agent-guard/api"
+	"github.com/tkingovr/agent-guard/internal/approval"
 	"github.com/tkingovr/agent-guard/internal/audit"
+	"github.com/tkingovr/agent-guard/internal/auth"
 	"github.com/tkingovr/agent-guard/internal/config"
+	"github.com/tkingovr/agent-guard/internal/dashboard"
 	"github.com/tkingovr/agent-guard/internal/filter"
 	"github.com/tkingovr/agent-guard/internal/policy"
 	httpproxy "github.com/tkingovr/agent-guard/internal/proxy/http"
+	"github.com/tkingovr/agent-guard/internal/tlsconfig"
 	"github.com/spf13/cobra"
 )
 
 var (
-	httpTarget string
-	httpListen string
+	httpTarget    string
+	httpListen    string
+	httpDashboard bool
 )
 
 var httpproxyCmd = &cobra.Command{
 	Use:   "httpproxy",
 	Short: "Start the HTTP Streamable MCP proxy",
 	Long: `Start an HTTP reverse proxy that intercepts MCP JSON-RPC messages
-sent over HTTP Streamable transport.`,
-	Example: `  agentguard httpproxy -c policy.yaml --target http://localhost:4000/mcp --listen :3000`,
-	RunE:    runHTTPProxy,
+sent over HTTP Streamable transport. With --dashboard, the web dashboard
+runs alongside it, where requests with an ask verdict are approved.
+
+With auth settings in the policy, clients must present a bearer token: a
+static token from tokens_file, or a JWT signed by the authorization server.
+With tls settings it serves HTTPS, reloading the certificate when it is
+renewed, and with client_ca_file it requires client certificates (mTLS).
+upstream_tls sets the CAs, client certificate and server name used to
+reach an https target.`,
+	Example: `  agentguard httpproxy -c policy.yaml --target http://localhost:4000/mcp --listen :3000
+  agentguard httpproxy -c policy.yaml --target http://localhost:4000/mcp --dashboard`,
+	RunE: runHTTPProxy,
 }
 
 func init() {
-	httpproxyCmd.Flags().StringVar(&httpTarget, "target", "", "target MCP server URL (required)")
+	httpproxyCmd.Flags().StringVar(&httpTarget, "target", "", "target MCP server URL (required unless the policy has routes)")
 	httpproxyCmd.Flags().StringVar(&httpListen, "listen", ":3000", "listen address")
-	_ = httpproxyCmd.MarkFlagRequired("target")
+	httpproxyCmd.Flags().BoolVar(&httpDashboard, "dashboard", false, "also start the web dashboard (at dashboard_addr)")
 	rootCmd.AddCommand(httpproxyCmd)
 }
 
@@ -48,7 +67,14 @@ func runHTTPProxy(cmd *cobra.Command, args []string) error {
 		cfg = config.DefaultConfig()
 	}
 
-	var engine policy.Engine
+	switch {
+	case httpTarget == "" && len(cfg.Routes) == 0:
+		return fmt.Errorf("--target is required unless the policy has routes")
+	case httpTarget != "" && len(cfg.Routes) > 0:
+		return fmt.Errorf("--target can't be combined with routes; add it as a route")
+	}
+
+	var engine *policy.YAMLEngine
 	if cfgFile != "" {
 		engine, err = policy.NewYAMLEngine(cfgFile)
 		if err != nil {
@@ -67,19 +93,60 @@ func runHTTPProxy(cmd *cobra.Command, args []string) error {
 	}
 	defer auditStore.Close()
 
-	chainCfg := filter.ChainConfig{
-		Engine:           engine,
-		AuditStore:       auditStore,
-		Logger:           logger,
-		SecretScanner:    cfg.SecretScanner,
-		EntropyThreshold: cfg.EntropyThreshold,
-		RateLimit:        filter.RateLimitConfigFromPolicy(cfg.RateLimit),
+	aq := approval.NewQueue(cfg.ApprovalTimeout)
+
+	// Options shared by every route
+	opts := []httpproxy.Option{
+		httpproxy.WithApprovalQueue(aq),
+		httpproxy.WithSessionIdleTimeout(cfg.SessionIdleTimeout),
+	}
+	if cfg.Auth != nil {
+		authenticator, err := auth.New(cfg.Auth)
+		if err != nil {
+			return fmt.Errorf("configuring auth: %w", err)
+		}
+		opts = append(opts, httpproxy.WithAuthenticator(authenticator))
+	} else if cfg.TLS == nil || cfg.TLS.ClientCAFile == "" || cfg.TLS.ClientAuth == "optional" {
+		logger.Warn("auth not configured: anyone who can reach the listen address can use the server", "listen", httpListen)
+	}
+	var serverTLS *tls.Config
+	if cfg.TLS != nil {
+		serverTLS, err = tlsconfig.Server(cfg.TLS, logger)
+		if err != nil {
+			return fmt.Errorf("configuring TLS: %w", err)
+		}
 	}
-	chain := filter.BuildInboundChain(chainCfg)
 
-	proxy, err := httpproxy.NewProxy(httpTarget, chain, logger)
-	if err != nil {
-		return err
+	var server interface {
+		ListenAndServe(ctx context.Context, addr string) error
+		Sessions() []api.SessionInfo
+	}
+	chains := make(map[string]filter.ChainConfig)
+	if len(cfg.Routes) == 0 {
+		if serverTLS != nil {
+			opts = append(opts, httpproxy.WithTLS(serverTLS))
+		}
+		proxy, chainCfg, err := newHTTPProxy(cfg, engine, auditStore, "", httpTarget, cfg.UpstreamTLS, opts)
+		if err != nil {
+			return err
+		}
+		server = proxy
+		chains[""] = chainCfg
+	} else {
+		var routes []httpproxy.Route
+		for _, rs := range cfg.Routes {
+			proxy, chainCfg, err := newRouteProxy(cfg, engine, auditStore, rs, opts)
+			if err != nil {
+				return fmt.Errorf("route %q: %w", rs.Name, err)
+			}
+			routes = append(routes, httpproxy.Route{Name: rs.Name, Host: rs.Host, PathPrefix: rs.PathPrefix, Proxy: proxy})
+			chains[rs.Name] = chainCfg
+		}
+		var routerOpts []httpproxy.RouterOption
+		if serverTLS != nil {
+			routerOpts = append(routerOpts, httpproxy.WithRouterTLS(serverTLS))
+		}
+		server = httpproxy.NewRouter(routes, logger, routerOpts...)
 	}
 
 	ctx, cancel := context.WithCancel(context.Background())
@@ -93,5 +160,115 @@ func runHTTPProxy(cmd *cobra.Command, args []string) error {
 		cancel()
 	}()
 
-	return proxy.ListenAndServe(ctx, httpListen)
+	if httpDashboard {
+		dashOpts := dashboardChainOptions(chains)
+		dashOpts = append(dashOpts, dashboard.WithSessions(server.Sessions))
+		dash := dashboard.NewServer(cfg.DashboardAddr, auditStore, aq, engine, logger, dashOpts...)
+		go func() {
+			if err := dash.ListenAndServe(ctx); err != nil {
+				logger.Error("dashboard error", "error", err)
+			}
+		}()
+		logger.Info("dashboard started", "addr", cfg.DashboardAddr)
+	} else {
+		logger.Warn("dashboard not running: calls a policy asks about wait out approval_timeout and are denied; start with --dashboard to approve them",
+			"approval_timeout", cfg.ApprovalTimeout)
+	}
+
+	return server.ListenAndServe(ctx, httpListen)
+}
+
+// newHTTPProxy builds a proxy to target, filtered by the chain cfg and
+// engine describe. A route's proxy is named after it.
+func newHTTPProxy(cfg *config.Config, engine policy.Engine, store audit.Store, name, target string, upstream *policy.UpstreamTLSSettings, opts []httpproxy.Option) (*httpproxy.Proxy, filter.ChainConfig, error) {
+	chainCfg, err := newChainConfig(cfg, engine, store)
+	if err != nil {
+		return nil, chainCfg, fmt.Errorf("building filter chain: %w", err)
+	}
+
+	opts = append(slices.Clip(opts), httpproxy.WithOutboundChain(filter.BuildOutboundChain(chainCfg)))
+	if name != "" {
+		opts = append(opts, httpproxy.WithServerName(name))
+		// Each route keeps its own quotas
+		if rl := chainCfg.RateLimit; rl != nil && rl.StateFile != "" {
+			rl.StateFile = filepath.Join(cfg.LogDir, "ratelimit-"+name+".json")
+		}
+	}
+	if upstream != nil {
+		upstreamTLS, err := tlsconfig.Client(upstream, logger)
+		if err != nil {
+			return nil, chainCfg, fmt.Errorf("configuring upstream TLS: %w", err)
+		}
+		opts = append(opts, httpproxy.WithUpstreamTLS(upstreamTLS))
+	}
+
+	proxy, err := httpproxy.NewProxy(target, filter.BuildInboundChain(chainCfg), logger, opts...)
+	return proxy, chainCfg, err
+}
+
+// newRouteProxy builds the proxy of a route, under the route's own policy
+// file if it has one. Every route writes to the same audit log.
+func newRouteProxy(cfg *config.Config, engine policy.Engine, store audit.Store, rs policy.RouteSettings, opts []httpproxy.Option) (*httpproxy.Proxy, filter.ChainConfig, error) {
+	routeCfg := *cfg
+	if rs.Policy != "" {
+		loaded, err := config.Load(rs.Policy)
+		if err != nil {
+			return nil, filter.ChainConfig{}, err
+		}
+		routeCfg = *loaded
+		routeCfg.LogDir = cfg.LogDir
+		if engine, err = policy.NewYAMLEngine(rs.Policy); err != nil {
+			return nil, filter.ChainConfig{}, fmt.Errorf("creating policy engine: %w", err)
+		}
+	}
+	if rs.RateLimit != nil {
+		routeCfg.RateLimit = rs.RateLimit
+	}
+	upstream := rs.UpstreamTLS
+	if upstream == nil {
+		upstream = cfg.UpstreamTLS
+	}
+
+	return newHTTPProxy(&routeCfg, engine, store, rs.Name, rs.Target, upstream, opts)
+}
+
+// dashboardChainOptions shows the in-flight calls and session budgets of
+// every route's chain on the dashboard, with tools prefixed by their
+// route.
+func dashboardChainOptions(chains map[string]filter.ChainConfig) []dashboard.Option {
+	var opts []dashboard.Option
+	inFlight := make(map[string]func() map[string]int)
+	budgets := make(map[string]func() map[string]policy.BudgetUsage)
+	for name, chainCfg := range chains {
+		if chainCfg.Concurrency != nil {
+			inFlight[name] = chainCfg.Concurrency.InFlight
+		}
+		if chainCfg.Budget != nil {
+			budgets[name] = chainCfg.Budget.Usage
+		}
+	}
+	if len(inFlight) > 0 {
+		opts = append(opts, dashboard.WithInFlight(func() map[string]int {
+			out := make(map[string]int)
+			for name, fn := range inFlight {
+				for tool, n := range fn() {
+					if name != "" {
+						tool = name + "/" + tool
+					}
+					out[tool] = n
+				}
+			}
+			return out
+		}))
+	}
+	if len(budgets) > 0 {
+		opts = append(opts, dashboard.WithBudgets(func() map[string]policy.BudgetUsage {
+			out := make(map[string]policy.BudgetUsage)
+			for _, fn := range budgets {
+				maps.Copy(out, fn())
+			}
+			return out
+		}))
+	}
+	return opts
 }
@@ -72,13 +72,9 @@ func runProxy(cmd *cobra.Command, args []string) error {
 	aq := approval.NewQueue(cfg.ApprovalTimeout)
 
 	// Build filter chains
-	chainCfg := filter.ChainConfig{
-		Engine:           engine,
-		AuditStore:       auditStore,
-		Logger:           logger,
-		SecretScanner:    cfg.SecretScanner,
-		EntropyThreshold: cfg.EntropyThreshold,
-		RateLimit:        filter.RateLimitConfigFromPolicy(cfg.RateLimit),
+	chainCfg, err := newChainConfig(cfg, engine, auditStore)
+	if err != nil {
+		return fmt.Errorf("building filter chain: %w", err)
 	}
 	inbound := filter.BuildInboundChain(chainCfg)
 	outbound := filter.BuildOutboundChain(chainCfg)
@@ -66,13 +66,9 @@ func runServe(cmd *cobra.Command, args []string) error {
 	aq := approval.NewQueue(cfg.ApprovalTimeout)
 
 	// Build filter chains
-	chainCfg := filter.ChainConfig{
-		Engine:           engine,
-		AuditStore:       auditStore,
-		Logger:           logger,
-		SecretScanner:    cfg.SecretScanner,
-		EntropyThreshold: cfg.EntropyThreshold,
-		RateLimit:        filter.RateLimitConfigFromPolicy(cfg.RateLimit),
+	chainCfg, err := newChainConfig(cfg, engine, auditStore)
+	if err != nil {
+		return fmt.Errorf("building filter chain: %w", err)
 	}
 	inbound := filter.BuildInboundChain(chainCfg)
 	outbound := filter.BuildOutboundChain(chainCfg)
@@ -89,7 +85,14 @@ func runServe(cmd *cobra.Command, args []string) error {
 	}()
 
 	// Start dashboard in background
-	dash := dashboard.NewServer(cfg.DashboardAddr, auditStore, aq, engine, logger)
+	var dashOpts []dashboard.Option
+	if chainCfg.Concurrency != nil {
+		dashOpts = append(dashOpts, dashboard.WithInFlight(chainCfg.Concurrency.InFlight))
+	}
+	if chainCfg.Budget != nil {
+		dashOpts = append(dashOpts, dashboard.WithBudgets(chainCfg.Budget.Usage))
+	}
+	dash := dashboard.NewServer(cfg.DashboardAddr, auditStore, aq, engine, logger, dashOpts...)
 	go func() {
 		if err := dash.ListenAndServe(ctx); err != nil {
 			logger.Error("dashboard error", "error", err)
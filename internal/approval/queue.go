@@ -2,6 +2,7 @@ package approval
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"sync"
 	"time"
@@ -31,20 +32,38 @@ func NewQueue(timeout time.Duration) *Queue {
 	}
 }
 
+// ErrCancelled is returned by Await when the client cancelled the request
+// while it was pending.
+var ErrCancelled = errors.New("approval request cancelled")
+
 // Submit creates a new approval request and blocks until it's resolved or times out.
 func (q *Queue) Submit(ctx context.Context, method, tool, rule, message string, args []byte) (api.Verdict, error) {
+	return q.Await(ctx, q.Enqueue(method, tool, rule, message, args))
+}
+
+// Enqueue creates a new approval request and notifies subscribers without
+// waiting for a decision. Use Await to block on it.
+func (q *Queue) Enqueue(method, tool, rule, message string, args []byte) *Request {
 	req := q.enqueue(method, tool, rule, message, args)
 
 	// Notify subscribers
 	q.notifySubscribers(req)
+	return req
+}
 
+// Await blocks until req is resolved or times out. A cancelled request
+// returns ErrCancelled.
+func (q *Queue) Await(ctx context.Context, req *Request) (api.Verdict, error) {
 	// Wait for resolution or timeout
 	select {
 	case <-req.Wait():
 		q.mu.RLock()
 		defer q.mu.RUnlock()
-		if req.Status == StatusApproved {
+		switch req.Status {
+		case StatusApproved:
 			return api.VerdictAllow, nil
+		case StatusCancelled:
+			return api.VerdictDeny, ErrCancelled
 		}
 		return api.VerdictDeny, nil
 
@@ -91,6 +110,11 @@ func (q *Queue) Deny(id string) error {
 	return q.resolve(id, StatusDenied)
 }
 
+// Cancel withdraws a pending request, e.g. when the client cancelled it.
+func (q *Queue) Cancel(id string) error {
+	return q.resolve(id, StatusCancelled)
+}
+
 func (q *Queue) resolve(id string, status Status) error {
 	q.mu.Lock()
 	defer q.mu.Unlock()
@@ -2,6 +2,7 @@ package approval
 
 import (
 	"context"
+	"errors"
 	"testing"
 	"time"
 
@@ -142,3 +143,29 @@ func TestQueue_Subscribe(t *testing.T) {
 		q.Approve(pending[0].ID)
 	}
 }
+
+func TestQueue_Cancel(t *testing.T) {
+	q := NewQueue(10 * time.Second)
+
+	req := q.Enqueue("tools/call", "write_file", "ask-write", "needs approval", nil)
+	if err := q.Cancel(req.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	verdict, err := q.Await(context.Background(), req)
+	if !errors.Is(err, ErrCancelled) {
+		t.Fatalf("expected ErrCancelled, got %v", err)
+	}
+	if verdict != api.VerdictDeny {
+		t.Errorf("expected deny for cancelled request, got %s", verdict)
+	}
+	if req.Status != StatusCancelled {
+		t.Errorf("expected status cancelled, got %s", req.Status)
+	}
+	if len(q.Pending()) != 0 {
+		t.Error("cancelled request should no longer be pending")
+	}
+	if err := q.Approve(req.ID); err == nil {
+		t.Error("expected error approving a cancelled request")
+	}
+}
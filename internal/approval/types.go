@@ -11,10 +11,11 @@ import (
 type Status string
 
 const (
-	StatusPending  Status = "pending"
-	StatusApproved Status = "approved"
-	StatusDenied   Status = "denied"
-	StatusTimedOut Status = "timed_out"
+	StatusPending   Status = "pending"
+	StatusApproved  Status = "approved"
+	StatusDenied    Status = "denied"
+	StatusTimedOut  Status = "timed_out"
+	StatusCancelled Status = "cancelled"
 )
 
 // Request represents a pending human approval request.
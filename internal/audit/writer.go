@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 	"sync"
 	"time"
 
@@ -137,6 +138,17 @@ func (s *JSONLStore) Stats(_ context.Context) (*api.AuditStats, error) {
 		case api.VerdictLog:
 			stats.LogCount++
 		}
+		if r.Delay > 0 {
+			stats.ThrottledCount++
+			stats.TotalDelay += r.Delay
+		}
+		if r.Verdict == api.VerdictDeny && strings.HasPrefix(r.Rule, "rate_limit:") {
+			stats.RateLimitedCount++
+		}
+		// A correlated response repeats its request's method and tool
+		if r.Direction == api.DirectionOutbound && r.CorrelationID != "" {
+			continue
+		}
 		if r.Method != "" {
 			stats.ByMethod[r.Method]++
 		}
@@ -136,6 +136,38 @@ func TestJSONLStore_Stats(t *testing.T) {
 	}
 }
 
+func TestJSONLStore_StatsThrottling(t *testing.T) {
+	store, err := NewJSONLStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	ctx := context.Background()
+	records := []*api.AuditRecord{
+		{Timestamp: time.Now(), Method: "tools/call", Tool: "search", Verdict: api.VerdictAllow, Delay: 200 * time.Millisecond},
+		{Timestamp: time.Now(), Method: "tools/call", Tool: "search", Verdict: api.VerdictAllow, Delay: 400 * time.Millisecond},
+		{Timestamp: time.Now(), Method: "tools/call", Tool: "search", Verdict: api.VerdictDeny, Rule: "rate_limit:search"},
+		{Timestamp: time.Now(), Method: "tools/call", Tool: "rm", Verdict: api.VerdictDeny, Rule: "block-rm"},
+	}
+	for _, r := range records {
+		if err := store.Write(ctx, r); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	stats, err := store.Stats(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.ThrottledCount != 2 || stats.TotalDelay != 600*time.Millisecond {
+		t.Errorf("expected 2 throttled totalling 600ms, got %d / %s", stats.ThrottledCount, stats.TotalDelay)
+	}
+	if stats.RateLimitedCount != 1 {
+		t.Errorf("expected 1 rate limited, got %d", stats.RateLimitedCount)
+	}
+}
+
 func TestJSONLStore_FileCreation(t *testing.T) {
 	dir := t.TempDir()
 	store, err := NewJSONLStore(dir)
@@ -0,0 +1,195 @@
+// Package auth authenticates clients of the HTTP proxy by bearer token,
+// following the OAuth 2.0 protected resource model of the MCP
+// authorization spec: static tokens listed in a file, or JWT access tokens
+// validated offline against the authorization server's signing keys.
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/tkingovr/agent-guard/api"
+	"github.com/tkingovr/agent-guard/internal/policy"
+)
+
+// MetadataPath is where protected resource metadata (RFC 9728) is served
+// for a resource without a path.
+const MetadataPath = "/.well-known/oauth-protected-resource"
+
+var (
+	// ErrNoToken is returned when a request carries no bearer token.
+	ErrNoToken = errors.New("no bearer token")
+
+	// ErrInvalidToken is returned for a token that is unknown, malformed,
+	// expired, or issued for another resource.
+	ErrInvalidToken = errors.New("invalid token")
+)
+
+// Authenticator checks the bearer token of each request.
+type Authenticator struct {
+	tokens *tokenSet
+	jwt    *jwtVerifier
+
+	resource     *url.URL // nil: derived from each request
+	servers      []string
+	scopes       []string
+	metadataPath string
+}
+
+// New creates an authenticator from the auth settings, loading the tokens
+// file and the signing keys.
+func New(settings *policy.AuthSettings) (*Authenticator, error) {
+	a := &Authenticator{
+		servers:      settings.AuthorizationServers,
+		scopes:       settings.ScopesSupported,
+		metadataPath: MetadataPath,
+	}
+
+	if settings.Resource != "" {
+		u, err := url.Parse(settings.Resource)
+		if err != nil || u.Scheme == "" || u.Host == "" {
+			return nil, fmt.Errorf("invalid resource URL %q", settings.Resource)
+		}
+		a.resource = u
+		// RFC 9728: the well-known segment goes before the resource's path
+		a.metadataPath = MetadataPath + strings.TrimSuffix(u.Path, "/")
+	}
+
+	if settings.TokensFile != "" {
+		tokens, err := loadTokens(settings.TokensFile)
+		if err != nil {
+			return nil, err
+		}
+		a.tokens = tokens
+	}
+
+	if settings.JWT != nil {
+		v, err := newJWTVerifier(settings.JWT)
+		if err != nil {
+			return nil, err
+		}
+		a.jwt = v
+	}
+
+	if a.tokens == nil && a.jwt == nil {
+		return nil, fmt.Errorf("auth: tokens_file or jwt is required")
+	}
+	return a, nil
+}
+
+// Authenticate returns the principal of the request's bearer token. A
+// token that could be a JWT is tried as one after the static tokens.
+func (a *Authenticator) Authenticate(r *http.Request) (*api.Principal, error) {
+	token, ok := bearerToken(r)
+	if !ok {
+		return nil, ErrNoToken
+	}
+	if a.tokens != nil {
+		if p := a.tokens.lookup(token); p != nil {
+			return p, nil
+		}
+	}
+	if a.jwt != nil && strings.Count(token, ".") == 2 {
+		p, err := a.jwt.verify(r.Context(), token)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+		}
+		return p, nil
+	}
+	return nil, ErrInvalidToken
+}
+
+// IsMetadataRequest reports whether r asks for the protected resource
+// metadata, which is served without authentication.
+func (a *Authenticator) IsMetadataRequest(r *http.Request) bool {
+	return r.Method == http.MethodGet && r.URL.Path == a.metadataPath
+}
+
+// ServeMetadata writes the protected resource metadata, which tells
+// clients which authorization servers issue tokens for the proxy.
+func (a *Authenticator) ServeMetadata(w http.ResponseWriter, r *http.Request) {
+	meta := struct {
+		Resource               string   `json:"resource"`
+		AuthorizationServers   []string `json:"authorization_servers,omitempty"`
+		ScopesSupported        []string `json:"scopes_supported,omitempty"`
+		BearerMethodsSupported []string `json:"bearer_methods_supported"`
+	}{
+		Resource:               a.resourceURL(r),
+		AuthorizationServers:   a.servers,
+		ScopesSupported:        a.scopes,
+		BearerMethodsSupported: []string{"header"},
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(meta)
+}
+
+// Challenge answers a request that failed authentication with 401 and a
+// WWW-Authenticate header pointing at the resource metadata (RFC 6750,
+// RFC 9728). A request that had no token gets no error code.
+func (a *Authenticator) Challenge(w http.ResponseWriter, r *http.Request, err error) {
+	params := []string{`realm="agentguard"`}
+	if !errors.Is(err, ErrNoToken) {
+		params = append(params, `error="invalid_token"`, `error_description="the access token is invalid or expired"`)
+	}
+	if len(a.scopes) > 0 {
+		params = append(params, fmt.Sprintf("scope=%q", strings.Join(a.scopes, " ")))
+	}
+	params = append(params, fmt.Sprintf("resource_metadata=%q", a.metadataURL(r)))
+
+	w.Header().Set("WWW-Authenticate", "Bearer "+strings.Join(params, ", "))
+	http.Error(w, "unauthorized", http.StatusUnauthorized)
+}
+
+// resourceURL is the configured resource, or the origin the request was
+// sent to.
+func (a *Authenticator) resourceURL(r *http.Request) string {
+	if a.resource != nil {
+		return a.resource.String()
+	}
+	return requestOrigin(r)
+}
+
+func (a *Authenticator) metadataURL(r *http.Request) string {
+	origin := requestOrigin(r)
+	if a.resource != nil {
+		origin = a.resource.Scheme + "://" + a.resource.Host
+	}
+	return origin + a.metadataPath
+}
+
+func requestOrigin(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host
+}
+
+// bearerToken returns the token of an "Authorization: Bearer" header.
+// Tokens in the query string are not accepted.
+func bearerToken(r *http.Request) (string, bool) {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+	token = strings.TrimSpace(token)
+	return token, token != ""
+}
+
+type principalKey struct{}
+
+// NewContext returns a copy of ctx carrying the authenticated principal.
+func NewContext(ctx context.Context, p *api.Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// PrincipalFrom returns the principal carried by ctx, or nil.
+func PrincipalFrom(ctx context.Context) *api.Principal {
+	p, _ := ctx.Value(principalKey{}).(*api.Principal)
+	return p
+}
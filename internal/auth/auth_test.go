@@ -0,0 +1,236 @@
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/lestrrat-go/jwx/v3/jwa"
+	"github.com/lestrrat-go/jwx/v3/jwk"
+	"github.com/lestrrat-go/jwx/v3/jwt"
+	"github.com/tkingovr/agent-guard/internal/policy"
+)
+
+const (
+	testIssuer   = "https://auth.example.com"
+	testAudience = "https://mcp.example.com/mcp"
+)
+
+// newSigningKey returns a private key with the given kid, and a JWKS
+// holding its public half.
+func newSigningKey(t *testing.T, kid string) (jwk.Key, []byte) {
+	t.Helper()
+	raw, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := jwk.Import(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := key.Set(jwk.KeyIDKey, kid); err != nil {
+		t.Fatal(err)
+	}
+	pub, err := jwk.PublicKeyOf(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	set := jwk.NewSet()
+	if err := set.AddKey(pub); err != nil {
+		t.Fatal(err)
+	}
+	data, err := json.Marshal(set)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key, data
+}
+
+func signToken(t *testing.T, key jwk.Key, build func(b *jwt.Builder) *jwt.Builder) string {
+	t.Helper()
+	b := jwt.NewBuilder().
+		Issuer(testIssuer).
+		Audience([]string{testAudience}).
+		Subject("alice").
+		Expiration(time.Now().Add(time.Hour))
+	if build != nil {
+		b = build(b)
+	}
+	tok, err := b.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	signed, err := jwt.Sign(tok, jwt.WithKey(jwa.ES256(), key))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(signed)
+}
+
+func writeFile(t *testing.T, name string, data []byte) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func request(token string) *http.Request {
+	r := httptest.NewRequest(http.MethodPost, "http://mcp.example.com/mcp", nil)
+	if token != "" {
+		r.Header.Set("Authorization", "Bearer "+token)
+	}
+	return r
+}
+
+func TestAuthenticate_StaticTokens(t *testing.T) {
+	path := writeFile(t, "tokens", []byte("# CI and ops\nci-token-1 ci-bot tools:read\n\nops-token-2 alice tools:read tools:write\n"))
+	a, err := New(&policy.AuthSettings{TokensFile: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := a.Authenticate(request("ops-token-2"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Subject != "alice" || p.Method != "token" || !slices.Equal(p.Scopes, []string{"tools:read", "tools:write"}) {
+		t.Errorf("unexpected principal %+v", p)
+	}
+
+	if _, err := a.Authenticate(request("ops-token-3")); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("unknown token: expected ErrInvalidToken, got %v", err)
+	}
+	if _, err := a.Authenticate(request("")); !errors.Is(err, ErrNoToken) {
+		t.Errorf("no token: expected ErrNoToken, got %v", err)
+	}
+}
+
+func TestAuthenticate_JWT(t *testing.T) {
+	key, jwks := newSigningKey(t, "k1")
+	a, err := New(&policy.AuthSettings{JWT: &policy.JWTSettings{
+		JWKSFile: writeFile(t, "jwks.json", jwks),
+		Issuer:   testIssuer,
+		Audience: testAudience,
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token := signToken(t, key, func(b *jwt.Builder) *jwt.Builder {
+		return b.Claim("scope", "tools:read tools:write").Claim("groups", []string{"eng", "oncall"})
+	})
+	p, err := a.Authenticate(request(token))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Subject != "alice" || p.Method != "jwt" ||
+		!slices.Equal(p.Scopes, []string{"tools:read", "tools:write"}) ||
+		!slices.Equal(p.Groups, []string{"eng", "oncall"}) {
+		t.Errorf("unexpected principal %+v", p)
+	}
+
+	other, _ := newSigningKey(t, "k1")
+	rejected := map[string]string{
+		"expired": signToken(t, key, func(b *jwt.Builder) *jwt.Builder {
+			return b.Expiration(time.Now().Add(-time.Hour))
+		}),
+		"wrong audience": signToken(t, key, func(b *jwt.Builder) *jwt.Builder {
+			return b.Audience([]string{"https://other.example.com"})
+		}),
+		"wrong issuer": signToken(t, key, func(b *jwt.Builder) *jwt.Builder {
+			return b.Issuer("https://evil.example.com")
+		}),
+		"unknown key": signToken(t, other, nil),
+	}
+	for name, token := range rejected {
+		if _, err := a.Authenticate(request(token)); !errors.Is(err, ErrInvalidToken) {
+			t.Errorf("%s: expected ErrInvalidToken, got %v", name, err)
+		}
+	}
+}
+
+func TestAuthenticate_JWKSURLRotation(t *testing.T) {
+	oldKey, oldJWKS := newSigningKey(t, "old")
+	newKey, newJWKS := newSigningKey(t, "new")
+	var jwks atomic.Value
+	jwks.Store(oldJWKS)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(jwks.Load().([]byte))
+	}))
+	defer srv.Close()
+
+	a, err := New(&policy.AuthSettings{JWT: &policy.JWTSettings{
+		JWKSURL:  srv.URL,
+		Issuer:   testIssuer,
+		Audience: testAudience,
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.Authenticate(request(signToken(t, oldKey, nil))); err != nil {
+		t.Fatal(err)
+	}
+
+	// The server rotates its key; a token signed with the new key fetches
+	// the keys again once they are old enough
+	jwks.Store(newJWKS)
+	a.jwt.mu.Lock()
+	a.jwt.fetched = time.Now().Add(-2 * jwksMinRefresh)
+	a.jwt.mu.Unlock()
+	if _, err := a.Authenticate(request(signToken(t, newKey, nil))); err != nil {
+		t.Fatalf("token signed with rotated key: %v", err)
+	}
+}
+
+func TestChallenge(t *testing.T) {
+	a, err := New(&policy.AuthSettings{
+		TokensFile:           writeFile(t, "tokens", []byte("t1 alice\n")),
+		Resource:             "https://mcp.example.com/mcp",
+		AuthorizationServers: []string{testIssuer},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := httptest.NewRecorder()
+	a.Challenge(w, request("bad"), ErrInvalidToken)
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401, got %d", w.Code)
+	}
+	challenge := w.Header().Get("WWW-Authenticate")
+	for _, want := range []string{"Bearer ", `error="invalid_token"`, `resource_metadata="https://mcp.example.com/.well-known/oauth-protected-resource/mcp"`} {
+		if !strings.Contains(challenge, want) {
+			t.Errorf("WWW-Authenticate %q lacks %q", challenge, want)
+		}
+	}
+
+	meta := httptest.NewRequest(http.MethodGet, "http://mcp.example.com/.well-known/oauth-protected-resource/mcp", nil)
+	if !a.IsMetadataRequest(meta) {
+		t.Fatal("metadata path not recognized")
+	}
+	w = httptest.NewRecorder()
+	a.ServeMetadata(w, meta)
+	var doc struct {
+		Resource             string   `json:"resource"`
+		AuthorizationServers []string `json:"authorization_servers"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &doc); err != nil {
+		t.Fatal(err)
+	}
+	if doc.Resource != "https://mcp.example.com/mcp" || !slices.Equal(doc.AuthorizationServers, []string{testIssuer}) {
+		t.Errorf("unexpected metadata %+v", doc)
+	}
+}
@@ -0,0 +1,50 @@
+package auth
+
+import (
+	"crypto/tls"
+
+	"github.com/tkingovr/agent-guard/api"
+)
+
+// CertificatePrincipal returns the principal of the verified client
+// certificate the connection was made with, or nil if there is none. Its
+// subject is the certificate's common name, or its DN without one.
+func CertificatePrincipal(state *tls.ConnectionState) *api.Principal {
+	if state == nil || len(state.VerifiedChains) == 0 || len(state.PeerCertificates) == 0 {
+		return nil
+	}
+	cert := state.PeerCertificates[0]
+
+	var sans []string
+	sans = append(sans, cert.DNSNames...)
+	sans = append(sans, cert.EmailAddresses...)
+	for _, u := range cert.URIs {
+		sans = append(sans, u.String())
+	}
+	for _, ip := range cert.IPAddresses {
+		sans = append(sans, ip.String())
+	}
+
+	p := &api.Principal{
+		Subject:     cert.Subject.CommonName,
+		Method:      "mtls",
+		CertSubject: cert.Subject.String(),
+		CertSANs:    sans,
+	}
+	if p.Subject == "" {
+		p.Subject = p.CertSubject
+	}
+	return p
+}
+
+// BindCertificate returns the token principal p with the client
+// certificate of cert, if any, attached. p itself is not modified.
+func BindCertificate(p, cert *api.Principal) *api.Principal {
+	if cert == nil {
+		return p
+	}
+	bound := *p
+	bound.CertSubject = cert.CertSubject
+	bound.CertSANs = cert.CertSANs
+	return &bound
+}
@@ -0,0 +1,197 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lestrrat-go/jwx/v3/jwk"
+	"github.com/lestrrat-go/jwx/v3/jws"
+	"github.com/lestrrat-go/jwx/v3/jwt"
+	"github.com/tkingovr/agent-guard/api"
+	"github.com/tkingovr/agent-guard/internal/policy"
+)
+
+const (
+	defaultLeeway      = 30 * time.Second
+	defaultGroupsClaim = "groups"
+
+	// jwksMaxAge is how long keys fetched from a JWKS URL are used before
+	// being fetched again; jwksMinRefresh is how soon a token signed with
+	// an unknown key may trigger a fetch, for keys rotated in between.
+	jwksMaxAge     = time.Hour
+	jwksMinRefresh = time.Minute
+
+	maxJWKSSize = 1 << 20
+)
+
+// jwtVerifier validates JWT access tokens: signature against the JWKS,
+// issuer, audience, expiry and not-before.
+type jwtVerifier struct {
+	url         string
+	issuer      string
+	audience    string
+	groupsClaim string
+	leeway      time.Duration
+	client      *http.Client
+
+	mu      sync.Mutex
+	keys    jwk.Set
+	fetched time.Time
+}
+
+func newJWTVerifier(s *policy.JWTSettings) (*jwtVerifier, error) {
+	v := &jwtVerifier{
+		url:         s.JWKSURL,
+		issuer:      s.Issuer,
+		audience:    s.Audience,
+		groupsClaim: s.GroupsClaim,
+		leeway:      defaultLeeway,
+		client:      &http.Client{Timeout: 10 * time.Second},
+	}
+	if v.groupsClaim == "" {
+		v.groupsClaim = defaultGroupsClaim
+	}
+	if s.Leeway != "" {
+		d, err := time.ParseDuration(s.Leeway)
+		if err != nil {
+			return nil, fmt.Errorf("jwt: invalid leeway %q: %w", s.Leeway, err)
+		}
+		v.leeway = d
+	}
+
+	if s.JWKSFile != "" {
+		keys, err := jwk.ReadFile(s.JWKSFile)
+		if err != nil {
+			return nil, fmt.Errorf("jwt: reading JWKS file: %w", err)
+		}
+		v.keys = keys
+		return v, nil
+	}
+	if err := v.refresh(context.Background()); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// verify validates token and returns its principal. A token whose
+// signature doesn't verify against keys fetched a while ago is retried
+// with freshly fetched keys.
+func (v *jwtVerifier) verify(ctx context.Context, token string) (*api.Principal, error) {
+	keys := v.keySet(ctx, false)
+	tok, err := v.parse(token, keys)
+	if err != nil && v.url != "" {
+		if fresh := v.keySet(ctx, true); fresh != keys {
+			tok, err = v.parse(token, fresh)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	p := &api.Principal{Method: "jwt"}
+	p.Subject, _ = tok.Subject()
+	p.Scopes = scopes(tok)
+	p.Groups = stringsClaim(tok, v.groupsClaim)
+	return p, nil
+}
+
+func (v *jwtVerifier) parse(token string, keys jwk.Set) (jwt.Token, error) {
+	return jwt.Parse([]byte(token),
+		// Keys without "alg", and tokens without "kid", are common
+		jwt.WithKeySet(keys, jws.WithInferAlgorithmFromKey(true), jws.WithRequireKid(false)),
+		jwt.WithValidate(true),
+		jwt.WithIssuer(v.issuer),
+		jwt.WithAudience(v.audience),
+		jwt.WithRequiredClaim(jwt.SubjectKey),
+		jwt.WithRequiredClaim(jwt.ExpirationKey),
+		jwt.WithAcceptableSkew(v.leeway),
+	)
+}
+
+// keySet returns the signing keys, fetching them from the JWKS URL when
+// they are older than jwksMaxAge, or, if stale is set, than
+// jwksMinRefresh. A failed fetch keeps the keys already held.
+func (v *jwtVerifier) keySet(ctx context.Context, stale bool) jwk.Set {
+	v.mu.Lock()
+	keys, age := v.keys, time.Since(v.fetched)
+	v.mu.Unlock()
+	if v.url == "" || age < jwksMinRefresh || (!stale && age < jwksMaxAge) {
+		return keys
+	}
+	if err := v.refresh(ctx); err != nil {
+		return keys
+	}
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return v.keys
+}
+
+// refresh fetches the keys from the JWKS URL.
+func (v *jwtVerifier) refresh(ctx context.Context) error {
+	v.mu.Lock()
+	// Whether it succeeds or not, don't fetch again too soon
+	v.fetched = time.Now()
+	v.mu.Unlock()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, v.url, nil)
+	if err != nil {
+		return fmt.Errorf("jwt: fetching JWKS: %w", err)
+	}
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("jwt: fetching JWKS: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("jwt: fetching JWKS: HTTP %d", resp.StatusCode)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxJWKSSize))
+	if err != nil {
+		return fmt.Errorf("jwt: fetching JWKS: %w", err)
+	}
+	keys, err := jwk.Parse(data)
+	if err != nil {
+		return fmt.Errorf("jwt: parsing JWKS: %w", err)
+	}
+
+	v.mu.Lock()
+	v.keys = keys
+	v.mu.Unlock()
+	return nil
+}
+
+// scopes returns the token's scopes, from the space-separated "scope"
+// claim (RFC 9068) or the "scp" array some issuers use instead.
+func scopes(tok jwt.Token) []string {
+	var scope string
+	if err := tok.Get("scope", &scope); err == nil {
+		return strings.Fields(scope)
+	}
+	return stringsClaim(tok, "scp")
+}
+
+// stringsClaim returns a claim holding a string or an array of strings.
+func stringsClaim(tok jwt.Token, name string) []string {
+	var value any
+	if err := tok.Get(name, &value); err != nil {
+		return nil
+	}
+	switch value := value.(type) {
+	case string:
+		return []string{value}
+	case []any:
+		out := make([]string, 0, len(value))
+		for _, v := range value {
+			if s, ok := v.(string); ok {
+				out = append(out, s)
+			}
+		}
+		return out
+	}
+	return nil
+}
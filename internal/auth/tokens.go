@@ -0,0 +1,62 @@
+package auth
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/tkingovr/agent-guard/api"
+)
+
+// tokenSet holds static bearer tokens. Only their SHA-256 hashes are kept,
+// so a lookup's timing depends on the hash of the presented token rather
+// than on how much of a real token it shares.
+type tokenSet struct {
+	principals map[[sha256.Size]byte]*api.Principal
+}
+
+// loadTokens reads a tokens file: one token per line, followed by its
+// subject and any scopes. Blank lines and lines starting with # are
+// skipped.
+func loadTokens(path string) (*tokenSet, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("opening tokens file: %w", err)
+	}
+	defer f.Close()
+
+	set := &tokenSet{principals: make(map[[sha256.Size]byte]*api.Principal)}
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			return nil, fmt.Errorf("tokens file %s:%d: expected a token and a subject", path, n)
+		}
+		hash := sha256.Sum256([]byte(fields[0]))
+		if _, ok := set.principals[hash]; ok {
+			return nil, fmt.Errorf("tokens file %s:%d: duplicate token", path, n)
+		}
+		set.principals[hash] = &api.Principal{
+			Subject: fields[1],
+			Scopes:  fields[2:],
+			Method:  "token",
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading tokens file: %w", err)
+	}
+	if len(set.principals) == 0 {
+		return nil, fmt.Errorf("tokens file %s has no tokens", path)
+	}
+	return set, nil
+}
+
+func (s *tokenSet) lookup(token string) *api.Principal {
+	return s.principals[sha256.Sum256([]byte(token))]
+}
@@ -24,7 +24,35 @@ type Config struct {
 	OPAPolicy        string
 	SecretScanner    bool
 	EntropyThreshold float64
+	SecretSettings   *policy.SecretSettings
 	RateLimit        *policy.RateLimitSettings
+	InjectionScanner *policy.InjectionSettings
+	ResultScanner    *policy.ResultScannerSettings
+	Redaction        *policy.RedactionSettings
+	Canary           *policy.CanarySettings
+	Honeytokens      *policy.HoneytokenSettings
+	Concurrency      *policy.ConcurrencySettings
+	LoopDetection    *policy.LoopDetectionSettings
+	Budget           *policy.BudgetSettings
+	OnFilterError    string
+
+	// SessionIdleTimeout is how long the HTTP proxy keeps a session
+	// nobody uses.
+	SessionIdleTimeout time.Duration
+
+	// Auth, if set, authenticates the HTTP proxy's clients.
+	Auth *policy.AuthSettings
+
+	// TLS and UpstreamTLS, if set, configure the HTTP proxy's listener and
+	// its connections to the target.
+	TLS         *policy.TLSSettings
+	UpstreamTLS *policy.UpstreamTLSSettings
+
+	// Routes, if set, send the HTTP proxy's requests to several servers.
+	Routes []policy.RouteSettings
+
+	// Servers are the MCP servers the gateway merges into one.
+	Servers []policy.ServerSettings
 }
 
 // Load reads a policy YAML file and produces a runtime Config.
@@ -76,6 +104,17 @@ func fromPolicy(pf *policy.PolicyFile, path string) (*Config, error) {
 		cfg.ApprovalTimeout = DefaultApprovalTimeout
 	}
 
+	// Session idle timeout
+	if pf.Settings.SessionIdleTimeout != "" {
+		d, err := time.ParseDuration(pf.Settings.SessionIdleTimeout)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("invalid session_idle_timeout %q", pf.Settings.SessionIdleTimeout)
+		}
+		cfg.SessionIdleTimeout = d
+	} else {
+		cfg.SessionIdleTimeout = DefaultSessionIdleTimeout
+	}
+
 	// OPA policy
 	if pf.Settings.OPAPolicy != "" {
 		cfg.OPAPolicy = expandHome(pf.Settings.OPAPolicy)
@@ -84,6 +123,7 @@ func fromPolicy(pf *policy.PolicyFile, path string) (*Config, error) {
 	// Secret scanner
 	if pf.Settings.SecretScanner != nil && pf.Settings.SecretScanner.Enabled {
 		cfg.SecretScanner = true
+		cfg.SecretSettings = pf.Settings.SecretScanner
 		if pf.Settings.SecretScanner.EntropyThreshold > 0 {
 			cfg.EntropyThreshold = pf.Settings.SecretScanner.EntropyThreshold
 		}
@@ -92,9 +132,108 @@ func fromPolicy(pf *policy.PolicyFile, path string) (*Config, error) {
 	// Rate limiting
 	cfg.RateLimit = pf.Settings.RateLimit
 
+	// Prompt-injection scanner
+	if pf.Settings.InjectionScanner != nil && pf.Settings.InjectionScanner.Enabled {
+		cfg.InjectionScanner = pf.Settings.InjectionScanner
+	}
+
+	// Tool-result scanner
+	if pf.Settings.ResultScanner != nil && pf.Settings.ResultScanner.Enabled {
+		cfg.ResultScanner = pf.Settings.ResultScanner
+	}
+
+	cfg.Redaction = pf.Settings.Redaction
+
+	// Host-environment canary
+	if cs := pf.Settings.Canary; cs != nil && cs.Enabled {
+		canary := *cs
+		canary.Files = make([]string, len(cs.Files))
+		for i, f := range cs.Files {
+			canary.Files[i] = expandHome(f)
+		}
+		cfg.Canary = &canary
+	}
+
+	// Honeytokens
+	if hs := pf.Settings.Honeytokens; hs != nil && hs.Enabled {
+		cfg.Honeytokens = hs
+	}
+
+	cfg.Concurrency = pf.Settings.Concurrency
+
+	cfg.Budget = pf.Settings.Budget
+	cfg.OnFilterError = pf.Settings.OnFilterError
+
+	// Client authentication
+	if as := pf.Settings.Auth; as != nil {
+		auth := *as
+		auth.TokensFile = expandHome(as.TokensFile)
+		if as.JWT != nil {
+			jwt := *as.JWT
+			jwt.JWKSFile = expandHome(jwt.JWKSFile)
+			auth.JWT = &jwt
+		}
+		cfg.Auth = &auth
+	}
+
+	// TLS
+	if ts := pf.Settings.TLS; ts != nil {
+		tlsSettings := *ts
+		tlsSettings.CertFile = expandHome(ts.CertFile)
+		tlsSettings.KeyFile = expandHome(ts.KeyFile)
+		tlsSettings.ClientCAFile = expandHome(ts.ClientCAFile)
+		cfg.TLS = &tlsSettings
+	}
+	cfg.UpstreamTLS = expandUpstreamTLS(pf.Settings.UpstreamTLS)
+
+	// Routes
+	for _, rs := range pf.Settings.Routes {
+		rs.Policy = expandHome(rs.Policy)
+		rs.UpstreamTLS = expandUpstreamTLS(rs.UpstreamTLS)
+		cfg.Routes = append(cfg.Routes, rs)
+	}
+
+	// Gateway servers
+	for _, ss := range pf.Settings.Servers {
+		ss.Command = expandHome(ss.Command)
+		ss.Env = expandEnv(ss.Env)
+		ss.Headers = expandEnv(ss.Headers)
+		ss.UpstreamTLS = expandUpstreamTLS(ss.UpstreamTLS)
+		cfg.Servers = append(cfg.Servers, ss)
+	}
+
+	// Loop and repetition detection
+	if ld := pf.Settings.LoopDetection; ld != nil && ld.Enabled {
+		cfg.LoopDetection = ld
+	}
+
 	return cfg, nil
 }
 
+func expandUpstreamTLS(us *policy.UpstreamTLSSettings) *policy.UpstreamTLSSettings {
+	if us == nil {
+		return nil
+	}
+	upstream := *us
+	upstream.CAFile = expandHome(us.CAFile)
+	upstream.CertFile = expandHome(us.CertFile)
+	upstream.KeyFile = expandHome(us.KeyFile)
+	return &upstream
+}
+
+// expandEnv returns a copy of m with ${VAR} and $VAR in its values
+// replaced from the environment.
+func expandEnv(m map[string]string) map[string]string {
+	if m == nil {
+		return nil
+	}
+	out := make(map[string]string, len(m))
+	for k, v := range m {
+		out[k] = os.ExpandEnv(v)
+	}
+	return out
+}
+
 func expandHome(path string) string {
 	if len(path) > 1 && path[0] == '~' && path[1] == '/' {
 		home, err := os.UserHomeDir()
@@ -119,6 +258,8 @@ func DefaultConfig() *Config {
 		DashboardAddr:   DefaultDashboardAddr,
 		ApprovalTimeout: DefaultApprovalTimeout,
 		DefaultAction:   api.VerdictDeny,
+
+		SessionIdleTimeout: DefaultSessionIdleTimeout,
 	}
 }
 
@@ -79,3 +79,54 @@ rules:
 		t.Fatal("expected error for invalid timeout")
 	}
 }
+
+func TestLoadBytes_SessionIdleTimeout(t *testing.T) {
+	cfg, err := LoadBytes([]byte("version: 1\nsettings:\n  session_idle_timeout: 2m\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.SessionIdleTimeout != 2*time.Minute {
+		t.Errorf("expected 2m idle timeout, got %s", cfg.SessionIdleTimeout)
+	}
+
+	cfg, err = LoadBytes([]byte("version: 1\nsettings: {}\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.SessionIdleTimeout != DefaultSessionIdleTimeout {
+		t.Errorf("expected default idle timeout %s, got %s", DefaultSessionIdleTimeout, cfg.SessionIdleTimeout)
+	}
+
+	if _, err := LoadBytes([]byte("version: 1\nsettings:\n  session_idle_timeout: \"-1m\"\n")); err == nil {
+		t.Error("expected error for negative session_idle_timeout")
+	}
+}
+
+func TestLoadBytes_ServersExpandEnv(t *testing.T) {
+	t.Setenv("GITHUB_TOKEN", "ghp_test")
+	cfg, err := LoadBytes([]byte(`version: 1
+settings:
+  servers:
+    - name: github
+      url: https://github-mcp.example.com/mcp
+      headers:
+        Authorization: "Bearer ${GITHUB_TOKEN}"
+    - name: files
+      command: npx
+      args: ["@modelcontextprotocol/server-filesystem", "/tmp"]
+      env:
+        TOKEN: $GITHUB_TOKEN
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cfg.Servers) != 2 {
+		t.Fatalf("expected 2 servers, got %d", len(cfg.Servers))
+	}
+	if got := cfg.Servers[0].Headers["Authorization"]; got != "Bearer ghp_test" {
+		t.Errorf("header not expanded: %q", got)
+	}
+	if got := cfg.Servers[1].Env["TOKEN"]; got != "ghp_test" {
+		t.Errorf("env not expanded: %q", got)
+	}
+}
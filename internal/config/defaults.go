@@ -3,8 +3,9 @@ package config
 import "time"
 
 const (
-	DefaultDashboardAddr   = "127.0.0.1:8080"
-	DefaultApprovalTimeout = 5 * time.Minute
+	DefaultDashboardAddr      = "127.0.0.1:8080"
+	DefaultApprovalTimeout    = 5 * time.Minute
+	DefaultSessionIdleTimeout = 30 * time.Minute
 )
 
 // DefaultLogDir returns the default log directory path.
@@ -30,6 +30,20 @@ func (s *Server) handleOverview(w http.ResponseWriter, r *http.Request) {
 		"Page":  "overview",
 		"Stats": stats,
 	}
+	if s.inFlight != nil {
+		byTool := s.inFlight()
+		total := 0
+		for _, n := range byTool {
+			total += n
+		}
+		data["InFlight"] = map[string]any{"Total": total, "ByTool": byTool}
+	}
+	if s.budgets != nil {
+		data["Budgets"] = s.budgets()
+	}
+	if s.sessions != nil {
+		data["Sessions"] = s.sessions()
+	}
 	renderPage(w, "overview", data)
 }
 
@@ -40,18 +54,48 @@ func (s *Server) handleAudit(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	rows := joinResponses(records)
+
 	// Reverse to show newest first
-	for i, j := 0, len(records)-1; i < j; i, j = i+1, j-1 {
-		records[i], records[j] = records[j], records[i]
+	for i, j := 0, len(rows)-1; i < j; i, j = i+1, j-1 {
+		rows[i], rows[j] = rows[j], rows[i]
 	}
 
 	data := map[string]any{
 		"Page":    "audit",
-		"Records": records,
+		"Records": rows,
 	}
 	renderPage(w, "audit", data)
 }
 
+// auditRow is one row of the audit page: a message and, for a request,
+// the response correlated with it.
+type auditRow struct {
+	*api.AuditRecord
+	Response *api.AuditRecord
+}
+
+// joinResponses folds each correlated response into its request's row.
+// Records are oldest first.
+func joinResponses(records []*api.AuditRecord) []*auditRow {
+	rows := make([]*auditRow, 0, len(records))
+	byCorrelation := make(map[string]*auditRow)
+	for _, r := range records {
+		if r.CorrelationID != "" && r.Direction == api.DirectionOutbound {
+			if row, ok := byCorrelation[r.CorrelationID]; ok {
+				row.Response = r
+				continue
+			}
+		}
+		row := &auditRow{AuditRecord: r}
+		if r.CorrelationID != "" && r.Direction == api.DirectionInbound {
+			byCorrelation[r.CorrelationID] = row
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
 func (s *Server) handleAuditStream(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "text/event-stream")
 	w.Header().Set("Cache-Control", "no-cache")
@@ -134,6 +178,33 @@ func (s *Server) handleAPIStats(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(stats)
 }
 
+func (s *Server) handleAPIInFlight(w http.ResponseWriter, r *http.Request) {
+	if s.inFlight == nil {
+		http.Error(w, "in-flight tracking not available", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.inFlight())
+}
+
+func (s *Server) handleAPIBudgets(w http.ResponseWriter, r *http.Request) {
+	if s.budgets == nil {
+		http.Error(w, "session budgets not configured", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.budgets())
+}
+
+func (s *Server) handleAPISessions(w http.ResponseWriter, r *http.Request) {
+	if s.sessions == nil {
+		http.Error(w, "session tracking not available", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.sessions())
+}
+
 func (s *Server) handleAPICheck(w http.ResponseWriter, r *http.Request) {
 	var req api.CheckRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -164,14 +235,29 @@ func (s *Server) handleAPICheck(w http.ResponseWriter, r *http.Request) {
 }
 
 func renderAuditRow(record *api.AuditRecord) string {
+	// A correlated response fills in its request's row
+	if record.CorrelationID != "" && record.Direction == api.DirectionOutbound {
+		return fmt.Sprintf(`<td id="resp-%s" hx-swap-oob="true" class="px-4 py-2 text-gray-400 text-xs">%s</td>`,
+			escapeHTML(record.CorrelationID), escapeHTML(responseSummary(record)))
+	}
+
+	respCellID := ""
+	if record.CorrelationID != "" {
+		respCellID = ` id="resp-` + escapeHTML(record.CorrelationID) + `"`
+	}
+
 	verdictClass := verdictColor(record.Verdict)
 	args := ""
 	if record.Arguments != nil {
 		args = truncate(string(record.Arguments), 80)
 	}
+	tags := ""
+	for _, tag := range record.Tags {
+		tags += ` <span class="px-2 py-1 rounded text-xs font-bold bg-purple-900 text-purple-300">` + escapeHTML(tag) + `</span>`
+	}
 
 	return fmt.Sprintf(
-		`<tr class="border-b border-gray-700 hover:bg-gray-800"><td class="px-4 py-2 text-gray-400 text-xs">%s</td><td class="px-4 py-2">%s</td><td class="px-4 py-2">%s</td><td class="px-4 py-2 font-mono text-sm">%s</td><td class="px-4 py-2"><span class="px-2 py-1 rounded text-xs font-bold %s">%s</span></td><td class="px-4 py-2 text-gray-400 text-xs">%s</td></tr>`,
+		`<tr class="border-b border-gray-700 hover:bg-gray-800"><td class="px-4 py-2 text-gray-400 text-xs">%s</td><td class="px-4 py-2">%s</td><td class="px-4 py-2">%s</td><td class="px-4 py-2 font-mono text-sm">%s</td><td class="px-4 py-2"><span class="px-2 py-1 rounded text-xs font-bold %s">%s</span></td><td class="px-4 py-2 text-gray-400 text-xs">%s%s</td><td%s class="px-4 py-2 text-gray-400 text-xs"></td></tr>`,
 		record.Timestamp.Format(time.RFC3339),
 		escapeHTML(record.Method),
 		escapeHTML(record.Tool),
@@ -179,6 +265,8 @@ func renderAuditRow(record *api.AuditRecord) string {
 		verdictClass,
 		strings.ToUpper(string(record.Verdict)),
 		escapeHTML(record.Rule),
+		tags,
+		respCellID,
 	)
 }
 
@@ -17,7 +17,7 @@ import (
 	"github.com/tkingovr/agent-guard/internal/policy"
 )
 
-func testServer(t *testing.T) *Server {
+func testServer(t *testing.T, opts ...Option) *Server {
 	t.Helper()
 	dir := t.TempDir()
 	store, err := audit.NewJSONLStore(dir)
@@ -43,7 +43,7 @@ func testServer(t *testing.T) *Server {
 	aq := approval.NewQueue(5 * time.Minute)
 	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
 
-	return NewServer(":0", store, aq, engine, logger)
+	return NewServer(":0", store, aq, engine, logger, opts...)
 }
 
 func TestOverviewPage(t *testing.T) {
@@ -60,6 +60,81 @@ func TestOverviewPage(t *testing.T) {
 	}
 }
 
+func TestOverviewPage_InFlight(t *testing.T) {
+	s := testServer(t, WithInFlight(func() map[string]int {
+		return map[string]int{"run_build": 2}
+	}))
+	req := httptest.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+	s.mux.ServeHTTP(w, req)
+
+	body := w.Body.String()
+	if !strings.Contains(body, "In Flight") || !strings.Contains(body, "run_build") {
+		t.Error("expected overview to list in-flight tool calls")
+	}
+
+	req = httptest.NewRequest("GET", "/api/v1/inflight", nil)
+	w = httptest.NewRecorder()
+	s.mux.ServeHTTP(w, req)
+	var counts map[string]int
+	if err := json.NewDecoder(w.Body).Decode(&counts); err != nil {
+		t.Fatal(err)
+	}
+	if counts["run_build"] != 2 {
+		t.Errorf("expected 2 in-flight run_build calls, got %v", counts)
+	}
+}
+
+func TestOverviewPage_Budgets(t *testing.T) {
+	s := testServer(t, WithBudgets(func() map[string]policy.BudgetUsage {
+		return map[string]policy.BudgetUsage{"sess-1": {Calls: 8, Usage: 0.8}}
+	}))
+	req := httptest.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+	s.mux.ServeHTTP(w, req)
+
+	body := w.Body.String()
+	if !strings.Contains(body, "Session Budgets") || !strings.Contains(body, "sess-1") || !strings.Contains(body, "80%") {
+		t.Error("expected overview to show session budget usage")
+	}
+
+	req = httptest.NewRequest("GET", "/api/v1/budgets", nil)
+	w = httptest.NewRecorder()
+	s.mux.ServeHTTP(w, req)
+	var usage map[string]policy.BudgetUsage
+	if err := json.NewDecoder(w.Body).Decode(&usage); err != nil {
+		t.Fatal(err)
+	}
+	if usage["sess-1"].Calls != 8 {
+		t.Errorf("expected 8 calls for sess-1, got %v", usage)
+	}
+}
+
+func TestOverviewPage_Sessions(t *testing.T) {
+	s := testServer(t, WithSessions(func() []api.SessionInfo {
+		return []api.SessionInfo{{ID: "sess-9", ClientName: "claude-desktop", Requests: 12, Denied: 2, LastSeen: time.Now()}}
+	}))
+	req := httptest.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+	s.mux.ServeHTTP(w, req)
+
+	body := w.Body.String()
+	if !strings.Contains(body, "Active Sessions") || !strings.Contains(body, "sess-9") || !strings.Contains(body, "claude-desktop") {
+		t.Error("expected overview to list active sessions")
+	}
+
+	req = httptest.NewRequest("GET", "/api/v1/sessions", nil)
+	w = httptest.NewRecorder()
+	s.mux.ServeHTTP(w, req)
+	var sessions []api.SessionInfo
+	if err := json.NewDecoder(w.Body).Decode(&sessions); err != nil {
+		t.Fatal(err)
+	}
+	if len(sessions) != 1 || sessions[0].Requests != 12 {
+		t.Errorf("expected sess-9 with 12 requests, got %+v", sessions)
+	}
+}
+
 func TestAuditPage(t *testing.T) {
 	s := testServer(t)
 
@@ -84,6 +159,48 @@ func TestAuditPage(t *testing.T) {
 	}
 }
 
+func TestAuditPage_JoinsResponses(t *testing.T) {
+	s := testServer(t)
+	ctx := context.Background()
+	s.auditStore.Write(ctx, &api.AuditRecord{
+		Timestamp:     time.Now(),
+		Direction:     api.DirectionInbound,
+		Method:        "tools/call",
+		Tool:          "read_file",
+		Verdict:       api.VerdictAllow,
+		CorrelationID: "sess-1",
+	})
+	s.auditStore.Write(ctx, &api.AuditRecord{
+		Timestamp:     time.Now(),
+		Direction:     api.DirectionOutbound,
+		Method:        "tools/call",
+		Tool:          "read_file",
+		Verdict:       api.VerdictAllow,
+		CorrelationID: "sess-1",
+		Latency:       25 * time.Millisecond,
+		ErrorCode:     -32602,
+		ErrorMessage:  "no such file",
+	})
+
+	req := httptest.NewRequest("GET", "/audit", nil)
+	w := httptest.NewRecorder()
+	s.mux.ServeHTTP(w, req)
+
+	body := w.Body.String()
+	if n := strings.Count(body, "read_file"); n != 1 {
+		t.Errorf("expected request and response in one row, found read_file %d times", n)
+	}
+	if !strings.Contains(body, "error -32602: no such file · 25ms") {
+		t.Error("expected the row to show the response error and latency")
+	}
+
+	// Streamed responses fill in the request's row out of band
+	row := renderAuditRow(&api.AuditRecord{Direction: api.DirectionOutbound, CorrelationID: "sess-1", ResultSize: 10})
+	if !strings.Contains(row, `id="resp-sess-1" hx-swap-oob="true"`) || !strings.Contains(row, "10 B") {
+		t.Errorf("unexpected streamed response row: %s", row)
+	}
+}
+
 func TestApprovalPage(t *testing.T) {
 	s := testServer(t)
 	req := httptest.NewRequest("GET", "/approval", nil)
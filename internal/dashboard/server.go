@@ -5,6 +5,7 @@ import (
 	"log/slog"
 	"net/http"
 
+	"github.com/tkingovr/agent-guard/api"
 	"github.com/tkingovr/agent-guard/internal/approval"
 	"github.com/tkingovr/agent-guard/internal/audit"
 	"github.com/tkingovr/agent-guard/internal/policy"
@@ -18,10 +19,34 @@ type Server struct {
 	approvalQ  *approval.Queue
 	engine     *policy.YAMLEngine
 	addr       string
+	inFlight   func() map[string]int
+	budgets    func() map[string]policy.BudgetUsage
+	sessions   func() []api.SessionInfo
+}
+
+// Option configures optional dashboard features.
+type Option func(*Server)
+
+// WithInFlight shows in-flight tool calls, as reported by fn per tool. Only
+// available when the dashboard runs in the proxy's process.
+func WithInFlight(fn func() map[string]int) Option {
+	return func(s *Server) { s.inFlight = fn }
+}
+
+// WithBudgets shows per-session budget consumption, as reported by fn. Only
+// available when the dashboard runs in the proxy's process.
+func WithBudgets(fn func() map[string]policy.BudgetUsage) Option {
+	return func(s *Server) { s.budgets = fn }
+}
+
+// WithSessions lists active client sessions, as reported by fn. Only
+// available when the dashboard runs in the HTTP proxy's process.
+func WithSessions(fn func() []api.SessionInfo) Option {
+	return func(s *Server) { s.sessions = fn }
 }
 
 // NewServer creates a new dashboard server.
-func NewServer(addr string, store audit.Store, aq *approval.Queue, engine *policy.YAMLEngine, logger *slog.Logger) *Server {
+func NewServer(addr string, store audit.Store, aq *approval.Queue, engine *policy.YAMLEngine, logger *slog.Logger, opts ...Option) *Server {
 	s := &Server{
 		mux:        http.NewServeMux(),
 		logger:     logger,
@@ -30,6 +55,9 @@ func NewServer(addr string, store audit.Store, aq *approval.Queue, engine *polic
 		engine:     engine,
 		addr:       addr,
 	}
+	for _, opt := range opts {
+		opt(s)
+	}
 	s.registerRoutes()
 	return s
 }
@@ -43,6 +71,9 @@ func (s *Server) registerRoutes() {
 	s.mux.HandleFunc("POST /approval/{id}/deny", s.handleApprovalDenyAction)
 	s.mux.HandleFunc("GET /policy", s.handlePolicy)
 	s.mux.HandleFunc("GET /api/v1/stats", s.handleAPIStats)
+	s.mux.HandleFunc("GET /api/v1/inflight", s.handleAPIInFlight)
+	s.mux.HandleFunc("GET /api/v1/budgets", s.handleAPIBudgets)
+	s.mux.HandleFunc("GET /api/v1/sessions", s.handleAPISessions)
 	s.mux.HandleFunc("POST /api/v1/check", s.handleAPICheck)
 }
 
@@ -2,13 +2,67 @@ package dashboard
 
 import (
 	"bytes"
+	"fmt"
 	"html/template"
 	"net/http"
 	"strings"
+	"time"
+
+	"github.com/tkingovr/agent-guard/api"
 )
 
 var funcMap = template.FuncMap{
-	"upper": strings.ToUpper,
+	"upper":    strings.ToUpper,
+	"avgDelay": avgDelay,
+	"percent":  percent,
+	"seconds":  seconds,
+	"ago":      ago,
+
+	"responseSummary": responseSummary,
+}
+
+// responseSummary describes a response record: the server's error or the
+// result size, and the latency.
+func responseSummary(r *api.AuditRecord) string {
+	if r == nil {
+		return ""
+	}
+	var parts []string
+	switch {
+	case r.Verdict == api.VerdictDeny:
+		parts = append(parts, "blocked: "+r.Rule)
+	case r.ErrorCode != 0:
+		parts = append(parts, fmt.Sprintf("error %d: %s", r.ErrorCode, r.ErrorMessage))
+	default:
+		parts = append(parts, fmt.Sprintf("%d B", r.ResultSize))
+	}
+	if r.Latency > 0 {
+		parts = append(parts, r.Latency.Round(time.Millisecond).String())
+	}
+	return strings.Join(parts, " · ")
+}
+
+// percent formats a usage fraction as a whole percentage.
+func percent(f float64) string {
+	return fmt.Sprintf("%.0f%%", f*100)
+}
+
+// seconds formats elapsed seconds as a rounded duration.
+func seconds(s float64) string {
+	return (time.Duration(s * float64(time.Second))).Round(time.Second).String()
+}
+
+// ago formats the time elapsed since t.
+func ago(t time.Time) string {
+	return time.Since(t).Round(time.Second).String()
+}
+
+// avgDelay formats the mean of total over n requests.
+func avgDelay(total time.Duration, n int) string {
+	if n == 0 {
+		return "0s"
+	}
+	return (total / time.Duration(n)).Round(time.Millisecond).String()
 }
 
 var pageTmpls = map[string]*template.Template{
@@ -89,6 +143,94 @@ const overviewHTML = headHTML + `
         <div class="text-3xl font-bold text-yellow-300">{{.Stats.AskCount}}</div>
     </div>
 </div>
+{{with .InFlight}}
+<div class="bg-gray-900 border border-blue-900 rounded-lg p-6 mb-8">
+    <div class="flex justify-between items-baseline mb-2">
+        <h2 class="text-lg font-bold text-blue-300">In Flight</h2>
+        <span class="text-3xl font-bold text-blue-300">{{.Total}}</span>
+    </div>
+    {{range $tool, $count := .ByTool}}
+    <div class="flex justify-between py-1 border-b border-gray-800">
+        <span class="text-gray-300 font-mono text-sm">{{$tool}}</span>
+        <span class="text-gray-400">{{$count}}</span>
+    </div>
+    {{else}}<p class="text-gray-500">No tool calls in flight</p>{{end}}
+</div>
+{{end}}
+{{with .Budgets}}
+<div class="bg-gray-900 border border-purple-900 rounded-lg p-6 mb-8">
+    <h2 class="text-lg font-bold text-purple-300 mb-4">Session Budgets</h2>
+    <table class="w-full text-sm text-left">
+        <thead class="text-gray-400">
+            <tr>
+                <th class="py-1">Session</th>
+                <th class="py-1">Calls</th>
+                <th class="py-1">Argument Bytes</th>
+                <th class="py-1">Response Bytes</th>
+                <th class="py-1">Elapsed</th>
+                <th class="py-1">Used</th>
+            </tr>
+        </thead>
+        <tbody>
+        {{range $session, $u := .}}
+            <tr class="border-b border-gray-800">
+                <td class="py-1 font-mono text-gray-300">{{if $session}}{{$session}}{{else}}default{{end}}</td>
+                <td class="py-1 text-gray-400">{{$u.Calls}}</td>
+                <td class="py-1 text-gray-400">{{$u.ArgumentBytes}}</td>
+                <td class="py-1 text-gray-400">{{$u.ResponseBytes}}</td>
+                <td class="py-1 text-gray-400">{{seconds $u.ElapsedSeconds}}</td>
+                <td class="py-1 {{if ge $u.Usage 1.0}}text-red-300{{else if ge $u.Usage 0.8}}text-yellow-300{{else}}text-gray-300{{end}}">{{percent $u.Usage}}</td>
+            </tr>
+        {{end}}
+        </tbody>
+    </table>
+</div>
+{{end}}
+{{if .Sessions}}
+<div class="bg-gray-900 border border-teal-900 rounded-lg p-6 mb-8">
+    <h2 class="text-lg font-bold text-teal-300 mb-4">Active Sessions</h2>
+    <table class="w-full text-sm text-left">
+        <thead class="text-gray-400">
+            <tr>
+                <th class="py-1">Session</th>
+                <th class="py-1">Client</th>
+                <th class="py-1">Requests</th>
+                <th class="py-1">Denied</th>
+                <th class="py-1">Streams</th>
+                <th class="py-1">Last Seen</th>
+            </tr>
+        </thead>
+        <tbody>
+        {{range .Sessions}}
+            <tr class="border-b border-gray-800">
+                <td class="py-1 font-mono text-gray-300">{{.ID}}</td>
+                <td class="py-1 text-gray-400">{{.ClientName}}</td>
+                <td class="py-1 text-gray-400">{{.Requests}}</td>
+                <td class="py-1 {{if .Denied}}text-red-300{{else}}text-gray-400{{end}}">{{.Denied}}</td>
+                <td class="py-1 text-gray-400">{{.Streams}}</td>
+                <td class="py-1 text-gray-400">{{ago .LastSeen}} ago</td>
+            </tr>
+        {{end}}
+        </tbody>
+    </table>
+</div>
+{{end}}
+{{if or .Stats.ThrottledCount .Stats.RateLimitedCount}}
+<div class="grid grid-cols-1 md:grid-cols-3 gap-6 mb-8">
+    <div class="bg-gray-900 border border-orange-900 rounded-lg p-6">
+        <div class="text-orange-400 text-sm mb-1">Throttled</div>
+        <div class="text-3xl font-bold text-orange-300">{{.Stats.ThrottledCount}}</div>
+    </div>
+    <div class="bg-gray-900 border border-orange-900 rounded-lg p-6">
+        <div class="text-orange-400 text-sm mb-1">Average Delay</div>
+        <div class="text-3xl font-bold text-orange-300">{{avgDelay .Stats.TotalDelay .Stats.ThrottledCount}}</div>
+    </div>
+    <div class="bg-gray-900 border border-red-900 rounded-lg p-6">
+        <div class="text-red-400 text-sm mb-1">Rate Limited</div>
+        <div class="text-3xl font-bold text-red-300">{{.Stats.RateLimitedCount}}</div>
+    </div>
+</div>
+{{end}}
 <div class="grid grid-cols-1 md:grid-cols-2 gap-6">
     <div class="bg-gray-900 border border-gray-700 rounded-lg p-6">
         <h2 class="text-lg font-bold mb-4">By Method</h2>
@@ -126,6 +268,7 @@ const auditHTML = headHTML + `
                 <th class="px-4 py-3">Arguments</th>
                 <th class="px-4 py-3">Verdict</th>
                 <th class="px-4 py-3">Rule</th>
+                <th class="px-4 py-3">Response</th>
             </tr>
         </thead>
         <tbody id="audit-table"
@@ -145,7 +288,8 @@ const auditHTML = headHTML + `
                     {{else if eq (printf "%s" .Verdict) "ask"}}<span class="px-2 py-1 rounded text-xs font-bold bg-yellow-900 text-yellow-300">ASK</span>
                     {{else}}<span class="px-2 py-1 rounded text-xs font-bold bg-blue-900 text-blue-300">LOG</span>{{end}}
                 </td>
-                <td class="px-4 py-2 text-gray-400 text-xs">{{.Rule}}</td>
+                <td class="px-4 py-2 text-gray-400 text-xs">{{.Rule}}{{range .Tags}} <span class="px-2 py-1 rounded text-xs font-bold bg-purple-900 text-purple-300">{{.}}</span>{{end}}</td>
+                <td{{if and .CorrelationID (eq (printf "%s" .Direction) "inbound")}} id="resp-{{.CorrelationID}}"{{end}} class="px-4 py-2 text-gray-400 text-xs">{{if .Response}}{{responseSummary .Response}}{{else if eq (printf "%s" .Direction) "outbound"}}{{responseSummary .AuditRecord}}{{end}}</td>
             </tr>
             {{end}}
         </tbody>
@@ -0,0 +1,47 @@
+// Package filelock provides an advisory, cross-process exclusive lock on a
+// file, used to share state files between proxy processes on one machine.
+package filelock
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// Lock acquires an exclusive lock on path+".lock", blocking until it is
+// available. The returned function releases it.
+func Lock(path string) (unlock func() error, err error) {
+	lockPath := path + ".lock"
+	if err := os.MkdirAll(filepath.Dir(lockPath), 0o700); err != nil {
+		return nil, fmt.Errorf("creating lock directory: %w", err)
+	}
+	return lock(lockPath)
+}
+
+// WriteFile writes data to path atomically: it writes a temporary file in
+// the same directory, syncs it, and renames it over path, so a crash leaves
+// either the old or the new contents, never a partial file.
+func WriteFile(path string, data []byte, perm os.FileMode) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	name := tmp.Name()
+	defer os.Remove(name) // no-op once renamed
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(name, perm); err != nil {
+		return err
+	}
+	return os.Rename(name, path)
+}
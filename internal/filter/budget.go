@@ -0,0 +1,186 @@
+package filter
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/tkingovr/agent-guard/api"
+	"github.com/tkingovr/agent-guard/internal/jsonrpc"
+	"github.com/tkingovr/agent-guard/internal/policy"
+)
+
+// maxBudgetSessions bounds the sessions tracked in memory.
+const maxBudgetSessions = 1024
+
+// BudgetConfig caps what one client session may consume. Zero values are
+// unlimited.
+type BudgetConfig struct {
+	MaxCalls         int
+	MaxArgumentBytes int64
+	MaxResponseBytes int64
+	MaxDuration      time.Duration
+}
+
+// budgetSession is the running consumption of one session.
+type budgetSession struct {
+	start         time.Time
+	lastSeen      time.Time
+	calls         int
+	argumentBytes int64
+	responseBytes int64
+}
+
+// BudgetTracker accounts session consumption. It is shared by the inbound
+// chain, which charges tool calls and arguments, and the outbound chain,
+// which charges response bytes.
+type BudgetTracker struct {
+	cfg BudgetConfig
+
+	mu       sync.Mutex
+	sessions map[string]*budgetSession
+}
+
+// NewBudgetTracker creates a budget tracker.
+func NewBudgetTracker(cfg BudgetConfig) *BudgetTracker {
+	return &BudgetTracker{
+		cfg:      cfg,
+		sessions: make(map[string]*budgetSession),
+	}
+}
+
+// Usage returns the consumption of every tracked session.
+func (t *BudgetTracker) Usage() map[string]policy.BudgetUsage {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	now := time.Now()
+	out := make(map[string]policy.BudgetUsage, len(t.sessions))
+	for id, s := range t.sessions {
+		out[id] = t.usage(s, now)
+	}
+	return out
+}
+
+// session returns the session's state, starting it if new and evicting
+// the least recently seen session when full. Callers must hold t.mu.
+func (t *BudgetTracker) session(id string, now time.Time) *budgetSession {
+	s, ok := t.sessions[id]
+	if !ok {
+		if len(t.sessions) >= maxBudgetSessions {
+			var oldest string
+			for sid, other := range t.sessions {
+				if oldest == "" || other.lastSeen.Before(t.sessions[oldest].lastSeen) {
+					oldest = sid
+				}
+			}
+			delete(t.sessions, oldest)
+		}
+		s = &budgetSession{start: now}
+		t.sessions[id] = s
+	}
+	s.lastSeen = now
+	return s
+}
+
+// usage summarizes s. Callers must hold t.mu.
+func (t *BudgetTracker) usage(s *budgetSession, now time.Time) policy.BudgetUsage {
+	elapsed := now.Sub(s.start)
+	u := policy.BudgetUsage{
+		Calls:          s.calls,
+		ArgumentBytes:  s.argumentBytes,
+		ResponseBytes:  s.responseBytes,
+		ElapsedSeconds: elapsed.Seconds(),
+	}
+	ratio := func(used, limit float64) {
+		if limit > 0 {
+			u.Usage = max(u.Usage, used/limit)
+		}
+	}
+	ratio(float64(s.calls), float64(t.cfg.MaxCalls))
+	ratio(float64(s.argumentBytes), float64(t.cfg.MaxArgumentBytes))
+	ratio(float64(s.responseBytes), float64(t.cfg.MaxResponseBytes))
+	ratio(float64(elapsed), float64(t.cfg.MaxDuration))
+	return u
+}
+
+// exhausted returns the budget a new call of argBytes would exceed, with
+// its limit and current use. Callers must hold t.mu.
+func (t *BudgetTracker) exhausted(s *budgetSession, argBytes int64, now time.Time) (name string, used, limit int64) {
+	switch {
+	case t.cfg.MaxCalls > 0 && s.calls >= t.cfg.MaxCalls:
+		return "calls", int64(s.calls), int64(t.cfg.MaxCalls)
+	case t.cfg.MaxArgumentBytes > 0 && s.argumentBytes+argBytes > t.cfg.MaxArgumentBytes:
+		return "argument_bytes", s.argumentBytes, t.cfg.MaxArgumentBytes
+	case t.cfg.MaxResponseBytes > 0 && s.responseBytes >= t.cfg.MaxResponseBytes:
+		return "response_bytes", s.responseBytes, t.cfg.MaxResponseBytes
+	case t.cfg.MaxDuration > 0 && now.Sub(s.start) >= t.cfg.MaxDuration:
+		return "duration", int64(now.Sub(s.start).Seconds()), int64(t.cfg.MaxDuration.Seconds())
+	}
+	return "", 0, 0
+}
+
+// BudgetFilter enforces per-session budgets. Inbound it runs before the
+// policy filter: it exposes the session's consumption as policy input
+// (so rules can ask at 80%) and denies tool calls once a budget is spent.
+// Calls are charged when attempted, so an agent retrying denied calls
+// still spends its budget. Outbound it charges response bytes.
+type BudgetFilter struct {
+	tracker *BudgetTracker
+}
+
+// NewBudgetFilter creates a filter backed by a shared tracker.
+func NewBudgetFilter(t *BudgetTracker) *BudgetFilter {
+	return &BudgetFilter{tracker: t}
+}
+
+func (f *BudgetFilter) Name() string { return "budget" }
+
+func (f *BudgetFilter) Process(_ context.Context, fc *FilterContext) error {
+	if fc.Message == nil {
+		return nil
+	}
+	t := f.tracker
+	now := time.Now()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	s := t.session(fc.SessionID, now)
+
+	if fc.Direction == api.DirectionOutbound {
+		if fc.Message.IsResponse() {
+			s.responseBytes += int64(len(fc.Raw))
+		}
+		return nil
+	}
+	if !fc.Message.IsRequest() {
+		return nil
+	}
+
+	usage := t.usage(s, now)
+	fc.Budget = &usage
+	if fc.Method != "tools/call" {
+		return nil
+	}
+
+	argBytes := int64(len(fc.Arguments))
+	if name, used, limit := t.exhausted(s, argBytes, now); name != "" {
+		data, _ := json.Marshal(map[string]any{
+			"budget": name,
+			"used":   used,
+			"limit":  limit,
+		})
+		fc.Verdict = api.VerdictDeny
+		fc.MatchedRule = "budget:" + name
+		fc.VerdictMessage = fmt.Sprintf("session budget exhausted: %s (%d of %d used)", name, used, limit)
+		fc.ErrorCode = jsonrpc.ErrorCodeBudgetExhausted
+		fc.ErrorData = data
+		fc.Halted = true
+		return nil
+	}
+
+	s.calls++
+	s.argumentBytes += argBytes
+	return nil
+}
@@ -0,0 +1,151 @@
+package filter
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/tkingovr/agent-guard/api"
+	"github.com/tkingovr/agent-guard/internal/audit"
+	"github.com/tkingovr/agent-guard/internal/jsonrpc"
+	"github.com/tkingovr/agent-guard/internal/policy"
+)
+
+func budgetCall(t *testing.T, f *BudgetFilter, session, args string) *FilterContext {
+	t.Helper()
+	raw := fmt.Sprintf(`{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"search","arguments":%s}}`, args)
+	fc := NewFilterContext([]byte(raw), api.DirectionInbound)
+	fc.SessionID = session
+	if err := NewParseFilter().Process(context.Background(), fc); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Process(context.Background(), fc); err != nil {
+		t.Fatal(err)
+	}
+	return fc
+}
+
+func TestBudgetFilter_MaxCalls(t *testing.T) {
+	f := NewBudgetFilter(NewBudgetTracker(BudgetConfig{MaxCalls: 5}))
+
+	for i := 0; i < 5; i++ {
+		fc := budgetCall(t, f, "s1", `{"q":"x"}`)
+		if fc.Halted {
+			t.Fatalf("call %d should be allowed", i+1)
+		}
+		if want := float64(i) / 5; fc.Budget == nil || fc.Budget.Usage != want {
+			t.Fatalf("call %d: expected usage %v, got %+v", i+1, want, fc.Budget)
+		}
+	}
+
+	fc := budgetCall(t, f, "s1", `{"q":"x"}`)
+	if !fc.Halted || fc.Verdict != api.VerdictDeny || fc.MatchedRule != "budget:calls" {
+		t.Fatalf("6th call should be denied, got %s %q", fc.Verdict, fc.MatchedRule)
+	}
+	if fc.ErrorCode != jsonrpc.ErrorCodeBudgetExhausted {
+		t.Errorf("expected error code %d, got %d", jsonrpc.ErrorCodeBudgetExhausted, fc.ErrorCode)
+	}
+	var data struct {
+		Budget string `json:"budget"`
+		Used   int64  `json:"used"`
+		Limit  int64  `json:"limit"`
+	}
+	if err := json.Unmarshal(fc.ErrorData, &data); err != nil {
+		t.Fatal(err)
+	}
+	if data.Budget != "calls" || data.Used != 5 || data.Limit != 5 {
+		t.Errorf("unexpected error data: %s", fc.ErrorData)
+	}
+
+	if fc := budgetCall(t, f, "s2", `{"q":"x"}`); fc.Halted {
+		t.Error("other sessions should have their own budget")
+	}
+}
+
+func TestBudgetFilter_Bytes(t *testing.T) {
+	tracker := NewBudgetTracker(BudgetConfig{MaxArgumentBytes: 20, MaxResponseBytes: 50})
+	f := NewBudgetFilter(tracker)
+
+	if fc := budgetCall(t, f, "s1", `{"q":"short"}`); fc.Halted {
+		t.Fatal("first call should fit the argument budget")
+	}
+	if fc := budgetCall(t, f, "s1", `{"q":"much longer"}`); fc.MatchedRule != "budget:argument_bytes" {
+		t.Fatalf("call over the argument budget should be denied, got %q", fc.MatchedRule)
+	}
+
+	resp := NewFilterContext([]byte(`{"jsonrpc":"2.0","id":1,"result":{"content":[{"type":"text","text":"0123456789"}]}}`), api.DirectionOutbound)
+	resp.SessionID = "s2"
+	if err := NewOutboundParseFilter().Process(context.Background(), resp); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Process(context.Background(), resp); err != nil {
+		t.Fatal(err)
+	}
+	if got := tracker.Usage()["s2"].ResponseBytes; got != int64(len(resp.Raw)) {
+		t.Fatalf("expected %d response bytes, got %d", len(resp.Raw), got)
+	}
+	if fc := budgetCall(t, f, "s2", `{}`); fc.MatchedRule != "budget:response_bytes" {
+		t.Errorf("call after the response budget is spent should be denied, got %q", fc.MatchedRule)
+	}
+}
+
+func TestBudgetFilter_MaxDuration(t *testing.T) {
+	f := NewBudgetFilter(NewBudgetTracker(BudgetConfig{MaxDuration: 20 * time.Millisecond}))
+
+	if fc := budgetCall(t, f, "s1", `{}`); fc.Halted {
+		t.Fatal("first call should be allowed")
+	}
+	time.Sleep(30 * time.Millisecond)
+	if fc := budgetCall(t, f, "s1", `{}`); fc.MatchedRule != "budget:duration" {
+		t.Errorf("call after the session deadline should be denied, got %q", fc.MatchedRule)
+	}
+}
+
+func TestBudgetFilter_PolicyInput(t *testing.T) {
+	engine, err := policy.NewYAMLEngineFromPolicy(&policy.PolicyFile{
+		Version:  1,
+		Settings: policy.Settings{DefaultAction: api.VerdictAllow},
+		Rules: []policy.Rule{
+			{
+				Name:   "ask-near-budget",
+				Match:  policy.RuleMatch{Method: "tools/call", MinBudgetUsage: 0.8},
+				Action: "ask",
+			},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	store, err := audit.NewJSONLStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	chain := BuildInboundChain(ChainConfig{
+		Engine:     engine,
+		AuditStore: store,
+		Logger:     newTestLogger(),
+		Budget:     NewBudgetTracker(BudgetConfig{MaxCalls: 5}),
+	})
+
+	var verdicts []api.Verdict
+	for i := 0; i < 6; i++ {
+		raw := []byte(`{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"search","arguments":{}}}`)
+		fc := NewFilterContext(raw, api.DirectionInbound)
+		if err := chain.Process(context.Background(), fc); err != nil {
+			t.Fatal(err)
+		}
+		verdicts = append(verdicts, fc.Verdict)
+		if i == 5 && fc.MatchedRule != "budget:calls" {
+			t.Errorf("policy should not override the budget deny, got %q", fc.MatchedRule)
+		}
+	}
+	want := []api.Verdict{api.VerdictAllow, api.VerdictAllow, api.VerdictAllow, api.VerdictAllow, api.VerdictAsk, api.VerdictDeny}
+	for i := range want {
+		if verdicts[i] != want[i] {
+			t.Errorf("call %d: expected %s, got %s", i+1, want[i], verdicts[i])
+		}
+	}
+}
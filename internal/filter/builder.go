@@ -1,7 +1,9 @@
 package filter
 
 import (
+	"fmt"
 	"log/slog"
+	"regexp"
 	"time"
 
 	"github.com/tkingovr/agent-guard/internal/audit"
@@ -15,67 +17,372 @@ type ChainConfig struct {
 	Logger           *slog.Logger
 	SecretScanner    bool
 	EntropyThreshold float64
+	SecretOptions    []SecretScannerOption
 	RateLimit        *RateLimitConfig
+	InjectionScanner *policy.InjectionSettings
+	ResultScanner    *policy.ResultScannerSettings
+	Redaction        *RedactionConfig
+	Canary           *Canary
+	Honeytokens      *HoneytokenSet
+	Concurrency      *ConcurrencyLimiter
+	LoopDetection    *LoopConfig
+	Budget           *BudgetTracker
+
+	// OnFilterError is OnFilterErrorDeny (default) or OnFilterErrorAllow.
+	OnFilterError string
 }
 
 // BuildInboundChain constructs the inbound (client→server) filter chain.
 func BuildInboundChain(cfg ChainConfig) *Chain {
 	filters := []Filter{
 		NewParseFilter(),
-		NewPolicyFilter(cfg.Engine),
 	}
 
+	// Budget usage is policy input, so it goes ahead of policy
+	if cfg.Budget != nil {
+		filters = append(filters, NewBudgetFilter(cfg.Budget))
+	}
+
+	filters = append(filters, NewPolicyFilter(cfg.Engine))
+
 	// Add secret scanner after policy (so policy denials take precedence)
 	if cfg.SecretScanner {
 		opts := []SecretScannerOption{}
 		if cfg.EntropyThreshold > 0 {
 			opts = append(opts, WithEntropyThreshold(cfg.EntropyThreshold))
 		}
+		opts = append(opts, cfg.SecretOptions...)
 		filters = append(filters, NewSecretScannerFilter(opts...))
 	}
 
+	// Block arguments carrying the host's own credentials
+	if cfg.Canary != nil {
+		filters = append(filters, NewCanaryFilter(cfg.Canary))
+	}
+
+	// Trip on planted honeytokens and serve decoy resources
+	if cfg.Honeytokens != nil {
+		filters = append(filters, NewHoneytokenFilter(cfg.Honeytokens))
+	}
+
+	// Catch runaway agents before they use up rate limits
+	if cfg.LoopDetection != nil {
+		filters = append(filters, NewLoopDetectorFilter(*cfg.LoopDetection))
+	}
+
 	// Add rate limiter
 	if cfg.RateLimit != nil {
 		filters = append(filters, NewRateLimitFilter(*cfg.RateLimit))
 	}
 
-	// Audit is always last
-	filters = append(filters, NewAuditFilter(cfg.AuditStore))
+	// Hold a concurrency slot until the response arrives
+	if cfg.Concurrency != nil {
+		filters = append(filters, NewConcurrencyFilter(cfg.Concurrency))
+	}
 
-	return NewChain(cfg.Logger, filters...)
+	chain := NewChain(cfg.Logger, filters...)
+	if cfg.OnFilterError != "" {
+		chain.SetOnError(cfg.OnFilterError)
+	}
+
+	// Mask secrets and sensitive arguments before they're recorded. Audit
+	// is always last, and runs even if a filter failed.
+	chain.Finally(NewRedactionFilter(cfg.Redaction), NewAuditFilter(cfg.AuditStore))
+	return chain
 }
 
 // BuildOutboundChain constructs the outbound (server→client) filter chain.
 func BuildOutboundChain(cfg ChainConfig) *Chain {
-	return NewChain(cfg.Logger,
+	filters := []Filter{
 		NewOutboundParseFilter(),
-		NewAuditFilter(cfg.AuditStore),
-	)
+	}
+
+	// Free the concurrency slot first, whatever later filters decide
+	if cfg.Concurrency != nil {
+		filters = append(filters, NewConcurrencyFilter(cfg.Concurrency))
+	}
+
+	// Server requests of the client (sampling, elicitation, roots) must
+	// be allowed like the client's own
+	if cfg.Engine != nil {
+		filters = append(filters, NewPolicyFilter(cfg.Engine))
+	}
+
+	// Charge response bytes to the session budget
+	if cfg.Budget != nil {
+		filters = append(filters, NewBudgetFilter(cfg.Budget))
+	}
+
+	// Scan tool/prompt/resource metadata before it reaches the model
+	if cfg.InjectionScanner != nil {
+		opts := []InjectionScannerOption{}
+		if cfg.InjectionScanner.Action != "" {
+			opts = append(opts, WithInjectionAction(InjectionAction(cfg.InjectionScanner.Action)))
+		}
+		if cfg.InjectionScanner.MaxDescriptionLength > 0 {
+			opts = append(opts, WithMaxDescriptionLength(cfg.InjectionScanner.MaxDescriptionLength))
+		}
+		filters = append(filters, NewInjectionScannerFilter(opts...))
+	}
+
+	// Scan tool results for secrets and PII
+	if cfg.ResultScanner != nil {
+		opts := []ResultScannerOption{}
+		if cfg.ResultScanner.PII {
+			opts = append(opts, WithPII())
+		}
+		if cfg.ResultScanner.Action != "" {
+			opts = append(opts, WithResultAction(ResultAction(cfg.ResultScanner.Action)))
+		}
+		for name, action := range cfg.ResultScanner.Actions {
+			opts = append(opts, WithPatternAction(name, ResultAction(action)))
+		}
+		filters = append(filters, NewResultScannerFilter(opts...))
+	}
+
+	// Block results that expose the host's own credentials
+	if cfg.Canary != nil {
+		filters = append(filters, NewCanaryFilter(cfg.Canary))
+	}
+
+	// Plant decoys after scanning so scanners don't redact them
+	if cfg.Honeytokens != nil {
+		filters = append(filters, NewHoneytokenFilter(cfg.Honeytokens))
+	}
+
+	chain := NewChain(cfg.Logger, filters...)
+	if cfg.OnFilterError != "" {
+		chain.SetOnError(cfg.OnFilterError)
+	}
+
+	// Audit is always last, and runs even if a filter failed
+	chain.Finally(NewAuditFilter(cfg.AuditStore))
+	return chain
+}
+
+// SecretScannerOptionsFromPolicy converts the extended secret scanner settings
+// (custom patterns, allowlists, exemptions, actions) into filter options.
+// The entropy threshold is carried separately in ChainConfig.
+func SecretScannerOptionsFromPolicy(settings *policy.SecretSettings) ([]SecretScannerOption, error) {
+	if settings == nil {
+		return nil, nil
+	}
+
+	var opts []SecretScannerOption
+	if settings.MinTokenLength > 0 {
+		opts = append(opts, WithMinTokenLength(settings.MinTokenLength))
+	}
+	if settings.Action != "" {
+		opts = append(opts, WithSecretAction(SecretAction(settings.Action)))
+	}
+
+	var custom []SecretPattern
+	for _, ps := range settings.Patterns {
+		re, err := regexp.Compile(ps.Regex)
+		if err != nil {
+			return nil, fmt.Errorf("secret pattern %q: %w", ps.Name, err)
+		}
+		p := SecretPattern{Name: ps.Name, Regex: re, Keywords: ps.Keywords}
+		if ps.Validator != "" {
+			v, ok := Validators[ps.Validator]
+			if !ok {
+				return nil, fmt.Errorf("secret pattern %q: unknown validator %q", ps.Name, ps.Validator)
+			}
+			p.Validate = v
+		}
+		custom = append(custom, p)
+		if ps.Action != "" {
+			opts = append(opts, WithSecretPatternAction(ps.Name, SecretAction(ps.Action)))
+		}
+	}
+	if len(custom) > 0 {
+		opts = append(opts, WithExtraPatterns(custom))
+	}
+
+	for name, action := range settings.Actions {
+		opts = append(opts, WithSecretPatternAction(name, SecretAction(action)))
+	}
+	if al := settings.Allowlist; al != nil {
+		opts = append(opts, WithAllowlist(al.Values, al.Paths))
+	}
+	if len(settings.ExemptTools) > 0 {
+		opts = append(opts, WithExemptTools(settings.ExemptTools...))
+	}
+	return opts, nil
 }
 
-// RateLimitConfigFromPolicy converts policy rate limit settings to filter config.
-func RateLimitConfigFromPolicy(settings *policy.RateLimitSettings) *RateLimitConfig {
+// RedactionConfigFromPolicy converts policy redaction settings to filter config.
+func RedactionConfigFromPolicy(settings *policy.RedactionSettings) *RedactionConfig {
 	if settings == nil {
 		return nil
 	}
 
+	cfg := &RedactionConfig{
+		SensitiveKeys:  settings.SensitiveKeys,
+		Capture:        CaptureMode(settings.Capture),
+		PerTool:        make(map[string]CaptureMode),
+		TruncateLength: settings.TruncateLength,
+	}
+	for tool, mode := range settings.Tools {
+		cfg.PerTool[tool] = CaptureMode(mode)
+	}
+	return cfg
+}
+
+// CanaryFromPolicy fingerprints the env vars and files named in the canary
+// settings. Returns nil if settings is nil.
+func CanaryFromPolicy(settings *policy.CanarySettings) (*Canary, error) {
+	if settings == nil {
+		return nil, nil
+	}
+	return NewCanary(CanaryConfig{
+		Env:       settings.Env,
+		Files:     settings.Files,
+		Action:    settings.Action,
+		MinLength: settings.MinLength,
+	})
+}
+
+// HoneytokensFromPolicy builds the shared honeytoken set. Generated values
+// are persisted to stateFile. Returns nil if settings is nil.
+func HoneytokensFromPolicy(settings *policy.HoneytokenSettings, stateFile string) (*HoneytokenSet, error) {
+	if settings == nil {
+		return nil, nil
+	}
+
+	cfg := HoneytokenConfig{StateFile: stateFile}
+	for _, t := range settings.Tokens {
+		cfg.Tokens = append(cfg.Tokens, HoneytokenSpec{Name: t.Name, Kind: t.Kind, Value: t.Value})
+	}
+	for _, r := range settings.Resources {
+		cfg.Resources = append(cfg.Resources, DecoyResource{
+			URI:         r.URI,
+			Name:        r.Name,
+			Description: r.Description,
+			MimeType:    r.MimeType,
+			Text:        r.Text,
+		})
+	}
+	for _, r := range settings.Results {
+		cfg.Results = append(cfg.Results, DecoyResult{Tool: r.Tool, Text: r.Text})
+	}
+	return NewHoneytokenSet(cfg)
+}
+
+// RateLimitConfigFromPolicy converts policy rate limit settings, plus any
+// inline rule limits, to filter config. Returns nil if neither is set.
+func RateLimitConfigFromPolicy(settings *policy.RateLimitSettings, rules ...policy.Rule) *RateLimitConfig {
 	cfg := &RateLimitConfig{
-		PerTool: make(map[string]*RateLimit),
+		PerTool:   make(map[string]*RateLimit),
+		PerMethod: make(map[string]*RateLimit),
+		PerRule:   make(map[string]*RateLimit),
 	}
 
-	if settings.Global != nil {
-		d, err := time.ParseDuration(settings.Global.Window)
-		if err == nil {
-			cfg.Global = &RateLimit{Max: settings.Global.Max, Window: d}
+	for _, rule := range rules {
+		if limit := rateLimitFromPolicy(rule.RateLimit); limit != nil {
+			cfg.PerRule[rule.Name] = limit
+		}
+	}
+	if settings == nil {
+		if len(cfg.PerRule) == 0 {
+			return nil
 		}
+		return cfg
 	}
 
+	cfg.OnExceed = settings.OnExceed
+	if d, err := time.ParseDuration(settings.MaxWait); err == nil {
+		cfg.MaxWait = d
+	}
+	for _, q := range settings.Quotas {
+		cfg.Quotas = append(cfg.Quotas, Quota{Tool: q.Tool, Method: q.Method, Max: q.Max, Period: q.Period})
+	}
+	cfg.Global = rateLimitFromPolicy(settings.Global)
+	cfg.PerSession = rateLimitFromPolicy(settings.PerSession)
+	cfg.PerClient = rateLimitFromPolicy(settings.PerClient)
 	for tool, rule := range settings.PerTool {
-		d, err := time.ParseDuration(rule.Window)
-		if err == nil {
-			cfg.PerTool[tool] = &RateLimit{Max: rule.Max, Window: d}
+		if limit := rateLimitFromPolicy(rule); limit != nil {
+			cfg.PerTool[tool] = limit
+		}
+	}
+	for method, rule := range settings.PerMethod {
+		if limit := rateLimitFromPolicy(rule); limit != nil {
+			cfg.PerMethod[method] = limit
+		}
+	}
+	for _, a := range settings.PerArgument {
+		if limit := rateLimitFromPolicy(&a.RateLimitRule); limit != nil {
+			cfg.PerArgument = append(cfg.PerArgument, ArgumentRateLimit{
+				Tool:     a.Tool,
+				Argument: a.Argument,
+				Host:     a.Host,
+				Limit:    limit,
+			})
 		}
 	}
 
 	return cfg
 }
+
+func rateLimitFromPolicy(rule *policy.RateLimitRule) *RateLimit {
+	if rule == nil {
+		return nil
+	}
+	d, err := time.ParseDuration(rule.Window)
+	if err != nil {
+		return nil
+	}
+	return &RateLimit{Max: rule.Max, Window: d, Algorithm: rule.Algorithm, Burst: rule.Burst}
+}
+
+// ConcurrencyFromPolicy builds the shared concurrency limiter. Returns nil
+// if settings is nil or sets no limits.
+func ConcurrencyFromPolicy(settings *policy.ConcurrencySettings) *ConcurrencyLimiter {
+	if settings == nil || (settings.MaxConcurrent == 0 && len(settings.PerTool) == 0) {
+		return nil
+	}
+	cfg := ConcurrencyConfig{
+		Global:   settings.MaxConcurrent,
+		PerTool:  settings.PerTool,
+		OnExceed: settings.OnExceed,
+	}
+	if d, err := time.ParseDuration(settings.MaxWait); err == nil {
+		cfg.MaxWait = d
+	}
+	if d, err := time.ParseDuration(settings.MaxHold); err == nil {
+		cfg.MaxHold = d
+	}
+	return NewConcurrencyLimiter(cfg)
+}
+
+// LoopConfigFromPolicy converts policy loop detection settings to filter
+// config. Returns nil if settings is nil.
+func LoopConfigFromPolicy(settings *policy.LoopDetectionSettings) *LoopConfig {
+	if settings == nil {
+		return nil
+	}
+	return &LoopConfig{
+		MaxRepeats:     settings.MaxRepeats,
+		MaxCycles:      settings.MaxCycles,
+		MaxCycleLength: settings.MaxCycleLength,
+		Window:         settings.Window,
+		Action:         settings.Action,
+	}
+}
+
+// BudgetFromPolicy builds the shared session budget tracker. Returns nil
+// if settings is nil.
+func BudgetFromPolicy(settings *policy.BudgetSettings) *BudgetTracker {
+	if settings == nil {
+		return nil
+	}
+	cfg := BudgetConfig{
+		MaxCalls:         settings.MaxCalls,
+		MaxArgumentBytes: settings.MaxArgumentBytes,
+		MaxResponseBytes: settings.MaxResponseBytes,
+	}
+	if d, err := time.ParseDuration(settings.MaxDuration); err == nil {
+		cfg.MaxDuration = d
+	}
+	return NewBudgetTracker(cfg)
+}
@@ -0,0 +1,352 @@
+package filter
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/tkingovr/agent-guard/api"
+)
+
+const (
+	// canaryWindow is the fingerprint window. Any leaked run of this many
+	// bytes of a protected value (or of its encoding) is detected.
+	canaryWindow = 16
+	// defaultCanaryMinLength skips short values ("true", "1", "dev").
+	defaultCanaryMinLength = 8
+)
+
+// CanaryConfig names the host secrets the canary protects.
+type CanaryConfig struct {
+	// Env lists environment variable names; path.Match globs like
+	// "*_TOKEN" are allowed.
+	Env []string
+
+	// Files lists credential files (.npmrc, .netrc, .env, .git-credentials).
+	// Token-like values are extracted from each line; missing files are
+	// skipped.
+	Files []string
+
+	// Action is deny (default) or log.
+	Action string
+
+	// MinLength is the shortest value worth protecting. Default is 8.
+	MinLength int
+}
+
+// Canary holds keyed rolling-hash fingerprints of the host's own secret
+// values. The plaintext values are discarded once fingerprinted.
+type Canary struct {
+	base   uint64
+	seed   uint64
+	prints map[int]map[uint64]string // window size → fingerprint → source
+	action string
+}
+
+// NewCanary reads the configured environment variables and files and
+// fingerprints every value found, plus its base64 and hex encodings.
+func NewCanary(cfg CanaryConfig) (*Canary, error) {
+	var key [16]byte
+	if _, err := rand.Read(key[:]); err != nil {
+		return nil, fmt.Errorf("seeding canary: %w", err)
+	}
+
+	c := &Canary{
+		base:   binary.LittleEndian.Uint64(key[:8]) | 1,
+		seed:   binary.LittleEndian.Uint64(key[8:]),
+		prints: make(map[int]map[uint64]string),
+		action: cfg.Action,
+	}
+	if c.action == "" {
+		c.action = "deny"
+	}
+	minLen := cfg.MinLength
+	if minLen <= 0 {
+		minLen = defaultCanaryMinLength
+	}
+
+	add := func(source, value string) {
+		value = strings.TrimSpace(value)
+		if len(value) < minLen {
+			return
+		}
+		for _, form := range canaryForms(value) {
+			c.fingerprint(source, form)
+		}
+	}
+
+	for _, env := range os.Environ() {
+		name, value, _ := strings.Cut(env, "=")
+		for _, pattern := range cfg.Env {
+			if ok, _ := path.Match(pattern, name); ok {
+				add(name, value)
+				break
+			}
+		}
+	}
+
+	for _, file := range cfg.Files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, fmt.Errorf("reading canary file: %w", err)
+		}
+		source := path.Base(file)
+		for _, value := range fileSecrets(data) {
+			if tokenLike(value) {
+				add(source, value)
+			}
+		}
+	}
+
+	return c, nil
+}
+
+// Size returns the number of fingerprints held.
+func (c *Canary) Size() int {
+	n := 0
+	for _, set := range c.prints {
+		n += len(set)
+	}
+	return n
+}
+
+func (c *Canary) fingerprint(source, value string) {
+	w := min(len(value), canaryWindow)
+	set := c.prints[w]
+	if set == nil {
+		set = make(map[uint64]string)
+		c.prints[w] = set
+	}
+	c.roll(value, w, func(_ int, h uint64) {
+		set[h] = source
+	})
+}
+
+// roll computes the keyed fingerprint of every w-byte window of s, calling
+// fn with the window start. The polynomial hash rolls in O(1) per byte; the
+// seed is mixed in afterwards so it doesn't disturb the rolling update.
+func (c *Canary) roll(s string, w int, fn func(start int, h uint64)) {
+	if len(s) < w {
+		return
+	}
+	pow := uint64(1)
+	for i := 1; i < w; i++ {
+		pow *= c.base
+	}
+	var h uint64
+	for i := 0; i < w; i++ {
+		h = h*c.base + uint64(s[i])
+	}
+	fn(0, c.mix(h))
+	for i := w; i < len(s); i++ {
+		h = (h-uint64(s[i-w])*pow)*c.base + uint64(s[i])
+		fn(i-w+1, c.mix(h))
+	}
+}
+
+// mix is the splitmix64 finalizer over the seeded hash.
+func (c *Canary) mix(h uint64) uint64 {
+	h ^= c.seed
+	h = (h ^ (h >> 30)) * 0xbf58476d1ce4e5b9
+	h = (h ^ (h >> 27)) * 0x94d049bb133111eb
+	return h ^ (h >> 31)
+}
+
+// match returns the sources whose fingerprints occur in text, and the
+// matched substrings (overlapping windows merged).
+func (c *Canary) match(text string) (map[string]bool, []string) {
+	var sources map[string]bool
+	var hits [][2]int
+	for w, set := range c.prints {
+		c.roll(text, w, func(start int, h uint64) {
+			if source, ok := set[h]; ok {
+				if sources == nil {
+					sources = make(map[string]bool)
+				}
+				sources[source] = true
+				hits = append(hits, [2]int{start, start + w})
+			}
+		})
+	}
+	if len(hits) == 0 {
+		return nil, nil
+	}
+
+	sort.Slice(hits, func(i, j int) bool { return hits[i][0] < hits[j][0] })
+	var spans []string
+	cur := hits[0]
+	for _, h := range hits[1:] {
+		if h[0] <= cur[1] {
+			cur[1] = max(cur[1], h[1])
+			continue
+		}
+		spans = append(spans, text[cur[0]:cur[1]])
+		cur = h
+	}
+	spans = append(spans, text[cur[0]:cur[1]])
+	return sources, spans
+}
+
+// canaryForms returns value and the encodings an agent is likely to use when
+// exfiltrating it. Base64 is taken at all three byte alignments, minus the
+// groups shared with surrounding bytes.
+func canaryForms(value string) []string {
+	forms := []string{value, hex.EncodeToString([]byte(value)), strings.ToUpper(hex.EncodeToString([]byte(value)))}
+	for pad := 0; pad < 3; pad++ {
+		for _, enc := range []*base64.Encoding{base64.StdEncoding, base64.URLEncoding} {
+			s := enc.EncodeToString(append(make([]byte, pad), value...))
+			start, end := 0, len(s)
+			if pad > 0 {
+				start = 4
+			}
+			if (pad+len(value))%3 != 0 {
+				end -= 4
+			}
+			if end-start >= canaryWindow {
+				forms = append(forms, s[start:end])
+			}
+		}
+	}
+	return forms
+}
+
+// fileSecrets extracts candidate secret values from a credential file:
+// KEY=value lines (.env, .npmrc), "password X" (.netrc), and URL userinfo
+// passwords (.git-credentials).
+func fileSecrets(data []byte) []string {
+	var out []string
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || line[0] == '#' || line[0] == ';' {
+			continue
+		}
+		if u, err := url.Parse(line); err == nil && u.User != nil {
+			if pw, ok := u.User.Password(); ok {
+				out = append(out, pw)
+			}
+			continue
+		}
+		fields := strings.Fields(line)
+		for i, f := range fields {
+			if (f == "password" || f == "account") && i+1 < len(fields) {
+				out = append(out, fields[i+1])
+			}
+		}
+		if _, value, ok := strings.Cut(line, "="); ok {
+			out = append(out, strings.Trim(strings.TrimSpace(value), `"'`))
+		}
+	}
+	return out
+}
+
+// tokenLike filters file values down to ones that look like credentials, so
+// settings such as "registry=https://..." or "NODE_ENV=production" aren't
+// treated as secrets.
+func tokenLike(value string) bool {
+	if u, err := url.Parse(value); err == nil && u.Scheme != "" && u.User == nil {
+		return false
+	}
+	return strings.ContainsAny(value, "0123456789") &&
+		strings.ContainsFunc(value, func(r rune) bool { return r >= 'A' && r <= 'Z' || r >= 'a' && r <= 'z' })
+}
+
+// CanaryFilter blocks messages that carry any of the host's own secret
+// values, in requests (exfiltration by argument) or results (a tool that
+// read ~/.npmrc).
+type CanaryFilter struct {
+	canary *Canary
+}
+
+// NewCanaryFilter creates a filter backed by a shared Canary.
+func NewCanaryFilter(c *Canary) *CanaryFilter {
+	return &CanaryFilter{canary: c}
+}
+
+func (f *CanaryFilter) Name() string { return "canary" }
+
+func (f *CanaryFilter) Process(_ context.Context, fc *FilterContext) error {
+	if fc.Halted || fc.Message == nil {
+		return nil
+	}
+
+	var payload json.RawMessage
+	where := "argument"
+	if fc.Direction == api.DirectionInbound {
+		payload = fc.Message.Params
+	} else {
+		payload = fc.Message.Result
+		where = "tool result"
+	}
+	if len(payload) == 0 {
+		return nil
+	}
+
+	var v any
+	if err := json.Unmarshal(payload, &v); err != nil {
+		return nil
+	}
+	sources := map[string]bool{}
+	f.walk(v, sources, fc)
+	if len(sources) == 0 {
+		return nil
+	}
+
+	names := make([]string, 0, len(sources))
+	for s := range sources {
+		names = append(names, s)
+	}
+	sort.Strings(names)
+
+	fc.MatchedRule = "canary:" + names[0]
+	fc.VerdictMessage = fmt.Sprintf("%s contains the value of a protected host secret (%s)", where, strings.Join(names, ", "))
+	if f.canary.action == "log" {
+		fc.Verdict = api.VerdictLog
+		return nil
+	}
+	fc.Verdict = api.VerdictDeny
+	fc.Halted = true
+	return nil
+}
+
+func (f *CanaryFilter) walk(v any, sources map[string]bool, fc *FilterContext) {
+	switch val := v.(type) {
+	case string:
+		f.scan(val, sources, fc)
+		if strings.Contains(val, "%") {
+			if unesc, err := url.QueryUnescape(val); err == nil && unesc != val {
+				f.scan(unesc, sources, fc)
+			}
+		}
+	case map[string]any:
+		for _, child := range val {
+			f.walk(child, sources, fc)
+		}
+	case []any:
+		for _, child := range val {
+			f.walk(child, sources, fc)
+		}
+	}
+}
+
+func (f *CanaryFilter) scan(text string, sources map[string]bool, fc *FilterContext) {
+	found, spans := f.canary.match(text)
+	for s := range found {
+		sources[s] = true
+	}
+	fc.Secrets = append(fc.Secrets, spans...)
+}
@@ -4,11 +4,38 @@ import (
 	"context"
 	"fmt"
 	"log/slog"
+
+	"github.com/tkingovr/agent-guard/api"
+	"github.com/tkingovr/agent-guard/internal/jsonrpc"
+)
+
+// What a chain does with a message when one of its filters fails.
+const (
+	OnFilterErrorDeny  = "deny"  // fail closed (default)
+	OnFilterErrorAllow = "allow" // fail open
 )
 
+// TagFilterError prefixes the audit tag naming the filter that failed, as
+// in "filter_error:parse".
+const TagFilterError = "filter_error"
+
+// FilterError is returned by Chain.Process when a filter fails.
+type FilterError struct {
+	Filter string
+	Err    error
+}
+
+func (e *FilterError) Error() string {
+	return fmt.Sprintf("filter %q: %v", e.Filter, e.Err)
+}
+
+func (e *FilterError) Unwrap() error { return e.Err }
+
 // Chain executes a sequence of filters in order.
 type Chain struct {
 	filters []Filter
+	finally []Filter
+	onError string
 	logger  *slog.Logger
 }
 
@@ -16,6 +43,7 @@ type Chain struct {
 func NewChain(logger *slog.Logger, filters ...Filter) *Chain {
 	return &Chain{
 		filters: filters,
+		onError: OnFilterErrorDeny,
 		logger:  logger,
 	}
 }
@@ -23,10 +51,19 @@ func NewChain(logger *slog.Logger, filters ...Filter) *Chain {
 // Process runs all filters in sequence on the given context.
 // If any filter sets fc.Halted to true, remaining filters still
 // run (e.g., audit) but the verdict is final.
+//
+// If a filter fails, the remaining filters are skipped and the message is
+// denied with a JSON-RPC error, or let through if the chain fails open.
+// Finally filters run either way, and the *FilterError is returned. For a
+// held request not pending approval, they run in Admit instead, once its
+// waits are over.
 func (c *Chain) Process(ctx context.Context, fc *FilterContext) error {
+	var failed *FilterError
 	for _, f := range c.filters {
 		if err := f.Process(ctx, fc); err != nil {
-			return fmt.Errorf("filter %q: %w", f.Name(), err)
+			failed = &FilterError{Filter: f.Name(), Err: err}
+			c.fail(fc, failed)
+			break
 		}
 		c.logger.Debug("filter executed",
 			"filter", f.Name(),
@@ -35,10 +72,118 @@ func (c *Chain) Process(ctx context.Context, fc *FilterContext) error {
 			"halted", fc.Halted,
 		)
 	}
+	if fc.Verdict == api.VerdictDeny {
+		fc.holds = nil
+	}
+	// A held request is recorded once admitted, with what its waits decided
+	if failed == nil && fc.Held() && fc.Verdict != api.VerdictAsk {
+		fc.unaudited = true
+		return nil
+	}
+	return c.runFinally(ctx, fc, failed)
+}
+
+// Admit runs the waits filters deferred with FilterContext.Hold, in order,
+// until one denies the request. Proxies call it before forwarding a held
+// request, off their read loop, and an approved one. The finally filters
+// Process left to it run here, and run again for an approved request
+// denied now. If ctx ends first, the request is denied and ctx.Err()
+// returned.
+func (c *Chain) Admit(ctx context.Context, fc *FilterContext) error {
+	holds := fc.holds
+	fc.holds = nil
+	asked := fc.Verdict == api.VerdictAsk
+
+	var failed *FilterError
+	var err error
+	for _, h := range holds {
+		if err = h.fn(ctx, fc); err != nil {
+			if ctx.Err() != nil {
+				// Cancelled or shut down while held; never let it through
+				fc.Verdict = api.VerdictDeny
+				fc.Halted = true
+				fc.VerdictMessage = "request cancelled while held"
+				break
+			}
+			failed = &FilterError{Filter: h.filter, Err: err}
+			c.fail(fc, failed)
+			err = failed
+			break
+		}
+		if fc.Verdict == api.VerdictDeny {
+			break
+		}
+	}
+
+	if fc.unaudited || (asked && fc.Verdict == api.VerdictDeny) {
+		fc.unaudited = false
+		// Recorded even if the request was cancelled
+		if ferr := c.runFinally(context.WithoutCancel(ctx), fc, failed); ferr != nil && err == nil {
+			err = ferr
+		}
+	}
+	return err
+}
+
+// runFinally runs the finally filters, failing the message on the first
+// error unless it already failed.
+func (c *Chain) runFinally(ctx context.Context, fc *FilterContext, failed *FilterError) error {
+	for _, f := range c.finally {
+		if err := f.Process(ctx, fc); err != nil && failed == nil {
+			failed = &FilterError{Filter: f.Name(), Err: err}
+			c.fail(fc, failed)
+		}
+	}
+	if failed != nil {
+		return failed
+	}
 	return nil
 }
 
+// fail applies the chain's on-error action to a message a filter failed on.
+// Only internal failures fail open: a message the proxy can't read (parse
+// error, invalid request or params) is always denied, as the server might
+// read it differently and the later filters never saw it. An earlier deny
+// is kept, as it is more specific than the failure.
+func (c *Chain) fail(fc *FilterContext, err *FilterError) {
+	fc.Tags = append(fc.Tags, TagFilterError+":"+err.Filter)
+	code := jsonrpc.ErrorCodeFor(err.Err)
+	if c.onError == OnFilterErrorAllow && code == jsonrpc.ErrorCodeInternalError {
+		if fc.Verdict == "" {
+			fc.Verdict = api.VerdictAllow
+		}
+		return
+	}
+	if fc.Verdict == api.VerdictDeny {
+		return
+	}
+
+	fc.Verdict = api.VerdictDeny
+	fc.Halted = true
+	fc.MatchedRule = TagFilterError + ":" + err.Filter
+	fc.ErrorCode = code
+	fc.ErrorData = nil
+	if fc.ErrorCode == jsonrpc.ErrorCodeInternalError {
+		// Don't expose internals (paths, state) to the client
+		fc.VerdictMessage = fmt.Sprintf("internal error in %s filter", err.Filter)
+	} else {
+		fc.VerdictMessage = err.Err.Error()
+	}
+}
+
 // AddFilter appends a filter to the chain.
 func (c *Chain) AddFilter(f Filter) {
 	c.filters = append(c.filters, f)
 }
+
+// Finally appends filters that run after all others even when one of them
+// fails, so that, e.g., every message is audited.
+func (c *Chain) Finally(filters ...Filter) {
+	c.finally = append(c.finally, filters...)
+}
+
+// SetOnError sets how a message is treated when a filter fails:
+// OnFilterErrorDeny (the default) or OnFilterErrorAllow.
+func (c *Chain) SetOnError(action string) {
+	c.onError = action
+}
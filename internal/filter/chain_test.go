@@ -3,11 +3,15 @@ package filter
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"io"
 	"log/slog"
 	"testing"
+	"time"
 
 	"github.com/tkingovr/agent-guard/api"
+	"github.com/tkingovr/agent-guard/internal/audit"
+	"github.com/tkingovr/agent-guard/internal/jsonrpc"
 	"github.com/tkingovr/agent-guard/internal/policy"
 )
 
@@ -15,6 +19,23 @@ func newTestLogger() *slog.Logger {
 	return slog.New(slog.NewTextHandler(io.Discard, nil))
 }
 
+// runFilter parses raw as a message in direction dir and runs f on it.
+func runFilter(t *testing.T, f Filter, raw string, dir api.Direction) *FilterContext {
+	t.Helper()
+	fc := NewFilterContext([]byte(raw), dir)
+	var parse Filter = NewParseFilter()
+	if dir == api.DirectionOutbound {
+		parse = NewOutboundParseFilter()
+	}
+	if err := parse.Process(context.Background(), fc); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Process(context.Background(), fc); err != nil {
+		t.Fatal(err)
+	}
+	return fc
+}
+
 func TestFilterChain_ParseAndPolicy(t *testing.T) {
 	pf := &policy.PolicyFile{
 		Version: 1,
@@ -103,6 +124,64 @@ func TestFilterChain_ToolCall(t *testing.T) {
 	}
 }
 
+func TestPolicyFilter_ServerRequests(t *testing.T) {
+	engine, err := policy.NewYAMLEngineFromPolicy(&policy.PolicyFile{
+		Version:  1,
+		Settings: policy.Settings{DefaultAction: api.VerdictDeny},
+		Rules: []policy.Rule{
+			{Name: "ask-sampling", Match: policy.RuleMatch{Method: "sampling/createMessage"}, Action: "ask"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := NewPolicyFilter(engine)
+
+	for raw, want := range map[string]api.Verdict{
+		// Nobody approves a server's request, so ask denies it
+		`{"jsonrpc":"2.0","id":1,"method":"sampling/createMessage","params":{}}`: api.VerdictDeny,
+		`{"jsonrpc":"2.0","id":2,"method":"roots/list"}`:                         api.VerdictDeny,
+		`{"jsonrpc":"2.0","method":"notifications/progress","params":{}}`:        api.VerdictAllow,
+		`{"jsonrpc":"2.0","id":3,"result":{}}`:                                   api.VerdictAllow,
+	} {
+		fc := runFilter(t, f, raw, api.DirectionOutbound)
+		if fc.Verdict != want {
+			t.Errorf("%s: expected %s, got %s", raw, want, fc.Verdict)
+		}
+	}
+}
+
+func TestDefaultPolicy_AllowsServerRequests(t *testing.T) {
+	pf, err := policy.LoadFile("../../configs/default.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	engine, err := policy.NewYAMLEngineFromPolicy(pf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store, err := audit.NewJSONLStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	chain := BuildOutboundChain(ChainConfig{Engine: engine, AuditStore: store, Logger: newTestLogger()})
+
+	for _, raw := range []string{
+		`{"jsonrpc":"2.0","id":1,"method":"roots/list"}`,
+		`{"jsonrpc":"2.0","id":2,"method":"sampling/createMessage","params":{"messages":[],"maxTokens":10}}`,
+		`{"jsonrpc":"2.0","id":3,"method":"elicitation/create","params":{"message":"Name?","requestedSchema":{}}}`,
+	} {
+		fc := NewFilterContext([]byte(raw), api.DirectionOutbound)
+		if err := chain.Process(context.Background(), fc); err != nil {
+			t.Fatal(err)
+		}
+		if fc.Verdict == api.VerdictDeny {
+			t.Errorf("%s: default policy should let the server's request through, got %q", raw, fc.MatchedRule)
+		}
+	}
+}
+
 func TestFilterContext_ToAuditRecord(t *testing.T) {
 	raw := []byte(`{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"test_tool","arguments":{"key":"val"}}}`)
 	fc := NewFilterContext(raw, api.DirectionInbound)
@@ -138,3 +217,175 @@ func TestOutboundParseFilter(t *testing.T) {
 		t.Errorf("expected allow for outbound, got %s", fc.Verdict)
 	}
 }
+
+func TestFilterContext_ToAuditRecord_Response(t *testing.T) {
+	raw := []byte(`{"jsonrpc":"2.0","id":7,"error":{"code":-32601,"message":"Method not found"}}`)
+	fc := NewFilterContext(raw, api.DirectionOutbound)
+	fc.Method = "tools/call"
+	fc.Tool = "read_file"
+	fc.CorrelationID = "abc-7"
+	fc.Latency = 42 * time.Millisecond
+	if err := NewOutboundParseFilter().Process(context.Background(), fc); err != nil {
+		t.Fatal(err)
+	}
+	if fc.Method != "tools/call" {
+		t.Errorf("outbound parse should keep the correlated method, got %q", fc.Method)
+	}
+
+	record := fc.ToAuditRecord()
+	if record.Tool != "read_file" || record.CorrelationID != "abc-7" || record.Latency != 42*time.Millisecond {
+		t.Errorf("expected correlated tool, ID and latency, got %+v", record)
+	}
+	if record.ErrorCode != -32601 || record.ErrorMessage != "Method not found" {
+		t.Errorf("expected server error in record, got %d %q", record.ErrorCode, record.ErrorMessage)
+	}
+
+	fc = NewFilterContext([]byte(`{"jsonrpc":"2.0","id":8,"result":{"content":[]}}`), api.DirectionOutbound)
+	if err := NewOutboundParseFilter().Process(context.Background(), fc); err != nil {
+		t.Fatal(err)
+	}
+	if got := fc.ToAuditRecord().ResultSize; got != len(`{"content":[]}`) {
+		t.Errorf("expected result size %d, got %d", len(`{"content":[]}`), got)
+	}
+}
+
+// failingFilter always returns its error.
+type failingFilter struct{ err error }
+
+func (f failingFilter) Name() string { return "failing" }
+func (f failingFilter) Process(context.Context, *FilterContext) error {
+	return f.err
+}
+
+// recordFilter keeps the audit record it would write.
+type recordFilter struct{ record *api.AuditRecord }
+
+func (f *recordFilter) Name() string { return "record" }
+func (f *recordFilter) Process(_ context.Context, fc *FilterContext) error {
+	f.record = fc.ToAuditRecord()
+	return nil
+}
+
+func TestChain_FilterErrorFailsClosed(t *testing.T) {
+	audit := &recordFilter{}
+	chain := NewChain(newTestLogger(), NewParseFilter())
+	chain.Finally(audit)
+
+	fc := NewFilterContext([]byte(`{"jsonrpc":"2.0","id":4,`), api.DirectionInbound)
+	err := chain.Process(context.Background(), fc)
+	var ferr *FilterError
+	if !errors.As(err, &ferr) || ferr.Filter != "parse" {
+		t.Fatalf("expected a parse FilterError, got %v", err)
+	}
+	if fc.Verdict != api.VerdictDeny || fc.ErrorCode != jsonrpc.ErrorCodeParseError {
+		t.Errorf("expected deny with parse error code, got %s %d", fc.Verdict, fc.ErrorCode)
+	}
+	if audit.record == nil || len(audit.record.Tags) != 1 || audit.record.Tags[0] != "filter_error:parse" {
+		t.Fatalf("expected an audit record tagged filter_error:parse, got %+v", audit.record)
+	}
+
+	resp := fc.DenyResponse()
+	if string(resp.ID) != "null" || resp.Error.Code != jsonrpc.ErrorCodeParseError {
+		t.Errorf("expected parse error response with null id, got id %s code %d", resp.ID, resp.Error.Code)
+	}
+
+	// Invalid request keeps its ID
+	fc = NewFilterContext([]byte(`{"jsonrpc":"1.0","id":9,"method":"ping"}`), api.DirectionInbound)
+	chain.Process(context.Background(), fc)
+	if resp := fc.DenyResponse(); string(resp.ID) != "9" || resp.Error.Code != jsonrpc.ErrorCodeInvalidRequest {
+		t.Errorf("expected invalid request response with id 9, got id %s code %d", resp.ID, resp.Error.Code)
+	}
+}
+
+func TestChain_FilterErrorFailsOpen(t *testing.T) {
+	audit := &recordFilter{}
+	chain := NewChain(newTestLogger(), NewParseFilter(), failingFilter{errors.New("state file unreadable")})
+	chain.Finally(audit)
+	chain.SetOnError(OnFilterErrorAllow)
+
+	fc := NewFilterContext([]byte(`{"jsonrpc":"2.0","id":1,"method":"ping"}`), api.DirectionInbound)
+	if err := chain.Process(context.Background(), fc); err == nil {
+		t.Fatal("expected the filter error to be returned")
+	}
+	if fc.Verdict != api.VerdictAllow || fc.Halted {
+		t.Errorf("expected allow when failing open, got %s", fc.Verdict)
+	}
+	if audit.record == nil || audit.record.Tags[0] != "filter_error:failing" {
+		t.Error("expected the failure to be audited")
+	}
+
+	// A message the proxy can't read is denied even when failing open:
+	// Go matches "Name" to the name field too, so the tool call doesn't
+	// parse, but a server matching keys exactly would run write_file
+	engine, err := policy.NewYAMLEngineFromPolicy(&policy.PolicyFile{
+		Version: 1,
+		Rules: []policy.Rule{
+			{Name: "no-writes", Match: policy.RuleMatch{Method: "tools/call", Tool: "write_file"}, Action: "deny"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	policyChain := NewChain(newTestLogger(), NewParseFilter(), NewPolicyFilter(engine))
+	policyChain.SetOnError(OnFilterErrorAllow)
+	fc = NewFilterContext([]byte(`{"jsonrpc":"2.0","id":2,"method":"tools/call","params":{"Name":5,"name":"write_file"}}`), api.DirectionInbound)
+	policyChain.Process(context.Background(), fc)
+	if fc.Verdict != api.VerdictDeny || fc.ErrorCode != jsonrpc.ErrorCodeInvalidParams {
+		t.Errorf("expected an invalid params deny, got %s %d", fc.Verdict, fc.ErrorCode)
+	}
+
+	// Failing closed hides internal error details from the client
+	chain.SetOnError(OnFilterErrorDeny)
+	fc = NewFilterContext([]byte(`{"jsonrpc":"2.0","id":1,"method":"ping"}`), api.DirectionInbound)
+	chain.Process(context.Background(), fc)
+	if fc.ErrorCode != jsonrpc.ErrorCodeInternalError || fc.VerdictMessage != "internal error in failing filter" {
+		t.Errorf("expected internal error, got %d %q", fc.ErrorCode, fc.VerdictMessage)
+	}
+}
+
+// holdFilter holds every request for wait.
+type holdFilter struct{ wait time.Duration }
+
+func (f holdFilter) Name() string { return "hold" }
+func (f holdFilter) Process(_ context.Context, fc *FilterContext) error {
+	fc.Hold(f.Name(), func(context.Context, *FilterContext) error {
+		time.Sleep(f.wait)
+		fc.Delay = f.wait
+		return nil
+	})
+	return nil
+}
+
+func TestChain_AdmitHeld(t *testing.T) {
+	audit := &recordFilter{}
+	chain := NewChain(newTestLogger(), NewParseFilter(), holdFilter{wait: 10 * time.Millisecond})
+	chain.Finally(audit)
+
+	fc := NewFilterContext([]byte(`{"jsonrpc":"2.0","id":1,"method":"ping"}`), api.DirectionInbound)
+	if err := chain.Process(context.Background(), fc); err != nil {
+		t.Fatal(err)
+	}
+	if !fc.Held() || audit.record != nil {
+		t.Fatal("held request should be audited once admitted, not in Process")
+	}
+	if err := chain.Admit(context.Background(), fc); err != nil {
+		t.Fatal(err)
+	}
+	if fc.Held() || audit.record == nil || audit.record.Delay != 10*time.Millisecond {
+		t.Fatalf("expected an audit record with the wait, got %+v", audit.record)
+	}
+
+	// Cancelled while held: denied, and still audited
+	audit.record = nil
+	fc = NewFilterContext([]byte(`{"jsonrpc":"2.0","id":2,"method":"ping"}`), api.DirectionInbound)
+	chain.Process(context.Background(), fc)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	fc.Hold("cancelled", func(ctx context.Context, _ *FilterContext) error { return ctx.Err() })
+	if err := chain.Admit(ctx, fc); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected the context error, got %v", err)
+	}
+	if fc.Verdict != api.VerdictDeny || audit.record == nil || audit.record.Verdict != api.VerdictDeny {
+		t.Errorf("request cancelled while held should be denied and audited, got %s", fc.Verdict)
+	}
+}
@@ -0,0 +1,318 @@
+package filter
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/tkingovr/agent-guard/api"
+	"github.com/tkingovr/agent-guard/internal/jsonrpc"
+)
+
+// OnExceedQueue holds a call over the concurrency limit until a slot frees.
+const OnExceedQueue = "queue"
+
+// defaultQueueWait bounds how long queue mode holds a call for a free slot.
+const defaultQueueWait = 30 * time.Second
+
+// defaultMaxHold bounds how long a call keeps its slot without a response.
+const defaultMaxHold = 10 * time.Minute
+
+// ruleDuplicateID denies a call reusing the ID of one still in flight.
+const ruleDuplicateID = "concurrency:duplicate_id"
+
+// ConcurrencyConfig limits how many tool calls may be in flight at once.
+type ConcurrencyConfig struct {
+	// Global is the maximum number of in-flight tool calls. Zero means no
+	// global limit.
+	Global int
+
+	// PerTool maps tool names to their maximum in-flight calls.
+	PerTool map[string]int
+
+	// OnExceed is deny (default) or queue. Queue mode holds the call until
+	// a slot frees up, for at most MaxWait.
+	OnExceed string
+
+	// MaxWait is the longest a call is queued. Default is 30s.
+	MaxWait time.Duration
+
+	// MaxHold is the longest a call keeps its slot without a response, as
+	// a server may drop a request. Default is 10m.
+	MaxHold time.Duration
+}
+
+// ConcurrencyLimiter tracks in-flight tool calls. It is shared by the
+// inbound chain, which acquires a slot, and the outbound chain, which
+// releases it when the response arrives.
+type ConcurrencyLimiter struct {
+	cfg ConcurrencyConfig
+
+	mu        sync.Mutex
+	inflight  map[string]*slot  // slot key → call
+	byRequest map[string]string // session + ID → slot key
+	byTool    map[string]int
+	freed     chan struct{} // closed and replaced whenever a slot is released
+}
+
+// slot is an in-flight call.
+type slot struct {
+	tool    string
+	request string // session + ID, "" without a session
+	start   time.Time
+}
+
+// NewConcurrencyLimiter creates a concurrency limiter.
+func NewConcurrencyLimiter(cfg ConcurrencyConfig) *ConcurrencyLimiter {
+	if cfg.MaxWait <= 0 {
+		cfg.MaxWait = defaultQueueWait
+	}
+	if cfg.MaxHold <= 0 {
+		cfg.MaxHold = defaultMaxHold
+	}
+	return &ConcurrencyLimiter{
+		cfg:       cfg,
+		inflight:  make(map[string]*slot),
+		byRequest: make(map[string]string),
+		byTool:    make(map[string]int),
+		freed:     make(chan struct{}),
+	}
+}
+
+// InFlight returns the number of in-flight tool calls per tool.
+func (l *ConcurrencyLimiter) InFlight() map[string]int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	out := make(map[string]int, len(l.byTool))
+	for tool, n := range l.byTool {
+		out[tool] = n
+	}
+	return out
+}
+
+// tryAcquire takes the slot key for a call to tool if one is free.
+// Otherwise it returns the rule and message of the limit that blocked it,
+// and a channel closed when a slot is next released. request is the
+// call's session and ID, which no other call in flight may share.
+func (l *ConcurrencyLimiter) tryAcquire(key, request, tool string) (rule, message string, freed <-chan struct{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	_, dup := l.inflight[key]
+	if _, ok := l.byRequest[request]; ok && request != "" {
+		dup = true
+	}
+	if dup {
+		return ruleDuplicateID, "request ID is already in use by a call in flight", nil
+	}
+	l.expire(time.Now())
+	if rule, message = l.blocked(tool); rule != "" {
+		return rule, message, l.freed
+	}
+	l.inflight[key] = &slot{tool: tool, request: request, start: time.Now()}
+	if request != "" {
+		l.byRequest[request] = key
+	}
+	l.byTool[tool]++
+	return "", "", nil
+}
+
+// acquire takes a slot for the call, queueing if configured. It returns
+// the rule and message of the limit that blocked it, or "" on success.
+func (l *ConcurrencyLimiter) acquire(ctx context.Context, key, request, tool string) (rule, message string, err error) {
+	deadline := time.Now().Add(l.cfg.MaxWait)
+	for {
+		rule, message, freed := l.tryAcquire(key, request, tool)
+		if rule == "" {
+			return "", "", nil
+		}
+
+		remaining := time.Until(deadline)
+		if l.cfg.OnExceed != OnExceedQueue || freed == nil || remaining <= 0 {
+			return rule, message, nil
+		}
+		timer := time.NewTimer(remaining)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return "", "", ctx.Err()
+		case <-timer.C:
+		case <-freed:
+			timer.Stop()
+		}
+	}
+}
+
+// blocked returns the limit a new call to tool would exceed. Callers must
+// hold l.mu.
+func (l *ConcurrencyLimiter) blocked(tool string) (rule, message string) {
+	if max, ok := l.cfg.PerTool[tool]; ok && l.byTool[tool] >= max {
+		return "concurrency:" + tool, fmt.Sprintf("too many concurrent calls to tool %q: max %d in flight", tool, max)
+	}
+	if l.cfg.Global > 0 && len(l.inflight) >= l.cfg.Global {
+		return "concurrency:global", fmt.Sprintf("too many concurrent tool calls: max %d in flight", l.cfg.Global)
+	}
+	return "", ""
+}
+
+// expire frees the slots of calls in flight longer than MaxHold, whose
+// responses are presumably never coming. Callers must hold l.mu.
+func (l *ConcurrencyLimiter) expire(now time.Time) {
+	for key, s := range l.inflight {
+		if now.Sub(s.start) > l.cfg.MaxHold {
+			l.free(key, s)
+		}
+	}
+}
+
+// release frees the slot key, if held.
+func (l *ConcurrencyLimiter) release(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if s, ok := l.inflight[key]; ok {
+		l.free(key, s)
+	}
+}
+
+// cancel frees the slot of the call request (session and ID), if held.
+func (l *ConcurrencyLimiter) cancel(request string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if key, ok := l.byRequest[request]; ok {
+		l.free(key, l.inflight[key])
+	}
+}
+
+// free releases slot s held by key. Callers must hold l.mu.
+func (l *ConcurrencyLimiter) free(key string, s *slot) {
+	delete(l.inflight, key)
+	if s.request != "" {
+		delete(l.byRequest, s.request)
+	}
+	if l.byTool[s.tool]--; l.byTool[s.tool] <= 0 {
+		delete(l.byTool, s.tool)
+	}
+	close(l.freed)
+	l.freed = make(chan struct{})
+}
+
+// ConcurrencyFilter enforces max in-flight tool calls. Inbound it takes a
+// slot for each tools/call request, or for one pending approval or
+// queued, in Chain.Admit; outbound it frees the slot when the matching
+// response arrives. Proxies call FilterContext.Finish for
+// requests that never reach the server, or once a synchronous (HTTP)
+// exchange is over. A notifications/cancelled frees the slot too, as the
+// server needn't answer a cancelled request.
+type ConcurrencyFilter struct {
+	limiter *ConcurrencyLimiter
+}
+
+// NewConcurrencyFilter creates a filter backed by a shared limiter.
+func NewConcurrencyFilter(l *ConcurrencyLimiter) *ConcurrencyFilter {
+	return &ConcurrencyFilter{limiter: l}
+}
+
+func (f *ConcurrencyFilter) Name() string { return "concurrency" }
+
+func (f *ConcurrencyFilter) Process(ctx context.Context, fc *FilterContext) error {
+	if fc.Message == nil {
+		return nil
+	}
+	if fc.Direction == api.DirectionOutbound {
+		if fc.Message.IsResponse() {
+			f.limiter.release(slotKey(fc))
+		}
+		return nil
+	}
+	// Whatever the policy says about the notification itself
+	if id := jsonrpc.CancelledRequestID(fc.Message); id != nil {
+		if request := requestKey(fc.SessionID, id); request != "" {
+			f.limiter.cancel(request)
+		}
+		return nil
+	}
+	if fc.Method != "tools/call" || !fc.Message.IsRequest() {
+		return nil
+	}
+	if fc.Halted && fc.Verdict != api.VerdictAsk {
+		return nil
+	}
+
+	if fc.Verdict != api.VerdictAsk && !fc.Held() {
+		key := slotKey(fc)
+		rule, message, _ := f.limiter.tryAcquire(key, requestKey(fc.SessionID, fc.Message.ID), fc.Tool)
+		if rule == "" {
+			fc.OnFinish(func() { f.limiter.release(key) })
+			return nil
+		}
+		if f.limiter.cfg.OnExceed != OnExceedQueue || rule == ruleDuplicateID {
+			f.deny(fc, rule, message)
+			return nil
+		}
+	}
+
+	// An asked call takes its slot once approved, not while a human
+	// decides; a held or queued one once its wait is over, off the
+	// proxy's read loop
+	fc.Hold(f.Name(), f.acquire)
+	return nil
+}
+
+// acquire takes the slot for a held call, queueing if configured.
+func (f *ConcurrencyFilter) acquire(ctx context.Context, fc *FilterContext) error {
+	key := slotKey(fc)
+	start := time.Now()
+	rule, message, err := f.limiter.acquire(ctx, key, requestKey(fc.SessionID, fc.Message.ID), fc.Tool)
+	if err != nil {
+		return err
+	}
+	waited := time.Since(start)
+	if rule != "" {
+		f.deny(fc, rule, message)
+		return nil
+	}
+
+	if f.limiter.cfg.OnExceed == OnExceedQueue && waited > time.Millisecond {
+		if fc.Delay == 0 {
+			fc.Tags = append(fc.Tags, TagThrottled)
+		}
+		fc.Delay += waited
+	}
+	fc.OnFinish(func() { f.limiter.release(key) })
+	return nil
+}
+
+// deny denies a call over the limit rule, or reusing an ID in flight.
+func (f *ConcurrencyFilter) deny(fc *FilterContext, rule, message string) {
+	fc.Verdict = api.VerdictDeny
+	fc.MatchedRule = rule
+	fc.VerdictMessage = message
+	fc.Halted = true
+	if rule == ruleDuplicateID {
+		fc.ErrorCode = jsonrpc.ErrorCodeInvalidRequest
+	}
+}
+
+// slotKey identifies the slot of the call fc, or of the call the response
+// fc answers. The correlation ID is unique to each request the proxy
+// handles, so clients that can't be told apart (HTTP ones without a
+// session) never share a slot by sending the same JSON-RPC ID.
+func slotKey(fc *FilterContext) string {
+	if fc.CorrelationID != "" {
+		return fc.CorrelationID
+	}
+	return inflightKey(fc.SessionID, fc.Message.ID)
+}
+
+// requestKey identifies a request by session and JSON-RPC ID, or is ""
+// without a session, as then the client isn't known.
+func requestKey(session string, id []byte) string {
+	if session == "" {
+		return ""
+	}
+	return inflightKey(session, id)
+}
+
+func inflightKey(session string, id []byte) string {
+	return session + "\x00" + string(id)
+}
@@ -0,0 +1,288 @@
+package filter
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/tkingovr/agent-guard/api"
+	"github.com/tkingovr/agent-guard/internal/jsonrpc"
+)
+
+func concurrencyCall(t *testing.T, f *ConcurrencyFilter, id int, tool string) *FilterContext {
+	t.Helper()
+	raw := fmt.Sprintf(`{"jsonrpc":"2.0","id":%d,"method":"tools/call","params":{"name":%q,"arguments":{}}}`, id, tool)
+	fc := NewFilterContext([]byte(raw), api.DirectionInbound)
+	if err := NewParseFilter().Process(context.Background(), fc); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Process(context.Background(), fc); err != nil {
+		t.Fatal(err)
+	}
+	if err := NewChain(newTestLogger()).Admit(context.Background(), fc); err != nil {
+		t.Fatal(err)
+	}
+	return fc
+}
+
+func concurrencyResponse(t *testing.T, f *ConcurrencyFilter, id int) {
+	t.Helper()
+	raw := fmt.Sprintf(`{"jsonrpc":"2.0","id":%d,"result":{"content":[]}}`, id)
+	fc := NewFilterContext([]byte(raw), api.DirectionOutbound)
+	if err := NewOutboundParseFilter().Process(context.Background(), fc); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Process(context.Background(), fc); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestConcurrency_PerToolLimit(t *testing.T) {
+	l := NewConcurrencyLimiter(ConcurrencyConfig{PerTool: map[string]int{"run_build": 1}})
+	f := NewConcurrencyFilter(l)
+
+	if fc := concurrencyCall(t, f, 1, "run_build"); fc.Halted {
+		t.Fatal("first build should be allowed")
+	}
+	fc := concurrencyCall(t, f, 2, "run_build")
+	if !fc.Halted || fc.MatchedRule != "concurrency:run_build" {
+		t.Fatalf("second concurrent build should be denied, got %q", fc.MatchedRule)
+	}
+	if fc := concurrencyCall(t, f, 3, "read_file"); fc.Halted {
+		t.Error("other tools should not be limited")
+	}
+	if n := l.InFlight()["run_build"]; n != 1 {
+		t.Errorf("expected 1 build in flight, got %d", n)
+	}
+
+	concurrencyResponse(t, f, 1)
+	if n := l.InFlight()["run_build"]; n != 0 {
+		t.Errorf("response should free the slot, %d in flight", n)
+	}
+	if fc := concurrencyCall(t, f, 4, "run_build"); fc.Halted {
+		t.Error("build should be allowed once the first finished")
+	}
+}
+
+func TestConcurrency_GlobalLimit(t *testing.T) {
+	f := NewConcurrencyFilter(NewConcurrencyLimiter(ConcurrencyConfig{Global: 2}))
+
+	concurrencyCall(t, f, 1, "a")
+	concurrencyCall(t, f, 2, "b")
+	if fc := concurrencyCall(t, f, 3, "c"); fc.MatchedRule != "concurrency:global" {
+		t.Errorf("third call should hit the global limit, got %q", fc.MatchedRule)
+	}
+}
+
+func TestConcurrency_FinishReleases(t *testing.T) {
+	l := NewConcurrencyLimiter(ConcurrencyConfig{Global: 1})
+	f := NewConcurrencyFilter(l)
+
+	// A request the proxy never forwards (e.g. denied by an approver)
+	fc := concurrencyCall(t, f, 1, "a")
+	fc.Finish()
+	fc.Finish()
+	if len(l.InFlight()) != 0 {
+		t.Error("Finish should free the slot")
+	}
+	if fc := concurrencyCall(t, f, 2, "a"); fc.Halted {
+		t.Error("slot should be available again")
+	}
+}
+
+func TestConcurrency_QueueMode(t *testing.T) {
+	l := NewConcurrencyLimiter(ConcurrencyConfig{
+		PerTool:  map[string]int{"run_build": 1},
+		OnExceed: OnExceedQueue,
+		MaxWait:  time.Second,
+	})
+	f := NewConcurrencyFilter(l)
+	concurrencyCall(t, f, 1, "run_build")
+
+	go func() {
+		time.Sleep(30 * time.Millisecond)
+		l.release(inflightKey("", []byte("1")))
+	}()
+
+	raw := `{"jsonrpc":"2.0","id":2,"method":"tools/call","params":{"name":"run_build","arguments":{}}}`
+	fc := NewFilterContext([]byte(raw), api.DirectionInbound)
+	NewParseFilter().Process(context.Background(), fc)
+	f.Process(context.Background(), fc)
+	if !fc.Held() {
+		t.Fatal("call over the limit should be queued in Admit, not in Process")
+	}
+	if err := NewChain(newTestLogger()).Admit(context.Background(), fc); err != nil || fc.Halted {
+		t.Fatalf("queued call should run once the slot frees, got %v, %q", err, fc.VerdictMessage)
+	}
+	if fc.Delay < 20*time.Millisecond {
+		t.Errorf("expected the call to be held, delay was %s", fc.Delay)
+	}
+}
+
+func TestConcurrency_QueueTimeout(t *testing.T) {
+	l := NewConcurrencyLimiter(ConcurrencyConfig{
+		Global:   1,
+		OnExceed: OnExceedQueue,
+		MaxWait:  20 * time.Millisecond,
+	})
+	f := NewConcurrencyFilter(l)
+	concurrencyCall(t, f, 1, "a")
+
+	if fc := concurrencyCall(t, f, 2, "b"); !fc.Halted {
+		t.Error("call should be denied after max_wait")
+	}
+}
+
+func TestConcurrency_AskTakesSlotOnceApproved(t *testing.T) {
+	l := NewConcurrencyLimiter(ConcurrencyConfig{Global: 1})
+	f := NewConcurrencyFilter(l)
+	chain := NewChain(newTestLogger())
+
+	asked := func(id int) *FilterContext {
+		raw := fmt.Sprintf(`{"jsonrpc":"2.0","id":%d,"method":"tools/call","params":{"name":"deploy","arguments":{}}}`, id)
+		fc := NewFilterContext([]byte(raw), api.DirectionInbound)
+		if err := NewParseFilter().Process(context.Background(), fc); err != nil {
+			t.Fatal(err)
+		}
+		fc.Verdict = api.VerdictAsk
+		fc.Halted = true
+		if err := f.Process(context.Background(), fc); err != nil {
+			t.Fatal(err)
+		}
+		return fc
+	}
+
+	// No slot is held while a human decides
+	fc := asked(1)
+	if len(l.InFlight()) != 0 || !fc.Held() {
+		t.Fatal("call pending approval should not hold a slot")
+	}
+	concurrencyCall(t, f, 2, "build")
+
+	// Approved with the limit reached
+	if err := chain.Admit(context.Background(), fc); err != nil {
+		t.Fatal(err)
+	}
+	if fc.Verdict != api.VerdictDeny || fc.MatchedRule != "concurrency:global" {
+		t.Fatalf("approved call over the limit should be denied, got %s %q", fc.Verdict, fc.MatchedRule)
+	}
+
+	concurrencyResponse(t, f, 2)
+	fc = asked(3)
+	if err := chain.Admit(context.Background(), fc); err != nil {
+		t.Fatal(err)
+	}
+	if fc.Verdict == api.VerdictDeny {
+		t.Fatalf("approved call should take the free slot, got %q", fc.MatchedRule)
+	}
+	if n := l.InFlight()["deploy"]; n != 1 {
+		t.Fatalf("expected the approved call in flight, got %d", n)
+	}
+	fc.Finish()
+	if len(l.InFlight()) != 0 {
+		t.Error("Finish should free the approved call's slot")
+	}
+}
+
+// concurrencyExchange sends raw through the filter as the proxies do, with
+// a session and correlation ID.
+func concurrencyExchange(t *testing.T, f *ConcurrencyFilter, dir api.Direction, session, correlation, raw string) *FilterContext {
+	t.Helper()
+	fc := NewFilterContext([]byte(raw), dir)
+	fc.SessionID = session
+	fc.CorrelationID = correlation
+	parse := Filter(NewParseFilter())
+	if dir == api.DirectionOutbound {
+		parse = NewOutboundParseFilter()
+	}
+	if err := parse.Process(context.Background(), fc); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Process(context.Background(), fc); err != nil {
+		t.Fatal(err)
+	}
+	if err := NewChain(newTestLogger()).Admit(context.Background(), fc); err != nil {
+		t.Fatal(err)
+	}
+	return fc
+}
+
+const concurrencyCallOne = `{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"a","arguments":{}}}`
+
+func TestConcurrency_CancelWithoutResponse(t *testing.T) {
+	l := NewConcurrencyLimiter(ConcurrencyConfig{Global: 1})
+	f := NewConcurrencyFilter(l)
+
+	concurrencyExchange(t, f, api.DirectionInbound, "s1", "c1", concurrencyCallOne)
+	concurrencyExchange(t, f, api.DirectionInbound, "s1", "c2",
+		`{"jsonrpc":"2.0","method":"notifications/cancelled","params":{"requestId":1}}`)
+	if len(l.InFlight()) != 0 {
+		t.Fatal("cancellation should free the slot, the server needn't answer")
+	}
+
+	// The server never answers; the next call gets the slot
+	fc := concurrencyExchange(t, f, api.DirectionInbound, "s1", "c3",
+		`{"jsonrpc":"2.0","id":2,"method":"tools/call","params":{"name":"a","arguments":{}}}`)
+	if fc.Halted {
+		t.Fatalf("call after a cancellation should be allowed, got %q", fc.MatchedRule)
+	}
+}
+
+func TestConcurrency_MaxHoldExpiresSlot(t *testing.T) {
+	l := NewConcurrencyLimiter(ConcurrencyConfig{Global: 1, MaxHold: 20 * time.Millisecond})
+	f := NewConcurrencyFilter(l)
+
+	concurrencyExchange(t, f, api.DirectionInbound, "s1", "c1", concurrencyCallOne)
+	time.Sleep(30 * time.Millisecond)
+	fc := concurrencyExchange(t, f, api.DirectionInbound, "s1", "c2",
+		`{"jsonrpc":"2.0","id":2,"method":"tools/call","params":{"name":"a","arguments":{}}}`)
+	if fc.Halted {
+		t.Fatalf("slot held past max_hold should be freed, got %q", fc.MatchedRule)
+	}
+}
+
+func TestConcurrency_DuplicateIDInvalid(t *testing.T) {
+	l := NewConcurrencyLimiter(ConcurrencyConfig{Global: 4})
+	f := NewConcurrencyFilter(l)
+
+	first := concurrencyExchange(t, f, api.DirectionInbound, "s1", "c1", concurrencyCallOne)
+	fc := concurrencyExchange(t, f, api.DirectionInbound, "s1", "c2", concurrencyCallOne)
+	if !fc.Halted || fc.ErrorCode != jsonrpc.ErrorCodeInvalidRequest {
+		t.Fatalf("reused ID should be an invalid request, got %q (%d)", fc.MatchedRule, fc.ErrorCode)
+	}
+	fc.Finish()
+	if n := l.InFlight()["a"]; n != 1 {
+		t.Fatalf("denied duplicate must not free the original slot, %d in flight", n)
+	}
+
+	first.Finish()
+	if fc := concurrencyExchange(t, f, api.DirectionInbound, "s1", "c3", concurrencyCallOne); fc.Halted {
+		t.Errorf("ID should be reusable once its call finished, got %q", fc.MatchedRule)
+	}
+}
+
+func TestConcurrency_SessionlessClientsShareIDs(t *testing.T) {
+	l := NewConcurrencyLimiter(ConcurrencyConfig{Global: 2})
+	f := NewConcurrencyFilter(l)
+
+	// Two HTTP clients without Mcp-Session-Id, both sending id 1
+	a := concurrencyExchange(t, f, api.DirectionInbound, "", "c1", concurrencyCallOne)
+	b := concurrencyExchange(t, f, api.DirectionInbound, "", "c2", concurrencyCallOne)
+	if a.Halted || b.Halted {
+		t.Fatalf("separate exchanges should each take a slot, got %q / %q", a.MatchedRule, b.MatchedRule)
+	}
+	if n := l.InFlight()["a"]; n != 2 {
+		t.Fatalf("expected 2 in flight, got %d", n)
+	}
+
+	concurrencyExchange(t, f, api.DirectionOutbound, "", "c1", `{"jsonrpc":"2.0","id":1,"result":{}}`)
+	a.Finish()
+	if n := l.InFlight()["a"]; n != 1 {
+		t.Fatalf("first exchange should free only its own slot, %d in flight", n)
+	}
+	b.Finish()
+	if len(l.InFlight()) != 0 {
+		t.Error("second exchange should free its slot")
+	}
+}
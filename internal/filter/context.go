@@ -1,10 +1,14 @@
 package filter
 
 import (
+	"context"
 	"encoding/json"
+	"fmt"
 	"time"
 
 	"github.com/tkingovr/agent-guard/api"
+	"github.com/tkingovr/agent-guard/internal/jsonrpc"
+	"github.com/tkingovr/agent-guard/internal/policy"
 )
 
 // FilterContext carries all metadata through the filter chain for a single message.
@@ -27,12 +31,31 @@ type FilterContext struct {
 	// Arguments is the raw JSON arguments for tools/call requests.
 	Arguments json.RawMessage
 
+	// SessionID identifies the client session (set by the proxy).
+	SessionID string
+
+	// ClientName is the client's name from initialize (set by ParseFilter
+	// on initialize, then carried by the proxy for the session).
+	ClientName string
+
+	// Server names the MCP server the message is for or from, when the
+	// proxy fronts several (set by the proxy).
+	Server string
+
+	// Principal is the authenticated caller, if the proxy authenticates
+	// clients (set by the proxy).
+	Principal *api.Principal
+
 	// Verdict is set by the PolicyFilter after evaluation.
 	Verdict api.Verdict
 
 	// MatchedRule is the name of the rule that matched.
 	MatchedRule string
 
+	// PolicyRule is the policy rule that matched, kept even if a later
+	// filter overrides MatchedRule.
+	PolicyRule string
+
 	// VerdictMessage is the human-readable message from the matched rule.
 	VerdictMessage string
 
@@ -41,6 +64,59 @@ type FilterContext struct {
 
 	// Halted indicates the pipeline should stop (deny/ask was decided).
 	Halted bool
+
+	// Rewritten holds the re-encoded message when a filter modified it in
+	// flight (e.g., stripping injected text). Nil means forward Raw as-is.
+	Rewritten []byte
+
+	// Secrets holds values flagged by the secret scanner so the redaction
+	// stage can mask them. Never written to the audit log.
+	Secrets []string
+
+	// Response, if set, is a reply the proxy sends back to the client in
+	// place of forwarding the request (e.g., a decoy resource).
+	Response []byte
+
+	// Tags are audit markers (e.g., "honeytoken") for records that need
+	// attention beyond their verdict.
+	Tags []string
+
+	// ErrorCode and ErrorData override the JSON-RPC error sent back for a
+	// deny. Zero means ErrorCodePolicyDenied with no data.
+	ErrorCode int
+	ErrorData json.RawMessage
+
+	// Budget is the session's budget consumption, passed to the policy
+	// engine (set by BudgetFilter).
+	Budget *policy.BudgetUsage
+
+	// CorrelationID links a request to its response in the audit log (set
+	// by the proxy).
+	CorrelationID string
+
+	// Latency is the time from the request entering the proxy to its
+	// response arriving (set by the proxy on responses).
+	Latency time.Duration
+
+	// Delay is how long the request was held before being let through
+	// (e.g., by rate limit throttling).
+	Delay time.Duration
+
+	// finish holds cleanups for resources the request holds until it is
+	// done (e.g., a concurrency slot).
+	finish []func()
+
+	// holds are waits filters deferred until the proxy admits the request
+	// (see Chain.Admit).
+	holds []hold
+
+	// unaudited means Process left the finally filters to Admit.
+	unaudited bool
+
+	// AuditArguments is the redacted form of Arguments for the audit log,
+	// dashboard, and approval queue (set by RedactionFilter). Nil means
+	// Arguments is used as-is.
+	AuditArguments json.RawMessage
 }
 
 // NewFilterContext creates a new FilterContext for a raw message.
@@ -52,18 +128,155 @@ func NewFilterContext(raw []byte, direction api.Direction) *FilterContext {
 	}
 }
 
+// Output returns the bytes the proxy should forward: the rewritten message if
+// a filter modified it, otherwise the original raw bytes.
+func (fc *FilterContext) Output() []byte {
+	if fc.Rewritten != nil {
+		return fc.Rewritten
+	}
+	return fc.Raw
+}
+
+// RewriteResult replaces the result of a response message and re-encodes it
+// into Rewritten.
+func (fc *FilterContext) RewriteResult(result any) error {
+	if fc.Message == nil {
+		return fmt.Errorf("no parsed message to rewrite")
+	}
+	data, err := json.Marshal(result)
+	if err != nil {
+		return fmt.Errorf("encoding rewritten result: %w", err)
+	}
+	fc.Message.Result = data
+	out, err := json.Marshal(fc.Message)
+	if err != nil {
+		return fmt.Errorf("encoding rewritten message: %w", err)
+	}
+	fc.Rewritten = out
+	return nil
+}
+
+// RewriteParams replaces the params of a request message and re-encodes it
+// into Rewritten. For tools/call, Arguments is refreshed from the new params.
+func (fc *FilterContext) RewriteParams(params any) error {
+	if fc.Message == nil {
+		msg, err := jsonrpc.Parse(fc.Raw)
+		if err != nil {
+			return err
+		}
+		fc.Message = msg
+	}
+	data, err := json.Marshal(params)
+	if err != nil {
+		return fmt.Errorf("encoding rewritten params: %w", err)
+	}
+	fc.Message.Params = data
+	out, err := json.Marshal(fc.Message)
+	if err != nil {
+		return fmt.Errorf("encoding rewritten message: %w", err)
+	}
+	fc.Rewritten = out
+
+	if fc.Message.Method == "tools/call" {
+		tc, err := jsonrpc.ExtractToolCall(fc.Message)
+		if err != nil {
+			return err
+		}
+		fc.Arguments = tc.Arguments
+	}
+	return nil
+}
+
+// hold is a wait a filter deferred to Chain.Admit.
+type hold struct {
+	filter string
+	fn     func(context.Context, *FilterContext) error
+}
+
+// Hold defers fn until the proxy admits the request with Chain.Admit, so a
+// request that must wait (e.g., for a rate limit window or a concurrency
+// slot) doesn't hold up the client's other messages. fn may block until
+// ctx is done, and may deny the request.
+func (fc *FilterContext) Hold(filter string, fn func(context.Context, *FilterContext) error) {
+	fc.holds = append(fc.holds, hold{filter: filter, fn: fn})
+}
+
+// Held reports whether the request has waits left for Chain.Admit.
+func (fc *FilterContext) Held() bool {
+	return len(fc.holds) > 0
+}
+
+// OnFinish registers fn to run when the proxy calls Finish.
+func (fc *FilterContext) OnFinish(fn func()) {
+	fc.finish = append(fc.finish, fn)
+}
+
+// Finish releases anything the request holds. Proxies call it when the
+// request will get no response from the server (denied or answered
+// locally), or once a synchronous exchange has completed. It is safe to
+// call more than once.
+func (fc *FilterContext) Finish() {
+	fns := fc.finish
+	fc.finish = nil
+	for _, fn := range fns {
+		fn()
+	}
+}
+
+// DenyResponse builds the JSON-RPC error returned to the client when the
+// message is denied, using ErrorCode and ErrorData if a filter set them.
+func (fc *FilterContext) DenyResponse() *api.JSONRPCMessage {
+	id := jsonrpc.RequestID(fc.Raw)
+	if fc.Message != nil {
+		id = fc.Message.ID
+	}
+	msg := fc.VerdictMessage
+	if msg == "" {
+		msg = "request denied by policy"
+	}
+	if fc.ErrorCode == 0 {
+		return jsonrpc.NewDenyResponse(id, msg)
+	}
+	return jsonrpc.NewErrorResponse(id, fc.ErrorCode, msg, fc.ErrorData)
+}
+
+// DisplayArguments returns the arguments safe to show outside the proxy:
+// the redacted form if the redaction stage ran, otherwise Arguments.
+func (fc *FilterContext) DisplayArguments() json.RawMessage {
+	if fc.AuditArguments != nil {
+		return fc.AuditArguments
+	}
+	return fc.Arguments
+}
+
 // ToAuditRecord converts the filter context into an audit record.
 func (fc *FilterContext) ToAuditRecord() *api.AuditRecord {
-	return &api.AuditRecord{
+	record := &api.AuditRecord{
 		Timestamp: fc.StartTime,
 		Direction: fc.Direction,
 		Method:    fc.Method,
 		Tool:      fc.Tool,
-		Arguments: fc.Arguments,
+		Session:   fc.SessionID,
+		Server:    fc.Server,
+		Arguments: fc.DisplayArguments(),
 		Verdict:   fc.Verdict,
 		Rule:      fc.MatchedRule,
 		Message:   fc.VerdictMessage,
+		Tags:      fc.Tags,
 		RawSize:   len(fc.Raw),
 		Duration:  time.Since(fc.StartTime),
+		Delay:     fc.Delay,
+		Principal: fc.Principal,
+
+		CorrelationID: fc.CorrelationID,
+		Latency:       fc.Latency,
+	}
+	if fc.Direction == api.DirectionOutbound && fc.Message != nil && fc.Message.IsResponse() {
+		if fc.Message.Error != nil {
+			record.ErrorCode = fc.Message.Error.Code
+			record.ErrorMessage = fc.Message.Error.Message
+		}
+		record.ResultSize = len(fc.Message.Result)
 	}
+	return record
 }
@@ -0,0 +1,168 @@
+package filter
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"encoding/hex"
+	"io"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	// maxDecodeDepth bounds how many encoding layers are peeled off a value.
+	maxDecodeDepth = 3
+	// minEncodedLength is the shortest token worth trying to decode.
+	minEncodedLength = 16
+	// maxDecodedSize caps decompressed output to avoid gzip bombs.
+	maxDecodedSize = 1 << 20
+)
+
+var (
+	base64Re  = regexp.MustCompile(`^[A-Za-z0-9+/]+={0,2}$`)
+	base64URL = regexp.MustCompile(`^[A-Za-z0-9_\-]+={0,2}$`)
+	hexRe     = regexp.MustCompile(`^(?:[0-9a-fA-F]{2})+$`)
+	percentRe = regexp.MustCompile(`%[0-9a-fA-F]{2}`)
+)
+
+// decodedForm is a plaintext reached by peeling one or more encoding
+// layers off a token. Via lists the layers outermost first.
+type decodedForm struct {
+	text string
+	via  []string
+}
+
+// decodeLayers returns every printable form of s reachable within
+// maxDecodeDepth decoding steps. s itself is not included.
+func decodeLayers(s string) []decodedForm {
+	var out []decodedForm
+	seen := map[string]bool{s: true}
+
+	var visit func(text string, via []string)
+	visit = func(text string, via []string) {
+		if len(via) >= maxDecodeDepth {
+			return
+		}
+		for _, step := range decodeOnce(text) {
+			if seen[step.text] {
+				continue
+			}
+			seen[step.text] = true
+			path := append(append([]string(nil), via...), step.via...)
+			out = append(out, decodedForm{text: step.text, via: path})
+			visit(step.text, path)
+		}
+	}
+	visit(s, nil)
+	return out
+}
+
+// decodeOnce tries each supported encoding on s and returns the forms that
+// decode cleanly to printable text.
+func decodeOnce(s string) []decodedForm {
+	var out []decodedForm
+	add := func(data []byte, via ...string) {
+		// Compressed payloads are common inside base64; unwrap them here so
+		// the layer is reported as e.g. "base64 > gzip".
+		if len(data) > 2 && data[0] == 0x1f && data[1] == 0x8b {
+			if plain, ok := gunzip(data); ok {
+				data, via = plain, append(via, "gzip")
+			}
+		}
+		if printable(data) {
+			out = append(out, decodedForm{text: string(data), via: via})
+		}
+	}
+
+	if strings.Contains(s, `\u`) || strings.Contains(s, `\x`) {
+		if unq, err := strconv.Unquote(`"` + strings.ReplaceAll(s, `"`, `\"`) + `"`); err == nil && unq != s {
+			add([]byte(unq), "escape")
+		}
+	}
+
+	if percentRe.MatchString(s) {
+		if unesc, err := url.QueryUnescape(s); err == nil && unesc != s {
+			add([]byte(unesc), "url")
+		}
+	}
+
+	if len(s) < minEncodedLength {
+		return out
+	}
+
+	if hexRe.MatchString(s) {
+		if data, err := hex.DecodeString(s); err == nil {
+			add(data, "hex")
+		}
+		// Long hex strings are also valid base64; don't decode them twice.
+		return out
+	}
+
+	trimmed := strings.TrimRight(s, "=")
+	switch {
+	case base64Re.MatchString(s):
+		if data, err := base64.RawStdEncoding.DecodeString(trimmed); err == nil {
+			add(data, "base64")
+		}
+	case base64URL.MatchString(s):
+		if data, err := base64.RawURLEncoding.DecodeString(trimmed); err == nil {
+			add(data, "base64url")
+		}
+	}
+	return out
+}
+
+func gunzip(data []byte) ([]byte, bool) {
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, false
+	}
+	defer zr.Close()
+	plain, err := io.ReadAll(io.LimitReader(zr, maxDecodedSize))
+	if err != nil && len(plain) == 0 {
+		return nil, false
+	}
+	return plain, true
+}
+
+// printable reports whether data looks like text: valid UTF-8 with at most
+// a small fraction of control characters.
+func printable(data []byte) bool {
+	if len(data) == 0 || !utf8.Valid(data) {
+		return false
+	}
+	total, bad := 0, 0
+	for _, r := range string(data) {
+		total++
+		if !unicode.IsPrint(r) && !unicode.IsSpace(r) {
+			bad++
+		}
+	}
+	return bad*10 <= total
+}
+
+// encodedCandidates splits a value into tokens that might carry an encoded
+// payload. The whole value is included so percent- or escape-encoded
+// strings containing separators are still tried.
+func encodedCandidates(value string) []string {
+	tokens := strings.FieldsFunc(value, func(r rune) bool {
+		return unicode.IsSpace(r) || strings.ContainsRune(`"'=:,;()<>|&`+"`", r)
+	})
+	seen := map[string]bool{}
+	out := []string{}
+	for _, tok := range append([]string{value}, tokens...) {
+		if len(tok) < minEncodedLength && !strings.Contains(tok, "%") && !strings.Contains(tok, `\`) {
+			continue
+		}
+		if !seen[tok] {
+			seen[tok] = true
+			out = append(out, tok)
+		}
+	}
+	return out
+}
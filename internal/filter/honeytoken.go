@@ -0,0 +1,408 @@
+package filter
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/tkingovr/agent-guard/api"
+	"github.com/tkingovr/agent-guard/internal/filelock"
+	"github.com/tkingovr/agent-guard/internal/jsonrpc"
+)
+
+// TagHoneytoken marks audit records where a planted honeytoken came back.
+const TagHoneytoken = "honeytoken"
+
+// TagDecoy marks audit records where a decoy was planted or served.
+const TagDecoy = "decoy"
+
+// maxPendingDecoys bounds the request-ID map for requests that never get a
+// response.
+const maxPendingDecoys = 4096
+
+// HoneytokenSpec defines one decoy credential. Value is generated from
+// Kind when empty.
+type HoneytokenSpec struct {
+	Name  string
+	Kind  string // aws_access_key | github_token | api_key | password
+	Value string
+}
+
+// DecoyResource is a fake resource added to resources/list and answered by
+// the proxy on resources/read. Text may reference tokens as {{name}}.
+type DecoyResource struct {
+	URI         string
+	Name        string
+	Description string
+	MimeType    string
+	Text        string
+}
+
+// DecoyResult appends a text block to the results of a tool. Text may
+// reference tokens as {{name}}.
+type DecoyResult struct {
+	Tool string
+	Text string
+}
+
+// HoneytokenConfig configures the decoys and where generated values persist.
+type HoneytokenConfig struct {
+	Tokens    []HoneytokenSpec
+	Resources []DecoyResource
+	Results   []DecoyResult
+
+	// StateFile stores generated values so tokens planted before a restart
+	// are still recognized. Empty means values are regenerated each run.
+	StateFile string
+}
+
+// HoneytokenSet holds the planted tokens and is shared by the inbound and
+// outbound chains, which correlate decoy planting by session and request ID.
+type HoneytokenSet struct {
+	tokens    map[string]string // name → value
+	resources []DecoyResource
+	results   map[string][]string // tool → expanded texts
+
+	mu      sync.Mutex
+	pending map[string]string // session + request ID → "resources/list" or tool name
+}
+
+// NewHoneytokenSet resolves token values (explicit, persisted, or newly
+// generated) and expands decoy templates.
+func NewHoneytokenSet(cfg HoneytokenConfig) (*HoneytokenSet, error) {
+	tokens, err := resolveHoneytokens(cfg)
+	if err != nil {
+		return nil, err
+	}
+	h := &HoneytokenSet{
+		tokens:  tokens,
+		results: make(map[string][]string),
+		pending: make(map[string]string),
+	}
+
+	pairs := make([]string, 0, 2*len(h.tokens))
+	for name, value := range h.tokens {
+		pairs = append(pairs, "{{"+name+"}}", value)
+	}
+	expand := strings.NewReplacer(pairs...)
+
+	for _, r := range cfg.Resources {
+		r.Text = expand.Replace(r.Text)
+		h.resources = append(h.resources, r)
+	}
+	for _, r := range cfg.Results {
+		h.results[r.Tool] = append(h.results[r.Tool], expand.Replace(r.Text))
+	}
+	return h, nil
+}
+
+// resolveHoneytokens returns the value of each token. With a state file,
+// reading it and saving newly generated values happen under its lock, so
+// proxies sharing a log_dir plant and recognize the same tokens.
+func resolveHoneytokens(cfg HoneytokenConfig) (map[string]string, error) {
+	state := map[string]string{}
+	if cfg.StateFile != "" {
+		unlock, err := filelock.Lock(cfg.StateFile)
+		if err != nil {
+			return nil, fmt.Errorf("honeytoken state: %w", err)
+		}
+		defer unlock()
+
+		data, err := os.ReadFile(cfg.StateFile)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("reading honeytoken state: %w", err)
+		}
+		if len(data) > 0 {
+			if err := json.Unmarshal(data, &state); err != nil {
+				return nil, fmt.Errorf("parsing honeytoken state: %w", err)
+			}
+		}
+	}
+
+	tokens := make(map[string]string, len(cfg.Tokens))
+	generated := false
+	for _, spec := range cfg.Tokens {
+		value := spec.Value
+		if value == "" {
+			value = state[spec.Name]
+		}
+		if value == "" {
+			v, err := generateHoneytoken(spec.Kind)
+			if err != nil {
+				return nil, err
+			}
+			value = v
+			state[spec.Name] = v
+			generated = true
+		}
+		tokens[spec.Name] = value
+	}
+
+	if generated && cfg.StateFile != "" {
+		data, err := json.MarshalIndent(state, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		if err := filelock.WriteFile(cfg.StateFile, data, 0o600); err != nil {
+			return nil, fmt.Errorf("writing honeytoken state: %w", err)
+		}
+	}
+	return tokens, nil
+}
+
+// Value returns the value of the named token.
+func (h *HoneytokenSet) Value(name string) string {
+	return h.tokens[name]
+}
+
+// find returns the names of tokens that occur in text, directly or under
+// one of the encodings understood by decodeLayers.
+func (h *HoneytokenSet) find(text string, found map[string]bool) {
+	forms := []string{text}
+	for _, tok := range encodedCandidates(text) {
+		for _, form := range decodeLayers(tok) {
+			forms = append(forms, form.text)
+		}
+	}
+	for name, value := range h.tokens {
+		for _, form := range forms {
+			if strings.Contains(form, value) {
+				found[name] = true
+				break
+			}
+		}
+	}
+}
+
+// track notes that the response to the request fc carries needs kind
+// planted. The note is dropped if the request is never forwarded.
+func (h *HoneytokenSet) track(fc *FilterContext, kind string) {
+	key := inflightKey(fc.SessionID, fc.Message.ID)
+	h.mu.Lock()
+	if len(h.pending) >= maxPendingDecoys {
+		h.pending = make(map[string]string)
+	}
+	h.pending[key] = kind
+	h.mu.Unlock()
+	fc.OnFinish(func() { h.take(key) })
+}
+
+func (h *HoneytokenSet) take(key string) (string, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	kind, ok := h.pending[key]
+	delete(h.pending, key)
+	return kind, ok
+}
+
+func (h *HoneytokenSet) resource(uri string) (DecoyResource, bool) {
+	for _, r := range h.resources {
+		if r.URI == uri {
+			return r, true
+		}
+	}
+	return DecoyResource{}, false
+}
+
+// generateHoneytoken creates a random value shaped like the given kind of
+// credential, so it is attractive to an exfiltrating agent.
+func generateHoneytoken(kind string) (string, error) {
+	const (
+		upper = "ABCDEFGHIJKLMNOPQRSTUVWXYZ234567"
+		alnum = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789"
+	)
+	switch kind {
+	case "aws_access_key":
+		s, err := randomString(upper, 16)
+		return "AKIA" + s, err
+	case "github_token":
+		s, err := randomString(alnum, 36)
+		return "ghp_" + s, err
+	case "password":
+		return randomString(alnum+"!@#$%^&*", 20)
+	default:
+		var b [16]byte
+		if _, err := rand.Read(b[:]); err != nil {
+			return "", err
+		}
+		return "sk_" + hex.EncodeToString(b[:]), nil
+	}
+}
+
+func randomString(alphabet string, n int) (string, error) {
+	out := make([]byte, n)
+	max := big.NewInt(int64(len(alphabet)))
+	for i := range out {
+		v, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		out[i] = alphabet[v.Int64()]
+	}
+	return string(out), nil
+}
+
+// HoneytokenFilter plants decoys and trips when a planted token comes back.
+// Inbound, it denies any request carrying a token, serves decoy resources,
+// and notes which responses need planting; outbound, it plants decoys into
+// those responses.
+type HoneytokenFilter struct {
+	set *HoneytokenSet
+}
+
+// NewHoneytokenFilter creates a filter backed by a shared HoneytokenSet.
+func NewHoneytokenFilter(set *HoneytokenSet) *HoneytokenFilter {
+	return &HoneytokenFilter{set: set}
+}
+
+func (f *HoneytokenFilter) Name() string { return "honeytoken" }
+
+func (f *HoneytokenFilter) Process(_ context.Context, fc *FilterContext) error {
+	if fc.Message == nil {
+		return nil
+	}
+	if fc.Direction == api.DirectionOutbound {
+		return f.plant(fc)
+	}
+
+	f.tripwire(fc)
+	if fc.Verdict == api.VerdictDeny || !fc.Message.IsRequest() {
+		return nil
+	}
+
+	switch fc.Method {
+	case "resources/list":
+		if len(f.set.resources) > 0 {
+			f.set.track(fc, "resources/list")
+		}
+	case "resources/read":
+		return f.serveResource(fc)
+	case "tools/call":
+		if len(f.set.results[fc.Tool]) > 0 {
+			f.set.track(fc, fc.Tool)
+		}
+	}
+	return nil
+}
+
+// tripwire denies the request if any planted token appears in it. It runs
+// regardless of earlier verdicts: a returning honeytoken outranks them.
+// The original bytes are scanned so an earlier redaction can't hide it.
+// Token values are decoys, so they're left visible in the audit log.
+func (f *HoneytokenFilter) tripwire(fc *FilterContext) {
+	var msg struct {
+		Params any `json:"params"`
+	}
+	if err := json.Unmarshal(fc.Raw, &msg); err != nil || msg.Params == nil {
+		return
+	}
+
+	found := map[string]bool{}
+	var walk func(v any)
+	walk = func(v any) {
+		switch val := v.(type) {
+		case string:
+			f.set.find(val, found)
+		case map[string]any:
+			for _, child := range val {
+				walk(child)
+			}
+		case []any:
+			for _, child := range val {
+				walk(child)
+			}
+		}
+	}
+	walk(msg.Params)
+	if len(found) == 0 {
+		return
+	}
+
+	names := make([]string, 0, len(found))
+	for name := range found {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fc.Verdict = api.VerdictDeny
+	fc.Halted = true
+	fc.MatchedRule = "honeytoken:" + names[0]
+	fc.VerdictMessage = fmt.Sprintf("honeytoken %s used: the agent may be prompt-injected or compromised", strings.Join(names, ", "))
+	fc.Tags = append(fc.Tags, TagHoneytoken)
+}
+
+func (f *HoneytokenFilter) serveResource(fc *FilterContext) error {
+	var params struct {
+		URI string `json:"uri"`
+	}
+	if err := json.Unmarshal(fc.Message.Params, &params); err != nil {
+		return nil
+	}
+	r, ok := f.set.resource(params.URI)
+	if !ok {
+		return nil
+	}
+
+	content := map[string]any{"uri": r.URI, "text": r.Text}
+	if r.MimeType != "" {
+		content["mimeType"] = r.MimeType
+	}
+	result, err := json.Marshal(map[string]any{"contents": []any{content}})
+	if err != nil {
+		return err
+	}
+	resp, err := json.Marshal(jsonrpc.NewResultResponse(fc.Message.ID, result))
+	if err != nil {
+		return err
+	}
+	fc.Response = resp
+	fc.Tags = append(fc.Tags, TagDecoy)
+	return nil
+}
+
+func (f *HoneytokenFilter) plant(fc *FilterContext) error {
+	if !fc.Message.IsResponse() || len(fc.Message.Result) == 0 {
+		return nil
+	}
+	kind, ok := f.set.take(inflightKey(fc.SessionID, fc.Message.ID))
+	if !ok {
+		return nil
+	}
+
+	var result map[string]any
+	if err := json.Unmarshal(fc.Message.Result, &result); err != nil {
+		return nil
+	}
+
+	if kind == "resources/list" {
+		list, _ := result["resources"].([]any)
+		for _, r := range f.set.resources {
+			entry := map[string]any{"uri": r.URI, "name": r.Name}
+			if r.Description != "" {
+				entry["description"] = r.Description
+			}
+			if r.MimeType != "" {
+				entry["mimeType"] = r.MimeType
+			}
+			list = append(list, entry)
+		}
+		result["resources"] = list
+	} else {
+		content, _ := result["content"].([]any)
+		for _, text := range f.set.results[kind] {
+			content = append(content, map[string]any{"type": "text", "text": text})
+		}
+		result["content"] = content
+	}
+
+	fc.Tags = append(fc.Tags, TagDecoy)
+	return fc.RewriteResult(result)
+}
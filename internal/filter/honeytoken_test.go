@@ -0,0 +1,219 @@
+package filter
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tkingovr/agent-guard/api"
+	"github.com/tkingovr/agent-guard/internal/filelock"
+)
+
+func newTestHoneytokens(t *testing.T, stateFile string) *HoneytokenSet {
+	t.Helper()
+	set, err := NewHoneytokenSet(HoneytokenConfig{
+		Tokens: []HoneytokenSpec{
+			{Name: "deploy_key", Kind: "aws_access_key"},
+			{Name: "db_password", Value: "Tr1pw1re-Pa55word"},
+		},
+		Resources: []DecoyResource{
+			{URI: "file:///etc/agent/credentials", Name: "credentials", MimeType: "text/plain", Text: "aws_access_key_id = {{deploy_key}}"},
+		},
+		Results: []DecoyResult{
+			{Tool: "read_config", Text: "DB_PASSWORD={{db_password}}"},
+		},
+		StateFile: stateFile,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return set
+}
+
+func TestHoneytoken_Tripwire(t *testing.T) {
+	set := newTestHoneytokens(t, "")
+	key := set.Value("deploy_key")
+	if !strings.HasPrefix(key, "AKIA") || len(key) != 20 {
+		t.Fatalf("expected generated AWS-shaped key, got %q", key)
+	}
+
+	for name, arg := range map[string]string{
+		"plain":  "aws s3 ls --access-key " + key,
+		"base64": base64.StdEncoding.EncodeToString([]byte("password=Tr1pw1re-Pa55word")),
+	} {
+		t.Run(name, func(t *testing.T) {
+			raw := `{"jsonrpc":"2.0","id":9,"method":"tools/call","params":{"name":"run_command","arguments":{"command":` + quoteJSON(arg) + `}}}`
+			fc := runFilter(t, NewHoneytokenFilter(set), raw, api.DirectionInbound)
+			if fc.Verdict != api.VerdictDeny || !fc.Halted {
+				t.Fatalf("expected halted deny, got %s", fc.Verdict)
+			}
+			if !strings.HasPrefix(fc.MatchedRule, "honeytoken:") {
+				t.Errorf("expected honeytoken rule, got %s", fc.MatchedRule)
+			}
+			if len(fc.Tags) != 1 || fc.Tags[0] != TagHoneytoken {
+				t.Errorf("expected honeytoken tag, got %v", fc.Tags)
+			}
+			if rec := fc.ToAuditRecord(); len(rec.Tags) == 0 {
+				t.Error("expected tag on audit record")
+			}
+		})
+	}
+}
+
+func TestHoneytoken_OverridesEarlierAllow(t *testing.T) {
+	set := newTestHoneytokens(t, "")
+	raw := `{"jsonrpc":"2.0","id":9,"method":"tools/call","params":{"name":"login","arguments":{"password":"Tr1pw1re-Pa55word"}}}`
+	fc := NewFilterContext([]byte(raw), api.DirectionInbound)
+	if err := NewParseFilter().Process(context.Background(), fc); err != nil {
+		t.Fatal(err)
+	}
+	fc.Verdict = api.VerdictAllow
+	fc.MatchedRule = "allow-all"
+	if err := NewHoneytokenFilter(set).Process(context.Background(), fc); err != nil {
+		t.Fatal(err)
+	}
+	if fc.Verdict != api.VerdictDeny || fc.MatchedRule != "honeytoken:db_password" {
+		t.Errorf("expected honeytoken deny to override allow, got %s %s", fc.Verdict, fc.MatchedRule)
+	}
+}
+
+func TestHoneytoken_DecoyResources(t *testing.T) {
+	set := newTestHoneytokens(t, "")
+
+	// resources/list response gains the decoy
+	fc := runFilter(t, NewHoneytokenFilter(set), `{"jsonrpc":"2.0","id":1,"method":"resources/list"}`, api.DirectionInbound)
+	if fc.Response != nil {
+		t.Fatal("resources/list should be forwarded")
+	}
+	out := runFilter(t, NewHoneytokenFilter(set), `{"jsonrpc":"2.0","id":1,"result":{"resources":[{"uri":"file:///README.md","name":"README"}]}}`, api.DirectionOutbound)
+	var list struct {
+		Result struct {
+			Resources []struct {
+				URI string `json:"uri"`
+			} `json:"resources"`
+		} `json:"result"`
+	}
+	if err := json.Unmarshal(out.Output(), &list); err != nil {
+		t.Fatal(err)
+	}
+	if len(list.Result.Resources) != 2 || list.Result.Resources[1].URI != "file:///etc/agent/credentials" {
+		t.Errorf("expected decoy appended to resources, got %+v", list.Result.Resources)
+	}
+
+	// resources/read of the decoy is answered locally
+	fc = runFilter(t, NewHoneytokenFilter(set), `{"jsonrpc":"2.0","id":2,"method":"resources/read","params":{"uri":"file:///etc/agent/credentials"}}`, api.DirectionInbound)
+	if fc.Response == nil {
+		t.Fatal("expected synthetic response for decoy resource")
+	}
+	if !strings.Contains(string(fc.Response), set.Value("deploy_key")) || !strings.Contains(string(fc.Response), `"id":2`) {
+		t.Errorf("expected decoy content with token, got %s", fc.Response)
+	}
+
+	// Other reads are untouched
+	fc = runFilter(t, NewHoneytokenFilter(set), `{"jsonrpc":"2.0","id":3,"method":"resources/read","params":{"uri":"file:///README.md"}}`, api.DirectionInbound)
+	if fc.Response != nil {
+		t.Error("expected real resources to be forwarded")
+	}
+}
+
+func TestHoneytoken_PlantsToolResult(t *testing.T) {
+	set := newTestHoneytokens(t, "")
+
+	runFilter(t, NewHoneytokenFilter(set), `{"jsonrpc":"2.0","id":"a","method":"tools/call","params":{"name":"read_config","arguments":{}}}`, api.DirectionInbound)
+	out := runFilter(t, NewHoneytokenFilter(set), `{"jsonrpc":"2.0","id":"a","result":{"content":[{"type":"text","text":"ok"}]}}`, api.DirectionOutbound)
+	if !strings.Contains(string(out.Output()), "DB_PASSWORD=Tr1pw1re-Pa55word") {
+		t.Errorf("expected decoy planted in result, got %s", out.Output())
+	}
+
+	// Responses to other requests are left alone
+	out = runFilter(t, NewHoneytokenFilter(set), `{"jsonrpc":"2.0","id":"b","result":{"content":[]}}`, api.DirectionOutbound)
+	if out.Rewritten != nil {
+		t.Error("expected unrelated response to be untouched")
+	}
+}
+
+func TestHoneytoken_PlantsBySession(t *testing.T) {
+	set := newTestHoneytokens(t, "")
+	inbound := NewChain(newTestLogger(), NewParseFilter(), NewHoneytokenFilter(set))
+	outbound := NewChain(newTestLogger(), NewOutboundParseFilter(), NewHoneytokenFilter(set))
+	run := func(chain *Chain, session, raw string, dir api.Direction) *FilterContext {
+		t.Helper()
+		fc := NewFilterContext([]byte(raw), dir)
+		fc.SessionID = session
+		if err := chain.Process(context.Background(), fc); err != nil {
+			t.Fatal(err)
+		}
+		return fc
+	}
+	call := `{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"read_config","arguments":{}}}`
+	result := `{"jsonrpc":"2.0","id":1,"result":{"content":[]}}`
+
+	run(inbound, "alice", call, api.DirectionInbound)
+	if out := run(outbound, "bob", result, api.DirectionOutbound); out.Rewritten != nil {
+		t.Errorf("expected another session's response with the same ID untouched, got %s", out.Output())
+	}
+	if out := run(outbound, "alice", result, api.DirectionOutbound); out.Rewritten == nil {
+		t.Error("expected the decoy planted in the caller's response")
+	}
+
+	// A request that is never forwarded leaves nothing behind
+	run(inbound, "alice", call, api.DirectionInbound).Finish()
+	if out := run(outbound, "alice", result, api.DirectionOutbound); out.Rewritten != nil {
+		t.Errorf("expected no decoy for a request that wasn't forwarded, got %s", out.Output())
+	}
+}
+
+func TestHoneytoken_PersistsGeneratedValues(t *testing.T) {
+	state := filepath.Join(t.TempDir(), "honeytokens.json")
+	first := newTestHoneytokens(t, state).Value("deploy_key")
+	second := newTestHoneytokens(t, state).Value("deploy_key")
+	if first != second {
+		t.Errorf("expected generated value to persist, got %q then %q", first, second)
+	}
+	info, err := os.Stat(state)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0o600 {
+		t.Errorf("expected state file mode 0600, got %v", info.Mode().Perm())
+	}
+}
+
+func TestHoneytoken_SharedStateFile(t *testing.T) {
+	// Another proxy on the same log_dir is generating the tokens
+	state := filepath.Join(t.TempDir(), "honeytokens.json")
+	unlock, err := filelock.Lock(state)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan *HoneytokenSet)
+	go func() {
+		set, err := NewHoneytokenSet(HoneytokenConfig{
+			Tokens:    []HoneytokenSpec{{Name: "deploy_key", Kind: "aws_access_key"}},
+			StateFile: state,
+		})
+		if err != nil {
+			t.Error(err)
+		}
+		done <- set
+	}()
+	select {
+	case <-done:
+		t.Fatal("state file should be read under its lock")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	if err := filelock.WriteFile(state, []byte(`{"deploy_key":"AKIAOTHERPROXY000000"}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	unlock()
+	if set := <-done; set == nil || set.Value("deploy_key") != "AKIAOTHERPROXY000000" {
+		t.Error("expected the token the other proxy generated")
+	}
+}
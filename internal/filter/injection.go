@@ -0,0 +1,260 @@
+package filter
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/tkingovr/agent-guard/api"
+)
+
+// InjectionAction controls what the injection scanner does with a finding.
+type InjectionAction string
+
+const (
+	// InjectionStrip removes hidden characters and matched phrases and
+	// truncates oversized descriptions.
+	InjectionStrip InjectionAction = "strip"
+	// InjectionAnnotate prefixes the offending text with a visible warning.
+	InjectionAnnotate InjectionAction = "annotate"
+	// InjectionBlock replaces the whole response with a JSON-RPC error.
+	InjectionBlock InjectionAction = "block"
+)
+
+// DefaultInjectionPatterns returns the built-in set of instruction-like phrases
+// that have no business appearing in tool, prompt, or resource metadata.
+func DefaultInjectionPatterns() []Pattern {
+	return []Pattern{
+		{Name: "ignore_instructions", Regex: regexp.MustCompile(`(?i)\b(?:ignore|disregard|forget|override)\s+(?:all\s+)?(?:of\s+)?(?:the\s+|your\s+)?(?:previous|prior|above|earlier|system)\s+(?:instructions|prompts?|rules|context|directions)`)},
+		{Name: "conceal_from_user", Regex: regexp.MustCompile(`(?i)\b(?:do\s+not|don'?t|never)\s+(?:tell|inform|mention|reveal|show|disclose)\b[^.]{0,40}\b(?:the\s+)?user`)},
+		{Name: "hidden_markup", Regex: regexp.MustCompile(`(?i)<\s*/?\s*(?:system|important|instructions?|secret|hidden)\s*>|\[\s*/?\s*(?:system|inst)\s*\]`)},
+		{Name: "role_override", Regex: regexp.MustCompile(`(?i)\byou\s+are\s+now\b|\bnew\s+instructions\s*:|\bfrom\s+now\s+on\s*,?\s+you\b`)},
+		{Name: "cross_tool_directive", Regex: regexp.MustCompile(`(?i)\b(?:before|after|instead\s+of)\s+(?:using|calling|invoking)\s+(?:this|any|the)\s+(?:\w+\s+)?tool\b`)},
+		{Name: "sensitive_file_reference", Regex: regexp.MustCompile(`(?i)(?:~/\.ssh|\bid_(?:rsa|ed25519)\b|/etc/(?:passwd|shadow)|\.aws/credentials|mcp\.json|\.env\b)`)},
+	}
+}
+
+// InjectionScannerFilter scans tool descriptions, prompt templates, and
+// resource metadata in outbound list responses for prompt-injection
+// heuristics before they reach the model context.
+type InjectionScannerFilter struct {
+	patterns             []Pattern
+	action               InjectionAction
+	maxDescriptionLength int
+}
+
+// InjectionScannerOption configures the InjectionScannerFilter.
+type InjectionScannerOption func(*InjectionScannerFilter)
+
+// WithInjectionPatterns sets custom injection patterns (replaces defaults).
+func WithInjectionPatterns(patterns []Pattern) InjectionScannerOption {
+	return func(f *InjectionScannerFilter) {
+		f.patterns = patterns
+	}
+}
+
+// WithInjectionAction sets how findings are handled. Default is block.
+func WithInjectionAction(action InjectionAction) InjectionScannerOption {
+	return func(f *InjectionScannerFilter) {
+		f.action = action
+	}
+}
+
+// WithMaxDescriptionLength sets the length (in characters) above which a
+// description is considered suspicious. Default is 1024; 0 disables the check.
+func WithMaxDescriptionLength(n int) InjectionScannerOption {
+	return func(f *InjectionScannerFilter) {
+		f.maxDescriptionLength = n
+	}
+}
+
+// NewInjectionScannerFilter creates a new prompt-injection scanner filter.
+func NewInjectionScannerFilter(opts ...InjectionScannerOption) *InjectionScannerFilter {
+	f := &InjectionScannerFilter{
+		patterns:             DefaultInjectionPatterns(),
+		action:               InjectionBlock,
+		maxDescriptionLength: 1024,
+	}
+	for _, opt := range opts {
+		opt(f)
+	}
+	return f
+}
+
+func (f *InjectionScannerFilter) Name() string { return "injection_scanner" }
+
+// injectionListKeys are the result fields of list/get responses that carry
+// model-facing metadata.
+var injectionListKeys = []string{"tools", "prompts", "resources", "resourceTemplates", "messages"}
+
+// injectionTextKeys are the object keys whose string values are scanned.
+var injectionTextKeys = map[string]bool{"description": true, "title": true, "text": true}
+
+func (f *InjectionScannerFilter) Process(_ context.Context, fc *FilterContext) error {
+	// Only scan outbound responses
+	if fc.Direction != api.DirectionOutbound {
+		return nil
+	}
+	if fc.Message == nil || len(fc.Message.Result) == 0 {
+		return nil
+	}
+
+	var result map[string]any
+	if err := json.Unmarshal(fc.Message.Result, &result); err != nil {
+		return nil
+	}
+
+	// prompts/get results carry a top-level description next to messages
+	found := map[string]bool{}
+	if desc, ok := result["description"].(string); ok {
+		result["description"] = f.scanText("description", desc, found)
+	}
+	for _, key := range injectionListKeys {
+		if items, ok := result[key].([]any); ok {
+			for i, item := range items {
+				items[i] = f.walk(item, found)
+			}
+		}
+	}
+
+	if len(found) == 0 {
+		return nil
+	}
+
+	names := make([]string, 0, len(found))
+	for name := range found {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fc.MatchedRule = "injection_scanner:" + names[0]
+	if f.action == InjectionBlock {
+		fc.Verdict = api.VerdictDeny
+		fc.VerdictMessage = fmt.Sprintf("potential prompt injection in server metadata: %s", strings.Join(names, ", "))
+		fc.Halted = true
+		return nil
+	}
+
+	fc.Verdict = api.VerdictLog
+	fc.VerdictMessage = fmt.Sprintf("potential prompt injection in server metadata (%s): %s", f.action, strings.Join(names, ", "))
+	return fc.RewriteResult(result)
+}
+
+// walk scans every text field in a decoded JSON value and returns the value
+// with any strip/annotate changes applied.
+func (f *InjectionScannerFilter) walk(v any, found map[string]bool) any {
+	switch val := v.(type) {
+	case map[string]any:
+		for k, child := range val {
+			if s, ok := child.(string); ok && injectionTextKeys[k] {
+				val[k] = f.scanText(k, s, found)
+				continue
+			}
+			val[k] = f.walk(child, found)
+		}
+	case []any:
+		for i, child := range val {
+			val[i] = f.walk(child, found)
+		}
+	}
+	return v
+}
+
+// scanText records findings for a single text field and returns the text
+// rewritten according to the configured action.
+func (f *InjectionScannerFilter) scanText(key, text string, found map[string]bool) string {
+	var hits []string
+
+	hidden := findHiddenRunes(text)
+	hits = append(hits, hidden...)
+
+	var matched []Pattern
+	for _, p := range f.patterns {
+		if p.matches(text) {
+			matched = append(matched, p)
+			hits = append(hits, p.Name)
+		}
+	}
+
+	tooLong := key == "description" && f.maxDescriptionLength > 0 &&
+		utf8.RuneCountInString(text) > f.maxDescriptionLength
+	if tooLong {
+		hits = append(hits, "long_description")
+	}
+
+	if len(hits) == 0 {
+		return text
+	}
+	for _, h := range hits {
+		found[h] = true
+	}
+
+	switch f.action {
+	case InjectionStrip:
+		if len(hidden) > 0 {
+			text = stripHiddenRunes(text)
+		}
+		for _, p := range matched {
+			text, _ = p.redact(text, "[removed]")
+		}
+		if tooLong {
+			text = string([]rune(text)[:f.maxDescriptionLength]) + "…"
+		}
+	case InjectionAnnotate:
+		text = fmt.Sprintf("[AgentGuard warning: possible prompt injection (%s)] %s", strings.Join(hits, ", "), text)
+	}
+	return text
+}
+
+// findHiddenRunes reports which classes of invisible characters appear in s.
+func findHiddenRunes(s string) []string {
+	var tags, zeroWidth, bidi bool
+	for _, r := range s {
+		switch hiddenRuneClass(r) {
+		case "unicode_tags":
+			tags = true
+		case "zero_width":
+			zeroWidth = true
+		case "bidi_control":
+			bidi = true
+		}
+	}
+	var out []string
+	if tags {
+		out = append(out, "unicode_tags")
+	}
+	if zeroWidth {
+		out = append(out, "zero_width")
+	}
+	if bidi {
+		out = append(out, "bidi_control")
+	}
+	return out
+}
+
+func stripHiddenRunes(s string) string {
+	return strings.Map(func(r rune) rune {
+		if hiddenRuneClass(r) != "" {
+			return -1
+		}
+		return r
+	}, s)
+}
+
+// hiddenRuneClass classifies characters that render invisibly but are still
+// read by the model.
+func hiddenRuneClass(r rune) string {
+	switch {
+	case r >= 0xE0000 && r <= 0xE007F:
+		return "unicode_tags"
+	case r == 0x200B, r == 0x200C, r == 0x200D, r == 0x2060, r == 0xFEFF, r == 0x180E:
+		return "zero_width"
+	case r >= 0x202A && r <= 0x202E, r >= 0x2066 && r <= 0x2069:
+		return "bidi_control"
+	}
+	return ""
+}
@@ -0,0 +1,235 @@
+package filter
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tkingovr/agent-guard/api"
+)
+
+// LoopRule is the MatchedRule for requests flagged by the loop detector.
+const LoopRule = "loop_detected"
+
+// maxLoopSessions bounds the per-session histories kept in memory.
+const maxLoopSessions = 1024
+
+// LoopConfig configures loop and repetition detection.
+type LoopConfig struct {
+	// MaxRepeats is how many identical calls are allowed within Window.
+	// Default is 5.
+	MaxRepeats int
+
+	// MaxCycles is how many times a short cycle (A→B→A→B) may repeat back
+	// to back. Default is 3.
+	MaxCycles int
+
+	// MaxCycleLength is the longest cycle looked for. Default is 3.
+	MaxCycleLength int
+
+	// Window is how many recent calls per session are remembered. Default
+	// is 50.
+	Window int
+
+	// Action is deny (default), ask, or log.
+	Action string
+}
+
+// loopHistory is the recent call fingerprints of one session.
+type loopHistory struct {
+	prints   []string
+	labels   map[string]string // fingerprint → "method tool" for messages
+	lastSeen time.Time
+}
+
+// LoopDetectorFilter flags agents that repeat the same call, or cycle
+// through a few calls, far more often than useful work would. Calls are
+// fingerprinted per session by method, tool, and normalized arguments.
+type LoopDetectorFilter struct {
+	cfg LoopConfig
+
+	mu       sync.Mutex
+	sessions map[string]*loopHistory
+}
+
+// NewLoopDetectorFilter creates a loop detector.
+func NewLoopDetectorFilter(cfg LoopConfig) *LoopDetectorFilter {
+	if cfg.MaxRepeats <= 0 {
+		cfg.MaxRepeats = 5
+	}
+	if cfg.MaxCycles <= 0 {
+		cfg.MaxCycles = 3
+	}
+	if cfg.MaxCycleLength <= 0 {
+		cfg.MaxCycleLength = 3
+	}
+	if cfg.Window <= 0 {
+		cfg.Window = 50
+	}
+	if cfg.Action == "" {
+		cfg.Action = "deny"
+	}
+	return &LoopDetectorFilter{
+		cfg:      cfg,
+		sessions: make(map[string]*loopHistory),
+	}
+}
+
+func (f *LoopDetectorFilter) Name() string { return "loop_detector" }
+
+func (f *LoopDetectorFilter) Process(_ context.Context, fc *FilterContext) error {
+	if fc.Direction != api.DirectionInbound || fc.Message == nil || !fc.Message.IsRequest() {
+		return nil
+	}
+	if !loopTracked(fc.Method) {
+		return nil
+	}
+
+	fp := loopFingerprint(fc.Method, fc.Tool, fc.Arguments, fc.Message.Params)
+	label := fc.Method
+	if fc.Tool != "" {
+		label = fmt.Sprintf("tool %q", fc.Tool)
+	}
+
+	f.mu.Lock()
+	h := f.history(fc.SessionID)
+	h.prints = append(h.prints, fp)
+	if len(h.prints) > f.cfg.Window {
+		h.prints = h.prints[len(h.prints)-f.cfg.Window:]
+	}
+	h.labels[fp] = label
+	message := f.detect(h)
+	f.mu.Unlock()
+
+	if message == "" || fc.Verdict == api.VerdictDeny {
+		return nil
+	}
+	f.flag(fc, message)
+	return nil
+}
+
+// loopTracked reports whether calls to method count toward loops. Listing
+// and keep-alive methods are legitimately repeated.
+func loopTracked(method string) bool {
+	switch method {
+	case "", "initialize", "ping":
+		return false
+	}
+	return !strings.HasSuffix(method, "/list")
+}
+
+// history returns the session's history, evicting the least recently seen
+// session when full. Callers must hold f.mu.
+func (f *LoopDetectorFilter) history(session string) *loopHistory {
+	h, ok := f.sessions[session]
+	if !ok {
+		if len(f.sessions) >= maxLoopSessions {
+			var oldest string
+			for id, s := range f.sessions {
+				if oldest == "" || s.lastSeen.Before(f.sessions[oldest].lastSeen) {
+					oldest = id
+				}
+			}
+			delete(f.sessions, oldest)
+		}
+		h = &loopHistory{labels: make(map[string]string)}
+		f.sessions[session] = h
+	}
+	h.lastSeen = time.Now()
+	return h
+}
+
+// detect checks the latest call for exact repeats, then for short cycles.
+func (f *LoopDetectorFilter) detect(h *loopHistory) string {
+	prints := h.prints
+	last := prints[len(prints)-1]
+
+	repeats := 0
+	for _, p := range prints {
+		if p == last {
+			repeats++
+		}
+	}
+	if repeats > f.cfg.MaxRepeats {
+		return fmt.Sprintf("%s: %s called %d times with identical arguments in the last %d calls",
+			LoopRule, h.labels[last], repeats, len(prints))
+	}
+
+	for n := 2; n <= f.cfg.MaxCycleLength; n++ {
+		span := n * f.cfg.MaxCycles
+		if len(prints) <= span {
+			break
+		}
+		if !periodic(prints[len(prints)-span-1:], n) || uniform(prints[len(prints)-n:]) {
+			continue
+		}
+		steps := make([]string, n)
+		for i, p := range prints[len(prints)-n:] {
+			steps[i] = h.labels[p]
+		}
+		return fmt.Sprintf("%s: cycle of %d calls (%s) repeated more than %d times",
+			LoopRule, n, strings.Join(steps, " → "), f.cfg.MaxCycles)
+	}
+	return ""
+}
+
+// flag applies the configured action, never weakening an earlier verdict.
+func (f *LoopDetectorFilter) flag(fc *FilterContext, message string) {
+	switch f.cfg.Action {
+	case "log":
+		if fc.Verdict == api.VerdictAsk {
+			return
+		}
+		fc.Verdict = api.VerdictLog
+	case "ask":
+		fc.Verdict = api.VerdictAsk
+		fc.Halted = true
+	default:
+		fc.Verdict = api.VerdictDeny
+		fc.Halted = true
+	}
+	fc.MatchedRule = LoopRule
+	fc.VerdictMessage = message
+}
+
+// periodic reports whether s repeats with period n throughout.
+func periodic(s []string, n int) bool {
+	for i := n; i < len(s); i++ {
+		if s[i] != s[i-n] {
+			return false
+		}
+	}
+	return true
+}
+
+func uniform(s []string) bool {
+	for _, v := range s[1:] {
+		if v != s[0] {
+			return false
+		}
+	}
+	return true
+}
+
+// loopFingerprint hashes the method, tool, and arguments (or params for
+// non-tool requests). Arguments are re-encoded so key order and whitespace
+// don't make identical calls look different.
+func loopFingerprint(method, tool string, args, params json.RawMessage) string {
+	payload := args
+	if tool == "" {
+		payload = params
+	}
+	var v any
+	if err := json.Unmarshal(payload, &v); err == nil {
+		if canonical, err := json.Marshal(v); err == nil {
+			payload = canonical
+		}
+	}
+	sum := sha256.Sum256([]byte(method + "\x00" + tool + "\x00" + string(payload)))
+	return hex.EncodeToString(sum[:8])
+}
@@ -0,0 +1,105 @@
+package filter
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/tkingovr/agent-guard/api"
+)
+
+func loopCall(t *testing.T, f *LoopDetectorFilter, session, tool, args string) *FilterContext {
+	t.Helper()
+	raw := fmt.Sprintf(`{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":%q,"arguments":%s}}`, tool, args)
+	fc := NewFilterContext([]byte(raw), api.DirectionInbound)
+	fc.SessionID = session
+	if err := NewParseFilter().Process(context.Background(), fc); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Process(context.Background(), fc); err != nil {
+		t.Fatal(err)
+	}
+	return fc
+}
+
+func TestLoopDetector_ExactRepeats(t *testing.T) {
+	f := NewLoopDetectorFilter(LoopConfig{MaxRepeats: 3})
+
+	for i := 0; i < 3; i++ {
+		if fc := loopCall(t, f, "s1", "search", `{"q":"weather","page":1}`); fc.Halted {
+			t.Fatalf("call %d should be allowed", i+1)
+		}
+	}
+	// Same arguments, different key order and spacing
+	fc := loopCall(t, f, "s1", "search", `{ "page": 1, "q": "weather" }`)
+	if !fc.Halted || fc.MatchedRule != LoopRule {
+		t.Fatalf("4th identical call should be flagged, got %q", fc.MatchedRule)
+	}
+	if !strings.Contains(fc.VerdictMessage, "loop_detected") || !strings.Contains(fc.VerdictMessage, `"search"`) {
+		t.Errorf("unexpected message: %s", fc.VerdictMessage)
+	}
+
+	if fc := loopCall(t, f, "s1", "search", `{"q":"news","page":1}`); fc.Halted {
+		t.Error("different arguments should be allowed")
+	}
+	if fc := loopCall(t, f, "s2", "search", `{"q":"weather","page":1}`); fc.Halted {
+		t.Error("other sessions should have their own history")
+	}
+}
+
+func TestLoopDetector_Cycle(t *testing.T) {
+	f := NewLoopDetectorFilter(LoopConfig{MaxRepeats: 10, MaxCycles: 2})
+
+	calls := []string{"read_file", "write_file", "read_file", "write_file"}
+	for i, tool := range calls {
+		if fc := loopCall(t, f, "s1", tool, `{"path":"/tmp/a"}`); fc.Halted {
+			t.Fatalf("call %d should be allowed", i+1)
+		}
+	}
+	fc := loopCall(t, f, "s1", "read_file", `{"path":"/tmp/a"}`)
+	if !fc.Halted || !strings.Contains(fc.VerdictMessage, "cycle of 2 calls") {
+		t.Fatalf("A→B cycle should be flagged, got %q", fc.VerdictMessage)
+	}
+}
+
+func TestLoopDetector_ProgressIsNotALoop(t *testing.T) {
+	f := NewLoopDetectorFilter(LoopConfig{MaxRepeats: 3, MaxCycles: 2})
+
+	for i := 0; i < 20; i++ {
+		args := fmt.Sprintf(`{"path":"/src/file%d.go"}`, i)
+		if fc := loopCall(t, f, "s1", "read_file", args); fc.Halted {
+			t.Fatalf("call %d reading a new file should be allowed: %s", i+1, fc.VerdictMessage)
+		}
+	}
+}
+
+func TestLoopDetector_Actions(t *testing.T) {
+	for _, tc := range []struct {
+		action  string
+		verdict api.Verdict
+		halted  bool
+	}{
+		{"ask", api.VerdictAsk, true},
+		{"log", api.VerdictLog, false},
+	} {
+		f := NewLoopDetectorFilter(LoopConfig{MaxRepeats: 1, Action: tc.action})
+		loopCall(t, f, "s1", "search", `{}`)
+		fc := loopCall(t, f, "s1", "search", `{}`)
+		if fc.Verdict != tc.verdict || fc.Halted != tc.halted {
+			t.Errorf("%s: got verdict %s halted %v", tc.action, fc.Verdict, fc.Halted)
+		}
+	}
+}
+
+func TestLoopDetector_SkipsListMethods(t *testing.T) {
+	f := NewLoopDetectorFilter(LoopConfig{MaxRepeats: 1})
+	for i := 0; i < 5; i++ {
+		fc := NewFilterContext([]byte(`{"jsonrpc":"2.0","id":1,"method":"tools/list"}`), api.DirectionInbound)
+		NewParseFilter().Process(context.Background(), fc)
+		f.Process(context.Background(), fc)
+		if fc.Halted {
+			t.Fatal("tools/list should not count as a loop")
+		}
+	}
+}
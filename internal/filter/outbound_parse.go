@@ -22,7 +22,10 @@ func (f *OutboundParseFilter) Process(_ context.Context, fc *FilterContext) erro
 		return nil
 	}
 	fc.Message = &msg
-	fc.Method = msg.Method
+	// Keep the method the proxy correlated a response with
+	if msg.Method != "" {
+		fc.Method = msg.Method
+	}
 	fc.Verdict = api.VerdictAllow
 	return nil
 }
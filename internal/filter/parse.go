@@ -2,6 +2,7 @@ package filter
 
 import (
 	"context"
+	"encoding/json"
 
 	"github.com/tkingovr/agent-guard/internal/jsonrpc"
 )
@@ -30,5 +31,17 @@ func (f *ParseFilter) Process(_ context.Context, fc *FilterContext) error {
 		fc.Arguments = tc.Arguments
 	}
 
+	// Record the client name so the proxy can carry it for the session
+	if msg.Method == "initialize" {
+		var params struct {
+			ClientInfo struct {
+				Name string `json:"name"`
+			} `json:"clientInfo"`
+		}
+		if json.Unmarshal(msg.Params, &params) == nil && params.ClientInfo.Name != "" {
+			fc.ClientName = params.ClientInfo.Name
+		}
+	}
+
 	return nil
 }
@@ -0,0 +1,107 @@
+package filter
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Pattern is a named regex used by the content scanners (secrets, PII,
+// prompt injection) to flag suspicious text.
+type Pattern struct {
+	Name  string
+	Regex *regexp.Regexp
+
+	// Keywords optionally prefilters text: the regex only runs when at least
+	// one keyword appears (case-insensitive).
+	Keywords []string
+
+	// Validate optionally confirms a candidate match (e.g., a checksum) to
+	// cut false positives. Nil accepts every regex match.
+	Validate func(match string) bool
+}
+
+// Validators maps the names accepted in policy YAML to match validators.
+var Validators = map[string]func(string) bool{
+	"luhn": luhnValid,
+	"iban": ibanValid,
+}
+
+// firstMatch returns the first pattern that matches text.
+func firstMatch(patterns []Pattern, text string) (Pattern, bool) {
+	for _, p := range patterns {
+		if p.matches(text) {
+			return p, true
+		}
+	}
+	return Pattern{}, false
+}
+
+// matches reports whether the pattern matches text and, when a validator is
+// set, whether at least one candidate passes it.
+func (p Pattern) matches(text string) bool {
+	if !p.hasKeyword(text) {
+		return false
+	}
+	if p.Validate == nil {
+		return p.Regex.MatchString(text)
+	}
+	for _, loc := range p.Regex.FindAllStringSubmatchIndex(text, -1) {
+		start, end := secretSpan(loc)
+		if p.Validate(text[start:end]) {
+			return true
+		}
+	}
+	return false
+}
+
+// redact replaces every validated match of the pattern in text with
+// replacement. When the regex has a capture group, only the first group is
+// replaced so surrounding context (e.g., "password=") is preserved.
+func (p Pattern) redact(text, replacement string) (string, int) {
+	if !p.hasKeyword(text) {
+		return text, 0
+	}
+	locs := p.Regex.FindAllStringSubmatchIndex(text, -1)
+	if len(locs) == 0 {
+		return text, 0
+	}
+	var out []byte
+	last, n := 0, 0
+	for _, loc := range locs {
+		start, end := secretSpan(loc)
+		if p.Validate != nil && !p.Validate(text[start:end]) {
+			continue
+		}
+		out = append(out, text[last:start]...)
+		out = append(out, replacement...)
+		last = end
+		n++
+	}
+	if n == 0 {
+		return text, 0
+	}
+	out = append(out, text[last:]...)
+	return string(out), n
+}
+
+func (p Pattern) hasKeyword(text string) bool {
+	if len(p.Keywords) == 0 {
+		return true
+	}
+	lower := strings.ToLower(text)
+	for _, kw := range p.Keywords {
+		if strings.Contains(lower, strings.ToLower(kw)) {
+			return true
+		}
+	}
+	return false
+}
+
+// secretSpan returns the span of the first capture group if it participated
+// in the match, otherwise the span of the whole match.
+func secretSpan(loc []int) (int, int) {
+	if len(loc) >= 4 && loc[2] >= 0 {
+		return loc[2], loc[3]
+	}
+	return loc[0], loc[1]
+}
@@ -0,0 +1,69 @@
+package filter
+
+import (
+	"regexp"
+	"strings"
+)
+
+// DefaultPIIPatterns returns the built-in set of personal data detectors.
+// Checksummed formats (cards, IBANs, Canadian SINs) are validated to keep
+// false positives low.
+func DefaultPIIPatterns() []Pattern {
+	return []Pattern{
+		{Name: "email", Regex: regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}`)},
+		{Name: "phone", Regex: regexp.MustCompile(`(?:\+\d{1,3}[\s.\-]?)?\(?\b\d{3}\)?[\s.\-]\d{3}[\s.\-]\d{4}\b`)},
+		{Name: "credit_card", Regex: regexp.MustCompile(`\b(?:\d[ \-]?){12,18}\d\b`), Validate: luhnValid},
+		{Name: "iban", Regex: regexp.MustCompile(`\b[A-Z]{2}\d{2}(?: ?[A-Z0-9]{4}){2,7}(?: ?[A-Z0-9]{1,3})?\b`), Validate: ibanValid},
+		{Name: "us_ssn", Regex: regexp.MustCompile(`\b(?:00[1-9]|0[1-9]\d|[1-578]\d{2}|6[0-57-9]\d|66[0-57-9])-(?:0[1-9]|[1-9]\d)-(?:000[1-9]|00[1-9]\d|0[1-9]\d{2}|[1-9]\d{3})\b`)},
+		{Name: "uk_nino", Regex: regexp.MustCompile(`\b[A-CEGHJ-PR-TW-Z][A-CEGHJ-NPR-TW-Z] ?\d{2} ?\d{2} ?\d{2} ?[A-D]\b`)},
+		{Name: "ca_sin", Regex: regexp.MustCompile(`\b\d{3}[ \-]\d{3}[ \-]\d{3}\b`), Validate: luhnValid},
+	}
+}
+
+// luhnValid reports whether the digits in s pass the Luhn checksum.
+// Separators (spaces, dashes) are ignored.
+func luhnValid(s string) bool {
+	sum, n := 0, 0
+	double := false
+	for i := len(s) - 1; i >= 0; i-- {
+		c := s[i]
+		if c == ' ' || c == '-' {
+			continue
+		}
+		if c < '0' || c > '9' {
+			return false
+		}
+		d := int(c - '0')
+		if double {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		double = !double
+		n++
+	}
+	return n >= 9 && sum%10 == 0
+}
+
+// ibanValid reports whether s is a syntactically valid IBAN (ISO 13616
+// mod-97 check). Spaces are ignored.
+func ibanValid(s string) bool {
+	s = strings.ReplaceAll(s, " ", "")
+	if len(s) < 15 || len(s) > 34 {
+		return false
+	}
+	rem := 0
+	for _, c := range s[4:] + s[:4] {
+		switch {
+		case c >= '0' && c <= '9':
+			rem = (rem*10 + int(c-'0')) % 97
+		case c >= 'A' && c <= 'Z':
+			rem = (rem*100 + int(c-'A') + 10) % 97
+		default:
+			return false
+		}
+	}
+	return rem == 1
+}
@@ -7,7 +7,10 @@ import (
 	"github.com/tkingovr/agent-guard/internal/policy"
 )
 
-// PolicyFilter evaluates the request against the policy engine.
+// PolicyFilter evaluates the request against the policy engine. Outbound,
+// it evaluates the requests a server makes of the client (sampling,
+// elicitation, roots) by the same rules; nobody approves those, so an ask
+// verdict denies them.
 type PolicyFilter struct {
 	engine policy.Engine
 }
@@ -19,22 +22,35 @@ func NewPolicyFilter(engine policy.Engine) *PolicyFilter {
 func (f *PolicyFilter) Name() string { return "policy" }
 
 func (f *PolicyFilter) Process(ctx context.Context, fc *FilterContext) error {
-	// Only evaluate inbound requests with a method
-	if fc.Direction != api.DirectionInbound || fc.Method == "" {
+	// Only evaluate messages with a method
+	if fc.Method == "" {
 		fc.Verdict = api.VerdictAllow
 		return nil
 	}
 
-	// Only evaluate requests (not responses)
+	// Only evaluate requests (not responses), and of the server's
+	// messages, only requests: its notifications answer the client's
 	if fc.Message != nil && fc.Message.IsResponse() {
 		fc.Verdict = api.VerdictAllow
 		return nil
 	}
+	if fc.Direction == api.DirectionOutbound && (fc.Message == nil || !fc.Message.IsRequest()) {
+		fc.Verdict = api.VerdictAllow
+		return nil
+	}
+
+	// A filter ahead of policy (e.g., an exhausted budget) already denied
+	if fc.Halted {
+		return nil
+	}
 
 	input := &policy.EvalInput{
 		Method:    fc.Method,
 		Tool:      fc.Tool,
+		Server:    fc.Server,
 		Arguments: fc.Arguments,
+		Budget:    fc.Budget,
+		Principal: fc.Principal,
 	}
 
 	result, err := f.engine.Evaluate(ctx, input)
@@ -44,7 +60,11 @@ func (f *PolicyFilter) Process(ctx context.Context, fc *FilterContext) error {
 
 	fc.Verdict = result.Verdict
 	fc.MatchedRule = result.Rule
+	fc.PolicyRule = result.Rule
 	fc.VerdictMessage = result.Message
+	if fc.Direction == api.DirectionOutbound && fc.Verdict == api.VerdictAsk {
+		fc.Verdict = api.VerdictDeny
+	}
 
 	if fc.Verdict == api.VerdictDeny || fc.Verdict == api.VerdictAsk {
 		fc.Halted = true
@@ -2,11 +2,41 @@ package filter
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"math"
+	"net/url"
+	"os"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/tkingovr/agent-guard/api"
+	"github.com/tkingovr/agent-guard/internal/filelock"
+	"github.com/tkingovr/agent-guard/internal/jsonrpc"
+)
+
+// Rate limit algorithms.
+const (
+	AlgorithmSlidingWindow = "sliding_window"
+	AlgorithmTokenBucket   = "token_bucket"
+)
+
+// What to do when a request exceeds a limit.
+const (
+	OnExceedDeny  = "deny"
+	OnExceedDelay = "delay"
+)
+
+// TagThrottled marks audit records for requests held by a rate limit.
+const TagThrottled = "throttled"
+
+const (
+	// sweepInterval is how often idle limiter state is evicted.
+	sweepInterval = time.Minute
+	// defaultMaxWait bounds how long delay mode holds a request.
+	defaultMaxWait = 10 * time.Second
 )
 
 // RateLimitConfig defines rate limiting rules.
@@ -16,117 +46,607 @@ type RateLimitConfig struct {
 
 	// PerTool maps tool names to per-tool rate limits.
 	PerTool map[string]*RateLimit
+
+	// PerMethod maps JSON-RPC methods to limits. Unlike the tool-scoped
+	// limits, these apply to any request (resources/read, prompts/get, ...).
+	PerMethod map[string]*RateLimit
+
+	// PerSession limits tool calls per client session.
+	PerSession *RateLimit
+
+	// PerClient limits tool calls per client name (from initialize).
+	PerClient *RateLimit
+
+	// PerArgument limits tool calls per value of a tool argument, e.g. one
+	// bucket per repo or per target host.
+	PerArgument []ArgumentRateLimit
+
+	// PerRule maps policy rule names to inline limits, applied when that
+	// rule matched the request.
+	PerRule map[string]*RateLimit
+
+	// OnExceed is deny (default) or delay. In delay mode a request over
+	// the limit is held until a slot frees up, for at most MaxWait, and
+	// only denied if none does. The wait is left to Chain.Admit.
+	OnExceed string
+
+	// MaxWait is the longest a request is held in delay mode. Default is
+	// 10s.
+	MaxWait time.Duration
+
+	// Quotas are calendar limits, e.g. 50 send_email per day.
+	Quotas []Quota
+
+	// StateFile, if set, persists counters so limits survive restarts and
+	// are shared by every proxy process using the same file.
+	StateFile string
+}
+
+// Quota limits requests per calendar day or month (local time). Tool
+// scopes it to one tool; otherwise Method scopes it to one method;
+// otherwise it counts all tool calls.
+type Quota struct {
+	Tool   string
+	Method string
+	Max    int
+	Period string // day | month
 }
 
 // RateLimit defines a single rate limit: max requests per time window.
 type RateLimit struct {
 	Max    int
 	Window time.Duration
+
+	// Algorithm is sliding_window (default) or token_bucket.
+	Algorithm string
+
+	// Burst is the token bucket capacity. Default is Max. Tokens refill at
+	// Max per Window.
+	Burst int
+
+	// Period, if set, makes this a calendar quota (day or month) and
+	// Window is unused.
+	Period string
+}
+
+// ArgumentRateLimit keys a limit by the value of a tool argument.
+type ArgumentRateLimit struct {
+	Tool     string
+	Argument string // dotted path into the arguments, e.g. "repo" or "target.url"
+	Host     bool   // key by the URL host of the value rather than the value
+	Limit    *RateLimit
 }
 
-// slidingWindow tracks request timestamps for rate limiting.
-type slidingWindow struct {
-	mu         sync.Mutex
-	timestamps []time.Time
+// limiterState is the state of one key. Sliding windows use Timestamps;
+// token buckets use Tokens and Last; quotas use Period and Count.
+type limiterState struct {
+	Timestamps []time.Time `json:"timestamps,omitempty"`
+	Tokens     float64     `json:"tokens,omitempty"`
+	Last       time.Time   `json:"last,omitempty"`
+	Period     string      `json:"period,omitempty"`
+	Count      int         `json:"count,omitempty"`
+
+	// Expires is when the state becomes indistinguishable from a fresh
+	// one and can be dropped.
+	Expires time.Time `json:"expires"`
 }
 
-// RateLimitFilter enforces per-tool and global rate limits using a sliding window.
+// check reports whether a request is allowed at now, without consuming.
+func (s *limiterState) check(limit *RateLimit, now time.Time) bool {
+	if limit.Period != "" {
+		return s.Period != periodLabel(limit.Period, now) || s.Count < limit.Max
+	}
+	if limit.Algorithm == AlgorithmTokenBucket {
+		return s.tokens(limit, now) >= 1
+	}
+	cutoff := now.Add(-limit.Window)
+	n := 0
+	for _, ts := range s.Timestamps {
+		if ts.After(cutoff) {
+			n++
+		}
+	}
+	return n < limit.Max
+}
+
+// wait returns how long until check would allow a request.
+func (s *limiterState) wait(limit *RateLimit, now time.Time) time.Duration {
+	if limit.Period != "" {
+		return periodEnd(limit.Period, now).Sub(now)
+	}
+	if limit.Algorithm == AlgorithmTokenBucket {
+		missing := 1 - s.tokens(limit, now)
+		if missing <= 0 {
+			return 0
+		}
+		rate := float64(limit.Max) / limit.Window.Seconds()
+		return time.Duration(missing / rate * float64(time.Second))
+	}
+	s.prune(limit, now)
+	over := len(s.Timestamps) - limit.Max
+	if over < 0 {
+		return 0
+	}
+	// Timestamps are in arrival order; the request fits once the
+	// over-th one ages out of the window.
+	return s.Timestamps[over].Add(limit.Window).Sub(now)
+}
+
+// take consumes one request.
+func (s *limiterState) take(limit *RateLimit, now time.Time) {
+	switch {
+	case limit.Period != "":
+		if label := periodLabel(limit.Period, now); s.Period != label {
+			s.Period, s.Count = label, 0
+		}
+		s.Count++
+		s.Expires = periodEnd(limit.Period, now)
+	case limit.Algorithm == AlgorithmTokenBucket:
+		s.Tokens = s.tokens(limit, now) - 1
+		s.Last = now
+		refill := (float64(limit.burst()) - s.Tokens) / float64(limit.Max) * limit.Window.Seconds()
+		s.Expires = now.Add(time.Duration(refill * float64(time.Second)))
+	default:
+		s.prune(limit, now)
+		s.Timestamps = append(s.Timestamps, now)
+		s.Expires = now.Add(limit.Window)
+	}
+}
+
+// tokens returns the bucket level at now after refilling.
+func (s *limiterState) tokens(limit *RateLimit, now time.Time) float64 {
+	capacity := float64(limit.burst())
+	if s.Last.IsZero() {
+		return capacity
+	}
+	rate := float64(limit.Max) / limit.Window.Seconds()
+	return min(capacity, s.Tokens+now.Sub(s.Last).Seconds()*rate)
+}
+
+func (s *limiterState) prune(limit *RateLimit, now time.Time) {
+	cutoff := now.Add(-limit.Window)
+	valid := 0
+	for _, ts := range s.Timestamps {
+		if ts.After(cutoff) {
+			s.Timestamps[valid] = ts
+			valid++
+		}
+	}
+	s.Timestamps = s.Timestamps[:valid]
+}
+
+// periodLabel names the calendar period containing t, e.g. "2026-10-18".
+func periodLabel(period string, t time.Time) string {
+	if period == "month" {
+		return t.Format("2006-01")
+	}
+	return t.Format("2006-01-02")
+}
+
+// periodEnd returns the start of the calendar period after the one
+// containing t.
+func periodEnd(period string, t time.Time) time.Time {
+	y, m, d := t.Date()
+	if period == "month" {
+		return time.Date(y, m+1, 1, 0, 0, 0, 0, t.Location())
+	}
+	return time.Date(y, m, d+1, 0, 0, 0, 0, t.Location())
+}
+
+func (l *RateLimit) burst() int {
+	if l.Burst > 0 {
+		return l.Burst
+	}
+	return l.Max
+}
+
+// limitCheck is one limit that applies to a request.
+type limitCheck struct {
+	key     string
+	limit   *RateLimit
+	rule    string
+	message string
+}
+
+// RateLimitFilter enforces rate limits and quotas keyed by tool, method,
+// session, client, argument value, and policy rule. A request is only
+// counted if every applicable limit allows it.
 type RateLimitFilter struct {
-	config  RateLimitConfig
-	mu      sync.RWMutex
-	windows map[string]*slidingWindow // key: tool name or "_global"
+	config RateLimitConfig
+	quotas []quotaLimit
+
+	mu        sync.Mutex
+	states    map[string]*limiterState
+	lastSweep time.Time
 }
 
 // NewRateLimitFilter creates a new rate limit filter.
 func NewRateLimitFilter(config RateLimitConfig) *RateLimitFilter {
-	return &RateLimitFilter{
-		config:  config,
-		windows: make(map[string]*slidingWindow),
+	f := &RateLimitFilter{
+		config: config,
+		states: make(map[string]*limiterState),
+	}
+	for _, q := range config.Quotas {
+		f.quotas = append(f.quotas, quotaLimit{
+			Quota: q,
+			limit: &RateLimit{Max: q.Max, Period: q.Period},
+		})
+	}
+	return f
+}
+
+// quotaLimit pairs a quota with the RateLimit the limiter state checks.
+type quotaLimit struct {
+	Quota
+	limit *RateLimit
+}
+
+// scope returns the quota's key and a description for messages, and
+// whether it applies to the request.
+func (q *quotaLimit) scope(fc *FilterContext) (key, desc string, ok bool) {
+	switch {
+	case q.Tool != "":
+		return q.Tool, fmt.Sprintf("tool %q", q.Tool), fc.Method == "tools/call" && fc.Tool == q.Tool
+	case q.Method != "":
+		return "method:" + q.Method, fmt.Sprintf("method %q", q.Method), fc.Method == q.Method
+	default:
+		return "tools", "tool calls", fc.Method == "tools/call"
 	}
 }
 
 func (f *RateLimitFilter) Name() string { return "rate_limit" }
 
-func (f *RateLimitFilter) Process(_ context.Context, fc *FilterContext) error {
-	// Only rate limit inbound tool calls
+func (f *RateLimitFilter) Process(ctx context.Context, fc *FilterContext) error {
+	// Only rate limit inbound requests
 	if fc.Direction != api.DirectionInbound {
 		return nil
 	}
 	if fc.Halted {
 		return nil
 	}
-	if fc.Method != "tools/call" {
+	if fc.Message != nil && !fc.Message.IsRequest() {
 		return nil
 	}
 
-	now := time.Now()
+	checks := f.applicable(fc)
+	if len(checks) == 0 {
+		return nil
+	}
 
-	// Check per-tool limit
-	if fc.Tool != "" {
-		if limit, ok := f.config.PerTool[fc.Tool]; ok {
-			if !f.allow(fc.Tool, limit, now) {
-				fc.Verdict = api.VerdictDeny
-				fc.MatchedRule = "rate_limit:" + fc.Tool
-				fc.VerdictMessage = fmt.Sprintf("rate limit exceeded for tool %q: max %d per %s",
-					fc.Tool, limit.Max, limit.Window)
-				fc.Halted = true
-				return nil
-			}
-		}
+	maxWait := f.config.MaxWait
+	if maxWait <= 0 {
+		maxWait = defaultMaxWait
+	}
+	blocked, wait, err := f.reserve(checks, time.Now())
+	if err != nil {
+		return err
 	}
+	if blocked == nil {
+		return nil
+	}
+	if f.config.OnExceed == OnExceedDelay && wait <= maxWait {
+		// Waited out in Admit, so the proxy goes on reading other messages
+		fc.Hold(f.Name(), func(ctx context.Context, fc *FilterContext) error {
+			return f.delay(ctx, fc, checks, maxWait)
+		})
+		return nil
+	}
+	f.deny(fc, blocked, wait)
+	return nil
+}
 
-	// Check global limit
-	if f.config.Global != nil {
-		if !f.allow("_global", f.config.Global, now) {
-			fc.Verdict = api.VerdictDeny
-			fc.MatchedRule = "rate_limit:global"
-			fc.VerdictMessage = fmt.Sprintf("global rate limit exceeded: max %d per %s",
-				f.config.Global.Max, f.config.Global.Window)
-			fc.Halted = true
+// delay holds a throttled request until all checks allow it, for at most
+// maxWait, then lets it through or denies it.
+func (f *RateLimitFilter) delay(ctx context.Context, fc *FilterContext, checks []limitCheck, maxWait time.Duration) error {
+	start := time.Now()
+	for {
+		blocked, wait, err := f.reserve(checks, time.Now())
+		if err != nil {
+			return err
+		}
+		if blocked == nil {
+			fc.Delay = time.Since(start)
+			fc.Tags = append(fc.Tags, TagThrottled)
+			return nil
+		}
+		if time.Since(start)+wait > maxWait {
+			f.deny(fc, blocked, wait)
+			fc.Delay = time.Since(start)
 			return nil
 		}
+
+		// Another request may take the freed slot first, so this re-checks
+		// after sleeping rather than reserving ahead.
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
 	}
+}
 
+// reserve takes a slot from every check if all of them allow the request.
+// Otherwise it takes nothing and returns the first blocking check and how
+// long until all of them would allow it. With a state file, the whole
+// check-and-take runs under the file lock on freshly loaded state.
+func (f *RateLimitFilter) reserve(checks []limitCheck, now time.Time) (*limitCheck, time.Duration, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.config.StateFile != "" {
+		unlock, err := filelock.Lock(f.config.StateFile)
+		if err != nil {
+			return nil, 0, fmt.Errorf("rate limit state: %w", err)
+		}
+		defer unlock()
+		if err := f.load(); err != nil {
+			return nil, 0, err
+		}
+	}
+	swept := f.sweep(now)
+
+	var blocked *limitCheck
+	var wait time.Duration
+	for i, c := range checks {
+		s := f.state(c.key, c.limit)
+		if s.check(c.limit, now) {
+			continue
+		}
+		if blocked == nil {
+			blocked = &checks[i]
+		}
+		wait = max(wait, s.wait(c.limit, now))
+	}
+	if blocked != nil {
+		if swept {
+			return blocked, wait, f.save()
+		}
+		return blocked, wait, nil
+	}
+	for _, c := range checks {
+		f.state(c.key, c.limit).take(c.limit, now)
+	}
+	return nil, 0, f.save()
+}
+
+// stateFile is the on-disk form of the limiter state.
+type stateFile struct {
+	States map[string]*limiterState `json:"states"`
+}
+
+// load replaces the in-memory state with the state file's. A missing or
+// unreadable file starts empty. Callers must hold f.mu and the file lock.
+func (f *RateLimitFilter) load() error {
+	data, err := os.ReadFile(f.config.StateFile)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("reading rate limit state: %w", err)
+	}
+	var sf stateFile
+	if len(data) > 0 {
+		// Writes are atomic, so a parse failure means the file was edited
+		// by hand; start over rather than block every request.
+		json.Unmarshal(data, &sf)
+	}
+	if sf.States == nil {
+		sf.States = make(map[string]*limiterState)
+	}
+	f.states = sf.States
 	return nil
 }
 
-// allow checks if a request is allowed under the given rate limit.
-func (f *RateLimitFilter) allow(key string, limit *RateLimit, now time.Time) bool {
-	f.mu.Lock()
-	w, ok := f.windows[key]
-	if !ok {
-		w = &slidingWindow{}
-		f.windows[key] = w
+// save writes the state file if persistence is enabled. Callers must hold
+// f.mu and the file lock.
+func (f *RateLimitFilter) save() error {
+	if f.config.StateFile == "" {
+		return nil
+	}
+	data, err := json.Marshal(stateFile{States: f.states})
+	if err != nil {
+		return err
 	}
-	f.mu.Unlock()
+	if err := filelock.WriteFile(f.config.StateFile, data, 0o600); err != nil {
+		return fmt.Errorf("writing rate limit state: %w", err)
+	}
+	return nil
+}
 
-	w.mu.Lock()
-	defer w.mu.Unlock()
+// deny rejects the request with a rate limit error whose data tells the
+// client when to retry.
+func (f *RateLimitFilter) deny(fc *FilterContext, c *limitCheck, retryAfter time.Duration) {
+	// Round up to the millisecond so retrying at retry_after succeeds
+	secs := math.Ceil(retryAfter.Seconds()*1000) / 1000
+	data, _ := json.Marshal(map[string]any{
+		"retry_after": secs,
+		"rule":        c.rule,
+	})
 
-	// Remove expired timestamps
-	cutoff := now.Add(-limit.Window)
-	valid := 0
-	for _, ts := range w.timestamps {
-		if ts.After(cutoff) {
-			w.timestamps[valid] = ts
-			valid++
+	fc.Verdict = api.VerdictDeny
+	fc.MatchedRule = c.rule
+	fc.VerdictMessage = fmt.Sprintf("%s (retry after %s)", c.message, time.Duration(secs*float64(time.Second)))
+	fc.ErrorCode = jsonrpc.ErrorCodeRateLimited
+	fc.ErrorData = data
+	fc.Halted = true
+}
+
+// applicable lists the limits for a request, most specific first.
+func (f *RateLimitFilter) applicable(fc *FilterContext) []limitCheck {
+	var checks []limitCheck
+
+	if fc.PolicyRule != "" {
+		if limit, ok := f.config.PerRule[fc.PolicyRule]; ok {
+			checks = append(checks, limitCheck{
+				key:     "rule:" + fc.PolicyRule,
+				limit:   limit,
+				rule:    "rate_limit:rule:" + fc.PolicyRule,
+				message: fmt.Sprintf("rate limit exceeded for rule %q: max %d per %s", fc.PolicyRule, limit.Max, limit.Window),
+			})
 		}
 	}
-	w.timestamps = w.timestamps[:valid]
 
-	// Check limit
-	if len(w.timestamps) >= limit.Max {
-		return false
+	if fc.Method == "tools/call" {
+		for _, al := range f.config.PerArgument {
+			if al.Tool != fc.Tool {
+				continue
+			}
+			value, ok := argumentValue(fc.Arguments, al.Argument, al.Host)
+			if !ok {
+				continue
+			}
+			checks = append(checks, limitCheck{
+				key:     "arg:" + al.Tool + "." + al.Argument + "=" + value,
+				limit:   al.Limit,
+				rule:    "rate_limit:" + al.Tool + "." + al.Argument,
+				message: fmt.Sprintf("rate limit exceeded for tool %q with %s %q: max %d per %s", al.Tool, al.Argument, value, al.Limit.Max, al.Limit.Window),
+			})
+		}
+
+		if fc.Tool != "" {
+			if limit, ok := f.config.PerTool[fc.Tool]; ok {
+				checks = append(checks, limitCheck{
+					key:     fc.Tool,
+					limit:   limit,
+					rule:    "rate_limit:" + fc.Tool,
+					message: fmt.Sprintf("rate limit exceeded for tool %q: max %d per %s", fc.Tool, limit.Max, limit.Window),
+				})
+			}
+		}
+	}
+
+	if limit, ok := f.config.PerMethod[fc.Method]; ok {
+		checks = append(checks, limitCheck{
+			key:     "method:" + fc.Method,
+			limit:   limit,
+			rule:    "rate_limit:method:" + fc.Method,
+			message: fmt.Sprintf("rate limit exceeded for method %q: max %d per %s", fc.Method, limit.Max, limit.Window),
+		})
 	}
 
-	// Record this request
-	w.timestamps = append(w.timestamps, now)
-	return true
+	for i := range f.quotas {
+		q := &f.quotas[i]
+		key, desc, ok := q.scope(fc)
+		if !ok {
+			continue
+		}
+		adj := "daily"
+		if q.Period == "month" {
+			adj = "monthly"
+		}
+		checks = append(checks, limitCheck{
+			key:     "quota:" + q.Period + ":" + key,
+			limit:   q.limit,
+			rule:    "rate_limit:quota:" + key,
+			message: fmt.Sprintf("%s quota exceeded for %s: max %d per %s", adj, desc, q.Max, q.Period),
+		})
+	}
+
+	if fc.Method != "tools/call" {
+		return checks
+	}
+
+	if limit := f.config.PerClient; limit != nil && fc.ClientName != "" {
+		checks = append(checks, limitCheck{
+			key:     "client:" + fc.ClientName,
+			limit:   limit,
+			rule:    "rate_limit:client",
+			message: fmt.Sprintf("rate limit exceeded for client %q: max %d per %s", fc.ClientName, limit.Max, limit.Window),
+		})
+	}
+	if limit := f.config.PerSession; limit != nil && fc.SessionID != "" {
+		checks = append(checks, limitCheck{
+			key:     "session:" + fc.SessionID,
+			limit:   limit,
+			rule:    "rate_limit:session",
+			message: fmt.Sprintf("session rate limit exceeded: max %d per %s", limit.Max, limit.Window),
+		})
+	}
+	if limit := f.config.Global; limit != nil {
+		checks = append(checks, limitCheck{
+			key:     "_global",
+			limit:   limit,
+			rule:    "rate_limit:global",
+			message: fmt.Sprintf("global rate limit exceeded: max %d per %s", limit.Max, limit.Window),
+		})
+	}
+	return checks
 }
 
-// Reset clears all rate limit windows (useful for testing).
+// state returns the limiter state for key, creating it if needed. Callers
+// must hold f.mu.
+func (f *RateLimitFilter) state(key string, limit *RateLimit) *limiterState {
+	s, ok := f.states[key]
+	if !ok {
+		s = &limiterState{}
+		f.states[key] = s
+	}
+	return s
+}
+
+// sweep drops expired state so per-session and per-argument keys don't
+// accumulate in long-running proxies or the state file. It reports whether
+// anything was dropped. Callers must hold f.mu.
+func (f *RateLimitFilter) sweep(now time.Time) bool {
+	if now.Sub(f.lastSweep) < sweepInterval {
+		return false
+	}
+	f.lastSweep = now
+	swept := false
+	for key, s := range f.states {
+		if now.After(s.Expires) {
+			delete(f.states, key)
+			swept = true
+		}
+	}
+	return swept
+}
+
+// Reset clears all rate limit state (useful for testing).
 func (f *RateLimitFilter) Reset() {
 	f.mu.Lock()
 	defer f.mu.Unlock()
-	f.windows = make(map[string]*slidingWindow)
+	f.states = make(map[string]*limiterState)
+}
+
+// argumentValue extracts the value at a dotted path in the arguments as a
+// string key, optionally reduced to its URL host.
+func argumentValue(args json.RawMessage, path string, host bool) (string, bool) {
+	if len(args) == 0 {
+		return "", false
+	}
+	var v any
+	if err := json.Unmarshal(args, &v); err != nil {
+		return "", false
+	}
+	for _, part := range strings.Split(path, ".") {
+		m, ok := v.(map[string]any)
+		if !ok {
+			return "", false
+		}
+		if v, ok = m[part]; !ok {
+			return "", false
+		}
+	}
+
+	var s string
+	switch val := v.(type) {
+	case string:
+		s = val
+	case nil:
+		return "", false
+	default:
+		data, _ := json.Marshal(val)
+		s = string(data)
+	}
+	if host {
+		u, err := url.Parse(s)
+		if err != nil || u.Host == "" {
+			// Bare "host:port" or "host" values
+			if u, err = url.Parse("//" + s); err != nil || u.Host == "" {
+				return "", false
+			}
+		}
+		s = u.Hostname()
+	}
+	return s, true
 }
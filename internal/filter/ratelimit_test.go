@@ -2,10 +2,14 @@ package filter
 
 import (
 	"context"
+	"encoding/json"
+	"path/filepath"
 	"testing"
 	"time"
 
 	"github.com/tkingovr/agent-guard/api"
+	"github.com/tkingovr/agent-guard/internal/jsonrpc"
+	"github.com/tkingovr/agent-guard/internal/policy"
 )
 
 func TestRateLimiter_PerToolLimit(t *testing.T) {
@@ -196,3 +200,383 @@ func TestRateLimitConfigFromPolicy(t *testing.T) {
 		t.Error("expected nil for nil settings")
 	}
 }
+
+func rateLimitCall(f *RateLimitFilter, tool, args string) *FilterContext {
+	fc := NewFilterContext(nil, api.DirectionInbound)
+	fc.Method = "tools/call"
+	fc.Tool = tool
+	if args != "" {
+		fc.Arguments = []byte(args)
+	}
+	f.Process(context.Background(), fc)
+	NewChain(newTestLogger()).Admit(context.Background(), fc)
+	return fc
+}
+
+func TestRateLimiter_TokenBucketBurst(t *testing.T) {
+	f := NewRateLimitFilter(RateLimitConfig{
+		PerTool: map[string]*RateLimit{
+			"search": {Max: 1, Window: 50 * time.Millisecond, Algorithm: AlgorithmTokenBucket, Burst: 3},
+		},
+	})
+
+	for i := 0; i < 3; i++ {
+		if fc := rateLimitCall(f, "search", ""); fc.Halted {
+			t.Fatalf("burst request %d should be allowed", i+1)
+		}
+	}
+	if fc := rateLimitCall(f, "search", ""); !fc.Halted {
+		t.Fatal("request beyond burst should be limited")
+	}
+
+	// One token refills per 50ms
+	time.Sleep(60 * time.Millisecond)
+	if fc := rateLimitCall(f, "search", ""); fc.Halted {
+		t.Error("request after refill should be allowed")
+	}
+	if fc := rateLimitCall(f, "search", ""); !fc.Halted {
+		t.Error("only one token should have refilled")
+	}
+}
+
+func TestRateLimiter_PerMethod(t *testing.T) {
+	f := NewRateLimitFilter(RateLimitConfig{
+		PerMethod: map[string]*RateLimit{
+			"resources/read": {Max: 1, Window: time.Minute},
+		},
+	})
+
+	for i, want := range []bool{false, true} {
+		fc := NewFilterContext(nil, api.DirectionInbound)
+		fc.Method = "resources/read"
+		f.Process(context.Background(), fc)
+		if fc.Halted != want {
+			t.Errorf("request %d: halted = %v, want %v", i+1, fc.Halted, want)
+		}
+		if want && fc.MatchedRule != "rate_limit:method:resources/read" {
+			t.Errorf("unexpected rule %s", fc.MatchedRule)
+		}
+	}
+}
+
+func TestRateLimiter_PerSessionAndClient(t *testing.T) {
+	f := NewRateLimitFilter(RateLimitConfig{
+		PerSession: &RateLimit{Max: 1, Window: time.Minute},
+		PerClient:  &RateLimit{Max: 2, Window: time.Minute},
+	})
+
+	call := func(session, client string) *FilterContext {
+		fc := NewFilterContext(nil, api.DirectionInbound)
+		fc.Method = "tools/call"
+		fc.Tool = "read_file"
+		fc.SessionID = session
+		fc.ClientName = client
+		f.Process(context.Background(), fc)
+		return fc
+	}
+
+	if fc := call("s1", "cursor"); fc.Halted {
+		t.Fatal("first call in s1 should be allowed")
+	}
+	if fc := call("s1", "cursor"); fc.MatchedRule != "rate_limit:session" {
+		t.Fatalf("second call in s1 should hit the session limit, got %q", fc.MatchedRule)
+	}
+	if fc := call("s2", "cursor"); fc.Halted {
+		t.Fatal("new session should have its own budget")
+	}
+	if fc := call("s3", "cursor"); fc.MatchedRule != "rate_limit:client" {
+		t.Fatalf("third cursor call should hit the client limit, got %q", fc.MatchedRule)
+	}
+	if fc := call("s4", "claude"); fc.Halted {
+		t.Error("other clients should not be affected")
+	}
+}
+
+func TestRateLimiter_PerArgument(t *testing.T) {
+	f := NewRateLimitFilter(RateLimitConfig{
+		PerArgument: []ArgumentRateLimit{
+			{Tool: "fetch", Argument: "url", Host: true, Limit: &RateLimit{Max: 1, Window: time.Minute}},
+			{Tool: "create_issue", Argument: "repo", Limit: &RateLimit{Max: 1, Window: time.Minute}},
+		},
+	})
+
+	if fc := rateLimitCall(f, "fetch", `{"url":"https://example.com/a"}`); fc.Halted {
+		t.Fatal("first fetch should be allowed")
+	}
+	fc := rateLimitCall(f, "fetch", `{"url":"https://example.com/b"}`)
+	if !fc.Halted || fc.MatchedRule != "rate_limit:fetch.url" {
+		t.Fatalf("same host should be limited, got %q", fc.MatchedRule)
+	}
+	if fc := rateLimitCall(f, "fetch", `{"url":"https://other.org/"}`); fc.Halted {
+		t.Error("other host should be allowed")
+	}
+
+	if fc := rateLimitCall(f, "create_issue", `{"repo":"a/b"}`); fc.Halted {
+		t.Fatal("first issue should be allowed")
+	}
+	if fc := rateLimitCall(f, "create_issue", `{"repo":"a/c"}`); fc.Halted {
+		t.Error("different repo should be allowed")
+	}
+	if fc := rateLimitCall(f, "create_issue", `{"repo":"a/b"}`); !fc.Halted {
+		t.Error("same repo should be limited")
+	}
+}
+
+func TestRateLimiter_PerRule(t *testing.T) {
+	f := NewRateLimitFilter(RateLimitConfig{
+		PerRule: map[string]*RateLimit{
+			"allow-shell": {Max: 1, Window: time.Minute},
+		},
+	})
+
+	call := func(rule string) *FilterContext {
+		fc := NewFilterContext(nil, api.DirectionInbound)
+		fc.Method = "tools/call"
+		fc.Tool = "run_command"
+		fc.PolicyRule = rule
+		f.Process(context.Background(), fc)
+		return fc
+	}
+
+	call("allow-shell")
+	if fc := call("allow-shell"); fc.MatchedRule != "rate_limit:rule:allow-shell" {
+		t.Errorf("expected rule limit, got %q", fc.MatchedRule)
+	}
+	if fc := call("other-rule"); fc.Halted {
+		t.Error("requests matched by other rules should not be limited")
+	}
+}
+
+func TestRateLimiter_DeniedRequestNotCounted(t *testing.T) {
+	f := NewRateLimitFilter(RateLimitConfig{
+		Global: &RateLimit{Max: 3, Window: time.Minute},
+		PerTool: map[string]*RateLimit{
+			"write_file": {Max: 1, Window: time.Minute},
+		},
+	})
+
+	rateLimitCall(f, "write_file", "")
+	for i := 0; i < 3; i++ {
+		if fc := rateLimitCall(f, "write_file", ""); !fc.Halted {
+			t.Fatal("write_file should be limited")
+		}
+	}
+
+	// The denied write_file calls must not have used up the global budget
+	for i := 0; i < 2; i++ {
+		if fc := rateLimitCall(f, "read_file", ""); fc.Halted {
+			t.Errorf("read_file %d should be allowed, got %q", i+1, fc.MatchedRule)
+		}
+	}
+}
+
+func TestRateLimiter_SweepsIdleState(t *testing.T) {
+	f := NewRateLimitFilter(RateLimitConfig{
+		PerSession: &RateLimit{Max: 5, Window: time.Millisecond},
+	})
+
+	for _, s := range []string{"a", "b", "c"} {
+		fc := NewFilterContext(nil, api.DirectionInbound)
+		fc.Method = "tools/call"
+		fc.Tool = "t"
+		fc.SessionID = s
+		f.Process(context.Background(), fc)
+	}
+	if len(f.states) != 3 {
+		t.Fatalf("expected 3 states, got %d", len(f.states))
+	}
+
+	time.Sleep(5 * time.Millisecond)
+	f.mu.Lock()
+	f.lastSweep = time.Time{}
+	f.sweep(time.Now())
+	n := len(f.states)
+	f.mu.Unlock()
+	if n != 0 {
+		t.Errorf("expected idle states to be evicted, %d left", n)
+	}
+}
+
+func TestRateLimitConfigFromPolicy_RuleLimits(t *testing.T) {
+	cfg := RateLimitConfigFromPolicy(nil, policy.Rule{
+		Name:      "allow-shell",
+		RateLimit: &policy.RateLimitRule{Max: 5, Window: "1m", Algorithm: "token_bucket", Burst: 10},
+	})
+	if cfg == nil {
+		t.Fatal("expected config for inline rule limits")
+	}
+	limit := cfg.PerRule["allow-shell"]
+	if limit == nil || limit.Max != 5 || limit.Window != time.Minute || limit.Burst != 10 || limit.Algorithm != AlgorithmTokenBucket {
+		t.Errorf("unexpected rule limit: %+v", limit)
+	}
+}
+
+func TestParseFilter_ClientName(t *testing.T) {
+	raw := []byte(`{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"clientInfo":{"name":"cursor","version":"1.0"}}}`)
+	fc := NewFilterContext(raw, api.DirectionInbound)
+	if err := NewParseFilter().Process(context.Background(), fc); err != nil {
+		t.Fatal(err)
+	}
+	if fc.ClientName != "cursor" {
+		t.Errorf("expected client name cursor, got %q", fc.ClientName)
+	}
+}
+
+func TestRateLimiter_DenyRetryAfter(t *testing.T) {
+	f := NewRateLimitFilter(RateLimitConfig{
+		PerTool: map[string]*RateLimit{
+			"search": {Max: 1, Window: time.Minute},
+		},
+	})
+
+	rateLimitCall(f, "search", "")
+	fc := rateLimitCall(f, "search", "")
+	if !fc.Halted {
+		t.Fatal("second request should be limited")
+	}
+	if fc.ErrorCode != jsonrpc.ErrorCodeRateLimited {
+		t.Errorf("expected error code %d, got %d", jsonrpc.ErrorCodeRateLimited, fc.ErrorCode)
+	}
+
+	var data struct {
+		RetryAfter float64 `json:"retry_after"`
+	}
+	if err := json.Unmarshal(fc.ErrorData, &data); err != nil {
+		t.Fatal(err)
+	}
+	if data.RetryAfter <= 59 || data.RetryAfter > 60 {
+		t.Errorf("expected retry_after just under 60s, got %v", data.RetryAfter)
+	}
+
+	resp := fc.DenyResponse()
+	if resp.Error.Code != jsonrpc.ErrorCodeRateLimited || len(resp.Error.Data) == 0 {
+		t.Errorf("deny response should carry the rate limit code and data: %+v", resp.Error)
+	}
+}
+
+func TestRateLimiter_DelayMode(t *testing.T) {
+	f := NewRateLimitFilter(RateLimitConfig{
+		PerTool: map[string]*RateLimit{
+			"search": {Max: 1, Window: 50 * time.Millisecond},
+		},
+		OnExceed: OnExceedDelay,
+		MaxWait:  time.Second,
+	})
+
+	if fc := rateLimitCall(f, "search", ""); fc.Halted || fc.Delay != 0 {
+		t.Fatal("first request should pass without delay")
+	}
+	fc := NewFilterContext(nil, api.DirectionInbound)
+	fc.Method = "tools/call"
+	fc.Tool = "search"
+	start := time.Now()
+	f.Process(context.Background(), fc)
+	if !fc.Held() || time.Since(start) > 20*time.Millisecond {
+		t.Fatal("request over the limit should be held for Admit, not waited on in Process")
+	}
+	if err := NewChain(newTestLogger()).Admit(context.Background(), fc); err != nil || fc.Halted {
+		t.Fatalf("delayed request should be let through, got %v, %q", err, fc.VerdictMessage)
+	}
+	if fc.Delay < 30*time.Millisecond {
+		t.Errorf("expected the request to be held, delay was %s", fc.Delay)
+	}
+	if len(fc.Tags) != 1 || fc.Tags[0] != TagThrottled {
+		t.Errorf("expected throttled tag, got %v", fc.Tags)
+	}
+	if rec := fc.ToAuditRecord(); rec.Delay != fc.Delay || rec.Duration < fc.Delay {
+		t.Errorf("audit record should include the delay: %+v", rec)
+	}
+}
+
+func TestRateLimiter_DelayExceedsMaxWait(t *testing.T) {
+	f := NewRateLimitFilter(RateLimitConfig{
+		PerTool: map[string]*RateLimit{
+			"search": {Max: 1, Window: time.Minute},
+		},
+		OnExceed: OnExceedDelay,
+		MaxWait:  10 * time.Millisecond,
+	})
+
+	rateLimitCall(f, "search", "")
+	start := time.Now()
+	fc := rateLimitCall(f, "search", "")
+	if !fc.Halted || fc.ErrorCode != jsonrpc.ErrorCodeRateLimited {
+		t.Fatal("request that can't be served within max_wait should be denied")
+	}
+	if time.Since(start) > 50*time.Millisecond {
+		t.Error("request should be denied without waiting")
+	}
+}
+
+func TestRateLimiter_DelayCancelled(t *testing.T) {
+	f := NewRateLimitFilter(RateLimitConfig{
+		PerTool: map[string]*RateLimit{
+			"search": {Max: 1, Window: time.Second},
+		},
+		OnExceed: OnExceedDelay,
+		MaxWait:  5 * time.Second,
+	})
+	rateLimitCall(f, "search", "")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	fc := NewFilterContext(nil, api.DirectionInbound)
+	fc.Method = "tools/call"
+	fc.Tool = "search"
+	f.Process(ctx, fc)
+	if err := NewChain(newTestLogger()).Admit(ctx, fc); err == nil {
+		t.Error("expected context error when cancelled while held")
+	}
+	if fc.Verdict != api.VerdictDeny {
+		t.Errorf("request cancelled while held should be denied, got %q", fc.Verdict)
+	}
+}
+
+func TestRateLimiter_DailyQuota(t *testing.T) {
+	f := NewRateLimitFilter(RateLimitConfig{
+		Quotas: []Quota{{Tool: "send_email", Max: 2, Period: "day"}},
+	})
+
+	rateLimitCall(f, "send_email", "")
+	rateLimitCall(f, "send_email", "")
+	fc := rateLimitCall(f, "send_email", "")
+	if !fc.Halted || fc.MatchedRule != "rate_limit:quota:send_email" {
+		t.Fatalf("third email should exceed the daily quota, got %q", fc.MatchedRule)
+	}
+	if fc := rateLimitCall(f, "read_file", ""); fc.Halted {
+		t.Error("other tools should not count against the quota")
+	}
+
+	// Yesterday's count doesn't carry over
+	f.states["quota:day:send_email"].Period = "2000-01-01"
+	if fc := rateLimitCall(f, "send_email", ""); fc.Halted {
+		t.Error("quota should reset in a new period")
+	}
+}
+
+func TestRateLimiter_PersistedState(t *testing.T) {
+	cfg := RateLimitConfig{
+		Quotas: []Quota{{Tool: "send_email", Max: 2, Period: "day"}},
+		PerTool: map[string]*RateLimit{
+			"search": {Max: 1, Window: time.Minute},
+		},
+		StateFile: filepath.Join(t.TempDir(), "ratelimit.json"),
+	}
+
+	first := NewRateLimitFilter(cfg)
+	rateLimitCall(first, "send_email", "")
+	rateLimitCall(first, "search", "")
+
+	// A restarted proxy, or a second one on the same machine, sees the
+	// counts so far.
+	second := NewRateLimitFilter(cfg)
+	if fc := rateLimitCall(second, "search", ""); !fc.Halted {
+		t.Error("search limit should survive a restart")
+	}
+	if fc := rateLimitCall(second, "send_email", ""); fc.Halted {
+		t.Fatal("second email should be within quota")
+	}
+	if fc := rateLimitCall(first, "send_email", ""); !fc.Halted {
+		t.Error("quota should be shared between filters using one state file")
+	}
+}
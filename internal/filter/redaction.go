@@ -0,0 +1,226 @@
+package filter
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/tkingovr/agent-guard/internal/filelock"
+)
+
+// CaptureMode controls how much of a tool call's arguments is kept in the
+// audit log.
+type CaptureMode string
+
+const (
+	// CaptureFull keeps arguments (with secrets and sensitive keys masked).
+	CaptureFull CaptureMode = "full"
+	// CaptureHashed replaces every value with a short keyed digest
+	// (HMAC-SHA256), keeping the structure so identical calls can still be
+	// correlated. Without the key, a digest can't be checked against a
+	// guessed value.
+	CaptureHashed CaptureMode = "hashed"
+	// CaptureTruncated shortens long string values.
+	CaptureTruncated CaptureMode = "truncated"
+	// CaptureNone drops arguments from the audit record entirely.
+	CaptureNone CaptureMode = "none"
+)
+
+const redactedValue = "[REDACTED]"
+
+// DefaultSensitiveKeys are argument keys whose values are always masked.
+var DefaultSensitiveKeys = []string{
+	"password", "passwd", "secret", "token", "api_key", "apikey",
+	"access_token", "refresh_token", "authorization", "private_key",
+}
+
+// RedactionConfig configures the audit redaction stage.
+type RedactionConfig struct {
+	// SensitiveKeys are argument keys (case-insensitive) whose values are
+	// masked, in addition to DefaultSensitiveKeys.
+	SensitiveKeys []string
+
+	// Capture is the default capture mode. Default is full.
+	Capture CaptureMode
+
+	// PerTool overrides the capture mode for individual tools.
+	PerTool map[string]CaptureMode
+
+	// TruncateLength is the maximum string length, in characters, kept in
+	// truncated mode. Default is 64.
+	TruncateLength int
+
+	// HashKey keys the digests of hashed mode (see LoadRedactionKey). Nil
+	// uses a random key, so digests only correlate within one process.
+	HashKey []byte
+}
+
+// RedactionFilter masks secrets and sensitive arguments before the audit
+// filter records them. It never changes what is forwarded upstream.
+type RedactionFilter struct {
+	keys     map[string]bool
+	capture  CaptureMode
+	perTool  map[string]CaptureMode
+	truncate int
+	hashKey  []byte
+}
+
+// NewRedactionFilter creates a redaction filter. A nil config masks only
+// scanner findings and DefaultSensitiveKeys.
+func NewRedactionFilter(cfg *RedactionConfig) *RedactionFilter {
+	f := &RedactionFilter{
+		keys:     make(map[string]bool),
+		capture:  CaptureFull,
+		perTool:  make(map[string]CaptureMode),
+		truncate: 64,
+	}
+	for _, k := range DefaultSensitiveKeys {
+		f.keys[k] = true
+	}
+	if cfg != nil && cfg.HashKey != nil {
+		f.hashKey = cfg.HashKey
+	} else {
+		f.hashKey = make([]byte, 32)
+		rand.Read(f.hashKey)
+	}
+	if cfg == nil {
+		return f
+	}
+	for _, k := range cfg.SensitiveKeys {
+		f.keys[strings.ToLower(k)] = true
+	}
+	if cfg.Capture != "" {
+		f.capture = cfg.Capture
+	}
+	for tool, mode := range cfg.PerTool {
+		f.perTool[tool] = mode
+	}
+	if cfg.TruncateLength > 0 {
+		f.truncate = cfg.TruncateLength
+	}
+	return f
+}
+
+func (f *RedactionFilter) Name() string { return "redaction" }
+
+func (f *RedactionFilter) Process(_ context.Context, fc *FilterContext) error {
+	if len(fc.Arguments) == 0 {
+		return nil
+	}
+
+	mode := f.capture
+	if m, ok := f.perTool[fc.Tool]; ok {
+		mode = m
+	}
+	if mode == CaptureNone {
+		// Non-nil but empty, so the record omits arguments altogether
+		fc.AuditArguments = json.RawMessage{}
+		return nil
+	}
+
+	var args any
+	if err := json.Unmarshal(fc.Arguments, &args); err != nil {
+		// Unparseable arguments may hold anything; don't log them
+		fc.AuditArguments = json.RawMessage(fmt.Sprintf("%q", redactedValue))
+		return nil
+	}
+
+	args = f.redact(args, fc.Secrets, mode)
+	data, err := json.Marshal(args)
+	if err != nil {
+		return fmt.Errorf("encoding redacted arguments: %w", err)
+	}
+	fc.AuditArguments = data
+	return nil
+}
+
+// redact masks sensitive keys and known secret values, then applies the
+// capture mode to each remaining leaf.
+func (f *RedactionFilter) redact(v any, secrets []string, mode CaptureMode) any {
+	switch val := v.(type) {
+	case map[string]any:
+		for k, child := range val {
+			if f.keys[strings.ToLower(k)] {
+				val[k] = redactedValue
+				continue
+			}
+			val[k] = f.redact(child, secrets, mode)
+		}
+		return val
+	case []any:
+		for i, child := range val {
+			val[i] = f.redact(child, secrets, mode)
+		}
+		return val
+	case string:
+		for _, s := range secrets {
+			if s != "" {
+				val = strings.ReplaceAll(val, s, redactedValue)
+			}
+		}
+		switch mode {
+		case CaptureHashed:
+			return f.hash(val)
+		case CaptureTruncated:
+			if utf8.RuneCountInString(val) > f.truncate {
+				return fmt.Sprintf("%s (%d bytes)", truncateStr(val, f.truncate), len(val))
+			}
+		}
+		return val
+	case nil, bool:
+		return val
+	default:
+		if mode == CaptureHashed {
+			return f.hash(fmt.Sprint(val))
+		}
+		return val
+	}
+}
+
+// hash returns a short digest of s under the install's key.
+func (f *RedactionFilter) hash(s string) string {
+	mac := hmac.New(sha256.New, f.hashKey)
+	mac.Write([]byte(s))
+	return "hmac:" + hex.EncodeToString(mac.Sum(nil)[:6])
+}
+
+// LoadRedactionKey reads the key for hashed capture from path, creating it
+// on first use. Proxies sharing a log_dir share the key, so their digests
+// of the same value match.
+func LoadRedactionKey(path string) ([]byte, error) {
+	unlock, err := filelock.Lock(path)
+	if err != nil {
+		return nil, fmt.Errorf("redaction key: %w", err)
+	}
+	defer unlock()
+
+	data, err := os.ReadFile(path)
+	if err == nil {
+		key, err := hex.DecodeString(strings.TrimSpace(string(data)))
+		if err != nil || len(key) == 0 {
+			return nil, fmt.Errorf("redaction key %s: not a hex key", path)
+		}
+		return key, nil
+	}
+	if !errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("reading redaction key: %w", err)
+	}
+
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	if err := filelock.WriteFile(path, []byte(hex.EncodeToString(key)+"\n"), 0o600); err != nil {
+		return nil, fmt.Errorf("writing redaction key: %w", err)
+	}
+	return key, nil
+}
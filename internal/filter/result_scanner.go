@@ -0,0 +1,191 @@
+package filter
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/tkingovr/agent-guard/api"
+)
+
+// ResultAction controls what the result scanner does with a finding.
+type ResultAction string
+
+const (
+	// ResultLog records the finding and forwards the result untouched.
+	ResultLog ResultAction = "log"
+	// ResultRedact rewrites the matched span in place.
+	ResultRedact ResultAction = "redact"
+	// ResultBlock replaces the whole result with a JSON-RPC error.
+	ResultBlock ResultAction = "block"
+)
+
+// severity orders actions so the strongest one wins when a result has
+// several findings.
+func (a ResultAction) severity() int {
+	switch a {
+	case ResultBlock:
+		return 2
+	case ResultRedact:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// resultContentKeys are the result fields that carry tool output
+// (tools/call) or resource contents (resources/read).
+var resultContentKeys = []string{"content", "structuredContent", "contents"}
+
+// ResultScannerFilter scans outbound tool results for secrets and personal
+// data, and logs, redacts, or blocks them before they reach the model.
+type ResultScannerFilter struct {
+	patterns      []Pattern
+	defaultAction ResultAction
+	actions       map[string]ResultAction
+}
+
+// ResultScannerOption configures the ResultScannerFilter.
+type ResultScannerOption func(*ResultScannerFilter)
+
+// WithResultPatterns sets the detectors to run (replaces defaults).
+func WithResultPatterns(patterns []Pattern) ResultScannerOption {
+	return func(f *ResultScannerFilter) {
+		f.patterns = patterns
+	}
+}
+
+// WithPII adds the built-in PII detectors to the secret patterns.
+func WithPII() ResultScannerOption {
+	return func(f *ResultScannerFilter) {
+		f.patterns = append(f.patterns, DefaultPIIPatterns()...)
+	}
+}
+
+// WithResultAction sets the action for findings without a per-pattern
+// override. Default is redact.
+func WithResultAction(action ResultAction) ResultScannerOption {
+	return func(f *ResultScannerFilter) {
+		f.defaultAction = action
+	}
+}
+
+// WithPatternAction overrides the action for a single detector by name.
+func WithPatternAction(name string, action ResultAction) ResultScannerOption {
+	return func(f *ResultScannerFilter) {
+		f.actions[name] = action
+	}
+}
+
+// NewResultScannerFilter creates a new outbound result scanner. By default it
+// runs the secret patterns from DefaultSecretPatterns and redacts findings.
+func NewResultScannerFilter(opts ...ResultScannerOption) *ResultScannerFilter {
+	f := &ResultScannerFilter{
+		patterns:      DefaultSecretPatterns(),
+		defaultAction: ResultRedact,
+		actions:       make(map[string]ResultAction),
+	}
+	for _, opt := range opts {
+		opt(f)
+	}
+	return f
+}
+
+func (f *ResultScannerFilter) Name() string { return "result_scanner" }
+
+func (f *ResultScannerFilter) Process(_ context.Context, fc *FilterContext) error {
+	// Only scan outbound results
+	if fc.Direction != api.DirectionOutbound || fc.Halted {
+		return nil
+	}
+	if fc.Message == nil || len(fc.Message.Result) == 0 {
+		return nil
+	}
+
+	var result map[string]any
+	if err := json.Unmarshal(fc.Message.Result, &result); err != nil {
+		return nil
+	}
+
+	found := map[string]ResultAction{}
+	redacted := 0
+	for _, key := range resultContentKeys {
+		if v, ok := result[key]; ok {
+			result[key] = f.walk(v, found, &redacted)
+		}
+	}
+
+	if len(found) == 0 {
+		return nil
+	}
+
+	names := make([]string, 0, len(found))
+	strongest := ResultLog
+	for name, action := range found {
+		names = append(names, name)
+		if action.severity() > strongest.severity() {
+			strongest = action
+		}
+	}
+	sort.Strings(names)
+
+	fc.MatchedRule = "result_scanner:" + names[0]
+	switch strongest {
+	case ResultBlock:
+		fc.Verdict = api.VerdictDeny
+		fc.VerdictMessage = fmt.Sprintf("tool result withheld: sensitive data detected (%s)", strings.Join(names, ", "))
+		fc.Halted = true
+		return nil
+	case ResultRedact:
+		fc.Verdict = api.VerdictLog
+		fc.VerdictMessage = fmt.Sprintf("redacted %d sensitive value(s) in tool result (%s)", redacted, strings.Join(names, ", "))
+		return fc.RewriteResult(result)
+	default:
+		fc.Verdict = api.VerdictLog
+		fc.VerdictMessage = fmt.Sprintf("sensitive data in tool result (%s)", strings.Join(names, ", "))
+		return nil
+	}
+}
+
+// walk scans every string in a decoded JSON value, redacting matches whose
+// action is redact, and records each finding with its action.
+func (f *ResultScannerFilter) walk(v any, found map[string]ResultAction, redacted *int) any {
+	switch val := v.(type) {
+	case string:
+		return f.scanString(val, found, redacted)
+	case map[string]any:
+		for k, child := range val {
+			val[k] = f.walk(child, found, redacted)
+		}
+	case []any:
+		for i, child := range val {
+			val[i] = f.walk(child, found, redacted)
+		}
+	}
+	return v
+}
+
+func (f *ResultScannerFilter) scanString(s string, found map[string]ResultAction, redacted *int) string {
+	for _, p := range f.patterns {
+		if !p.matches(s) {
+			continue
+		}
+		action := f.actionFor(p.Name)
+		found[p.Name] = action
+		if action == ResultRedact {
+			var n int
+			s, n = p.redact(s, "[REDACTED:"+p.Name+"]")
+			*redacted += n
+		}
+	}
+	return s
+}
+
+func (f *ResultScannerFilter) actionFor(name string) ResultAction {
+	if a, ok := f.actions[name]; ok {
+		return a
+	}
+	return f.defaultAction
+}
@@ -2,19 +2,20 @@ package filter
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"math"
+	"path"
 	"regexp"
+	"sort"
 	"strings"
+	"unicode/utf8"
 
 	"github.com/tkingovr/agent-guard/api"
 )
 
 // SecretPattern defines a named regex pattern for detecting secrets.
-type SecretPattern struct {
-	Name  string
-	Regex *regexp.Regexp
-}
+type SecretPattern = Pattern
 
 // DefaultSecretPatterns returns the built-in set of secret detection patterns.
 func DefaultSecretPatterns() []SecretPattern {
@@ -34,11 +35,44 @@ func DefaultSecretPatterns() []SecretPattern {
 	}
 }
 
+// SecretAction controls what the secret scanner does with a finding.
+type SecretAction string
+
+const (
+	SecretDeny   SecretAction = "deny"
+	SecretAsk    SecretAction = "ask"
+	SecretLog    SecretAction = "log"
+	SecretRedact SecretAction = "redact"
+)
+
+// severity orders actions so the strongest one decides the verdict when a
+// message has several findings.
+func (a SecretAction) severity() int {
+	switch a {
+	case SecretDeny:
+		return 3
+	case SecretAsk:
+		return 2
+	case SecretRedact:
+		return 1
+	default:
+		return 0
+	}
+}
+
 // SecretScannerFilter scans arguments for secrets using regex patterns and entropy analysis.
+// Encoded values (base64, hex, URL, escapes, gzip) are decoded a few layers
+// deep so trivially obfuscated secrets are still caught.
 type SecretScannerFilter struct {
 	patterns         []SecretPattern
 	entropyThreshold float64
 	minTokenLength   int
+
+	defaultAction SecretAction
+	actions       map[string]SecretAction
+	allowValues   map[string]bool
+	allowPaths    []string
+	exemptTools   map[string]bool
 }
 
 // SecretScannerOption configures the SecretScannerFilter.
@@ -51,6 +85,13 @@ func WithPatterns(patterns []SecretPattern) SecretScannerOption {
 	}
 }
 
+// WithExtraPatterns appends patterns to the current set (defaults included).
+func WithExtraPatterns(patterns []SecretPattern) SecretScannerOption {
+	return func(f *SecretScannerFilter) {
+		f.patterns = append(f.patterns, patterns...)
+	}
+}
+
 // WithEntropyThreshold sets the Shannon entropy threshold for high-entropy string detection.
 // Default is 4.5 (a random 32-char hex string has ~4.0 entropy).
 func WithEntropyThreshold(threshold float64) SecretScannerOption {
@@ -59,12 +100,63 @@ func WithEntropyThreshold(threshold float64) SecretScannerOption {
 	}
 }
 
+// WithMinTokenLength sets the minimum length of a string value before it is
+// considered for high-entropy detection. Default is 20.
+func WithMinTokenLength(n int) SecretScannerOption {
+	return func(f *SecretScannerFilter) {
+		f.minTokenLength = n
+	}
+}
+
+// WithSecretAction sets the action for findings without a per-pattern
+// override. Default is deny.
+func WithSecretAction(action SecretAction) SecretScannerOption {
+	return func(f *SecretScannerFilter) {
+		f.defaultAction = action
+	}
+}
+
+// WithSecretPatternAction overrides the action for a single pattern by name.
+// Use "high_entropy" for the entropy check.
+func WithSecretPatternAction(name string, action SecretAction) SecretScannerOption {
+	return func(f *SecretScannerFilter) {
+		f.actions[name] = action
+	}
+}
+
+// WithAllowlist ignores known-safe values (e.g., documented test keys) and
+// path arguments (path, file, uri, ...) that name an allowlisted path; the
+// call's other arguments are still scanned. Paths are path.Match globs,
+// matched after path.Clean; a trailing "/**" matches everything below a
+// directory.
+func WithAllowlist(values, paths []string) SecretScannerOption {
+	return func(f *SecretScannerFilter) {
+		for _, v := range values {
+			f.allowValues[v] = true
+		}
+		f.allowPaths = append(f.allowPaths, paths...)
+	}
+}
+
+// WithExemptTools skips scanning for calls to the given tools.
+func WithExemptTools(tools ...string) SecretScannerOption {
+	return func(f *SecretScannerFilter) {
+		for _, t := range tools {
+			f.exemptTools[t] = true
+		}
+	}
+}
+
 // NewSecretScannerFilter creates a new secret scanner filter.
 func NewSecretScannerFilter(opts ...SecretScannerOption) *SecretScannerFilter {
 	f := &SecretScannerFilter{
 		patterns:         DefaultSecretPatterns(),
 		entropyThreshold: 4.5,
 		minTokenLength:   20,
+		defaultAction:    SecretDeny,
+		actions:          make(map[string]SecretAction),
+		allowValues:      make(map[string]bool),
+		exemptTools:      make(map[string]bool),
 	}
 	for _, opt := range opts {
 		opt(f)
@@ -85,35 +177,310 @@ func (f *SecretScannerFilter) Process(_ context.Context, fc *FilterContext) erro
 		return nil
 	}
 
-	// Scan the raw message for secret patterns
-	text := string(fc.Raw)
+	if fc.Tool != "" && f.exemptTools[fc.Tool] {
+		return nil
+	}
+
+	var msg map[string]any
+	if err := json.Unmarshal(fc.Raw, &msg); err != nil {
+		// Not structured JSON; fall back to scanning the raw text
+		return f.scanRaw(fc)
+	}
 
-	// Check regex patterns
-	for _, p := range f.patterns {
-		if p.Regex.MatchString(text) {
-			fc.Verdict = api.VerdictDeny
-			fc.MatchedRule = "secret_scanner:" + p.Name
-			fc.VerdictMessage = fmt.Sprintf("potential secret detected: %s pattern matched", p.Name)
-			fc.Halted = true
-			return nil
-		}
+	scan := &secretScan{f: f, entropy: fc.Arguments != nil}
+	params := scan.walk("", "", msg["params"])
+	if len(scan.findings) == 0 {
+		return nil
 	}
+	fc.Secrets = append(fc.Secrets, scan.secrets...)
 
-	// Check high-entropy strings in arguments
-	if fc.Arguments != nil {
-		if token, found := f.findHighEntropyToken(string(fc.Arguments)); found {
-			fc.Verdict = api.VerdictDeny
-			fc.MatchedRule = "secret_scanner:high_entropy"
-			fc.VerdictMessage = fmt.Sprintf("potential secret detected: high-entropy string (%.1f bits) starting with %q",
-				shannonEntropy(token), truncateStr(token, 8))
-			fc.Halted = true
-			return nil
+	if scan.redactions > 0 {
+		if err := fc.RewriteParams(params); err != nil {
+			return err
 		}
 	}
 
+	best := scan.best()
+	fc.MatchedRule = "secret_scanner:" + best.name
+	fc.VerdictMessage = best.message
+	switch best.action {
+	case SecretDeny:
+		fc.Verdict = api.VerdictDeny
+		fc.Halted = true
+	case SecretAsk:
+		fc.Verdict = api.VerdictAsk
+		fc.Halted = true
+	case SecretRedact:
+		fc.Verdict = api.VerdictLog
+		fc.VerdictMessage = fmt.Sprintf("redacted %d potential secret(s) before forwarding (%s)",
+			scan.redactions, strings.Join(scan.names(), ", "))
+	default:
+		fc.Verdict = api.VerdictLog
+	}
+	return nil
+}
+
+// scanRaw is the legacy plain-text scan used when the message isn't JSON.
+func (f *SecretScannerFilter) scanRaw(fc *FilterContext) error {
+	if p, ok := firstMatch(f.patterns, string(fc.Raw)); ok {
+		fc.Verdict = api.VerdictDeny
+		fc.MatchedRule = "secret_scanner:" + p.Name
+		fc.VerdictMessage = fmt.Sprintf("potential secret detected: %s pattern matched", p.Name)
+		fc.Halted = true
+	}
 	return nil
 }
 
+func (f *SecretScannerFilter) actionFor(name string) SecretAction {
+	if a, ok := f.actions[name]; ok {
+		return a
+	}
+	return f.defaultAction
+}
+
+// pathKeys are the argument names whose values are taken as paths for the
+// path allowlist.
+var pathKeys = map[string]bool{
+	"path": true, "paths": true, "file": true, "files": true, "filename": true,
+	"file_path": true, "filepath": true, "uri": true, "dir": true, "directory": true,
+}
+
+// allowlistedPath reports whether value, the argument named key, is a path
+// that matches an allowlisted path glob.
+func (f *SecretScannerFilter) allowlistedPath(key, value string) bool {
+	if len(f.allowPaths) == 0 || !pathKeys[strings.ToLower(key)] {
+		return false
+	}
+	p := path.Clean(strings.TrimPrefix(value, "file://"))
+	for _, pattern := range f.allowPaths {
+		if matchPathGlob(pattern, p) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchPathGlob(pattern, p string) bool {
+	if dir, ok := strings.CutSuffix(pattern, "/**"); ok {
+		return p == dir || strings.HasPrefix(p, dir+"/")
+	}
+	ok, _ := path.Match(pattern, p)
+	return ok
+}
+
+// secretFinding is a single pattern (or entropy) hit within a message.
+type secretFinding struct {
+	name    string
+	order   int
+	action  SecretAction
+	message string
+}
+
+// secretScan accumulates findings while walking one message.
+type secretScan struct {
+	f          *SecretScannerFilter
+	entropy    bool
+	findings   map[string]*secretFinding
+	redactions int
+	secrets    []string // matched values, for audit redaction
+}
+
+// walk scans every string value in a decoded JSON value and returns it with
+// redact-action matches replaced. path locates the value within params and
+// key is the nearest object key.
+func (s *secretScan) walk(path, key string, v any) any {
+	switch val := v.(type) {
+	case string:
+		return s.scanValue(path, key, val)
+	case map[string]any:
+		for k, child := range val {
+			val[k] = s.walk(joinPath(path, k), k, child)
+		}
+	case []any:
+		for i, child := range val {
+			val[i] = s.walk(fmt.Sprintf("%s[%d]", path, i), key, child)
+		}
+	}
+	return v
+}
+
+// scanValue runs every pattern over a single value. The object key is
+// prepended so key-anchored patterns (e.g., "password: ...") still match,
+// but only spans inside the value count. What is left after plain-text
+// redaction is then decoded (base64, hex, URL, escapes, gzip) and scanned
+// again, so an encoded secret can't hide behind a harmless match.
+func (s *secretScan) scanValue(path, key, value string) string {
+	if s.f.allowValues[value] || s.f.allowlistedPath(key, value) {
+		return value
+	}
+
+	prefix := ""
+	if key != "" {
+		prefix = key + ": "
+	}
+
+	matched := false
+	for i, p := range s.f.patterns {
+		spans := s.spans(p, prefix, value)
+		if len(spans) == 0 {
+			continue
+		}
+
+		matched = true
+		for _, sp := range spans {
+			s.secrets = append(s.secrets, value[sp[0]:sp[1]])
+		}
+		action := s.f.actionFor(p.Name)
+		s.record(p.Name, i, action, fmt.Sprintf("potential secret detected: %s pattern matched", p.Name))
+		if action == SecretRedact {
+			value = replaceSpans(value, spans, "[REDACTED:"+p.Name+"]")
+			s.redactions += len(spans)
+		}
+	}
+
+	value, encoded := s.scanEncoded(path, prefix, value)
+	matched = matched || encoded
+
+	// A value already flagged by a pattern isn't re-scored for entropy.
+	if s.entropy && !matched && len(value) >= s.f.minTokenLength {
+		if e := shannonEntropy(value); e >= s.f.entropyThreshold {
+			s.secrets = append(s.secrets, value)
+			action := s.f.actionFor("high_entropy")
+			// Never quote the value: the message reaches the client and the audit log
+			where := path
+			if where == "" {
+				where = "arguments"
+			}
+			s.record("high_entropy", len(s.f.patterns), action,
+				fmt.Sprintf("potential secret detected: high-entropy string at %s (%.1f bits, %d chars)",
+					where, e, utf8.RuneCountInString(value)))
+			if action == SecretRedact {
+				value = "[REDACTED:high_entropy]"
+				s.redactions++
+			}
+		}
+	}
+
+	return value
+}
+
+// scanEncoded decodes candidate tokens in value and runs the patterns on
+// each decoded form. A redact action replaces the whole encoded token.
+func (s *secretScan) scanEncoded(path, prefix, value string) (string, bool) {
+	matched := false
+	for _, tok := range encodedCandidates(value) {
+		for _, form := range decodeLayers(tok) {
+			hit := false
+			for i, p := range s.f.patterns {
+				if len(s.spans(p, prefix, form.text)) == 0 {
+					continue
+				}
+				hit = true
+				s.secrets = append(s.secrets, tok)
+				action := s.f.actionFor(p.Name)
+				s.record(p.Name, i, action, fmt.Sprintf("potential secret detected: %s pattern matched (via %s) in argument %s",
+					p.Name, strings.Join(form.via, " > "), strings.TrimPrefix(path, "arguments.")))
+				if action == SecretRedact {
+					if at := strings.Index(value, tok); at >= 0 {
+						// Tokens are split on '=', so take any base64 padding with them
+						end := at + len(tok)
+						for end < len(value) && value[end] == '=' {
+							end++
+						}
+						value = value[:at] + "[REDACTED:" + p.Name + "]" + value[end:]
+						s.redactions++
+					}
+				}
+			}
+			if hit {
+				matched = true
+				break
+			}
+		}
+	}
+	return value, matched
+}
+
+// spans returns the byte spans of value matched by p, honoring keywords,
+// validators, and the value allowlist.
+func (s *secretScan) spans(p Pattern, prefix, value string) [][2]int {
+	text := prefix + value
+	if !p.hasKeyword(text) {
+		return nil
+	}
+	var spans [][2]int
+	for _, loc := range p.Regex.FindAllStringSubmatchIndex(text, -1) {
+		start, end := secretSpan(loc)
+		if start < len(prefix) {
+			continue
+		}
+		m := text[start:end]
+		if p.Validate != nil && !p.Validate(m) {
+			continue
+		}
+		if s.f.allowValues[m] {
+			continue
+		}
+		spans = append(spans, [2]int{start - len(prefix), end - len(prefix)})
+	}
+	return spans
+}
+
+func joinPath(parent, key string) string {
+	if parent == "" {
+		return key
+	}
+	return parent + "." + key
+}
+
+func (s *secretScan) record(name string, order int, action SecretAction, message string) {
+	if s.findings == nil {
+		s.findings = make(map[string]*secretFinding)
+	}
+	if _, ok := s.findings[name]; !ok {
+		s.findings[name] = &secretFinding{name: name, order: order, action: action, message: message}
+	}
+}
+
+// best returns the finding with the strongest action, ties broken by
+// pattern order so verdicts are deterministic.
+func (s *secretScan) best() *secretFinding {
+	var best *secretFinding
+	for _, fd := range s.findings {
+		if best == nil ||
+			fd.action.severity() > best.action.severity() ||
+			(fd.action.severity() == best.action.severity() && fd.order < best.order) {
+			best = fd
+		}
+	}
+	return best
+}
+
+func (s *secretScan) names() []string {
+	names := make([]string, 0, len(s.findings))
+	for name := range s.findings {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// replaceSpans replaces the given non-overlapping, ordered byte spans of s.
+func replaceSpans(s string, spans [][2]int, replacement string) string {
+	var b strings.Builder
+	last := 0
+	for _, sp := range spans {
+		if sp[0] < last {
+			continue
+		}
+		b.WriteString(s[last:sp[0]])
+		b.WriteString(replacement)
+		last = sp[1]
+	}
+	b.WriteString(s[last:])
+	return b.String()
+}
+
 // findHighEntropyToken splits text into tokens and checks each for high entropy.
 func (f *SecretScannerFilter) findHighEntropyToken(text string) (string, bool) {
 	// Extract string values from JSON-like text
@@ -180,9 +547,10 @@ func shannonEntropy(s string) float64 {
 	return entropy
 }
 
+// truncateStr shortens s to max characters, never splitting a rune.
 func truncateStr(s string, max int) string {
-	if len(s) > max {
-		return s[:max] + "..."
+	if utf8.RuneCountInString(s) > max {
+		return string([]rune(s)[:max]) + "..."
 	}
 	return s
 }
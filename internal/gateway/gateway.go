@@ -0,0 +1,514 @@
+package gateway
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/tkingovr/agent-guard/api"
+	"github.com/tkingovr/agent-guard/internal/approval"
+	"github.com/tkingovr/agent-guard/internal/filter"
+	"github.com/tkingovr/agent-guard/internal/jsonrpc"
+	"github.com/tkingovr/agent-guard/internal/relay"
+)
+
+// separator joins a server's name to the names of its tools and prompts.
+const separator = "."
+
+// connectTimeout bounds starting and initializing the servers.
+const connectTimeout = 30 * time.Second
+
+// maxListPages bounds the pages fetched from one server for a list.
+const maxListPages = 100
+
+// listKeys maps the list methods the gateway merges to the result field
+// holding their items.
+var listKeys = map[string]string{
+	"tools/list":               "tools",
+	"prompts/list":             "prompts",
+	"resources/list":           "resources",
+	"resources/templates/list": "resourceTemplates",
+}
+
+// routedMethods are the requests forwarded to the one server they name.
+var routedMethods = map[string]bool{
+	"tools/call":            true,
+	"prompts/get":           true,
+	"resources/read":        true,
+	"resources/subscribe":   true,
+	"resources/unsubscribe": true,
+	"completion/complete":   true,
+}
+
+// Gateway presents several MCP servers to a host as one, over stdio. The
+// servers' tools and prompts are named "<server>.<name>", list requests
+// are merged across servers, and other requests go to the server they
+// name. Every message goes through the same filter chains, so one policy
+// and one audit log cover all the servers.
+type Gateway struct {
+	logger        *slog.Logger
+	upstreams     []*Upstream
+	byName        map[string]*Upstream
+	inboundChain  *filter.Chain
+	outboundChain *filter.Chain
+	approvals     *relay.Approvals // nil without an approval queue
+	version       string
+
+	// A gateway serves exactly one client session.
+	sessionID string
+
+	// client writes to the host's stdout.
+	client *relay.LineWriter
+
+	ids      *relay.CorrelationIDs
+	inflight *relay.Inflight // host requests being handled
+
+	mu         sync.Mutex
+	clientName string
+	resources  map[string]*Upstream // resource URI or template → server that listed it
+	templates  []resourceTemplate
+}
+
+// resourceTemplate routes the URIs a server's resource template expands
+// to, by the part ahead of its first variable.
+type resourceTemplate struct {
+	prefix   string
+	upstream *Upstream
+}
+
+// Option configures optional gateway features.
+type Option func(*Gateway)
+
+// WithApprovalQueue holds requests with an ask verdict until a human
+// decides. Without it they are let through.
+func WithApprovalQueue(aq *approval.Queue) Option {
+	return func(g *Gateway) {
+		g.approvals = relay.NewApprovals(aq, g.logger, relay.WithToolName(qualifiedTool))
+	}
+}
+
+// WithVersion sets the version the gateway reports in its serverInfo.
+func WithVersion(version string) Option {
+	return func(g *Gateway) { g.version = version }
+}
+
+// New creates a gateway to upstreams, which must have distinct names.
+func New(upstreams []*Upstream, inbound, outbound *filter.Chain, logger *slog.Logger, opts ...Option) *Gateway {
+	sessionID := relay.NewSessionID()
+	g := &Gateway{
+		logger:        logger,
+		upstreams:     upstreams,
+		byName:        make(map[string]*Upstream, len(upstreams)),
+		inboundChain:  inbound,
+		outboundChain: outbound,
+		version:       "dev",
+		sessionID:     sessionID,
+		ids:           relay.NewCorrelationIDs(sessionID),
+		inflight:      relay.NewInflight(),
+		resources:     make(map[string]*Upstream),
+	}
+	for _, u := range upstreams {
+		g.byName[u.Name] = u
+	}
+	for _, opt := range opts {
+		opt(g)
+	}
+	return g
+}
+
+// Run connects to the servers, then serves the host on in and out until
+// in ends or ctx is done. A server that can't be reached is left out; Run
+// fails only if none can.
+func (g *Gateway) Run(ctx context.Context, in io.Reader, out io.Writer) error {
+	g.client = relay.NewLineWriter(out)
+	defer g.close()
+	if err := g.connect(ctx); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- g.serve(ctx, in)
+	}()
+	select {
+	case err := <-errCh:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// connect connects to every server at once.
+func (g *Gateway) connect(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, connectTimeout)
+	defer cancel()
+
+	errs := make([]error, len(g.upstreams))
+	var wg sync.WaitGroup
+	for i, u := range g.upstreams {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = u.connect(ctx, g.notify)
+		}()
+	}
+	wg.Wait()
+
+	connected := 0
+	for i, u := range g.upstreams {
+		if errs[i] != nil {
+			g.logger.Error("server unavailable", "server", u.Name, "error", errs[i])
+			u.close()
+			continue
+		}
+		g.logger.Info("server connected", "server", u.Name)
+		connected++
+	}
+	if connected == 0 {
+		return fmt.Errorf("none of the %d servers could be reached", len(g.upstreams))
+	}
+	return nil
+}
+
+func (g *Gateway) close() {
+	var wg sync.WaitGroup
+	for _, u := range g.upstreams {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			u.close()
+		}()
+	}
+	wg.Wait()
+}
+
+// serve reads the host's messages, handling each in its own goroutine so
+// a slow call or a pending approval doesn't hold up the others.
+func (g *Gateway) serve(ctx context.Context, in io.Reader) error {
+	scanner := bufio.NewScanner(in)
+	scanner.Buffer(make([]byte, 0, 1024*1024), maxMessageSize)
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		line := bytes.Clone(scanner.Bytes())
+
+		msgs := []json.RawMessage{line}
+		batch := false
+		if jsonrpc.IsBatch(line) {
+			// A batch that doesn't split is handled as one message, which
+			// gets the error
+			if split, err := jsonrpc.SplitBatch(line); err == nil {
+				msgs, batch = split, true
+			}
+		}
+		// Tracked before the next message is read, so a cancel that
+		// follows finds its request
+		ctxs := make([]context.Context, len(msgs))
+		dones := make([]func(), len(msgs))
+		for i, raw := range msgs {
+			ctxs[i], dones[i] = g.track(ctx, raw)
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			out := make([][]byte, len(msgs))
+			var handled sync.WaitGroup
+			for i, raw := range msgs {
+				handled.Add(1)
+				go func() {
+					defer handled.Done()
+					defer dones[i]()
+					out[i] = g.handle(ctxs[i], raw)
+				}()
+			}
+			handled.Wait()
+
+			out = slices.DeleteFunc(out, func(b []byte) bool { return b == nil })
+			switch {
+			case len(out) == 0:
+			case batch:
+				g.write(jsonrpc.JoinBatch(out))
+			default:
+				g.write(out[0])
+			}
+		}()
+	}
+
+	return scanner.Err()
+}
+
+// track registers a request from the host, so a notifications/cancelled
+// for it can stop it. done forgets it.
+func (g *Gateway) track(ctx context.Context, raw []byte) (reqCtx context.Context, done func()) {
+	msg, err := jsonrpc.Parse(raw)
+	if err != nil || !msg.IsRequest() {
+		return ctx, func() {}
+	}
+	return g.inflight.Start(ctx, g.sessionID, msg.ID)
+}
+
+// handle processes a message from the host and returns the response to
+// send back, or nil if there is none.
+func (g *Gateway) handle(ctx context.Context, raw []byte) []byte {
+	upstream, raw, routeErr := g.route(raw)
+	fc := g.filterInbound(ctx, raw, upstream)
+
+	switch fc.Verdict {
+	case api.VerdictDeny:
+		return g.deny(fc)
+	case api.VerdictAsk:
+		if g.approvals != nil {
+			approved, resp := g.approvals.Decide(ctx, fc, g.client.WriteMessage)
+			if !approved {
+				if resp == nil {
+					return nil
+				}
+				return marshal(resp)
+			}
+		}
+	}
+	// Waits a filter deferred (e.g., throttling) are over before forwarding
+	if err := g.inboundChain.Admit(ctx, fc); err != nil {
+		if ctx.Err() != nil {
+			// Cancelled while held; there is nothing to answer
+			fc.Finish()
+			return nil
+		}
+		g.logger.Error("inbound filter error", "error", err)
+	}
+	if fc.Verdict == api.VerdictDeny {
+		return g.deny(fc)
+	}
+
+	// Answer locally (e.g., decoy resources) instead of forwarding
+	if fc.Response != nil {
+		fc.Finish()
+		return fc.Response
+	}
+	defer fc.Finish()
+
+	msg := fc.Message
+	if msg == nil {
+		// Let through by a chain failing open
+		return marshal(jsonrpc.NewErrorResponse(jsonrpc.RequestID(fc.Raw), jsonrpc.ErrorCodeParseError, "invalid JSON-RPC message", nil))
+	}
+	if !msg.IsRequest() {
+		// Notifications are between the host and the gateway, which
+		// handled a cancel when filtering it
+		return nil
+	}
+
+	switch {
+	case msg.Method == "initialize":
+		return g.respond(msg.ID, g.initializeResult(msg))
+	case msg.Method == "ping":
+		return g.respond(msg.ID, struct{}{})
+	case msg.Method == "logging/setLevel":
+		g.broadcast(ctx, fc)
+		return g.respond(msg.ID, struct{}{})
+	case listKeys[msg.Method] != "":
+		return g.respond(msg.ID, g.list(ctx, fc))
+	case routedMethods[msg.Method]:
+		if routeErr != nil {
+			return marshal(jsonrpc.NewErrorResponse(msg.ID, jsonrpc.ErrorCodeInvalidParams, routeErr.Error(), nil))
+		}
+		return g.forward(ctx, upstream, fc)
+	}
+	return marshal(jsonrpc.NewErrorResponse(msg.ID, jsonrpc.ErrorCodeMethodNotFound, "method not found: "+msg.Method, nil))
+}
+
+// filterInbound runs a message from the host through the inbound chain.
+func (g *Gateway) filterInbound(ctx context.Context, raw []byte, upstream *Upstream) *filter.FilterContext {
+	fc := filter.NewFilterContext(raw, api.DirectionInbound)
+	fc.SessionID = g.sessionID
+	fc.CorrelationID = g.ids.Next()
+	if upstream != nil {
+		fc.Server = upstream.Name
+	}
+	g.mu.Lock()
+	fc.ClientName = g.clientName
+	g.mu.Unlock()
+
+	// A failed filter leaves a deny (or, failing open, an allow) verdict
+	if err := g.inboundChain.Process(ctx, fc); err != nil {
+		g.logger.Error("inbound filter error", "error", err)
+	}
+
+	g.mu.Lock()
+	if g.clientName == "" && fc.ClientName != "" {
+		g.clientName = fc.ClientName
+	}
+	g.mu.Unlock()
+	// Stop a cancelled request, whatever the policy says about the
+	// notification itself
+	if id := jsonrpc.CancelledRequestID(fc.Message); id != nil {
+		g.inflight.Cancel(g.sessionID, id)
+	}
+	if fc.Verdict == api.VerdictAsk {
+		g.logger.Info("request pending approval",
+			"method", fc.Method,
+			"server", fc.Server,
+			"tool", fc.Tool,
+			"rule", fc.MatchedRule,
+		)
+	}
+	return fc
+}
+
+// deny finishes a denied message and returns the error response for the
+// host, or nil for a notification.
+func (g *Gateway) deny(fc *filter.FilterContext) []byte {
+	g.logger.Warn("request denied",
+		"method", fc.Method,
+		"server", fc.Server,
+		"tool", fc.Tool,
+		"rule", fc.MatchedRule,
+		"message", fc.VerdictMessage,
+	)
+	fc.Finish()
+	if fc.Message == nil || fc.Message.ID != nil {
+		return marshal(fc.DenyResponse())
+	}
+	return nil
+}
+
+// qualifiedTool is the tool as the host knows it, with its server prefix.
+func qualifiedTool(fc *filter.FilterContext) string {
+	if fc.Server == "" || fc.Tool == "" {
+		return fc.Tool
+	}
+	return fc.Server + separator + fc.Tool
+}
+
+// forward sends an allowed request to its server and returns the
+// server's response, filtered. A request the host cancelled gets none.
+func (g *Gateway) forward(ctx context.Context, upstream *Upstream, fc *filter.FilterContext) []byte {
+	req := fc.Message
+	if fc.Rewritten != nil {
+		rewritten, err := jsonrpc.Parse(fc.Rewritten)
+		if err != nil {
+			g.logger.Error("parsing rewritten request", "error", err)
+			return marshal(jsonrpc.NewErrorResponse(req.ID, jsonrpc.ErrorCodeInternalError, "internal error", nil))
+		}
+		req = rewritten
+	}
+
+	resp, err := upstream.call(ctx, req)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil
+		}
+		g.logger.Error("server request failed",
+			"server", upstream.Name,
+			"method", fc.Method,
+			"error", err,
+		)
+		return marshal(jsonrpc.NewErrorResponse(req.ID, jsonrpc.ErrorCodeInternalError, fmt.Sprintf("server %s: %v", upstream.Name, err), nil))
+	}
+	resp.ID = req.ID
+	return g.filterOutbound(ctx, upstream, marshal(resp), fc)
+}
+
+// broadcast sends a request to every server that supports it, for
+// settings that apply to all of them.
+func (g *Gateway) broadcast(ctx context.Context, fc *filter.FilterContext) {
+	var wg sync.WaitGroup
+	for _, u := range g.upstreams {
+		if !u.offers(fc.Method) {
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp, err := u.call(ctx, fc.Message)
+			if err == nil && resp.Error != nil {
+				err = errors.New(resp.Error.Message)
+			}
+			if err != nil {
+				g.logger.Warn("server request failed", "server", u.Name, "method", fc.Method, "error", err)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// filterOutbound runs a message from a server through the outbound chain;
+// req is the host request it answers, if any. It returns what to send the
+// host: the message, possibly rewritten, an error in place of a blocked
+// response, or nil to drop it.
+func (g *Gateway) filterOutbound(ctx context.Context, upstream *Upstream, raw []byte, req *filter.FilterContext) []byte {
+	if g.outboundChain == nil {
+		return raw
+	}
+	fc := filter.NewFilterContext(raw, api.DirectionOutbound)
+	fc.SessionID = g.sessionID
+	fc.Server = upstream.Name
+	if req != nil {
+		relay.Join(fc, req)
+	}
+	if err := g.outboundChain.Process(ctx, fc); err != nil {
+		g.logger.Error("outbound filter error", "error", err)
+	}
+	if fc.Verdict != api.VerdictDeny {
+		return fc.Output()
+	}
+
+	g.logger.Warn("response blocked",
+		"server", upstream.Name,
+		"rule", fc.MatchedRule,
+		"message", fc.VerdictMessage,
+	)
+	if fc.Message == nil || !fc.Message.IsResponse() {
+		return nil
+	}
+	return marshal(fc.DenyResponse())
+}
+
+// notify passes a notification from a server on to the host.
+func (g *Gateway) notify(upstream *Upstream, msg *api.JSONRPCMessage) {
+	// A server cancels only requests of its own, which the gateway
+	// answered itself
+	if msg.Method == "notifications/cancelled" {
+		return
+	}
+	if out := g.filterOutbound(context.Background(), upstream, marshal(msg), nil); out != nil {
+		g.write(out)
+	}
+}
+
+func (g *Gateway) respond(id json.RawMessage, result any) []byte {
+	data, err := json.Marshal(result)
+	if err != nil {
+		return marshal(jsonrpc.NewErrorResponse(id, jsonrpc.ErrorCodeInternalError, "encoding result: "+err.Error(), nil))
+	}
+	return marshal(jsonrpc.NewResultResponse(id, data))
+}
+
+func (g *Gateway) write(data []byte) {
+	if err := g.client.WriteLine(data); err != nil {
+		g.logger.Error("writing to host", "error", err)
+	}
+}
+
+// marshal encodes a message built by the gateway, which can't fail.
+func marshal(msg *api.JSONRPCMessage) []byte {
+	data, _ := json.Marshal(msg)
+	return data
+}
@@ -0,0 +1,322 @@
+package gateway
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tkingovr/agent-guard/api"
+	"github.com/tkingovr/agent-guard/internal/approval"
+	"github.com/tkingovr/agent-guard/internal/audit"
+	"github.com/tkingovr/agent-guard/internal/filter"
+	"github.com/tkingovr/agent-guard/internal/jsonrpc"
+	"github.com/tkingovr/agent-guard/internal/policy"
+)
+
+// lineSink collects each line written to it.
+type lineSink chan string
+
+func (s lineSink) Write(p []byte) (int, error) {
+	s <- strings.TrimSuffix(string(p), "\n")
+	return len(p), nil
+}
+
+// fakeServer answers the requests of a minimal MCP server called name.
+// Its tools come in two pages; with resources it has one, notes.txt.
+func fakeServer(name string, resources bool, msg *api.JSONRPCMessage) *api.JSONRPCMessage {
+	var params struct {
+		Name   string `json:"name"`
+		URI    string `json:"uri"`
+		Cursor string `json:"cursor"`
+	}
+	_ = json.Unmarshal(msg.Params, &params)
+
+	var result any
+	switch msg.Method {
+	case "initialize":
+		caps := map[string]any{"tools": map[string]any{}}
+		if resources {
+			caps["resources"] = map[string]any{}
+		}
+		result = map[string]any{"protocolVersion": protocolVersion, "capabilities": caps, "serverInfo": map[string]string{"name": name}}
+	case "tools/list":
+		if params.Cursor == "" {
+			result = map[string]any{"tools": []map[string]string{{"name": "read"}}, "nextCursor": "2"}
+		} else {
+			result = map[string]any{"tools": []map[string]string{{"name": "delete"}}}
+		}
+	case "tools/call":
+		result = map[string]any{"content": []map[string]string{{"type": "text", "text": name + ": " + params.Name}}}
+	case "resources/read":
+		result = map[string]any{"contents": []map[string]string{{"uri": params.URI, "text": "notes"}}}
+	default:
+		if msg.IsRequest() {
+			return jsonrpc.NewErrorResponse(msg.ID, jsonrpc.ErrorCodeMethodNotFound, "method not found", nil)
+		}
+		return nil
+	}
+	data, _ := json.Marshal(result)
+	return jsonrpc.NewResultResponse(msg.ID, data)
+}
+
+// TestHelperServer isn't a real test: the gateway runs the test binary as
+// a stdio MCP server with GATEWAY_HELPER_SERVER set.
+func TestHelperServer(t *testing.T) {
+	if os.Getenv("GATEWAY_HELPER_SERVER") == "" {
+		return
+	}
+	scanner := bufio.NewScanner(os.Stdin)
+	for scanner.Scan() {
+		msg, err := jsonrpc.Parse(scanner.Bytes())
+		if err != nil {
+			continue
+		}
+		if resp := fakeServer(os.Getenv("GATEWAY_HELPER_SERVER"), true, msg); resp != nil {
+			data, _ := json.Marshal(resp)
+			fmt.Printf("%s\n", data)
+		}
+	}
+	os.Exit(0)
+}
+
+// newHTTPServer serves fakeServer over Streamable HTTP, answering tool
+// calls with an SSE stream.
+func newHTTPServer(t *testing.T, name string) *httptest.Server {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer t0k" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if r.Method == http.MethodDelete {
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		msg, err := jsonrpc.Parse(body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if msg.Method == "initialize" {
+			w.Header().Set("Mcp-Session-Id", "s-"+name)
+		} else if r.Header.Get("Mcp-Session-Id") != "s-"+name {
+			http.Error(w, "no session", http.StatusNotFound)
+			return
+		}
+		resp := fakeServer(name, false, msg)
+		if resp == nil {
+			w.WriteHeader(http.StatusAccepted)
+			return
+		}
+		data, _ := json.Marshal(resp)
+		if msg.Method == "tools/call" {
+			w.Header().Set("Content-Type", "text/event-stream")
+			fmt.Fprintf(w, "event: message\ndata: %s\n\n", data)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(data)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// host drives a gateway as its host would.
+type host struct {
+	t    *testing.T
+	in   *io.PipeWriter
+	out  lineSink
+	done chan error
+}
+
+// startGateway runs a gateway to a stdio server "files" and an HTTP server
+// "github", under rules, and connects a host to it.
+func startGateway(t *testing.T, rules []policy.Rule, opts ...Option) (*host, audit.Store) {
+	t.Helper()
+	github := newHTTPServer(t, "github")
+
+	store, err := audit.NewJSONLStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.Close() })
+	engine, err := policy.NewYAMLEngineFromPolicy(&policy.PolicyFile{
+		Version:  1,
+		Settings: policy.Settings{DefaultAction: api.VerdictAllow},
+		Rules:    rules,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	cfg := filter.ChainConfig{Engine: engine, AuditStore: store, Logger: logger}
+
+	g := New([]*Upstream{
+		NewUpstream(policy.ServerSettings{
+			Name:    "files",
+			Command: os.Args[0],
+			Args:    []string{"-test.run=^TestHelperServer$"},
+			Env:     map[string]string{"GATEWAY_HELPER_SERVER": "files"},
+		}, nil, logger),
+		NewUpstream(policy.ServerSettings{
+			Name:    "github",
+			URL:     github.URL,
+			Headers: map[string]string{"Authorization": "Bearer t0k"},
+		}, nil, logger),
+	}, filter.BuildInboundChain(cfg), filter.BuildOutboundChain(cfg), logger, opts...)
+
+	hostIn, toGateway := io.Pipe()
+	h := &host{t: t, in: toGateway, out: make(lineSink, 16), done: make(chan error, 1)}
+	go func() { h.done <- g.Run(context.Background(), hostIn, h.out) }()
+	return h, store
+}
+
+func (h *host) write(msg string) {
+	h.t.Helper()
+	if _, err := h.in.Write([]byte(msg + "\n")); err != nil {
+		h.t.Fatal(err)
+	}
+}
+
+func (h *host) read() string {
+	h.t.Helper()
+	select {
+	case line := <-h.out:
+		return line
+	case <-time.After(10 * time.Second):
+		h.t.Fatal("no message from the gateway")
+		return ""
+	}
+}
+
+// close ends the host's input and waits for the gateway to stop.
+func (h *host) close() {
+	h.t.Helper()
+	h.in.Close()
+	if err := <-h.done; err != nil {
+		h.t.Fatalf("gateway: %v", err)
+	}
+}
+
+func TestGateway(t *testing.T) {
+	h, store := startGateway(t, []policy.Rule{
+		{Name: "no-github-deletes", Match: policy.RuleMatch{Method: "tools/call", Server: "github", Tool: "delete"}, Action: "deny"},
+	})
+	send := func(req string) string {
+		t.Helper()
+		h.write(req)
+		return h.read()
+	}
+	call := func(tool string) string {
+		t.Helper()
+		return send(`{"jsonrpc":"2.0","id":5,"method":"tools/call","params":{"name":"` + tool + `"}}`)
+	}
+
+	init := send(`{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"protocolVersion":"2025-03-26","clientInfo":{"name":"test-host"}}}`)
+	for _, want := range []string{`"protocolVersion":"2025-03-26"`, `"agentguard-gateway"`, `"tools":`, `"resources":`} {
+		if !strings.Contains(init, want) {
+			t.Errorf("initialize result lacks %s: %s", want, init)
+		}
+	}
+
+	var list struct {
+		Result struct {
+			Tools []struct {
+				Name string `json:"name"`
+			} `json:"tools"`
+		} `json:"result"`
+	}
+	if err := json.Unmarshal([]byte(send(`{"jsonrpc":"2.0","id":2,"method":"tools/list"}`)), &list); err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, tool := range list.Result.Tools {
+		names = append(names, tool.Name)
+	}
+	if want := []string{"files.read", "files.delete", "github.read", "github.delete"}; !slices.Equal(names, want) {
+		t.Errorf("expected merged tools %v, got %v", want, names)
+	}
+
+	if resp := call("files.read"); !strings.Contains(resp, `"files: read"`) {
+		t.Errorf("expected the stdio server to answer, got %s", resp)
+	}
+	if resp := call("github.read"); !strings.Contains(resp, `"github: read"`) {
+		t.Errorf("expected the HTTP server to answer, got %s", resp)
+	}
+	if resp := call("github.delete"); !strings.Contains(resp, "-32001") {
+		t.Errorf("the server rule should deny github deletes, got %s", resp)
+	}
+	if resp := call("files.delete"); !strings.Contains(resp, `"files: delete"`) {
+		t.Errorf("the server rule should leave other servers alone, got %s", resp)
+	}
+	if resp := call("jira.read"); !strings.Contains(resp, "-32602") {
+		t.Errorf("expected an unknown server's tool to be refused, got %s", resp)
+	}
+	if resp := send(`{"jsonrpc":"2.0","id":6,"method":"resources/read","params":{"uri":"file:///notes.txt"}}`); !strings.Contains(resp, `"notes"`) {
+		t.Errorf("expected the resource from the only server with resources, got %s", resp)
+	}
+
+	h.close()
+
+	records, err := store.Query(context.Background(), api.QueryFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	denied := false
+	for _, r := range records {
+		if r.Direction == api.DirectionInbound && r.Method == "tools/call" && r.Server == "" && r.Tool != "jira.read" {
+			t.Errorf("tool call audited without its server: %+v", r)
+		}
+		if r.Server == "github" && r.Tool == "delete" && r.Verdict == api.VerdictDeny {
+			denied = true
+		}
+	}
+	if !denied {
+		t.Error("expected the denied github.delete in the audit log, by server and tool")
+	}
+}
+
+func TestGateway_CancelPendingApproval(t *testing.T) {
+	queue := approval.NewQueue(time.Minute)
+	h, _ := startGateway(t, []policy.Rule{
+		{Name: "ask-github", Match: policy.RuleMatch{Method: "tools/call", Server: "github"}, Action: "ask"},
+	}, WithApprovalQueue(queue))
+
+	h.write(`{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"github.read"}}`)
+	var pending []*approval.Request
+	for deadline := time.Now().Add(5 * time.Second); len(pending) == 0; {
+		if time.Now().After(deadline) {
+			t.Fatal("request never reached the approval queue")
+		}
+		time.Sleep(10 * time.Millisecond)
+		pending = queue.Pending()
+	}
+	if pending[0].Tool != "github.read" {
+		t.Errorf("expected the approver to see the tool as the host names it, got %q", pending[0].Tool)
+	}
+
+	// Other requests go on while one waits
+	h.write(`{"jsonrpc":"2.0","id":2,"method":"tools/call","params":{"name":"files.read"}}`)
+	if resp := h.read(); !strings.Contains(resp, `"id":2`) || !strings.Contains(resp, `"files: read"`) {
+		t.Errorf("expected files.read to be answered, got %s", resp)
+	}
+
+	h.write(`{"jsonrpc":"2.0","method":"notifications/cancelled","params":{"requestId":1}}`)
+	h.write(`{"jsonrpc":"2.0","id":3,"method":"ping"}`)
+	if resp := h.read(); !strings.Contains(resp, `"id":3`) {
+		t.Errorf("a cancelled request gets no response, got %s", resp)
+	}
+	h.close()
+	if status := queue.All()[0].Status; status != approval.StatusCancelled {
+		t.Errorf("expected the approval to be withdrawn, got %s", status)
+	}
+}
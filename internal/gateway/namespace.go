@@ -0,0 +1,300 @@
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/tkingovr/agent-guard/api"
+	"github.com/tkingovr/agent-guard/internal/filter"
+	"github.com/tkingovr/agent-guard/internal/jsonrpc"
+)
+
+// route finds the server a request is for: by the prefix of the tool or
+// prompt it names, or by the resource URI it reads. The name loses its
+// prefix, so the request is filtered and forwarded as the server knows
+// it. Other messages are returned as they are.
+func (g *Gateway) route(raw []byte) (*Upstream, []byte, error) {
+	msg, err := jsonrpc.Parse(raw)
+	if err != nil || !msg.IsRequest() || !routedMethods[msg.Method] {
+		return nil, raw, nil
+	}
+	var params map[string]json.RawMessage
+	if err := json.Unmarshal(msg.Params, &params); err != nil || params == nil {
+		return nil, raw, fmt.Errorf("invalid params for %s", msg.Method)
+	}
+
+	var upstream *Upstream
+	switch msg.Method {
+	case "tools/call":
+		upstream, err = g.unqualify(params, "name", "tool")
+	case "prompts/get":
+		upstream, err = g.unqualify(params, "name", "prompt")
+	case "completion/complete":
+		var ref map[string]json.RawMessage
+		if err := json.Unmarshal(params["ref"], &ref); err != nil || ref == nil {
+			return nil, raw, fmt.Errorf("invalid ref for %s", msg.Method)
+		}
+		if _, ok := ref["uri"]; ok {
+			upstream, err = g.resourceServer(ref)
+		} else {
+			upstream, err = g.unqualify(ref, "name", "prompt")
+			params["ref"], _ = json.Marshal(ref)
+		}
+	default:
+		upstream, err = g.resourceServer(params)
+	}
+	if err != nil {
+		return nil, raw, err
+	}
+
+	msg.Params, err = json.Marshal(params)
+	if err != nil {
+		return nil, raw, err
+	}
+	out, err := json.Marshal(msg)
+	if err != nil {
+		return nil, raw, err
+	}
+	return upstream, out, nil
+}
+
+// unqualify strips the server prefix from the name in fields[key] and
+// returns the server it names.
+func (g *Gateway) unqualify(fields map[string]json.RawMessage, key, kind string) (*Upstream, error) {
+	var name string
+	_ = json.Unmarshal(fields[key], &name)
+	server, local, ok := strings.Cut(name, separator)
+	upstream := g.byName[server]
+	if !ok || upstream == nil || local == "" {
+		return nil, fmt.Errorf("unknown %s %q", kind, name)
+	}
+	fields[key], _ = json.Marshal(local)
+	return upstream, nil
+}
+
+// resourceServer returns the server of the resource in fields["uri"]: the
+// one that listed it or a template it fits, or the only server that has
+// resources.
+func (g *Gateway) resourceServer(fields map[string]json.RawMessage) (*Upstream, error) {
+	var uri string
+	_ = json.Unmarshal(fields["uri"], &uri)
+
+	g.mu.Lock()
+	upstream := g.resources[uri]
+	if upstream == nil {
+		best := 0
+		for _, t := range g.templates {
+			if len(t.prefix) > best && strings.HasPrefix(uri, t.prefix) {
+				upstream, best = t.upstream, len(t.prefix)
+			}
+		}
+	}
+	g.mu.Unlock()
+	if upstream != nil {
+		return upstream, nil
+	}
+
+	var only []*Upstream
+	for _, u := range g.upstreams {
+		if u.offers("resources/read") {
+			only = append(only, u)
+		}
+	}
+	if len(only) == 1 {
+		return only[0], nil
+	}
+	return nil, fmt.Errorf("unknown resource %q", uri)
+}
+
+// list merges a list request across the servers that support it. A server
+// that fails is left out of the list.
+func (g *Gateway) list(ctx context.Context, fc *filter.FilterContext) map[string]any {
+	method := fc.Message.Method
+	key := listKeys[method]
+
+	pages := make([][]json.RawMessage, len(g.upstreams))
+	var wg sync.WaitGroup
+	for i, u := range g.upstreams {
+		if !u.offers(method) {
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			items, err := g.listServer(ctx, u, fc, key)
+			if err != nil {
+				g.logger.Warn("server left out of list", "server", u.Name, "method", method, "error", err)
+				return
+			}
+			pages[i] = items
+		}()
+	}
+	wg.Wait()
+
+	items := []json.RawMessage{}
+	for i, u := range g.upstreams {
+		for _, item := range pages[i] {
+			if item = g.adopt(u, method, item); item != nil {
+				items = append(items, item)
+			}
+		}
+	}
+	return map[string]any{key: items}
+}
+
+// listServer fetches every page of the list fc asks for from one server.
+// Each page goes through the outbound chain as a response to fc.
+func (g *Gateway) listServer(ctx context.Context, upstream *Upstream, fc *filter.FilterContext, key string) ([]json.RawMessage, error) {
+	var items []json.RawMessage
+	var cursor string
+	for range maxListPages {
+		var params json.RawMessage
+		if cursor != "" {
+			params, _ = json.Marshal(map[string]string{"cursor": cursor})
+		}
+		resp, err := upstream.request(ctx, fc.Message.Method, params)
+		if err != nil {
+			return nil, err
+		}
+		resp.ID = fc.Message.ID
+		page, err := jsonrpc.Parse(g.filterOutbound(ctx, upstream, marshal(resp), fc))
+		if err != nil {
+			return nil, err
+		}
+		if page.Error != nil {
+			return nil, errors.New(page.Error.Message)
+		}
+
+		var result map[string]json.RawMessage
+		if err := json.Unmarshal(page.Result, &result); err != nil {
+			return nil, fmt.Errorf("invalid result: %w", err)
+		}
+		if raw := result[key]; raw != nil {
+			var pageItems []json.RawMessage
+			if err := json.Unmarshal(raw, &pageItems); err != nil {
+				return nil, fmt.Errorf("invalid %s: %w", key, err)
+			}
+			items = append(items, pageItems...)
+		}
+		var next string
+		if raw := result["nextCursor"]; raw != nil {
+			_ = json.Unmarshal(raw, &next)
+		}
+		if next == "" {
+			return items, nil
+		}
+		cursor = next
+	}
+	return nil, fmt.Errorf("more than %d pages", maxListPages)
+}
+
+// adopt presents an item a server listed as the gateway's: tools and
+// prompts get the server's prefix, and resources are remembered so reads
+// find their server. A malformed item is dropped.
+func (g *Gateway) adopt(upstream *Upstream, method string, item json.RawMessage) json.RawMessage {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(item, &fields); err != nil || fields == nil {
+		return nil
+	}
+
+	switch method {
+	case "tools/list", "prompts/list":
+		var name string
+		if err := json.Unmarshal(fields["name"], &name); err != nil || name == "" {
+			return nil
+		}
+		fields["name"], _ = json.Marshal(upstream.Name + separator + name)
+		out, err := json.Marshal(fields)
+		if err != nil {
+			return nil
+		}
+		return out
+
+	case "resources/list":
+		var uri string
+		if err := json.Unmarshal(fields["uri"], &uri); err != nil || uri == "" {
+			return nil
+		}
+		g.mu.Lock()
+		g.resources[uri] = upstream
+		g.mu.Unlock()
+
+	case "resources/templates/list":
+		var tmpl string
+		if err := json.Unmarshal(fields["uriTemplate"], &tmpl); err != nil || tmpl == "" {
+			return nil
+		}
+		prefix, _, _ := strings.Cut(tmpl, "{")
+		g.mu.Lock()
+		g.resources[tmpl] = upstream
+		t := resourceTemplate{prefix: prefix, upstream: upstream}
+		if prefix != "" && prefix != tmpl && !slices.Contains(g.templates, t) {
+			g.templates = append(g.templates, t)
+		}
+		g.mu.Unlock()
+	}
+	return item
+}
+
+// initializeResult answers the host's initialize for all the servers: the
+// union of their capabilities, and their instructions.
+func (g *Gateway) initializeResult(msg *api.JSONRPCMessage) map[string]any {
+	var params struct {
+		ProtocolVersion string `json:"protocolVersion"`
+	}
+	_ = json.Unmarshal(msg.Params, &params)
+	version := protocolVersion
+	if supportedVersions[params.ProtocolVersion] {
+		version = params.ProtocolVersion
+	}
+
+	caps := map[string]any{}
+	var instructions []string
+	for _, u := range g.upstreams {
+		c := u.capabilities
+		if c.Tools != nil {
+			caps["tools"] = map[string]bool{"listChanged": true}
+		}
+		if c.Prompts != nil {
+			caps["prompts"] = map[string]bool{"listChanged": true}
+		}
+		if c.Resources != nil {
+			var resources struct {
+				Subscribe bool `json:"subscribe"`
+			}
+			_ = json.Unmarshal(c.Resources, &resources)
+			merged, _ := caps["resources"].(map[string]bool)
+			caps["resources"] = map[string]bool{
+				"listChanged": true,
+				"subscribe":   resources.Subscribe || merged["subscribe"],
+			}
+		}
+		if c.Logging != nil {
+			caps["logging"] = struct{}{}
+		}
+		if c.Completions != nil {
+			caps["completions"] = struct{}{}
+		}
+		if u.instructions != "" {
+			instructions = append(instructions, fmt.Sprintf("Tools and prompts named %s%s*:\n%s", u.Name, separator, u.instructions))
+		}
+	}
+
+	result := map[string]any{
+		"protocolVersion": version,
+		"capabilities":    caps,
+		"serverInfo": map[string]string{
+			"name":    "agentguard-gateway",
+			"version": g.version,
+		},
+	}
+	if len(instructions) > 0 {
+		result["instructions"] = strings.Join(instructions, "\n\n")
+	}
+	return result
+}
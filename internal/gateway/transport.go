@@ -0,0 +1,252 @@
+package gateway
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"maps"
+	"mime"
+	"net/http"
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tkingovr/agent-guard/internal/policy"
+)
+
+// maxMessageSize bounds a message read from a server.
+const maxMessageSize = 10 * 1024 * 1024
+
+// transport carries JSON-RPC messages to one server. Whatever the server
+// sends, in response or on its own, is passed to the receive function the
+// transport was created with.
+type transport interface {
+	send(ctx context.Context, msg []byte) error
+
+	// negotiated records the protocol version agreed on in initialize.
+	negotiated(version string)
+
+	close() error
+}
+
+// stdioTransport talks to a server subprocess over its stdin and stdout.
+type stdioTransport struct {
+	cmd *exec.Cmd
+
+	mu    sync.Mutex
+	stdin io.WriteCloser
+}
+
+// startProcess spawns the server s describes. Lines it writes are passed
+// to receive; once it exits, closed is called with the reason.
+func startProcess(s policy.ServerSettings, receive func([]byte), closed func(error)) (*stdioTransport, error) {
+	cmd := exec.Command(s.Command, s.Args...)
+	if len(s.Env) > 0 {
+		cmd.Env = os.Environ()
+		for _, k := range slices.Sorted(maps.Keys(s.Env)) {
+			cmd.Env = append(cmd.Env, k+"="+s.Env[k])
+		}
+	}
+	// Our stdout belongs to the host, so only stderr is shared
+	cmd.Stderr = os.Stderr
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, fmt.Errorf("creating stdin pipe: %w", err)
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, fmt.Errorf("creating stdout pipe: %w", err)
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("starting %q: %w", s.Command, err)
+	}
+
+	go func() {
+		scanner := bufio.NewScanner(stdout)
+		scanner.Buffer(make([]byte, 0, 64*1024), maxMessageSize)
+		for scanner.Scan() {
+			if len(scanner.Bytes()) > 0 {
+				receive(bytes.Clone(scanner.Bytes()))
+			}
+		}
+		err := scanner.Err()
+		// Wait only once all output is read
+		if werr := cmd.Wait(); err == nil {
+			err = werr
+		}
+		if err == nil {
+			err = io.EOF
+		}
+		closed(fmt.Errorf("server exited: %w", err))
+	}()
+
+	return &stdioTransport{cmd: cmd, stdin: stdin}, nil
+}
+
+func (t *stdioTransport) send(_ context.Context, msg []byte) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	line := make([]byte, 0, len(msg)+1)
+	line = append(append(line, msg...), '\n')
+	_, err := t.stdin.Write(line)
+	return err
+}
+
+func (t *stdioTransport) negotiated(string) {}
+
+func (t *stdioTransport) close() error {
+	t.mu.Lock()
+	t.stdin.Close()
+	t.mu.Unlock()
+	if t.cmd.Process != nil {
+		return t.cmd.Process.Kill()
+	}
+	return nil
+}
+
+// httpTransport talks to a server over MCP Streamable HTTP: each message
+// is POSTed, and the server answers with a JSON body or an SSE stream.
+type httpTransport struct {
+	url     string
+	headers map[string]string
+	client  *http.Client
+	receive func([]byte)
+
+	mu       sync.Mutex
+	session  string // Mcp-Session-Id assigned in initialize
+	protocol string
+}
+
+func newHTTPTransport(s policy.ServerSettings, tlsConfig *tls.Config, receive func([]byte)) *httpTransport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if tlsConfig != nil {
+		transport.TLSClientConfig = tlsConfig
+	}
+	return &httpTransport{
+		url:     s.URL,
+		headers: s.Headers,
+		client:  &http.Client{Transport: transport},
+		receive: receive,
+	}
+}
+
+func (t *httpTransport) send(ctx context.Context, msg []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.url, bytes.NewReader(msg))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json, text/event-stream")
+	t.setHeaders(req)
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if session := resp.Header.Get("Mcp-Session-Id"); session != "" {
+		t.mu.Lock()
+		t.session = session
+		t.mu.Unlock()
+	}
+	if resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("HTTP %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	switch mediaType {
+	case "text/event-stream":
+		return readSSE(resp.Body, t.receive)
+	case "application/json":
+		body, err := io.ReadAll(io.LimitReader(resp.Body, maxMessageSize))
+		if err != nil {
+			return fmt.Errorf("reading response: %w", err)
+		}
+		t.receive(body)
+	}
+	// Anything else (202 Accepted for a notification) carries no message
+	return nil
+}
+
+func (t *httpTransport) setHeaders(req *http.Request) {
+	for k, v := range t.headers {
+		req.Header.Set(k, v)
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.session != "" {
+		req.Header.Set("Mcp-Session-Id", t.session)
+	}
+	if t.protocol != "" {
+		req.Header.Set("MCP-Protocol-Version", t.protocol)
+	}
+}
+
+func (t *httpTransport) negotiated(version string) {
+	t.mu.Lock()
+	t.protocol = version
+	t.mu.Unlock()
+}
+
+// close ends the session on the server, if it assigned one.
+func (t *httpTransport) close() error {
+	t.mu.Lock()
+	session := t.session
+	t.mu.Unlock()
+	if session == "" {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, t.url, nil)
+	if err != nil {
+		return err
+	}
+	t.setHeaders(req)
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// readSSE passes the data of each event of an SSE stream to receive.
+func readSSE(r io.Reader, receive func([]byte)) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxMessageSize)
+	var data []byte
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			if len(data) > 0 {
+				receive(data)
+				data = nil
+			}
+			continue
+		}
+		value, ok := bytes.CutPrefix(line, []byte("data:"))
+		if !ok {
+			// event, id, retry and comments don't matter here
+			continue
+		}
+		value = bytes.TrimPrefix(value, []byte(" "))
+		if data != nil {
+			data = append(data, '\n')
+		}
+		data = append(data, value...)
+	}
+	if len(data) > 0 {
+		receive(data)
+	}
+	return scanner.Err()
+}
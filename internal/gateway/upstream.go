@@ -0,0 +1,306 @@
+package gateway
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tkingovr/agent-guard/api"
+	"github.com/tkingovr/agent-guard/internal/jsonrpc"
+	"github.com/tkingovr/agent-guard/internal/policy"
+)
+
+// protocolVersion is the MCP version the gateway asks its servers for,
+// and offers a host that asks for one it doesn't know.
+const protocolVersion = "2025-06-18"
+
+// supportedVersions are the MCP versions the gateway agrees to with a host.
+var supportedVersions = map[string]bool{
+	"2024-11-05": true,
+	"2025-03-26": true,
+	"2025-06-18": true,
+}
+
+// cancelTimeout bounds telling a server a request was cancelled.
+const cancelTimeout = 5 * time.Second
+
+// errNotConnected is returned for calls to a server before it is connected.
+var errNotConnected = errors.New("not connected")
+
+// Upstream is one MCP server behind the gateway, spawned as a subprocess
+// or reached over Streamable HTTP. The gateway is its MCP client.
+type Upstream struct {
+	Name string
+
+	settings  policy.ServerSettings
+	tlsConfig *tls.Config
+	logger    *slog.Logger
+
+	t      transport
+	notify func(*Upstream, *api.JSONRPCMessage)
+
+	// Set by initialize
+	capabilities capabilities
+	instructions string
+
+	mu      sync.Mutex
+	seq     int64
+	pending map[string]chan *api.JSONRPCMessage // request ID → response
+	err     error                               // why calls fail, if they do
+}
+
+// capabilities holds the capabilities a server declares; a nil field
+// means it lacks that one.
+type capabilities struct {
+	Tools     json.RawMessage `json:"tools,omitempty"`
+	Prompts   json.RawMessage `json:"prompts,omitempty"`
+	Resources json.RawMessage `json:"resources,omitempty"`
+	Logging   json.RawMessage `json:"logging,omitempty"`
+
+	Completions json.RawMessage `json:"completions,omitempty"`
+}
+
+// offers reports whether the server declared the capability method needs.
+func (u *Upstream) offers(method string) bool {
+	c := u.capabilities
+	switch {
+	case strings.HasPrefix(method, "tools/"):
+		return c.Tools != nil
+	case strings.HasPrefix(method, "prompts/"):
+		return c.Prompts != nil
+	case strings.HasPrefix(method, "resources/"):
+		return c.Resources != nil
+	case strings.HasPrefix(method, "logging/"):
+		return c.Logging != nil
+	case strings.HasPrefix(method, "completion/"):
+		return c.Completions != nil
+	}
+	return false
+}
+
+// NewUpstream returns the server s describes, which the gateway connects
+// when it runs. tlsConfig, if set, is used to reach an https url.
+func NewUpstream(s policy.ServerSettings, tlsConfig *tls.Config, logger *slog.Logger) *Upstream {
+	return &Upstream{
+		Name:      s.Name,
+		settings:  s,
+		tlsConfig: tlsConfig,
+		logger:    logger.With("server", s.Name),
+		pending:   make(map[string]chan *api.JSONRPCMessage),
+		err:       errNotConnected,
+	}
+}
+
+// connect starts or reaches the server and initializes a session with it.
+// Notifications the server sends are passed to notify.
+func (u *Upstream) connect(ctx context.Context, notify func(*Upstream, *api.JSONRPCMessage)) error {
+	u.notify = notify
+	// Connected before the transport starts, so a server that exits at
+	// once leaves its failure
+	u.mu.Lock()
+	u.err = nil
+	u.mu.Unlock()
+	var t transport
+	if u.settings.URL != "" {
+		t = newHTTPTransport(u.settings, u.tlsConfig, u.receive)
+	} else {
+		st, err := startProcess(u.settings, u.receive, u.fail)
+		if err != nil {
+			return err
+		}
+		t = st
+	}
+	u.mu.Lock()
+	u.t = t
+	u.mu.Unlock()
+
+	params, _ := json.Marshal(map[string]any{
+		"protocolVersion": protocolVersion,
+		"capabilities":    map[string]any{},
+		"clientInfo":      map[string]string{"name": "agentguard-gateway"},
+	})
+	resp, err := u.request(ctx, "initialize", params)
+	if err != nil {
+		return fmt.Errorf("initialize: %w", err)
+	}
+	if resp.Error != nil {
+		return fmt.Errorf("initialize: %s", resp.Error.Message)
+	}
+	var result struct {
+		ProtocolVersion string       `json:"protocolVersion"`
+		Capabilities    capabilities `json:"capabilities"`
+		Instructions    string       `json:"instructions"`
+	}
+	if err := json.Unmarshal(resp.Result, &result); err != nil {
+		return fmt.Errorf("initialize: %w", err)
+	}
+	u.capabilities = result.Capabilities
+	u.instructions = result.Instructions
+	t.negotiated(result.ProtocolVersion)
+
+	return u.send(ctx, &api.JSONRPCMessage{JSONRPC: "2.0", Method: "notifications/initialized"})
+}
+
+// request sends a request the gateway makes itself.
+func (u *Upstream) request(ctx context.Context, method string, params json.RawMessage) (*api.JSONRPCMessage, error) {
+	return u.call(ctx, &api.JSONRPCMessage{JSONRPC: "2.0", Method: method, Params: params})
+}
+
+// call sends a request to the server, under an ID of the upstream's own,
+// and waits for its response. If ctx ends first, the server is told the
+// request was cancelled.
+func (u *Upstream) call(ctx context.Context, msg *api.JSONRPCMessage) (*api.JSONRPCMessage, error) {
+	u.mu.Lock()
+	if u.err != nil {
+		err := u.err
+		u.mu.Unlock()
+		return nil, err
+	}
+	u.seq++
+	id := json.RawMessage(strconv.FormatInt(u.seq, 10))
+	ch := make(chan *api.JSONRPCMessage, 1)
+	u.pending[string(id)] = ch
+	u.mu.Unlock()
+
+	req := *msg
+	req.ID = id
+	if err := u.send(ctx, &req); err != nil {
+		u.forget(id)
+		if ctx.Err() != nil {
+			u.cancel(id)
+			return nil, ctx.Err()
+		}
+		return nil, err
+	}
+
+	select {
+	case resp, ok := <-ch:
+		if !ok {
+			u.mu.Lock()
+			defer u.mu.Unlock()
+			return nil, u.err
+		}
+		return resp, nil
+	case <-ctx.Done():
+		u.forget(id)
+		u.cancel(id)
+		return nil, ctx.Err()
+	}
+}
+
+// send sends a message without waiting for an answer.
+func (u *Upstream) send(ctx context.Context, msg *api.JSONRPCMessage) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	u.mu.Lock()
+	t := u.t
+	u.mu.Unlock()
+	if t == nil {
+		return errNotConnected
+	}
+	return t.send(ctx, data)
+}
+
+func (u *Upstream) forget(id json.RawMessage) {
+	u.mu.Lock()
+	delete(u.pending, string(id))
+	u.mu.Unlock()
+}
+
+// cancel tells the server to stop working on request id.
+func (u *Upstream) cancel(id json.RawMessage) {
+	params, _ := json.Marshal(map[string]any{"requestId": id, "reason": "cancelled by the client"})
+	ctx, cancel := context.WithTimeout(context.Background(), cancelTimeout)
+	defer cancel()
+	if err := u.send(ctx, &api.JSONRPCMessage{JSONRPC: "2.0", Method: "notifications/cancelled", Params: params}); err != nil {
+		u.logger.Debug("sending cancellation", "error", err)
+	}
+}
+
+// receive handles a message from the server: a response goes to the call
+// waiting for it, a notification to the gateway.
+func (u *Upstream) receive(data []byte) {
+	if jsonrpc.IsBatch(data) {
+		msgs, err := jsonrpc.SplitBatch(data)
+		if err != nil {
+			u.logger.Warn("invalid batch from server", "error", err)
+			return
+		}
+		for _, msg := range msgs {
+			u.receive(msg)
+		}
+		return
+	}
+
+	msg, err := jsonrpc.Parse(data)
+	if err != nil {
+		u.logger.Warn("invalid message from server", "error", err)
+		return
+	}
+	switch {
+	case msg.IsResponse():
+		u.mu.Lock()
+		ch, ok := u.pending[string(msg.ID)]
+		delete(u.pending, string(msg.ID))
+		u.mu.Unlock()
+		if ok {
+			ch <- msg
+		}
+	case msg.IsRequest():
+		// Answered apart, since the transport may be busy delivering
+		go u.answer(msg)
+	default:
+		u.notify(u, msg)
+	}
+}
+
+// answer responds to a request from the server. The gateway declares no
+// client capabilities (sampling, roots, elicitation), so it only answers
+// pings.
+func (u *Upstream) answer(req *api.JSONRPCMessage) {
+	resp := jsonrpc.NewErrorResponse(req.ID, jsonrpc.ErrorCodeMethodNotFound, "not supported by the gateway: "+req.Method, nil)
+	if req.Method == "ping" {
+		resp = jsonrpc.NewResultResponse(req.ID, json.RawMessage("{}"))
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), cancelTimeout)
+	defer cancel()
+	if err := u.send(ctx, resp); err != nil {
+		u.logger.Debug("answering server request", "method", req.Method, "error", err)
+	}
+}
+
+// fail ends every call to a server that has gone away.
+func (u *Upstream) fail(err error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	// A server the gateway closed is expected to go
+	if u.err != errNotConnected {
+		u.logger.Error("server connection lost", "error", err)
+		u.err = err
+	}
+	for id, ch := range u.pending {
+		close(ch)
+		delete(u.pending, id)
+	}
+}
+
+func (u *Upstream) close() {
+	u.mu.Lock()
+	u.err = errNotConnected
+	t := u.t
+	u.mu.Unlock()
+	if t != nil {
+		if err := t.close(); err != nil {
+			u.logger.Debug("closing server connection", "error", err)
+		}
+	}
+}
@@ -2,16 +2,48 @@ package jsonrpc
 
 import (
 	"encoding/json"
+	"errors"
 
 	"github.com/tkingovr/agent-guard/api"
 )
 
+// Standard JSON-RPC error codes.
+const (
+	ErrorCodeParseError     = -32700
+	ErrorCodeInvalidRequest = -32600
+	ErrorCodeMethodNotFound = -32601
+	ErrorCodeInvalidParams  = -32602
+	ErrorCodeInternalError  = -32603
+)
+
 // ErrorCodePolicyDenied is a custom JSON-RPC error code for policy denials.
 const ErrorCodePolicyDenied = -32001
 
 // ErrorCodeApprovalTimeout is a custom JSON-RPC error code for approval timeouts.
 const ErrorCodeApprovalTimeout = -32002
 
+// ErrorCodeRateLimited is a custom JSON-RPC error code for rate limit
+// denials. The error data carries retry_after in seconds.
+const ErrorCodeRateLimited = -32003
+
+// ErrorCodeBudgetExhausted is a custom JSON-RPC error code for requests
+// refused because the session has spent one of its budgets.
+const ErrorCodeBudgetExhausted = -32004
+
+// ErrorCodeFor returns the JSON-RPC error code for a failure to handle a
+// message: parse error, invalid request or params, or internal error.
+func ErrorCodeFor(err error) int {
+	switch {
+	case errors.Is(err, ErrParse):
+		return ErrorCodeParseError
+	case errors.Is(err, ErrInvalidRequest):
+		return ErrorCodeInvalidRequest
+	case errors.Is(err, ErrInvalidParams):
+		return ErrorCodeInvalidParams
+	}
+	return ErrorCodeInternalError
+}
+
 // NewDenyResponse creates a JSON-RPC error response for a denied request.
 func NewDenyResponse(id json.RawMessage, message string) *api.JSONRPCMessage {
 	return &api.JSONRPCMessage{
@@ -24,6 +56,29 @@ func NewDenyResponse(id json.RawMessage, message string) *api.JSONRPCMessage {
 	}
 }
 
+// NewErrorResponse creates a JSON-RPC error response with a specific code
+// and optional data.
+func NewErrorResponse(id json.RawMessage, code int, message string, data json.RawMessage) *api.JSONRPCMessage {
+	return &api.JSONRPCMessage{
+		JSONRPC: "2.0",
+		ID:      id,
+		Error: &api.JSONRPCError{
+			Code:    code,
+			Message: message,
+			Data:    data,
+		},
+	}
+}
+
+// NewResultResponse creates a JSON-RPC success response with the given result.
+func NewResultResponse(id json.RawMessage, result json.RawMessage) *api.JSONRPCMessage {
+	return &api.JSONRPCMessage{
+		JSONRPC: "2.0",
+		ID:      id,
+		Result:  result,
+	}
+}
+
 // NewApprovalTimeoutResponse creates a JSON-RPC error response for an approval timeout.
 func NewApprovalTimeoutResponse(id json.RawMessage) *api.JSONRPCMessage {
 	return &api.JSONRPCMessage{
@@ -36,6 +91,33 @@ func NewApprovalTimeoutResponse(id json.RawMessage) *api.JSONRPCMessage {
 	}
 }
 
+// NewProgressNotification creates a notifications/progress message for the
+// request that asked for progress with token.
+func NewProgressNotification(token json.RawMessage, progress int, message string) *api.JSONRPCMessage {
+	params, _ := json.Marshal(map[string]any{
+		"progressToken": token,
+		"progress":      progress,
+		"message":       message,
+	})
+	return &api.JSONRPCMessage{
+		JSONRPC: "2.0",
+		Method:  "notifications/progress",
+		Params:  params,
+	}
+}
+
+// JoinBatch encodes messages, each already JSON, as a batch.
+func JoinBatch(msgs [][]byte) []byte {
+	out := []byte{'['}
+	for i, msg := range msgs {
+		if i > 0 {
+			out = append(out, ',')
+		}
+		out = append(out, msg...)
+	}
+	return append(out, ']')
+}
+
 // Marshal encodes a JSONRPCMessage to JSON bytes.
 func Marshal(msg *api.JSONRPCMessage) ([]byte, error) {
 	return json.Marshal(msg)
@@ -1,35 +1,81 @@
 package jsonrpc
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 
 	"github.com/tkingovr/agent-guard/api"
 )
 
+// Sentinel errors for messages that can't be handled, matched with
+// errors.Is. ErrorCodeFor maps them to JSON-RPC error codes.
+var (
+	ErrParse          = errors.New("parse error")
+	ErrInvalidRequest = errors.New("invalid request")
+	ErrInvalidParams  = errors.New("invalid params")
+)
+
 // Parse decodes a raw JSON byte slice into a JSONRPCMessage.
 func Parse(data []byte) (*api.JSONRPCMessage, error) {
 	var msg api.JSONRPCMessage
 	if err := json.Unmarshal(data, &msg); err != nil {
-		return nil, fmt.Errorf("invalid JSON-RPC message: %w", err)
+		var typeErr *json.UnmarshalTypeError
+		if errors.As(err, &typeErr) {
+			// Valid JSON, but not shaped like a JSON-RPC message
+			return nil, fmt.Errorf("%w: invalid JSON-RPC message: %w", ErrInvalidRequest, err)
+		}
+		return nil, fmt.Errorf("%w: invalid JSON-RPC message: %w", ErrParse, err)
 	}
 	if msg.JSONRPC != "2.0" {
-		return nil, fmt.Errorf("unsupported JSON-RPC version: %q", msg.JSONRPC)
+		return nil, fmt.Errorf("%w: unsupported JSON-RPC version: %q", ErrInvalidRequest, msg.JSONRPC)
 	}
 	return &msg, nil
 }
 
+// IsBatch reports whether data is a JSON-RPC batch: a JSON array.
+func IsBatch(data []byte) bool {
+	trimmed := bytes.TrimLeft(data, " \t\r\n")
+	return len(trimmed) > 0 && trimmed[0] == '['
+}
+
+// SplitBatch returns the messages of a batch, unparsed, so each can be
+// handled on its own. An empty batch is an invalid request.
+func SplitBatch(data []byte) ([]json.RawMessage, error) {
+	var msgs []json.RawMessage
+	if err := json.Unmarshal(data, &msgs); err != nil {
+		return nil, fmt.Errorf("%w: invalid JSON-RPC batch: %w", ErrParse, err)
+	}
+	if len(msgs) == 0 {
+		return nil, fmt.Errorf("%w: empty JSON-RPC batch", ErrInvalidRequest)
+	}
+	return msgs, nil
+}
+
+// RequestID returns the id member of a raw message that failed to parse,
+// or null if there is none, for use in the error response.
+func RequestID(data []byte) json.RawMessage {
+	var probe struct {
+		ID json.RawMessage `json:"id"`
+	}
+	if json.Unmarshal(data, &probe) != nil || probe.ID == nil {
+		return json.RawMessage("null")
+	}
+	return probe.ID
+}
+
 // ExtractToolCall extracts tool name and arguments from a tools/call request.
 func ExtractToolCall(msg *api.JSONRPCMessage) (*api.ToolCallParams, error) {
 	if msg.Method != "tools/call" {
 		return nil, fmt.Errorf("not a tools/call request: %q", msg.Method)
 	}
 	if msg.Params == nil {
-		return nil, fmt.Errorf("tools/call request has no params")
+		return nil, fmt.Errorf("%w: tools/call request has no params", ErrInvalidParams)
 	}
 	var params api.ToolCallParams
 	if err := json.Unmarshal(msg.Params, &params); err != nil {
-		return nil, fmt.Errorf("failed to parse tools/call params: %w", err)
+		return nil, fmt.Errorf("%w: failed to parse tools/call params: %w", ErrInvalidParams, err)
 	}
 	return &params, nil
 }
@@ -45,3 +91,35 @@ func ExtractArguments(raw json.RawMessage) (map[string]any, error) {
 	}
 	return args, nil
 }
+
+// ProgressToken returns the progressToken a request asked progress
+// notifications for in params._meta, or nil if it has none.
+func ProgressToken(msg *api.JSONRPCMessage) json.RawMessage {
+	if msg == nil || msg.Params == nil {
+		return nil
+	}
+	var params struct {
+		Meta struct {
+			ProgressToken json.RawMessage `json:"progressToken"`
+		} `json:"_meta"`
+	}
+	if err := json.Unmarshal(msg.Params, &params); err != nil {
+		return nil
+	}
+	return params.Meta.ProgressToken
+}
+
+// CancelledRequestID returns the ID of the request a notifications/cancelled
+// message cancels, or nil if msg is not one.
+func CancelledRequestID(msg *api.JSONRPCMessage) json.RawMessage {
+	if msg == nil || msg.Method != "notifications/cancelled" || msg.Params == nil {
+		return nil
+	}
+	var params struct {
+		RequestID json.RawMessage `json:"requestId"`
+	}
+	if err := json.Unmarshal(msg.Params, &params); err != nil {
+		return nil
+	}
+	return params.RequestID
+}
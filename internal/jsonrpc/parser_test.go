@@ -2,6 +2,7 @@ package jsonrpc
 
 import (
 	"encoding/json"
+	"io"
 	"testing"
 )
 
@@ -116,3 +117,89 @@ func TestMarshalDenyResponse(t *testing.T) {
 		t.Errorf("expected error code %d, got %v", ErrorCodePolicyDenied, errObj["code"])
 	}
 }
+
+func TestProgressToken(t *testing.T) {
+	msg, err := Parse([]byte(`{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"x","_meta":{"progressToken":"tok-1"}}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(ProgressToken(msg)); got != `"tok-1"` {
+		t.Errorf("expected progress token \"tok-1\", got %s", got)
+	}
+
+	msg, _ = Parse([]byte(`{"jsonrpc":"2.0","id":2,"method":"tools/call","params":{"name":"x"}}`))
+	if ProgressToken(msg) != nil {
+		t.Error("expected no progress token")
+	}
+}
+
+func TestCancelledRequestID(t *testing.T) {
+	msg, err := Parse([]byte(`{"jsonrpc":"2.0","method":"notifications/cancelled","params":{"requestId":7,"reason":"user aborted"}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(CancelledRequestID(msg)); got != "7" {
+		t.Errorf("expected request ID 7, got %s", got)
+	}
+
+	msg, _ = Parse([]byte(`{"jsonrpc":"2.0","method":"notifications/progress","params":{"requestId":7}}`))
+	if CancelledRequestID(msg) != nil {
+		t.Error("only notifications/cancelled cancels a request")
+	}
+}
+
+func TestErrorCodeFor(t *testing.T) {
+	_, err := Parse([]byte(`{"jsonrpc":"2.0",`))
+	if got := ErrorCodeFor(err); got != ErrorCodeParseError {
+		t.Errorf("truncated JSON: expected %d, got %d", ErrorCodeParseError, got)
+	}
+	_, err = Parse([]byte(`{"jsonrpc":"2.0","id":1,"method":42}`))
+	if got := ErrorCodeFor(err); got != ErrorCodeInvalidRequest {
+		t.Errorf("non-string method: expected %d, got %d", ErrorCodeInvalidRequest, got)
+	}
+	msg, _ := Parse([]byte(`{"jsonrpc":"2.0","id":1,"method":"tools/call"}`))
+	_, err = ExtractToolCall(msg)
+	if got := ErrorCodeFor(err); got != ErrorCodeInvalidParams {
+		t.Errorf("tools/call without params: expected %d, got %d", ErrorCodeInvalidParams, got)
+	}
+	if got := ErrorCodeFor(io.ErrUnexpectedEOF); got != ErrorCodeInternalError {
+		t.Errorf("other errors: expected %d, got %d", ErrorCodeInternalError, got)
+	}
+}
+
+func TestRequestID(t *testing.T) {
+	if got := string(RequestID([]byte(`{"jsonrpc":"1.0","id":"a"}`))); got != `"a"` {
+		t.Errorf("expected \"a\", got %s", got)
+	}
+	if got := string(RequestID([]byte(`not json`))); got != "null" {
+		t.Errorf("expected null, got %s", got)
+	}
+}
+
+func TestSplitBatch(t *testing.T) {
+	data := []byte(` [{"jsonrpc":"2.0","id":1,"method":"ping"}, {"jsonrpc":"2.0","method":"notifications/initialized"}]`)
+	if !IsBatch(data) {
+		t.Fatal("expected a batch")
+	}
+	msgs, err := SplitBatch(data)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(msgs) != 2 {
+		t.Fatalf("expected 2 messages, got %d", len(msgs))
+	}
+	joined := string(JoinBatch([][]byte{msgs[0], msgs[1]}))
+	if joined != `[{"jsonrpc":"2.0","id":1,"method":"ping"},{"jsonrpc":"2.0","method":"notifications/initialized"}]` {
+		t.Errorf("unexpected join: %s", joined)
+	}
+
+	if IsBatch([]byte(`{"jsonrpc":"2.0","id":1}`)) {
+		t.Error("an object is not a batch")
+	}
+	if _, err := SplitBatch([]byte(`[]`)); ErrorCodeFor(err) != ErrorCodeInvalidRequest {
+		t.Errorf("empty batch: expected invalid request, got %v", err)
+	}
+	if _, err := SplitBatch([]byte(`[{"jsonrpc"`)); ErrorCodeFor(err) != ErrorCodeParseError {
+		t.Errorf("truncated batch: expected parse error, got %v", err)
+	}
+}
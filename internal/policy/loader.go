@@ -2,8 +2,12 @@ package policy
 
 import (
 	"fmt"
+	"net/url"
 	"os"
+	"path"
 	"regexp"
+	"strings"
+	"time"
 
 	"github.com/tkingovr/agent-guard/api"
 	"gopkg.in/yaml.v3"
@@ -39,6 +43,161 @@ func validate(pf *PolicyFile) error {
 		pf.Settings.DefaultAction = api.VerdictDeny
 	}
 
+	if is := pf.Settings.InjectionScanner; is != nil && is.Action != "" {
+		switch is.Action {
+		case "strip", "annotate", "block":
+		default:
+			return fmt.Errorf("injection_scanner: invalid action %q (expected strip, annotate, or block)", is.Action)
+		}
+	}
+
+	if ss := pf.Settings.SecretScanner; ss != nil {
+		if err := validateSecretSettings(ss); err != nil {
+			return fmt.Errorf("secret_scanner: %w", err)
+		}
+	}
+
+	if rs := pf.Settings.ResultScanner; rs != nil {
+		if err := validateResultAction(rs.Action); err != nil {
+			return fmt.Errorf("result_scanner: %w", err)
+		}
+		for name, action := range rs.Actions {
+			if err := validateResultAction(action); err != nil {
+				return fmt.Errorf("result_scanner: detector %q: %w", name, err)
+			}
+		}
+	}
+
+	if rs := pf.Settings.Redaction; rs != nil {
+		if err := validateCaptureMode(rs.Capture); err != nil {
+			return fmt.Errorf("redaction: %w", err)
+		}
+		for tool, mode := range rs.Tools {
+			if err := validateCaptureMode(mode); err != nil {
+				return fmt.Errorf("redaction: tool %q: %w", tool, err)
+			}
+		}
+	}
+
+	if cs := pf.Settings.Canary; cs != nil {
+		switch cs.Action {
+		case "", "deny", "log":
+		default:
+			return fmt.Errorf("canary: invalid action %q (expected deny or log)", cs.Action)
+		}
+		for _, pattern := range cs.Env {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return fmt.Errorf("canary: env pattern %q: %w", pattern, err)
+			}
+		}
+	}
+
+	if hs := pf.Settings.Honeytokens; hs != nil {
+		if err := validateHoneytokens(hs); err != nil {
+			return fmt.Errorf("honeytokens: %w", err)
+		}
+	}
+
+	if rl := pf.Settings.RateLimit; rl != nil {
+		if err := validateRateLimits(rl); err != nil {
+			return fmt.Errorf("rate_limit: %w", err)
+		}
+	}
+
+	switch pf.Settings.OnFilterError {
+	case "", "deny", "allow":
+	default:
+		return fmt.Errorf("invalid on_filter_error %q (expected deny or allow)", pf.Settings.OnFilterError)
+	}
+
+	if ld := pf.Settings.LoopDetection; ld != nil {
+		switch ld.Action {
+		case "", "deny", "ask", "log":
+		default:
+			return fmt.Errorf("loop_detection: invalid action %q (expected deny, ask or log)", ld.Action)
+		}
+		if ld.MaxRepeats < 0 || ld.MaxCycles < 0 || ld.MaxCycleLength < 0 || ld.Window < 0 {
+			return fmt.Errorf("loop_detection: thresholds must not be negative")
+		}
+		if ld.MaxCycleLength == 1 {
+			return fmt.Errorf("loop_detection: max_cycle_length must be at least 2")
+		}
+	}
+
+	if bs := pf.Settings.Budget; bs != nil {
+		if bs.MaxCalls < 0 || bs.MaxArgumentBytes < 0 || bs.MaxResponseBytes < 0 {
+			return fmt.Errorf("budget: limits must not be negative")
+		}
+		if bs.MaxDuration != "" {
+			if d, err := time.ParseDuration(bs.MaxDuration); err != nil || d <= 0 {
+				return fmt.Errorf("budget: invalid max_duration %q", bs.MaxDuration)
+			}
+		}
+	}
+
+	if cs := pf.Settings.Concurrency; cs != nil {
+		if err := validateConcurrency(cs); err != nil {
+			return fmt.Errorf("concurrency: %w", err)
+		}
+	}
+
+	if as := pf.Settings.Auth; as != nil {
+		if err := validateAuth(as); err != nil {
+			return fmt.Errorf("auth: %w", err)
+		}
+	}
+
+	if ts := pf.Settings.TLS; ts != nil {
+		if ts.CertFile == "" || ts.KeyFile == "" {
+			return fmt.Errorf("tls: cert_file and key_file are required")
+		}
+		switch ts.ClientAuth {
+		case "", "require", "optional":
+		default:
+			return fmt.Errorf("tls: invalid client_auth %q (expected require or optional)", ts.ClientAuth)
+		}
+		if ts.ClientAuth != "" && ts.ClientCAFile == "" {
+			return fmt.Errorf("tls: client_auth needs client_ca_file")
+		}
+		switch ts.MinVersion {
+		case "", "1.2", "1.3":
+		default:
+			return fmt.Errorf("tls: invalid min_version %q (expected 1.2 or 1.3)", ts.MinVersion)
+		}
+	}
+
+	if us := pf.Settings.UpstreamTLS; us != nil && (us.CertFile == "") != (us.KeyFile == "") {
+		return fmt.Errorf("upstream_tls: cert_file and key_file go together")
+	}
+
+	routes := make(map[string]bool)
+	for i, rs := range pf.Settings.Routes {
+		if rs.Name == "" {
+			return fmt.Errorf("route %d: name is required", i)
+		}
+		if routes[rs.Name] {
+			return fmt.Errorf("route %q: duplicate name", rs.Name)
+		}
+		routes[rs.Name] = true
+		if err := validateRoute(&rs); err != nil {
+			return fmt.Errorf("route %q: %w", rs.Name, err)
+		}
+	}
+
+	servers := make(map[string]bool)
+	for i, ss := range pf.Settings.Servers {
+		if ss.Name == "" {
+			return fmt.Errorf("server %d: name is required", i)
+		}
+		if servers[ss.Name] {
+			return fmt.Errorf("server %q: duplicate name", ss.Name)
+		}
+		servers[ss.Name] = true
+		if err := validateServer(&ss); err != nil {
+			return fmt.Errorf("server %q: %w", ss.Name, err)
+		}
+	}
+
 	validActions := map[string]bool{
 		"allow": true, "deny": true, "ask": true, "log": true,
 	}
@@ -54,6 +213,16 @@ func validate(pf *PolicyFile) error {
 			return fmt.Errorf("rule %q: match.method is required", rule.Name)
 		}
 		// Validate regex patterns compile
+		if rule.Match.MinBudgetUsage < 0 {
+			return fmt.Errorf("rule %q: min_budget_usage must not be negative", rule.Name)
+		}
+		if pm := rule.Match.Principal; pm != nil {
+			for _, pattern := range append([]string{pm.Subject, pm.CertSubject}, pm.SANs...) {
+				if _, err := path.Match(pattern, ""); err != nil {
+					return fmt.Errorf("rule %q: principal pattern %q: %w", rule.Name, pattern, err)
+				}
+			}
+		}
 		for key, am := range rule.Match.Arguments {
 			if am.Regex != "" {
 				if _, err := regexp.Compile(am.Regex); err != nil {
@@ -61,7 +230,262 @@ func validate(pf *PolicyFile) error {
 				}
 			}
 		}
+		if rule.RateLimit != nil {
+			if err := validateRateLimitRule(rule.RateLimit); err != nil {
+				return fmt.Errorf("rule %q: rate_limit: %w", rule.Name, err)
+			}
+		}
 	}
 
 	return nil
 }
+
+func validateRoute(rs *RouteSettings) error {
+	if rs.Target == "" {
+		return fmt.Errorf("target is required")
+	}
+	if rs.PathPrefix == "" && rs.Host == "" {
+		return fmt.Errorf("path_prefix or host is required")
+	}
+	if rs.PathPrefix != "" && !strings.HasPrefix(rs.PathPrefix, "/") {
+		return fmt.Errorf("path_prefix %q must start with /", rs.PathPrefix)
+	}
+	if rs.RateLimit != nil {
+		if err := validateRateLimits(rs.RateLimit); err != nil {
+			return fmt.Errorf("rate_limit: %w", err)
+		}
+	}
+	if us := rs.UpstreamTLS; us != nil && (us.CertFile == "") != (us.KeyFile == "") {
+		return fmt.Errorf("upstream_tls: cert_file and key_file go together")
+	}
+	return nil
+}
+
+// serverNamePattern keeps "." out of server names, since it separates
+// them from tool names.
+var serverNamePattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+func validateServer(ss *ServerSettings) error {
+	if !serverNamePattern.MatchString(ss.Name) {
+		return fmt.Errorf("name may only hold letters, digits, _ and -")
+	}
+	if (ss.Command == "") == (ss.URL == "") {
+		return fmt.Errorf("exactly one of command or url is required")
+	}
+	if ss.URL != "" {
+		u, err := url.Parse(ss.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("url %q must be an http or https URL", ss.URL)
+		}
+	}
+	if us := ss.UpstreamTLS; us != nil && (us.CertFile == "") != (us.KeyFile == "") {
+		return fmt.Errorf("upstream_tls: cert_file and key_file go together")
+	}
+	return nil
+}
+
+func validateAuth(as *AuthSettings) error {
+	if as.TokensFile == "" && as.JWT == nil {
+		return fmt.Errorf("tokens_file or jwt is required")
+	}
+	if j := as.JWT; j != nil {
+		if j.JWKSFile == "" && j.JWKSURL == "" {
+			return fmt.Errorf("jwt: jwks_file or jwks_url is required")
+		}
+		if j.Issuer == "" || j.Audience == "" {
+			return fmt.Errorf("jwt: issuer and audience are required")
+		}
+		if j.Leeway != "" {
+			if d, err := time.ParseDuration(j.Leeway); err != nil || d < 0 {
+				return fmt.Errorf("jwt: invalid leeway %q", j.Leeway)
+			}
+		}
+	}
+	return nil
+}
+
+func validateResultAction(action string) error {
+	switch action {
+	case "", "redact", "block", "log":
+		return nil
+	}
+	return fmt.Errorf("invalid action %q (expected redact, block, or log)", action)
+}
+
+func validateSecretSettings(ss *SecretSettings) error {
+	if err := validateSecretAction(ss.Action); err != nil {
+		return err
+	}
+	for name, action := range ss.Actions {
+		if err := validateSecretAction(action); err != nil {
+			return fmt.Errorf("pattern %q: %w", name, err)
+		}
+	}
+	for i, p := range ss.Patterns {
+		if p.Name == "" {
+			return fmt.Errorf("pattern %d: name is required", i)
+		}
+		if _, err := regexp.Compile(p.Regex); err != nil {
+			return fmt.Errorf("pattern %q: regex invalid: %w", p.Name, err)
+		}
+		if err := validateSecretAction(p.Action); err != nil {
+			return fmt.Errorf("pattern %q: %w", p.Name, err)
+		}
+	}
+	return nil
+}
+
+func validateSecretAction(action string) error {
+	switch action {
+	case "", "deny", "ask", "log", "redact":
+		return nil
+	}
+	return fmt.Errorf("invalid action %q (expected deny, ask, log, or redact)", action)
+}
+
+func validateCaptureMode(mode string) error {
+	switch mode {
+	case "", "full", "hashed", "truncated", "none":
+		return nil
+	}
+	return fmt.Errorf("invalid capture mode %q (expected full, hashed, truncated, or none)", mode)
+}
+
+func validateHoneytokens(hs *HoneytokenSettings) error {
+	names := make(map[string]bool)
+	for i, t := range hs.Tokens {
+		if t.Name == "" {
+			return fmt.Errorf("token %d: name is required", i)
+		}
+		if names[t.Name] {
+			return fmt.Errorf("duplicate token name %q", t.Name)
+		}
+		names[t.Name] = true
+		switch t.Kind {
+		case "", "aws_access_key", "github_token", "api_key", "password":
+		default:
+			return fmt.Errorf("token %q: invalid kind %q", t.Name, t.Kind)
+		}
+	}
+	for i, r := range hs.Resources {
+		if r.URI == "" {
+			return fmt.Errorf("resource %d: uri is required", i)
+		}
+	}
+	for i, r := range hs.Results {
+		if r.Tool == "" {
+			return fmt.Errorf("result %d: tool is required", i)
+		}
+	}
+	return nil
+}
+
+func validateRateLimits(rl *RateLimitSettings) error {
+	switch rl.OnExceed {
+	case "", "deny", "delay":
+	default:
+		return fmt.Errorf("invalid on_exceed %q (expected deny or delay)", rl.OnExceed)
+	}
+	if rl.MaxWait != "" {
+		if d, err := time.ParseDuration(rl.MaxWait); err != nil || d <= 0 {
+			return fmt.Errorf("invalid max_wait %q", rl.MaxWait)
+		}
+	}
+
+	check := func(name string, r *RateLimitRule) error {
+		if r == nil {
+			return nil
+		}
+		if err := validateRateLimitRule(r); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		return nil
+	}
+
+	for i, q := range rl.Quotas {
+		if q.Max <= 0 {
+			return fmt.Errorf("quotas %d: max must be positive", i)
+		}
+		if q.Period != "day" && q.Period != "month" {
+			return fmt.Errorf("quotas %d: invalid period %q (expected day or month)", i, q.Period)
+		}
+	}
+
+	if err := check("global", rl.Global); err != nil {
+		return err
+	}
+	if err := check("per_session", rl.PerSession); err != nil {
+		return err
+	}
+	if err := check("per_client", rl.PerClient); err != nil {
+		return err
+	}
+	for tool, r := range rl.PerTool {
+		if err := check("per_tool "+tool, r); err != nil {
+			return err
+		}
+	}
+	for method, r := range rl.PerMethod {
+		if err := check("per_method "+method, r); err != nil {
+			return err
+		}
+	}
+	for i, a := range rl.PerArgument {
+		if a.Tool == "" || a.Argument == "" {
+			return fmt.Errorf("per_argument %d: tool and argument are required", i)
+		}
+		if err := check("per_argument "+a.Tool+"."+a.Argument, &a.RateLimitRule); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func validateRateLimitRule(r *RateLimitRule) error {
+	if r.Max <= 0 {
+		return fmt.Errorf("max must be positive")
+	}
+	d, err := time.ParseDuration(r.Window)
+	if err != nil {
+		return fmt.Errorf("invalid window %q: %w", r.Window, err)
+	}
+	if d <= 0 {
+		return fmt.Errorf("window must be positive")
+	}
+	switch r.Algorithm {
+	case "", "sliding_window", "token_bucket":
+	default:
+		return fmt.Errorf("invalid algorithm %q (expected sliding_window or token_bucket)", r.Algorithm)
+	}
+	if r.Burst < 0 {
+		return fmt.Errorf("burst must not be negative")
+	}
+	return nil
+}
+
+func validateConcurrency(cs *ConcurrencySettings) error {
+	if cs.MaxConcurrent < 0 {
+		return fmt.Errorf("max_concurrent must not be negative")
+	}
+	for tool, max := range cs.PerTool {
+		if max <= 0 {
+			return fmt.Errorf("per_tool %s: max must be positive", tool)
+		}
+	}
+	switch cs.OnExceed {
+	case "", "deny", "queue":
+	default:
+		return fmt.Errorf("invalid on_exceed %q (expected deny or queue)", cs.OnExceed)
+	}
+	if cs.MaxWait != "" {
+		if d, err := time.ParseDuration(cs.MaxWait); err != nil || d <= 0 {
+			return fmt.Errorf("invalid max_wait %q", cs.MaxWait)
+		}
+	}
+	if cs.MaxHold != "" {
+		if d, err := time.ParseDuration(cs.MaxHold); err != nil || d <= 0 {
+			return fmt.Errorf("invalid max_hold %q", cs.MaxHold)
+		}
+	}
+	return nil
+}
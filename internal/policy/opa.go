@@ -54,7 +54,12 @@ func NewOPAEngineFromSource(source string) (*OPAEngine, error) {
 //
 //	input.method: string
 //	input.tool: string
+//	input.server: string (route name, when the HTTP proxy has routes)
 //	input.arguments: object
+//	input.budget: object (calls, argument_bytes, response_bytes,
+//	  elapsed_seconds, usage), when session budgets are configured
+//	input.principal: object (subject, scopes, groups, method,
+//	  cert_subject, cert_sans), when the HTTP proxy authenticates clients
 func (e *OPAEngine) Evaluate(ctx context.Context, input *EvalInput) (*EvalResult, error) {
 	e.mu.RLock()
 	defer e.mu.RUnlock()
@@ -63,6 +68,7 @@ func (e *OPAEngine) Evaluate(ctx context.Context, input *EvalInput) (*EvalResult
 	inputMap := map[string]any{
 		"method": input.Method,
 		"tool":   input.Tool,
+		"server": input.Server,
 	}
 	if input.Arguments != nil {
 		var args any
@@ -70,6 +76,27 @@ func (e *OPAEngine) Evaluate(ctx context.Context, input *EvalInput) (*EvalResult
 			inputMap["arguments"] = args
 		}
 	}
+	if b := input.Budget; b != nil {
+		inputMap["budget"] = map[string]any{
+			"calls":           b.Calls,
+			"argument_bytes":  b.ArgumentBytes,
+			"response_bytes":  b.ResponseBytes,
+			"elapsed_seconds": b.ElapsedSeconds,
+			"usage":           b.Usage,
+		}
+	}
+
+	if pr := input.Principal; pr != nil {
+		inputMap["principal"] = map[string]any{
+			"subject": pr.Subject,
+			"scopes":  pr.Scopes,
+			"groups":  pr.Groups,
+			"method":  pr.Method,
+
+			"cert_subject": pr.CertSubject,
+			"cert_sans":    pr.CertSANs,
+		}
+	}
 
 	rs, err := e.query.Eval(ctx, rego.EvalInput(inputMap))
 	if err != nil {
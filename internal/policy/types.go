@@ -22,24 +22,286 @@ type Settings struct {
 	OPAPolicy       string           `yaml:"opa_policy,omitempty" json:"opa_policy,omitempty"`
 	SecretScanner   *SecretSettings  `yaml:"secret_scanner,omitempty" json:"secret_scanner,omitempty"`
 	RateLimit       *RateLimitSettings `yaml:"rate_limit,omitempty" json:"rate_limit,omitempty"`
+
+	InjectionScanner   *InjectionSettings     `yaml:"injection_scanner,omitempty" json:"injection_scanner,omitempty"`
+	ResultScanner      *ResultScannerSettings `yaml:"result_scanner,omitempty" json:"result_scanner,omitempty"`
+	Redaction          *RedactionSettings     `yaml:"redaction,omitempty" json:"redaction,omitempty"`
+	Canary             *CanarySettings        `yaml:"canary,omitempty" json:"canary,omitempty"`
+	Honeytokens        *HoneytokenSettings    `yaml:"honeytokens,omitempty" json:"honeytokens,omitempty"`
+	Concurrency        *ConcurrencySettings   `yaml:"concurrency,omitempty" json:"concurrency,omitempty"`
+	LoopDetection      *LoopDetectionSettings `yaml:"loop_detection,omitempty" json:"loop_detection,omitempty"`
+	Budget             *BudgetSettings        `yaml:"budget,omitempty" json:"budget,omitempty"`
+	OnFilterError      string                 `yaml:"on_filter_error,omitempty" json:"on_filter_error,omitempty"`           // deny (default) | allow
+	SessionIdleTimeout string                 `yaml:"session_idle_timeout,omitempty" json:"session_idle_timeout,omitempty"` // HTTP proxy, e.g. "30m"
+	Auth               *AuthSettings          `yaml:"auth,omitempty" json:"auth,omitempty"`                                 // HTTP proxy
+	TLS                *TLSSettings           `yaml:"tls,omitempty" json:"tls,omitempty"`                                   // HTTP proxy listener
+	UpstreamTLS        *UpstreamTLSSettings   `yaml:"upstream_tls,omitempty" json:"upstream_tls,omitempty"`                 // HTTP proxy target
+	Routes             []RouteSettings        `yaml:"routes,omitempty" json:"routes,omitempty"`                             // HTTP proxy, several servers
+	Servers            []ServerSettings       `yaml:"servers,omitempty" json:"servers,omitempty"`                           // gateway
+}
+
+// AuthSettings configures authentication of the HTTP proxy's clients, as
+// an OAuth 2.0 protected resource. Static tokens and JWTs may be combined.
+type AuthSettings struct {
+	// TokensFile lists static bearer tokens, one per line: the token, its
+	// subject, then any scopes, separated by whitespace.
+	TokensFile string       `yaml:"tokens_file,omitempty" json:"tokens_file,omitempty"`
+	JWT        *JWTSettings `yaml:"jwt,omitempty" json:"jwt,omitempty"`
+
+	// Resource is the proxy's canonical URL, advertised with the
+	// authorization servers in its protected resource metadata (RFC 9728).
+	Resource             string   `yaml:"resource,omitempty" json:"resource,omitempty"`
+	AuthorizationServers []string `yaml:"authorization_servers,omitempty" json:"authorization_servers,omitempty"`
+	ScopesSupported      []string `yaml:"scopes_supported,omitempty" json:"scopes_supported,omitempty"`
+}
+
+// JWTSettings configures offline validation of JWT access tokens against
+// the authorization server's signing keys.
+type JWTSettings struct {
+	JWKSFile    string `yaml:"jwks_file,omitempty" json:"jwks_file,omitempty"`
+	JWKSURL     string `yaml:"jwks_url,omitempty" json:"jwks_url,omitempty"`
+	Issuer      string `yaml:"issuer" json:"issuer"`
+	Audience    string `yaml:"audience" json:"audience"`                             // usually the resource URL
+	GroupsClaim string `yaml:"groups_claim,omitempty" json:"groups_claim,omitempty"` // default "groups"
+	Leeway      string `yaml:"leeway,omitempty" json:"leeway,omitempty"`             // clock skew, default "30s"
+}
+
+// TLSSettings configures TLS on the HTTP proxy's listener. The certificate
+// and key are reloaded when their files change.
+type TLSSettings struct {
+	CertFile string `yaml:"cert_file" json:"cert_file"`
+	KeyFile  string `yaml:"key_file" json:"key_file"`
+
+	// ClientCAFile enables client certificate authentication (mTLS)
+	// against the CAs it holds.
+	ClientCAFile string `yaml:"client_ca_file,omitempty" json:"client_ca_file,omitempty"`
+	ClientAuth   string `yaml:"client_auth,omitempty" json:"client_auth,omitempty"` // require (default) | optional
+	MinVersion   string `yaml:"min_version,omitempty" json:"min_version,omitempty"` // "1.2" (default) | "1.3"
+}
+
+// UpstreamTLSSettings configures the HTTP proxy's TLS connections to an
+// https target.
+type UpstreamTLSSettings struct {
+	CAFile     string `yaml:"ca_file,omitempty" json:"ca_file,omitempty"` // trusted instead of the system roots
+	CertFile   string `yaml:"cert_file,omitempty" json:"cert_file,omitempty"`
+	KeyFile    string `yaml:"key_file,omitempty" json:"key_file,omitempty"`
+	ServerName string `yaml:"server_name,omitempty" json:"server_name,omitempty"` // SNI and verified name
+}
+
+// RouteSettings sends the HTTP proxy's requests for a path prefix, a host,
+// or both, to one MCP server. The most specific route wins: one for the
+// request's host before one for any host, then the longest prefix.
+type RouteSettings struct {
+	Name       string `yaml:"name" json:"name"` // matched by rules as server, and audited
+	PathPrefix string `yaml:"path_prefix,omitempty" json:"path_prefix,omitempty"`
+	Host       string `yaml:"host,omitempty" json:"host,omitempty"`
+	Target     string `yaml:"target" json:"target"`
+
+	// Policy is a policy file for this route, whose rules and settings
+	// (e.g. scanners, rate limits) replace the main file's. Default is the
+	// main file.
+	Policy      string               `yaml:"policy,omitempty" json:"policy,omitempty"`
+	RateLimit   *RateLimitSettings   `yaml:"rate_limit,omitempty" json:"rate_limit,omitempty"`
+	UpstreamTLS *UpstreamTLSSettings `yaml:"upstream_tls,omitempty" json:"upstream_tls,omitempty"`
+}
+
+// ServerSettings is one MCP server behind the gateway, spawned with
+// command or reached over Streamable HTTP at url. The gateway presents its
+// tools and prompts to the host as "<name>.<tool>".
+type ServerSettings struct {
+	Name    string            `yaml:"name" json:"name"` // matched by rules as server, and audited
+	Command string            `yaml:"command,omitempty" json:"command,omitempty"`
+	Args    []string          `yaml:"args,omitempty" json:"args,omitempty"`
+	Env     map[string]string `yaml:"env,omitempty" json:"env,omitempty"` // added to the gateway's own; ${VAR} expanded
+	URL     string            `yaml:"url,omitempty" json:"url,omitempty"`
+
+	// Headers are sent with every request to url, e.g. an Authorization
+	// header. ${VAR} is expanded, so secrets can stay in the environment.
+	Headers     map[string]string    `yaml:"headers,omitempty" json:"headers,omitempty"`
+	UpstreamTLS *UpstreamTLSSettings `yaml:"upstream_tls,omitempty" json:"upstream_tls,omitempty"`
 }
 
 // SecretSettings configures the secret scanner filter.
 type SecretSettings struct {
 	Enabled          bool    `yaml:"enabled" json:"enabled"`
 	EntropyThreshold float64 `yaml:"entropy_threshold,omitempty" json:"entropy_threshold,omitempty"`
+	MinTokenLength   int     `yaml:"min_token_length,omitempty" json:"min_token_length,omitempty"`
+
+	// Action is the default for findings: deny (default), ask, log, or redact.
+	Action      string                  `yaml:"action,omitempty" json:"action,omitempty"`
+	Actions     map[string]string       `yaml:"actions,omitempty" json:"actions,omitempty"` // per-pattern override
+	Patterns    []SecretPatternSettings `yaml:"patterns,omitempty" json:"patterns,omitempty"`
+	Allowlist   *SecretAllowlist        `yaml:"allowlist,omitempty" json:"allowlist,omitempty"`
+	ExemptTools []string                `yaml:"exempt_tools,omitempty" json:"exempt_tools,omitempty"`
+}
+
+// SecretPatternSettings defines a custom secret pattern.
+type SecretPatternSettings struct {
+	Name      string   `yaml:"name" json:"name"`
+	Regex     string   `yaml:"regex" json:"regex"`
+	Keywords  []string `yaml:"keywords,omitempty" json:"keywords,omitempty"`
+	Validator string   `yaml:"validator,omitempty" json:"validator,omitempty"` // luhn | iban
+	Action    string   `yaml:"action,omitempty" json:"action,omitempty"`
+}
+
+// SecretAllowlist suppresses findings for known-safe values and paths.
+type SecretAllowlist struct {
+	Values []string `yaml:"values,omitempty" json:"values,omitempty"`
+	Paths  []string `yaml:"paths,omitempty" json:"paths,omitempty"`
+}
+
+// InjectionSettings configures the outbound prompt-injection scanner that
+// inspects tool, prompt, and resource metadata returned by the server.
+type InjectionSettings struct {
+	Enabled              bool   `yaml:"enabled" json:"enabled"`
+	Action               string `yaml:"action,omitempty" json:"action,omitempty"` // strip | annotate | block
+	MaxDescriptionLength int    `yaml:"max_description_length,omitempty" json:"max_description_length,omitempty"`
+}
+
+// ResultScannerSettings configures scanning of outbound tool results for
+// secrets and personal data.
+type ResultScannerSettings struct {
+	Enabled bool              `yaml:"enabled" json:"enabled"`
+	PII     bool              `yaml:"pii,omitempty" json:"pii,omitempty"`
+	Action  string            `yaml:"action,omitempty" json:"action,omitempty"`   // redact | block | log
+	Actions map[string]string `yaml:"actions,omitempty" json:"actions,omitempty"` // per-detector override
+}
+
+// RedactionSettings controls what tool arguments are written to the audit
+// log. Secrets found by the scanner are always masked.
+type RedactionSettings struct {
+	SensitiveKeys  []string          `yaml:"sensitive_keys,omitempty" json:"sensitive_keys,omitempty"`
+	Capture        string            `yaml:"capture,omitempty" json:"capture,omitempty"` // full | hashed | truncated | none
+	TruncateLength int               `yaml:"truncate_length,omitempty" json:"truncate_length,omitempty"`
+	Tools          map[string]string `yaml:"tools,omitempty" json:"tools,omitempty"` // per-tool capture mode
+}
+
+// CanarySettings configures the host-environment canary, which blocks
+// messages carrying the values of the listed env vars and credential files.
+type CanarySettings struct {
+	Enabled   bool     `yaml:"enabled" json:"enabled"`
+	Env       []string `yaml:"env,omitempty" json:"env,omitempty"`       // names or globs, e.g. "*_TOKEN"
+	Files     []string `yaml:"files,omitempty" json:"files,omitempty"`   // e.g. ~/.npmrc, ~/.netrc
+	Action    string   `yaml:"action,omitempty" json:"action,omitempty"` // deny | log
+	MinLength int      `yaml:"min_length,omitempty" json:"min_length,omitempty"`
+}
+
+// BudgetSettings caps what a single client session may consume. Zero
+// values are unlimited.
+type BudgetSettings struct {
+	MaxCalls         int    `yaml:"max_calls,omitempty" json:"max_calls,omitempty"`                   // tool calls
+	MaxArgumentBytes int64  `yaml:"max_argument_bytes,omitempty" json:"max_argument_bytes,omitempty"` // cumulative tool arguments
+	MaxResponseBytes int64  `yaml:"max_response_bytes,omitempty" json:"max_response_bytes,omitempty"` // cumulative responses
+	MaxDuration      string `yaml:"max_duration,omitempty" json:"max_duration,omitempty"`             // e.g. "2h"
+}
+
+// LoopDetectionSettings configures detection of agents repeating the same
+// call, or cycling through a few calls, within a session.
+type LoopDetectionSettings struct {
+	Enabled        bool   `yaml:"enabled" json:"enabled"`
+	MaxRepeats     int    `yaml:"max_repeats,omitempty" json:"max_repeats,omitempty"`           // identical calls allowed in the window
+	MaxCycles      int    `yaml:"max_cycles,omitempty" json:"max_cycles,omitempty"`             // back-to-back repeats of a cycle
+	MaxCycleLength int    `yaml:"max_cycle_length,omitempty" json:"max_cycle_length,omitempty"` // longest cycle looked for
+	Window         int    `yaml:"window,omitempty" json:"window,omitempty"`                     // calls remembered per session
+	Action         string `yaml:"action,omitempty" json:"action,omitempty"`                     // deny | ask | log
+}
+
+// HoneytokenSettings configures decoy credentials and where they're planted.
+// Generated values persist in log_dir/honeytokens.json.
+type HoneytokenSettings struct {
+	Enabled   bool                    `yaml:"enabled" json:"enabled"`
+	Tokens    []HoneytokenDef         `yaml:"tokens,omitempty" json:"tokens,omitempty"`
+	Resources []DecoyResourceSettings `yaml:"resources,omitempty" json:"resources,omitempty"`
+	Results   []DecoyResultSettings   `yaml:"results,omitempty" json:"results,omitempty"`
+}
+
+// HoneytokenDef defines a single honeytoken. Value is generated if empty.
+type HoneytokenDef struct {
+	Name  string `yaml:"name" json:"name"`
+	Kind  string `yaml:"kind,omitempty" json:"kind,omitempty"` // aws_access_key | github_token | api_key | password
+	Value string `yaml:"value,omitempty" json:"value,omitempty"`
+}
+
+// DecoyResourceSettings defines a fake resource served by the proxy. Text
+// may reference tokens as {{name}}.
+type DecoyResourceSettings struct {
+	URI         string `yaml:"uri" json:"uri"`
+	Name        string `yaml:"name" json:"name"`
+	Description string `yaml:"description,omitempty" json:"description,omitempty"`
+	MimeType    string `yaml:"mime_type,omitempty" json:"mime_type,omitempty"`
+	Text        string `yaml:"text" json:"text"`
+}
+
+// DecoyResultSettings appends decoy text to a tool's results.
+type DecoyResultSettings struct {
+	Tool string `yaml:"tool" json:"tool"`
+	Text string `yaml:"text" json:"text"`
 }
 
 // RateLimitSettings configures rate limiting.
 type RateLimitSettings struct {
 	Global  *RateLimitRule            `yaml:"global,omitempty" json:"global,omitempty"`
 	PerTool map[string]*RateLimitRule `yaml:"per_tool,omitempty" json:"per_tool,omitempty"`
+
+	PerMethod   map[string]*RateLimitRule `yaml:"per_method,omitempty" json:"per_method,omitempty"`
+	PerSession  *RateLimitRule            `yaml:"per_session,omitempty" json:"per_session,omitempty"`
+	PerClient   *RateLimitRule            `yaml:"per_client,omitempty" json:"per_client,omitempty"`
+	PerArgument []ArgumentRateLimitRule   `yaml:"per_argument,omitempty" json:"per_argument,omitempty"`
+
+	// OnExceed is deny (default) or delay; delay holds an over-limit
+	// request for up to MaxWait (default "10s") before denying it.
+	OnExceed string `yaml:"on_exceed,omitempty" json:"on_exceed,omitempty"`
+	MaxWait  string `yaml:"max_wait,omitempty" json:"max_wait,omitempty"`
+
+	// Quotas are calendar limits, e.g. 50 send_email per day.
+	Quotas []QuotaRule `yaml:"quotas,omitempty" json:"quotas,omitempty"`
+
+	// Persist stores counters in log_dir so limits and quotas survive
+	// restarts and are shared by all proxy processes on the machine.
+	Persist bool `yaml:"persist,omitempty" json:"persist,omitempty"`
+}
+
+// QuotaRule limits requests per calendar day or month. Tool scopes it to
+// one tool, Method to one method; with neither it counts all tool calls.
+type QuotaRule struct {
+	Tool   string `yaml:"tool,omitempty" json:"tool,omitempty"`
+	Method string `yaml:"method,omitempty" json:"method,omitempty"`
+	Max    int    `yaml:"max" json:"max"`
+	Period string `yaml:"period" json:"period"` // day | month
 }
 
 // RateLimitRule defines a rate limit: max requests per time window.
 type RateLimitRule struct {
 	Max    int    `yaml:"max" json:"max"`
 	Window string `yaml:"window" json:"window"`
+
+	// Algorithm is sliding_window (default) or token_bucket. Burst is the
+	// bucket capacity (default max); tokens refill at max per window.
+	Algorithm string `yaml:"algorithm,omitempty" json:"algorithm,omitempty"`
+	Burst     int    `yaml:"burst,omitempty" json:"burst,omitempty"`
+}
+
+// ConcurrencySettings limits in-flight tool calls, globally and per tool.
+type ConcurrencySettings struct {
+	MaxConcurrent int            `yaml:"max_concurrent,omitempty" json:"max_concurrent,omitempty"`
+	PerTool       map[string]int `yaml:"per_tool,omitempty" json:"per_tool,omitempty"`
+
+	// OnExceed is deny (default) or queue; queue holds the call for up to
+	// MaxWait (default "30s") until a slot frees up.
+	OnExceed string `yaml:"on_exceed,omitempty" json:"on_exceed,omitempty"`
+	MaxWait  string `yaml:"max_wait,omitempty" json:"max_wait,omitempty"`
+
+	// MaxHold (default "10m") frees the slot of a call the server never
+	// answers.
+	MaxHold string `yaml:"max_hold,omitempty" json:"max_hold,omitempty"`
+}
+
+// ArgumentRateLimitRule limits a tool per value of one of its arguments.
+type ArgumentRateLimitRule struct {
+	Tool          string `yaml:"tool" json:"tool"`
+	Argument      string `yaml:"argument" json:"argument"`             // dotted path, e.g. "repo"
+	Host          bool   `yaml:"host,omitempty" json:"host,omitempty"` // key by URL host
+	RateLimitRule `yaml:",inline"`
 }
 
 // Rule represents a single policy rule.
@@ -48,13 +310,36 @@ type Rule struct {
 	Match   RuleMatch `yaml:"match" json:"match"`
 	Action  string    `yaml:"action" json:"action"`
 	Message string    `yaml:"message,omitempty" json:"message,omitempty"`
+
+	// RateLimit, if set, limits requests matching this rule.
+	RateLimit *RateLimitRule `yaml:"rate_limit,omitempty" json:"rate_limit,omitempty"`
 }
 
 // RuleMatch specifies conditions for matching a request.
 type RuleMatch struct {
 	Method    string                   `yaml:"method,omitempty" json:"method,omitempty"`
 	Tool      string                   `yaml:"tool,omitempty" json:"tool,omitempty"`
+	Server    string                   `yaml:"server,omitempty" json:"server,omitempty"` // route name
 	Arguments map[string]ArgumentMatch `yaml:"arguments,omitempty" json:"arguments,omitempty"`
+
+	// MinBudgetUsage matches once the session has used at least this
+	// fraction (0–1) of any of its budgets, e.g. 0.8 to ask at 80%.
+	MinBudgetUsage float64 `yaml:"min_budget_usage,omitempty" json:"min_budget_usage,omitempty"`
+
+	// Principal matches the authenticated caller.
+	Principal *PrincipalMatch `yaml:"principal,omitempty" json:"principal,omitempty"`
+}
+
+// PrincipalMatch matches the authenticated caller. A request without one
+// never matches.
+type PrincipalMatch struct {
+	Subject string   `yaml:"subject,omitempty" json:"subject,omitempty"` // glob, e.g. "svc-*"
+	Scopes  []string `yaml:"scopes,omitempty" json:"scopes,omitempty"`   // all required
+	Groups  []string `yaml:"groups,omitempty" json:"groups,omitempty"`   // any
+
+	// CertSubject and SANs match the verified client certificate (mTLS).
+	CertSubject string   `yaml:"cert_subject,omitempty" json:"cert_subject,omitempty"` // glob on the DN
+	SANs        []string `yaml:"sans,omitempty" json:"sans,omitempty"`                 // globs where * spans "/", any
 }
 
 // ArgumentMatch specifies a matching condition for a single argument.
@@ -67,7 +352,22 @@ type ArgumentMatch struct {
 type EvalInput struct {
 	Method    string          `json:"method"`
 	Tool      string          `json:"tool,omitempty"`
+	Server    string          `json:"server,omitempty"`
 	Arguments json.RawMessage `json:"arguments,omitempty"`
+	Budget    *BudgetUsage    `json:"budget,omitempty"`
+	Principal *api.Principal  `json:"principal,omitempty"`
+}
+
+// BudgetUsage is how much of its budgets a session has consumed so far.
+type BudgetUsage struct {
+	Calls          int     `json:"calls"`
+	ArgumentBytes  int64   `json:"argument_bytes"`
+	ResponseBytes  int64   `json:"response_bytes"`
+	ElapsedSeconds float64 `json:"elapsed_seconds"`
+
+	// Usage is the highest fraction of any configured budget used, so 1
+	// means at least one budget is exhausted.
+	Usage float64 `json:"usage"`
 }
 
 // EvalResult is the output of a policy engine evaluation.
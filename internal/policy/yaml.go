@@ -4,7 +4,9 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"path"
 	"regexp"
+	"slices"
 	"sync"
 
 	"github.com/tkingovr/agent-guard/api"
@@ -115,6 +117,23 @@ func (e *YAMLEngine) matches(rule *Rule, input *EvalInput) bool {
 		return false
 	}
 
+	// Match the server (route) the request is for
+	if rule.Match.Server != "" && rule.Match.Server != input.Server {
+		return false
+	}
+
+	// Match session budget consumption
+	if rule.Match.MinBudgetUsage > 0 {
+		if input.Budget == nil || input.Budget.Usage < rule.Match.MinBudgetUsage {
+			return false
+		}
+	}
+
+	// Match the authenticated caller
+	if pm := rule.Match.Principal; pm != nil && !matchPrincipal(pm, input.Principal) {
+		return false
+	}
+
 	// Match arguments
 	if len(rule.Match.Arguments) > 0 {
 		if input.Arguments == nil {
@@ -146,6 +165,70 @@ func (e *YAMLEngine) matches(rule *Rule, input *EvalInput) bool {
 	return true
 }
 
+// matchPrincipal reports whether p has the subject, every scope, any of
+// the groups, and the client certificate pm asks for.
+func matchPrincipal(pm *PrincipalMatch, p *api.Principal) bool {
+	if p == nil {
+		return false
+	}
+	if pm.Subject != "" {
+		if ok, _ := path.Match(pm.Subject, p.Subject); !ok {
+			return false
+		}
+	}
+	for _, scope := range pm.Scopes {
+		if !slices.Contains(p.Scopes, scope) {
+			return false
+		}
+	}
+	if len(pm.Groups) > 0 && !slices.ContainsFunc(pm.Groups, func(g string) bool {
+		return slices.Contains(p.Groups, g)
+	}) {
+		return false
+	}
+	if pm.CertSubject != "" {
+		if ok, _ := path.Match(pm.CertSubject, p.CertSubject); !ok {
+			return false
+		}
+	}
+	if len(pm.SANs) > 0 && !slices.ContainsFunc(pm.SANs, func(pattern string) bool {
+		return slices.ContainsFunc(p.CertSANs, func(san string) bool {
+			return matchSAN(pattern, san)
+		})
+	}) {
+		return false
+	}
+	return true
+}
+
+// matchSAN matches a certificate SAN against a glob. Unlike path.Match,
+// * spans "/", so spiffe://corp/* covers every workload under corp; ?
+// matches one character and everything else is literal.
+func matchSAN(pattern, san string) bool {
+	p, s := 0, 0
+	star, next := -1, 0
+	for s < len(san) {
+		switch {
+		case p < len(pattern) && (pattern[p] == '?' || pattern[p] == san[s]):
+			p++
+			s++
+		case p < len(pattern) && pattern[p] == '*':
+			star, next = p, s
+			p++
+		case star >= 0:
+			// Let the last * take one more character
+			next++
+			p, s = star+1, next
+		default:
+			return false
+		}
+	}
+	for p < len(pattern) && pattern[p] == '*' {
+		p++
+	}
+	return p == len(pattern)
+}
+
 func (e *YAMLEngine) matchAnyValue(ruleName, matchKey string, am ArgumentMatch, args map[string]any) bool {
 	for _, v := range args {
 		if e.matchArgument(ruleName, matchKey, am, v) {
@@ -374,3 +374,374 @@ func TestYAMLEngine_ExactArgumentMatch(t *testing.T) {
 		}
 	}
 }
+
+func TestLoadBytes_InvalidInjectionAction(t *testing.T) {
+	yaml := `
+version: 1
+settings:
+  injection_scanner:
+    enabled: true
+    action: quarantine
+rules: []
+`
+	_, err := LoadBytes([]byte(yaml))
+	if err == nil {
+		t.Fatal("expected error for invalid injection_scanner action")
+	}
+}
+
+func TestLoadBytes_InvalidSecretPattern(t *testing.T) {
+	yaml := `
+version: 1
+settings:
+  secret_scanner:
+    enabled: true
+    patterns:
+      - name: broken
+        regex: "([a-z"
+rules: []
+`
+	_, err := LoadBytes([]byte(yaml))
+	if err == nil {
+		t.Fatal("expected error for invalid secret_scanner pattern regex")
+	}
+}
+
+func TestLoadBytes_InvalidCaptureMode(t *testing.T) {
+	yaml := `
+version: 1
+settings:
+  redaction:
+    tools:
+      write_file: partial
+rules: []
+`
+	_, err := LoadBytes([]byte(yaml))
+	if err == nil {
+		t.Fatal("expected error for invalid redaction capture mode")
+	}
+}
+
+func TestLoadBytes_InvalidCanaryAction(t *testing.T) {
+	yaml := `
+version: 1
+settings:
+  canary:
+    enabled: true
+    env: [GITHUB_TOKEN]
+    action: redact
+rules: []
+`
+	_, err := LoadBytes([]byte(yaml))
+	if err == nil {
+		t.Fatal("expected error for invalid canary action")
+	}
+}
+
+func TestLoadBytes_InvalidHoneytoken(t *testing.T) {
+	yaml := `
+version: 1
+settings:
+  honeytokens:
+    enabled: true
+    tokens:
+      - name: key
+        kind: ssh_key
+rules: []
+`
+	_, err := LoadBytes([]byte(yaml))
+	if err == nil {
+		t.Fatal("expected error for invalid honeytoken kind")
+	}
+}
+
+func TestLoadBytes_InvalidRateLimit(t *testing.T) {
+	yaml := `
+version: 1
+settings:
+  rate_limit:
+    per_method:
+      resources/read:
+        max: 10
+        window: 1m
+        algorithm: leaky_bucket
+rules: []
+`
+	_, err := LoadBytes([]byte(yaml))
+	if err == nil {
+		t.Fatal("expected error for invalid rate limit algorithm")
+	}
+}
+
+func TestLoadBytes_InvalidOnExceed(t *testing.T) {
+	yaml := `
+version: 1
+settings:
+  rate_limit:
+    on_exceed: queue
+    global:
+      max: 10
+      window: 1m
+rules: []
+`
+	_, err := LoadBytes([]byte(yaml))
+	if err == nil {
+		t.Fatal("expected error for invalid on_exceed")
+	}
+}
+
+func TestLoadBytes_InvalidQuotaPeriod(t *testing.T) {
+	yaml := `
+version: 1
+settings:
+  rate_limit:
+    quotas:
+      - tool: send_email
+        max: 50
+        period: week
+rules: []
+`
+	_, err := LoadBytes([]byte(yaml))
+	if err == nil {
+		t.Fatal("expected error for invalid quota period")
+	}
+}
+
+func TestLoadBytes_InvalidLoopAction(t *testing.T) {
+	yaml := `
+version: 1
+settings:
+  loop_detection:
+    enabled: true
+    action: block
+rules: []
+`
+	_, err := LoadBytes([]byte(yaml))
+	if err == nil {
+		t.Fatal("expected error for invalid loop detection action")
+	}
+}
+
+func TestYAMLEngine_MinBudgetUsage(t *testing.T) {
+	pf := &PolicyFile{
+		Version:  1,
+		Settings: Settings{DefaultAction: api.VerdictAllow},
+		Rules: []Rule{
+			{
+				Name:   "ask-near-budget",
+				Match:  RuleMatch{Method: "tools/call", MinBudgetUsage: 0.8},
+				Action: "ask",
+			},
+		},
+	}
+	engine, err := NewYAMLEngineFromPolicy(pf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		budget *BudgetUsage
+		want   api.Verdict
+	}{
+		{nil, api.VerdictAllow},
+		{&BudgetUsage{Usage: 0.5}, api.VerdictAllow},
+		{&BudgetUsage{Usage: 0.8}, api.VerdictAsk},
+	} {
+		result, err := engine.Evaluate(context.Background(), &EvalInput{
+			Method: "tools/call",
+			Tool:   "search",
+			Budget: tc.budget,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.Verdict != tc.want {
+			t.Errorf("budget %+v: expected %s, got %s", tc.budget, tc.want, result.Verdict)
+		}
+	}
+}
+
+func TestLoadBytes_InvalidBudgetDuration(t *testing.T) {
+	yaml := `
+version: 1
+settings:
+  budget:
+    max_calls: 100
+    max_duration: forever
+rules: []
+`
+	_, err := LoadBytes([]byte(yaml))
+	if err == nil {
+		t.Fatal("expected error for invalid budget max_duration")
+	}
+}
+
+func TestLoadBytes_InvalidOnFilterError(t *testing.T) {
+	yaml := `
+version: 1
+settings:
+  on_filter_error: ignore
+rules: []
+`
+	_, err := LoadBytes([]byte(yaml))
+	if err == nil {
+		t.Fatal("expected error for invalid on_filter_error")
+	}
+}
+
+func TestYAMLEngine_Principal(t *testing.T) {
+	pf, err := LoadBytes([]byte(`
+version: 1
+settings:
+  default_action: deny
+rules:
+  - name: oncall-writes
+    match:
+      method: tools/call
+      principal:
+        subject: "svc-*"
+        scopes: [tools:write]
+        groups: [oncall, sre]
+    action: allow
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	engine, err := NewYAMLEngineFromPolicy(pf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		principal *api.Principal
+		want      api.Verdict
+	}{
+		{nil, api.VerdictDeny},
+		{&api.Principal{Subject: "svc-deploy", Scopes: []string{"tools:read", "tools:write"}, Groups: []string{"sre"}}, api.VerdictAllow},
+		{&api.Principal{Subject: "alice", Scopes: []string{"tools:write"}, Groups: []string{"sre"}}, api.VerdictDeny},
+		{&api.Principal{Subject: "svc-deploy", Scopes: []string{"tools:read"}, Groups: []string{"sre"}}, api.VerdictDeny},
+		{&api.Principal{Subject: "svc-deploy", Scopes: []string{"tools:write"}, Groups: []string{"eng"}}, api.VerdictDeny},
+	} {
+		result, err := engine.Evaluate(context.Background(), &EvalInput{Method: "tools/call", Principal: tc.principal})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.Verdict != tc.want {
+			t.Errorf("principal %+v: expected %s, got %s", tc.principal, tc.want, result.Verdict)
+		}
+	}
+}
+
+func TestYAMLEngine_PrincipalSANs(t *testing.T) {
+	engine, err := NewYAMLEngineFromPolicy(&PolicyFile{
+		Version:  1,
+		Settings: Settings{DefaultAction: api.VerdictDeny},
+		Rules: []Rule{
+			{Name: "corp-workloads", Match: RuleMatch{Method: "tools/call", Principal: &PrincipalMatch{SANs: []string{"spiffe://corp/*"}}}, Action: "allow"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for san, want := range map[string]api.Verdict{
+		"spiffe://corp/ns/prod/sa/x":  api.VerdictAllow,
+		"spiffe://corp/agent":         api.VerdictAllow,
+		"spiffe://corpx/ns/prod/sa/x": api.VerdictDeny,
+		"spiffe://other/ns/prod":      api.VerdictDeny,
+	} {
+		result, err := engine.Evaluate(context.Background(), &EvalInput{
+			Method:    "tools/call",
+			Principal: &api.Principal{CertSANs: []string{"bot.corp.example", san}},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.Verdict != want {
+			t.Errorf("SAN %q: expected %s, got %s", san, want, result.Verdict)
+		}
+	}
+}
+
+func TestLoadBytes_InvalidAuth(t *testing.T) {
+	yaml := `
+version: 1
+settings:
+  auth:
+    jwt:
+      jwks_url: https://auth.example.com/jwks.json
+      issuer: https://auth.example.com
+rules: []
+`
+	_, err := LoadBytes([]byte(yaml))
+	if err == nil {
+		t.Fatal("expected error for jwt without audience")
+	}
+}
+
+func TestLoadBytes_InvalidTLS(t *testing.T) {
+	yaml := `
+version: 1
+settings:
+  tls:
+    cert_file: proxy.crt
+    key_file: proxy.key
+    client_auth: require
+rules: []
+`
+	_, err := LoadBytes([]byte(yaml))
+	if err == nil {
+		t.Fatal("expected error for client_auth without client_ca_file")
+	}
+}
+
+func TestYAMLEngine_Server(t *testing.T) {
+	engine, err := NewYAMLEngineFromPolicy(&PolicyFile{
+		Version:  1,
+		Settings: Settings{DefaultAction: api.VerdictAllow},
+		Rules: []Rule{
+			{Name: "github-read-only", Match: RuleMatch{Method: "tools/call", Server: "github", Tool: "delete_repo"}, Action: "deny"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for server, want := range map[string]api.Verdict{"github": api.VerdictDeny, "gitlab": api.VerdictAllow, "": api.VerdictAllow} {
+		result, err := engine.Evaluate(context.Background(), &EvalInput{Method: "tools/call", Tool: "delete_repo", Server: server})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.Verdict != want {
+			t.Errorf("server %q: expected %s, got %s", server, want, result.Verdict)
+		}
+	}
+}
+
+func TestLoadBytes_InvalidRoutes(t *testing.T) {
+	for name, routes := range map[string]string{
+		"no target":       `[{name: github, path_prefix: /github}]`,
+		"no match":        `[{name: github, target: "http://localhost:4000/mcp"}]`,
+		"relative prefix": `[{name: github, path_prefix: github, target: "http://localhost:4000/mcp"}]`,
+		"duplicate name":  `[{name: a, host: a.example.com, target: "http://a/mcp"}, {name: a, host: b.example.com, target: "http://b/mcp"}]`,
+	} {
+		_, err := LoadBytes([]byte("version: 1\nsettings:\n  routes: " + routes + "\nrules: []\n"))
+		if err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
+
+func TestLoadBytes_InvalidServers(t *testing.T) {
+	for name, servers := range map[string]string{
+		"no name":        `[{command: npx}]`,
+		"dot in name":    `[{name: git.hub, command: npx}]`,
+		"neither":        `[{name: github}]`,
+		"both":           `[{name: github, command: npx, url: "http://localhost:4000/mcp"}]`,
+		"bad url":        `[{name: github, url: "localhost:4000/mcp"}]`,
+		"duplicate name": `[{name: a, command: npx}, {name: a, url: "http://a/mcp"}]`,
+	} {
+		_, err := LoadBytes([]byte("version: 1\nsettings:\n  servers: " + servers + "\nrules: []\n"))
+		if err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package http
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/tkingovr/agent-guard/api"
+	"github.com/tkingovr/agent-guard/internal/filter"
+	"github.com/tkingovr/agent-guard/internal/jsonrpc"
+)
+
+// serveApproval holds a request until an approver decides, then forwards
+// it or answers with a deny. A client that accepts SSE and asked for
+// progress gets an SSE response at once, carrying a notifications/progress
+// periodically while it waits and then the server's response.
+func (p *Proxy) serveApproval(w http.ResponseWriter, r *http.Request, fc *filter.FilterContext) {
+	// A notifications/cancelled from the same session withdraws it
+	ctx, done := p.inflight.Start(r.Context(), fc.SessionID, fc.Message.ID)
+	defer done()
+
+	token := jsonrpc.ProgressToken(fc.Message)
+	if token == nil || !acceptsSSE(r) {
+		approved, resp := p.approvals.Decide(ctx, fc, nil)
+		if approved {
+			approved, resp = p.admit(ctx, fc)
+		}
+		switch {
+		case approved:
+			p.forward(w, r, fc)
+		case resp != nil:
+			writeMessage(w, resp)
+		default:
+			// Cancelled; there is nothing to answer
+			w.WriteHeader(http.StatusAccepted)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	stream := newSSERelay(w, fc.Message.ID)
+	stream.Flush()
+
+	approved, resp := p.approvals.Decide(ctx, fc, func(progress *api.JSONRPCMessage) error {
+		stream.send(progress)
+		return nil
+	})
+	if approved {
+		approved, resp = p.admit(ctx, fc)
+	}
+	switch {
+	case approved:
+		p.forward(stream, r, fc)
+		stream.finish()
+	case resp != nil:
+		stream.send(resp)
+	}
+}
+
+func acceptsSSE(r *http.Request) bool {
+	return strings.Contains(r.Header.Get("Accept"), "text/event-stream")
+}
+
+// sseRelay carries the response to a request into an SSE stream already
+// open to the client: an SSE response from the server passes through, and
+// a JSON one is sent as a single event. It is the http.ResponseWriter the
+// reverse proxy writes to once the request is approved.
+type sseRelay struct {
+	w      http.ResponseWriter
+	id     json.RawMessage
+	header http.Header
+	status int
+	stream bool
+	body   bytes.Buffer
+}
+
+func newSSERelay(w http.ResponseWriter, id json.RawMessage) *sseRelay {
+	return &sseRelay{w: w, id: id, header: make(http.Header)}
+}
+
+func (s *sseRelay) Header() http.Header { return s.header }
+
+func (s *sseRelay) WriteHeader(code int) {
+	if s.status != 0 {
+		return
+	}
+	s.status = code
+	mediaType, _, _ := mime.ParseMediaType(s.header.Get("Content-Type"))
+	s.stream = code < 300 && mediaType == "text/event-stream"
+}
+
+func (s *sseRelay) Write(b []byte) (int, error) {
+	if s.status == 0 {
+		s.WriteHeader(http.StatusOK)
+	}
+	if !s.stream {
+		return s.body.Write(b)
+	}
+	return s.w.Write(b)
+}
+
+func (s *sseRelay) Flush() {
+	_ = http.NewResponseController(s.w).Flush()
+}
+
+// send writes msg as an SSE event.
+func (s *sseRelay) send(msg *api.JSONRPCMessage) {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return
+	}
+	fmt.Fprintf(s.w, "event: message\ndata: %s\n\n", data)
+	s.Flush()
+}
+
+// finish sends a buffered JSON response as an event, or an error if the
+// server didn't answer with one.
+func (s *sseRelay) finish() {
+	if s.stream {
+		return
+	}
+	// An event's data can't span lines
+	var data bytes.Buffer
+	if s.status >= 300 || json.Compact(&data, s.body.Bytes()) != nil {
+		s.send(jsonrpc.NewErrorResponse(s.id, jsonrpc.ErrorCodeInternalError,
+			fmt.Sprintf("upstream server returned HTTP %d", s.status), nil))
+		return
+	}
+	fmt.Fprintf(s.w, "event: message\ndata: %s\n\n", data.Bytes())
+	s.Flush()
+}
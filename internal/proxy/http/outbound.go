@@ -0,0 +1,133 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/tkingovr/agent-guard/api"
+	"github.com/tkingovr/agent-guard/internal/filter"
+	"github.com/tkingovr/agent-guard/internal/jsonrpc"
+	"github.com/tkingovr/agent-guard/internal/relay"
+)
+
+// answerTimeout bounds delivering the answer to a blocked server request.
+const answerTimeout = 30 * time.Second
+
+// exchangeKey is the request context key for the *exchange of a forwarded
+// request.
+type exchangeKey struct{}
+
+// exchange is what the proxy knows about a forwarded POST while its
+// response comes back: the requests it carried, so responses are audited
+// with their method, tool, and correlation ID, and the responses the proxy
+// gave to other messages of a batch, merged into the server's.
+type exchange struct {
+	session    string
+	clientName string
+	local      [][]byte
+	requests   *relay.Requests
+}
+
+func newExchange(session string) *exchange {
+	return &exchange{session: session, requests: relay.NewRequests(0)}
+}
+
+// filterOutbound runs the messages of a response body or SSE event, one
+// message or a batch, through the outbound chain. It returns what to send
+// the client: the messages, possibly rewritten, errors in place of blocked
+// responses, or nil if every message was dropped. A blocked server request
+// is answered with the error in the client's place.
+func (p *Proxy) filterOutbound(ctx context.Context, ex *exchange, raw []byte) []byte {
+	if !jsonrpc.IsBatch(raw) {
+		return p.filterOutboundMessage(ctx, ex, raw)
+	}
+	msgs, err := jsonrpc.SplitBatch(raw)
+	if err != nil {
+		return p.filterOutboundMessage(ctx, ex, raw)
+	}
+	var out [][]byte
+	for _, msg := range msgs {
+		if data := p.filterOutboundMessage(ctx, ex, msg); data != nil {
+			out = append(out, data)
+		}
+	}
+	if len(out) == 0 {
+		return nil
+	}
+	return jsonrpc.JoinBatch(out)
+}
+
+func (p *Proxy) filterOutboundMessage(ctx context.Context, ex *exchange, raw []byte) []byte {
+	fc := filter.NewFilterContext(raw, api.DirectionOutbound)
+	fc.SessionID = ex.session
+	fc.Server = p.server
+	ex.requests.Correlate(fc)
+	if err := p.outboundChain.Process(ctx, fc); err != nil {
+		p.logger.Error("outbound filter error", "error", err)
+	}
+	if fc.Verdict != api.VerdictDeny {
+		return fc.Output()
+	}
+
+	if fc.Message != nil && fc.Message.IsRequest() {
+		p.logger.Warn("server request denied",
+			"method", fc.Method,
+			"rule", fc.MatchedRule,
+			"message", fc.VerdictMessage,
+		)
+		// Not on the stream, which the server may be waiting to write to
+		go p.answerServer(ex.session, fc.DenyResponse())
+		return nil
+	}
+
+	p.logger.Warn("response blocked",
+		"rule", fc.MatchedRule,
+		"message", fc.VerdictMessage,
+	)
+	// Replace a blocked response with an error so the client isn't left
+	// waiting; other blocked messages are dropped.
+	if fc.Message == nil || !fc.Message.IsResponse() {
+		return nil
+	}
+	data, err := json.Marshal(fc.DenyResponse())
+	if err != nil {
+		return nil
+	}
+	return data
+}
+
+// answerServer sends the server the response to one of its requests, as
+// the client would: POSTed on the client's session.
+func (p *Proxy) answerServer(session string, resp *api.JSONRPCMessage) {
+	data, err := json.Marshal(resp)
+	if err != nil {
+		p.logger.Error("encoding server request answer", "error", err)
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), answerTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.target.String(), bytes.NewReader(data))
+	if err != nil {
+		p.logger.Error("answering server request", "error", err)
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json, text/event-stream")
+	if session != "" {
+		req.Header.Set("Mcp-Session-Id", session)
+	}
+	res, err := p.transport.RoundTrip(req)
+	if err != nil {
+		p.logger.Warn("answering server request", "error", err)
+		return
+	}
+	_, _ = io.Copy(io.Discard, res.Body)
+	res.Body.Close()
+	if res.StatusCode >= 300 {
+		p.logger.Warn("server refused answer to its request", "status", res.StatusCode)
+	}
+}
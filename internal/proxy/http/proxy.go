@@ -3,17 +3,26 @@ package http
 import (
 	"bytes"
 	"context"
+	"crypto/tls"
 	"encoding/json"
 	"fmt"
 	"io"
 	"log/slog"
+	"mime"
 	"net/http"
 	"net/http/httputil"
 	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/tkingovr/agent-guard/api"
+	"github.com/tkingovr/agent-guard/internal/approval"
+	"github.com/tkingovr/agent-guard/internal/auth"
 	"github.com/tkingovr/agent-guard/internal/filter"
 	"github.com/tkingovr/agent-guard/internal/jsonrpc"
+	"github.com/tkingovr/agent-guard/internal/relay"
 )
 
 // Proxy is an HTTP reverse proxy for MCP Streamable HTTP transport.
@@ -22,10 +31,77 @@ type Proxy struct {
 	reverseProxy *httputil.ReverseProxy
 	filterChain  *filter.Chain
 	logger       *slog.Logger
+
+	outboundChain *filter.Chain
+	approvals     *relay.Approvals // nil without an approval queue
+	authenticator *auth.Authenticator
+	tlsConfig     *tls.Config // listener
+	upstreamTLS   *tls.Config
+	transport     http.RoundTripper // to the target
+
+	// server names the target when the proxy is a route of a Router.
+	server string
+
+	// Inbound requests get correlation IDs, shared by the audit record
+	// of their response.
+	ids *relay.CorrelationIDs
+
+	inflight *relay.Inflight // requests pending approval
+	sessions *sessionTracker
+}
+
+// Option configures optional proxy features.
+type Option func(*Proxy)
+
+// WithOutboundChain runs every message from the server, in JSON and SSE
+// responses alike, through chain.
+func WithOutboundChain(chain *filter.Chain) Option {
+	return func(p *Proxy) { p.outboundChain = chain }
+}
+
+// WithSessionIdleTimeout sets how long a session nobody uses is kept
+// before requests for it get 404. Default is 30m.
+func WithSessionIdleTimeout(d time.Duration) Option {
+	return func(p *Proxy) { p.sessions.idle = d }
+}
+
+// WithApprovalQueue holds requests with an ask verdict until an approver
+// decides. Without a queue they are denied.
+func WithApprovalQueue(q *approval.Queue) Option {
+	return func(p *Proxy) { p.approvals = relay.NewApprovals(q, p.logger) }
+}
+
+// WithAuthenticator requires every request to carry a bearer token that
+// authenticator accepts. The caller it identifies is passed to policy and
+// audit, and the token itself is not forwarded to the server.
+func WithAuthenticator(authenticator *auth.Authenticator) Option {
+	return func(p *Proxy) { p.authenticator = authenticator }
+}
+
+// WithTLS serves the proxy over TLS. A config with ClientCAs set
+// authenticates clients by certificate, whose subject and SANs are passed
+// to policy and audit.
+func WithTLS(cfg *tls.Config) Option {
+	return func(p *Proxy) { p.tlsConfig = cfg }
+}
+
+// WithUpstreamTLS sets the TLS configuration for connections to an https
+// target (trusted CAs, client certificate, server name).
+func WithUpstreamTLS(cfg *tls.Config) Option {
+	return func(p *Proxy) { p.upstreamTLS = cfg }
+}
+
+// WithServerName names the target, for rules matching on server and for
+// audit records. A Router names each route's proxy after the route.
+func WithServerName(name string) Option {
+	return func(p *Proxy) {
+		p.server = name
+		p.sessions.server = name
+	}
 }
 
 // NewProxy creates a new HTTP MCP proxy targeting the given URL.
-func NewProxy(target string, chain *filter.Chain, logger *slog.Logger) (*Proxy, error) {
+func NewProxy(target string, chain *filter.Chain, logger *slog.Logger, opts ...Option) (*Proxy, error) {
 	u, err := url.Parse(target)
 	if err != nil {
 		return nil, fmt.Errorf("invalid target URL: %w", err)
@@ -35,12 +111,25 @@ func NewProxy(target string, chain *filter.Chain, logger *slog.Logger) (*Proxy,
 		target:      u,
 		filterChain: chain,
 		logger:      logger,
+		ids:         relay.NewCorrelationIDs(relay.NewSessionID()),
+		inflight:    relay.NewInflight(),
+		sessions:    newSessionTracker(defaultSessionIdleTimeout),
+	}
+	for _, opt := range opts {
+		opt(p)
 	}
 
 	rp := httputil.NewSingleHostReverseProxy(u)
 	rp.Director = p.director
 	rp.ModifyResponse = p.modifyResponse
 	rp.ErrorHandler = p.errorHandler
+	p.transport = http.DefaultTransport
+	if p.upstreamTLS != nil {
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.TLSClientConfig = p.upstreamTLS
+		p.transport = transport
+	}
+	rp.Transport = p.transport
 	p.reverseProxy = rp
 
 	return p, nil
@@ -48,8 +137,37 @@ func NewProxy(target string, chain *filter.Chain, logger *slog.Logger) (*Proxy,
 
 // ServeHTTP handles incoming HTTP requests.
 func (p *Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	// Only intercept POST requests (MCP JSON-RPC over HTTP)
-	if r.Method != http.MethodPost {
+	principal := auth.CertificatePrincipal(r.TLS)
+	if p.authenticator != nil {
+		if p.authenticator.IsMetadataRequest(r) {
+			p.authenticator.ServeMetadata(w, r)
+			return
+		}
+		token, err := p.authenticator.Authenticate(r)
+		if err != nil {
+			p.logger.Warn("unauthenticated request", "remote", r.RemoteAddr, "error", err)
+			p.authenticator.Challenge(w, r, err)
+			return
+		}
+		principal = auth.BindCertificate(token, principal)
+	}
+	if principal != nil {
+		r = r.WithContext(auth.NewContext(r.Context(), principal))
+	}
+
+	if session := r.Header.Get("Mcp-Session-Id"); session != "" && !p.sessions.touch(session) {
+		p.logger.Info("request for ended session", "session", session)
+		http.Error(w, "session not found", http.StatusNotFound)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPost:
+		// MCP JSON-RPC over HTTP, handled below
+	case http.MethodGet, http.MethodDelete:
+		p.serveSessionRequest(w, r)
+		return
+	default:
 		p.reverseProxy.ServeHTTP(w, r)
 		return
 	}
@@ -63,78 +181,368 @@ func (p *Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Run through filter chain
-	fc := filter.NewFilterContext(body, api.DirectionInbound)
-	if err := p.filterChain.Process(r.Context(), fc); err != nil {
+	// Each message of a batch is filtered on its own. A batch that
+	// doesn't split is handled as one message, which gets the error.
+	if jsonrpc.IsBatch(body) {
+		if msgs, err := jsonrpc.SplitBatch(body); err == nil {
+			p.serveBatch(w, r, msgs)
+			return
+		}
+	}
+
+	fc := p.filter(r, body)
+	// Responses come back synchronously, so anything the request holds
+	// (e.g., a concurrency slot) is released when the exchange is over.
+	defer fc.Finish()
+
+	switch fc.Verdict {
+	case api.VerdictDeny:
+		p.writeDenyResponse(w, fc)
+		return
+
+	case api.VerdictAsk:
+		if p.approvals == nil {
+			p.writeDenyResponse(w, fc)
+			return
+		}
+		p.serveApproval(w, r, fc)
+		return
+	}
+
+	if fc.Held() {
+		// A notifications/cancelled from the same session withdraws it
+		ctx, done := p.inflight.Start(r.Context(), fc.SessionID, fc.Message.ID)
+		defer done()
+		if admitted, resp := p.admit(ctx, fc); !admitted {
+			if resp != nil {
+				writeMessage(w, resp)
+			} else {
+				w.WriteHeader(http.StatusAccepted)
+			}
+			return
+		}
+	}
+	p.forward(w, r, fc)
+}
+
+// admit runs the waits filters held a request for. It returns whether to
+// forward the request, or else the deny response for the client, nil if
+// the client cancelled it meanwhile.
+func (p *Proxy) admit(ctx context.Context, fc *filter.FilterContext) (bool, *api.JSONRPCMessage) {
+	if err := p.filterChain.Admit(ctx, fc); err != nil {
+		if ctx.Err() != nil {
+			return false, nil
+		}
 		p.logger.Error("filter chain error", "error", err)
-		http.Error(w, "internal filter error", http.StatusInternalServerError)
+	}
+	if fc.Verdict != api.VerdictDeny {
+		return true, nil
+	}
+	p.logger.Warn("request denied",
+		"method", fc.Method,
+		"tool", fc.Tool,
+		"rule", fc.MatchedRule,
+		"subject", subject(fc.Principal),
+	)
+	return false, fc.DenyResponse()
+}
+
+// forward sends an allowed request to the server, or answers it locally
+// when a filter produced the response.
+func (p *Proxy) forward(w http.ResponseWriter, r *http.Request, fc *filter.FilterContext) {
+	// Answer locally (e.g., decoy resources) instead of forwarding
+	if fc.Response != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write(fc.Response)
 		return
 	}
 
+	ex := newExchange(fc.SessionID)
+	ex.clientName = fc.ClientName
+	ex.requests.Track(fc)
+	r = r.WithContext(context.WithValue(r.Context(), exchangeKey{}, ex))
+
+	// Forward allowed request, possibly rewritten (e.g. redacted secrets)
+	out := fc.Output()
+	r.Body = io.NopCloser(bytes.NewReader(out))
+	r.ContentLength = int64(len(out))
+	p.reverseProxy.ServeHTTP(w, r)
+}
+
+// filter runs a message through the filter chain.
+func (p *Proxy) filter(r *http.Request, raw []byte) *filter.FilterContext {
+	fc := filter.NewFilterContext(raw, api.DirectionInbound)
+	fc.SessionID = r.Header.Get("Mcp-Session-Id")
+	// The client named itself once, in the initialize that began the session
+	fc.ClientName = p.sessions.clientName(fc.SessionID)
+	fc.Server = p.server
+	fc.Principal = auth.PrincipalFrom(r.Context())
+	fc.CorrelationID = p.ids.Next()
+	// A failed filter leaves a deny (or, failing open, an allow) verdict,
+	// answered like any other
+	if err := p.filterChain.Process(r.Context(), fc); err != nil {
+		p.logger.Error("filter chain error", "error", err)
+	}
+	p.sessions.record(fc)
+	// Withdraw a cancelled request still waiting for approval, whatever
+	// the policy says about the notification itself
+	if id := jsonrpc.CancelledRequestID(fc.Message); id != nil {
+		p.inflight.Cancel(fc.SessionID, id)
+	}
+
 	switch fc.Verdict {
 	case api.VerdictDeny:
 		p.logger.Warn("request denied",
 			"method", fc.Method,
 			"tool", fc.Tool,
 			"rule", fc.MatchedRule,
+			"subject", subject(fc.Principal),
 		)
-		p.writeDenyResponse(w, fc)
-		return
-
 	case api.VerdictAsk:
 		p.logger.Info("request pending approval",
 			"method", fc.Method,
 			"tool", fc.Tool,
 		)
-		// For now, deny with a message suggesting approval via dashboard
-		p.writeDenyResponse(w, fc)
+	}
+	return fc
+}
+
+// serveBatch filters each message of a batch and forwards the allowed ones
+// as a smaller batch. Denied messages are answered by the proxy, in the
+// same batch response as the server's answers. Messages pending approval
+// or held by a filter hold the batch until all are decided.
+func (p *Proxy) serveBatch(w http.ResponseWriter, r *http.Request, msgs []json.RawMessage) {
+	var allowed, waits []*filter.FilterContext
+	var local [][]byte
+	respond := func(msg *api.JSONRPCMessage) {
+		if data, err := json.Marshal(msg); err == nil {
+			local = append(local, data)
+		}
+	}
+	for _, raw := range msgs {
+		fc := p.filter(r, raw)
+		defer fc.Finish()
+
+		switch fc.Verdict {
+		case api.VerdictAsk:
+			if p.approvals != nil {
+				waits = append(waits, fc)
+				continue
+			}
+			fallthrough
+		case api.VerdictDeny:
+			// Notifications get no response
+			if fc.Message == nil || fc.Message.ID != nil {
+				respond(fc.DenyResponse())
+			}
+			continue
+		}
+		if fc.Held() {
+			waits = append(waits, fc)
+			continue
+		}
+		allowed = append(allowed, fc)
+	}
+
+	if len(waits) > 0 {
+		approved := make([]bool, len(waits))
+		denials := make([]*api.JSONRPCMessage, len(waits))
+		var wg sync.WaitGroup
+		for i, fc := range waits {
+			ctx, done := p.inflight.Start(r.Context(), fc.SessionID, fc.Message.ID)
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				defer done()
+				approved[i] = true
+				if fc.Verdict == api.VerdictAsk {
+					approved[i], denials[i] = p.approvals.Decide(ctx, fc, nil)
+				}
+				if approved[i] {
+					approved[i], denials[i] = p.admit(ctx, fc)
+				}
+			}()
+		}
+		wg.Wait()
+		for i, fc := range waits {
+			if approved[i] {
+				allowed = append(allowed, fc)
+			} else if denials[i] != nil {
+				respond(denials[i])
+			}
+		}
+	}
+
+	var forward [][]byte
+	ex := newExchange(r.Header.Get("Mcp-Session-Id"))
+	for _, fc := range allowed {
+		if fc.Response != nil {
+			local = append(local, fc.Response)
+			continue
+		}
+		ex.requests.Track(fc)
+		forward = append(forward, fc.Output())
+	}
+
+	if len(forward) == 0 {
+		if len(local) == 0 {
+			w.WriteHeader(http.StatusAccepted)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write(jsonrpc.JoinBatch(local))
 		return
 	}
 
-	// Forward allowed request
-	r.Body = io.NopCloser(bytes.NewReader(body))
-	r.ContentLength = int64(len(body))
+	ex.local = local
+	out := jsonrpc.JoinBatch(forward)
+	r = r.WithContext(context.WithValue(r.Context(), exchangeKey{}, ex))
+	r.Body = io.NopCloser(bytes.NewReader(out))
+	r.ContentLength = int64(len(out))
 	p.reverseProxy.ServeHTTP(w, r)
 }
 
+// mergeBatch adds the proxy's responses to the server's batch response,
+// whether it is JSON, an SSE stream, or empty (when the server had only
+// notifications to handle).
+func mergeBatch(resp *http.Response, local [][]byte) error {
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	switch {
+	case resp.StatusCode == http.StatusAccepted:
+		resp.Body.Close()
+		setBody(resp, jsonrpc.JoinBatch(local))
+		resp.StatusCode = http.StatusOK
+		resp.Status = "200 OK"
+		resp.Header.Set("Content-Type", "application/json")
+
+	case mediaType == "text/event-stream":
+		// Sent as one more event once the server's stream ends
+		event := "event: message\ndata: " + string(jsonrpc.JoinBatch(local)) + "\n\n"
+		resp.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(resp.Body, strings.NewReader(event)), resp.Body}
+		resp.ContentLength = -1
+		resp.Header.Del("Content-Length")
+
+	case mediaType == "application/json":
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return fmt.Errorf("reading batch response: %w", err)
+		}
+		msgs, err := jsonrpc.SplitBatch(body)
+		if err != nil && len(bytes.TrimSpace(body)) > 0 {
+			// A lone response rather than a batch
+			msgs = []json.RawMessage{body}
+		}
+		merged := make([][]byte, 0, len(msgs)+len(local))
+		for _, msg := range msgs {
+			merged = append(merged, msg)
+		}
+		setBody(resp, jsonrpc.JoinBatch(append(merged, local...)))
+	}
+	return nil
+}
+
+func setBody(resp *http.Response, body []byte) {
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	resp.ContentLength = int64(len(body))
+	resp.Header.Set("Content-Length", strconv.Itoa(len(body)))
+}
+
 func (p *Proxy) director(req *http.Request) {
 	req.URL.Scheme = p.target.Scheme
 	req.URL.Host = p.target.Host
 	req.URL.Path = p.target.Path
 	req.Host = p.target.Host
+	// The client's token is for the proxy, not the server (no passthrough)
+	if p.authenticator != nil {
+		req.Header.Del("Authorization")
+	}
 }
 
 func (p *Proxy) modifyResponse(resp *http.Response) error {
-	// Log outbound responses
-	if resp.Header.Get("Content-Type") == "text/event-stream" {
-		// SSE responses are streamed, log at connection level
-		p.logger.Debug("SSE response stream opened", "status", resp.StatusCode)
-		return nil
+	ctx := resp.Request.Context()
+	ex, _ := ctx.Value(exchangeKey{}).(*exchange)
+	if ex == nil {
+		// A stream the client opened with GET, or another non-POST request
+		ex = newExchange(resp.Request.Header.Get("Mcp-Session-Id"))
+	}
+
+	p.trackSession(resp, ex)
+
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if p.outboundChain != nil && resp.StatusCode < 300 {
+		switch mediaType {
+		case "text/event-stream":
+			p.logger.Debug("SSE response stream opened", "status", resp.StatusCode)
+			resp.Body = newSSEFilter(resp.Body, func(data []byte) []byte {
+				return p.filterOutbound(ctx, ex, data)
+			})
+			resp.ContentLength = -1
+			resp.Header.Del("Content-Length")
+
+		case "application/json":
+			body, err := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			if err != nil {
+				return fmt.Errorf("reading response: %w", err)
+			}
+			setBody(resp, p.filterOutbound(ctx, ex, body))
+		}
+	}
+
+	if len(ex.local) > 0 {
+		return mergeBatch(resp, ex.local)
 	}
 	return nil
 }
 
+// trackSession starts the session a server response assigns, adopts one
+// the server accepted a request in, and ends the one a successful DELETE
+// terminated.
+func (p *Proxy) trackSession(resp *http.Response, ex *exchange) {
+	if resp.StatusCode >= 300 {
+		return
+	}
+	requested := resp.Request.Header.Get("Mcp-Session-Id")
+	if resp.Request.Method == http.MethodDelete && requested != "" {
+		p.sessions.end(requested)
+		return
+	}
+	if assigned := resp.Header.Get("Mcp-Session-Id"); assigned != "" && assigned != requested {
+		p.sessions.start(assigned, ex.clientName)
+		return
+	}
+	if requested != "" {
+		p.sessions.adopt(requested, resp.Request.Method == http.MethodGet)
+	}
+}
+
+func subject(principal *api.Principal) string {
+	if principal == nil {
+		return ""
+	}
+	return principal.Subject
+}
+
 func (p *Proxy) errorHandler(w http.ResponseWriter, r *http.Request, err error) {
 	p.logger.Error("proxy error", "error", err, "url", r.URL.String())
 	http.Error(w, "proxy error: "+err.Error(), http.StatusBadGateway)
 }
 
 func (p *Proxy) writeDenyResponse(w http.ResponseWriter, fc *filter.FilterContext) {
+	writeMessage(w, fc.DenyResponse())
+}
+
+func writeMessage(w http.ResponseWriter, msg *api.JSONRPCMessage) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK) // JSON-RPC errors use 200 status
 
-	var id json.RawMessage
-	if fc.Message != nil && fc.Message.ID != nil {
-		id = fc.Message.ID
-	}
-
-	msg := fc.VerdictMessage
-	if msg == "" {
-		msg = "request denied by policy"
-	}
-
-	resp := jsonrpc.NewDenyResponse(id, msg)
-	data, _ := json.Marshal(resp)
+	data, _ := json.Marshal(msg)
 	w.Write(data)
 }
 
@@ -145,9 +553,21 @@ func (p *Proxy) Handler() http.Handler {
 
 // ListenAndServe starts the HTTP proxy server.
 func (p *Proxy) ListenAndServe(ctx context.Context, addr string) error {
+	p.logger.Info("starting HTTP proxy",
+		"listen", addr,
+		"target", p.target.String(),
+		"tls", p.tlsConfig != nil,
+	)
+	return listenAndServe(ctx, addr, p, p.tlsConfig)
+}
+
+// listenAndServe serves handler on addr, over TLS if tlsConfig is set,
+// until ctx is done.
+func listenAndServe(ctx context.Context, addr string, handler http.Handler, tlsConfig *tls.Config) error {
 	srv := &http.Server{
-		Addr:    addr,
-		Handler: p,
+		Addr:      addr,
+		Handler:   handler,
+		TLSConfig: tlsConfig,
 	}
 
 	go func() {
@@ -155,10 +575,9 @@ func (p *Proxy) ListenAndServe(ctx context.Context, addr string) error {
 		srv.Close()
 	}()
 
-	p.logger.Info("starting HTTP proxy",
-		"listen", addr,
-		"target", p.target.String(),
-	)
-
+	if tlsConfig != nil {
+		// The certificate comes from TLSConfig.GetCertificate
+		return srv.ListenAndServeTLS("", "")
+	}
 	return srv.ListenAndServe()
 }
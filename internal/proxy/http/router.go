@@ -0,0 +1,130 @@
+package http
+
+import (
+	"context"
+	"crypto/tls"
+	"log/slog"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/tkingovr/agent-guard/api"
+)
+
+// Route sends the requests for a path prefix, a host, or both, to the
+// proxy of one MCP server.
+type Route struct {
+	Name       string
+	Host       string // any host if empty
+	PathPrefix string // any path if empty
+	Proxy      *Proxy
+}
+
+// Router fronts several MCP servers on one listener. Each request goes to
+// the most specific route that matches it: one for the request's host
+// before one for any host, then the one with the longest path prefix.
+// Every route's proxy has its own filter chain, so policy, rate limits
+// and sessions are kept per server.
+type Router struct {
+	routes    []Route
+	logger    *slog.Logger
+	tlsConfig *tls.Config
+}
+
+// RouterOption configures optional router features.
+type RouterOption func(*Router)
+
+// WithRouterTLS serves the router over TLS, as WithTLS does a proxy.
+func WithRouterTLS(cfg *tls.Config) RouterOption {
+	return func(rt *Router) { rt.tlsConfig = cfg }
+}
+
+// NewRouter creates a router over routes. Each route's proxy should have
+// been created WithServerName(route.Name).
+func NewRouter(routes []Route, logger *slog.Logger, opts ...RouterOption) *Router {
+	rt := &Router{routes: append([]Route(nil), routes...), logger: logger}
+	sort.SliceStable(rt.routes, func(i, j int) bool {
+		a, b := rt.routes[i], rt.routes[j]
+		if (a.Host != "") != (b.Host != "") {
+			return a.Host != ""
+		}
+		return len(a.PathPrefix) > len(b.PathPrefix)
+	})
+	for _, opt := range opts {
+		opt(rt)
+	}
+	return rt
+}
+
+// ServeHTTP sends the request to the proxy of its route.
+func (rt *Router) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// Protected resource metadata is served wherever its path is
+	for _, route := range rt.routes {
+		if a := route.Proxy.authenticator; a != nil && a.IsMetadataRequest(r) {
+			a.ServeMetadata(w, r)
+			return
+		}
+	}
+
+	route := rt.match(r)
+	if route == nil {
+		rt.logger.Info("no route for request", "host", r.Host, "path", r.URL.Path)
+		http.Error(w, "no MCP server at this address", http.StatusNotFound)
+		return
+	}
+	route.Proxy.ServeHTTP(w, r)
+}
+
+func (rt *Router) match(r *http.Request) *Route {
+	host := r.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	for i := range rt.routes {
+		route := &rt.routes[i]
+		if route.Host != "" && !strings.EqualFold(route.Host, host) {
+			continue
+		}
+		if !hasPathPrefix(r.URL.Path, route.PathPrefix) {
+			continue
+		}
+		return route
+	}
+	return nil
+}
+
+// hasPathPrefix reports whether path is prefix or below it, so that
+// /github matches /github and /github/mcp but not /githubx.
+func hasPathPrefix(path, prefix string) bool {
+	prefix = strings.TrimSuffix(prefix, "/")
+	return prefix == "" || path == prefix || strings.HasPrefix(path, prefix+"/")
+}
+
+// Sessions returns the active client sessions of every route.
+func (rt *Router) Sessions() []api.SessionInfo {
+	var out []api.SessionInfo
+	for _, route := range rt.routes {
+		out = append(out, route.Proxy.Sessions()...)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].LastSeen.After(out[j].LastSeen) })
+	return out
+}
+
+// ListenAndServe starts the router's HTTP server.
+func (rt *Router) ListenAndServe(ctx context.Context, addr string) error {
+	for _, route := range rt.routes {
+		rt.logger.Info("route",
+			"name", route.Name,
+			"host", route.Host,
+			"path_prefix", route.PathPrefix,
+			"target", route.Proxy.target.String(),
+		)
+	}
+	rt.logger.Info("starting HTTP proxy",
+		"listen", addr,
+		"routes", len(rt.routes),
+		"tls", rt.tlsConfig != nil,
+	)
+	return listenAndServe(ctx, addr, rt, rt.tlsConfig)
+}
@@ -0,0 +1,80 @@
+package http
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/tkingovr/agent-guard/api"
+	"github.com/tkingovr/agent-guard/internal/audit"
+	"github.com/tkingovr/agent-guard/internal/filter"
+	"github.com/tkingovr/agent-guard/internal/policy"
+)
+
+func TestRouter(t *testing.T) {
+	newBackend := func(name string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":{"server":"` + name + `"}}`))
+		}))
+	}
+	github, jira := newBackend("github"), newBackend("jira")
+	defer github.Close()
+	defer jira.Close()
+
+	store, _ := audit.NewJSONLStore(t.TempDir())
+	defer store.Close()
+	engine, _ := policy.NewYAMLEngineFromPolicy(&policy.PolicyFile{
+		Version:  1,
+		Settings: policy.Settings{DefaultAction: api.VerdictAllow},
+		Rules: []policy.Rule{
+			{Name: "no-github-deletes", Match: policy.RuleMatch{Method: "tools/call", Server: "github", Tool: "delete"}, Action: "deny"},
+		},
+	})
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	route := func(name, host, prefix, target string) Route {
+		chain := filter.BuildInboundChain(filter.ChainConfig{Engine: engine, AuditStore: store, Logger: logger})
+		proxy, err := NewProxy(target, chain, logger, WithServerName(name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return Route{Name: name, Host: host, PathPrefix: prefix, Proxy: proxy}
+	}
+	router := NewRouter([]Route{
+		route("github", "", "/github", github.URL),
+		route("jira", "jira.example.com", "", jira.URL),
+	}, logger)
+
+	send := func(target, tool string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", target, strings.NewReader(`{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"`+tool+`"}}`))
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := send("http://mcp.example.com/github/mcp", "list"); !strings.Contains(w.Body.String(), `"server":"github"`) {
+		t.Errorf("expected the github route, got %d %s", w.Code, w.Body.String())
+	}
+	if w := send("http://jira.example.com:3000/github/mcp", "delete"); !strings.Contains(w.Body.String(), `"server":"jira"`) {
+		t.Errorf("a host route should win over a path route, got %s", w.Body.String())
+	}
+	if w := send("http://mcp.example.com/github/mcp", "delete"); !strings.Contains(w.Body.String(), "-32001") {
+		t.Errorf("the server rule should deny github deletes, got %s", w.Body.String())
+	}
+	if w := send("http://mcp.example.com/githubx/mcp", "list"); w.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for an unrouted path, got %d", w.Code)
+	}
+
+	records, _ := store.Query(context.Background(), api.QueryFilter{})
+	servers := map[string]int{}
+	for _, r := range records {
+		servers[r.Server]++
+	}
+	if servers["github"] != 2 || servers["jira"] != 1 {
+		t.Errorf("expected audit records stamped with their route, got %v", servers)
+	}
+}
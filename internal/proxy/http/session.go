@@ -0,0 +1,268 @@
+package http
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/tkingovr/agent-guard/api"
+	"github.com/tkingovr/agent-guard/internal/filter"
+)
+
+// Pseudo-methods under which the inbound chain, and so policy, rate limits
+// and audit, see Streamable HTTP requests that carry no JSON-RPC message.
+const (
+	MethodSessionStream    = "session/stream"    // GET: open an SSE stream
+	MethodSessionTerminate = "session/terminate" // DELETE: end the session
+)
+
+// defaultSessionIdleTimeout is how long a session nobody uses is kept.
+const defaultSessionIdleTimeout = 30 * time.Minute
+
+// maxSessions bounds the sessions, and the ended session IDs, kept in
+// memory.
+const maxSessions = 4096
+
+// sessionTracker follows Streamable HTTP sessions by Mcp-Session-Id. A
+// session ends when the client terminates it or when it idles for longer
+// than the timeout with no stream open: requests that still carry its ID
+// get 404, which tells the client to start a new session. Only sessions
+// the server issued or accepted are tracked.
+type sessionTracker struct {
+	idle   time.Duration
+	server string
+
+	mu        sync.Mutex
+	sessions  map[string]*api.SessionInfo
+	ended     map[string]time.Time // session ID → when it ended
+	lastSweep time.Time
+}
+
+func newSessionTracker(idle time.Duration) *sessionTracker {
+	return &sessionTracker{
+		idle:     idle,
+		sessions: make(map[string]*api.SessionInfo),
+		ended:    make(map[string]time.Time),
+	}
+}
+
+// touch marks session id as used. It reports false if the session has
+// ended. A session the proxy doesn't know yet (e.g., started before it
+// restarted) is left for the server to judge, and adopted once the server
+// accepts a request in it.
+func (t *sessionTracker) touch(id string) bool {
+	now := time.Now()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.sweep(now)
+	if _, ok := t.ended[id]; ok {
+		return false
+	}
+	s, ok := t.sessions[id]
+	if ok && t.isIdle(s, now) {
+		t.expire(id, now)
+		return false
+	}
+	if ok {
+		s.LastSeen = now
+	}
+	return true
+}
+
+// adopt tracks session id, which the server accepted a request in, unless
+// it is tracked already or has ended. stream is whether the request opened
+// a stream, counted as by stream.
+func (t *sessionTracker) adopt(id string, stream bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if _, ok := t.ended[id]; ok {
+		return
+	}
+	if _, ok := t.sessions[id]; ok {
+		return
+	}
+	if s := t.session(id, time.Now()); stream {
+		s.Streams++
+	}
+}
+
+// start records a session the server just created.
+func (t *sessionTracker) start(id, clientName string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	s := t.session(id, time.Now())
+	if s.ClientName == "" {
+		s.ClientName = clientName
+	}
+}
+
+// end forgets a session the client terminated.
+func (t *sessionTracker) end(id string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.expire(id, time.Now())
+}
+
+// clientName returns the name the client of session id gave in its
+// initialize, if known.
+func (t *sessionTracker) clientName(id string) string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if s, ok := t.sessions[id]; ok {
+		return s.ClientName
+	}
+	return ""
+}
+
+// record counts a filtered message toward its session.
+func (t *sessionTracker) record(fc *filter.FilterContext) {
+	if fc.SessionID == "" {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	s, ok := t.sessions[fc.SessionID]
+	if !ok {
+		return
+	}
+	s.Requests++
+	if fc.Verdict == api.VerdictDeny {
+		s.Denied++
+	}
+	if s.ClientName == "" {
+		s.ClientName = fc.ClientName
+	}
+}
+
+// stream counts a GET stream open on session id until the returned func
+// is called. A session with a stream open never idles.
+func (t *sessionTracker) stream(id string) (done func()) {
+	t.mu.Lock()
+	if s, ok := t.sessions[id]; ok {
+		s.Streams++
+	}
+	t.mu.Unlock()
+	return func() {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		if s, ok := t.sessions[id]; ok && s.Streams > 0 {
+			s.Streams--
+			s.LastSeen = time.Now()
+		}
+	}
+}
+
+// list returns the active sessions, most recently seen first.
+func (t *sessionTracker) list() []api.SessionInfo {
+	now := time.Now()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.expireIdle(now)
+	out := make([]api.SessionInfo, 0, len(t.sessions))
+	for _, s := range t.sessions {
+		out = append(out, *s)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].LastSeen.After(out[j].LastSeen) })
+	return out
+}
+
+// session returns the session's state, starting it if new and evicting
+// the least recently seen session when full. Callers must hold t.mu.
+func (t *sessionTracker) session(id string, now time.Time) *api.SessionInfo {
+	s, ok := t.sessions[id]
+	if !ok {
+		if len(t.sessions) >= maxSessions {
+			var oldest string
+			for sid, other := range t.sessions {
+				if oldest == "" || other.LastSeen.Before(t.sessions[oldest].LastSeen) {
+					oldest = sid
+				}
+			}
+			delete(t.sessions, oldest)
+		}
+		s = &api.SessionInfo{ID: id, Server: t.server, Created: now, LastSeen: now}
+		t.sessions[id] = s
+	}
+	return s
+}
+
+func (t *sessionTracker) isIdle(s *api.SessionInfo, now time.Time) bool {
+	return s.Streams == 0 && now.Sub(s.LastSeen) > t.idle
+}
+
+// sweep expires idle sessions, at most once a second. Callers must hold
+// t.mu.
+func (t *sessionTracker) sweep(now time.Time) {
+	if now.Sub(t.lastSweep) < time.Second {
+		return
+	}
+	t.lastSweep = now
+	t.expireIdle(now)
+}
+
+// expireIdle expires every idle session. Callers must hold t.mu.
+func (t *sessionTracker) expireIdle(now time.Time) {
+	for id, s := range t.sessions {
+		if t.isIdle(s, now) {
+			t.expire(id, now)
+		}
+	}
+}
+
+// expire moves a session to the ended set, evicting the oldest ended ID
+// when full. Callers must hold t.mu.
+func (t *sessionTracker) expire(id string, now time.Time) {
+	delete(t.sessions, id)
+	if len(t.ended) >= maxSessions {
+		var oldest string
+		for sid, at := range t.ended {
+			if oldest == "" || at.Before(t.ended[oldest]) {
+				oldest = sid
+			}
+		}
+		delete(t.ended, oldest)
+	}
+	t.ended[id] = now
+}
+
+// Sessions returns the proxy's active client sessions.
+func (p *Proxy) Sessions() []api.SessionInfo {
+	return p.sessions.list()
+}
+
+// serveSessionRequest filters a GET (open a stream) or DELETE (terminate
+// the session) as the pseudo-method session/stream or session/terminate,
+// then forwards it if allowed.
+func (p *Proxy) serveSessionRequest(w http.ResponseWriter, r *http.Request) {
+	method := MethodSessionStream
+	if r.Method == http.MethodDelete {
+		method = MethodSessionTerminate
+	}
+	raw, _ := json.Marshal(map[string]string{"jsonrpc": "2.0", "method": method})
+	fc := p.filter(r, raw)
+	defer fc.Finish()
+
+	allowed := fc.Verdict != api.VerdictDeny && fc.Verdict != api.VerdictAsk
+	if fc.Verdict == api.VerdictAsk && p.approvals != nil {
+		allowed, _ = p.approvals.Decide(r.Context(), fc, nil)
+	}
+	if allowed {
+		allowed, _ = p.admit(r.Context(), fc)
+	}
+	if !allowed {
+		msg := fc.VerdictMessage
+		if msg == "" {
+			msg = fmt.Sprintf("%s denied by policy", method)
+		}
+		http.Error(w, msg, http.StatusForbidden)
+		return
+	}
+
+	if session := r.Header.Get("Mcp-Session-Id"); session != "" && r.Method == http.MethodGet {
+		defer p.sessions.stream(session)()
+	}
+	p.reverseProxy.ServeHTTP(w, r)
+}
@@ -0,0 +1,221 @@
+package http
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tkingovr/agent-guard/api"
+	"github.com/tkingovr/agent-guard/internal/audit"
+	"github.com/tkingovr/agent-guard/internal/filter"
+	"github.com/tkingovr/agent-guard/internal/policy"
+)
+
+// newSessionProxy returns a proxy whose policy denies opening GET streams
+// and allows everything else.
+func newSessionProxy(t *testing.T, backendURL string, opts ...Option) *Proxy {
+	t.Helper()
+	store, _ := audit.NewJSONLStore(t.TempDir())
+	t.Cleanup(func() { store.Close() })
+	engine, _ := policy.NewYAMLEngineFromPolicy(&policy.PolicyFile{
+		Version:  1,
+		Settings: policy.Settings{DefaultAction: api.VerdictAllow},
+		Rules: []policy.Rule{
+			{Name: "no-streams", Match: policy.RuleMatch{Method: MethodSessionStream}, Action: "deny"},
+		},
+	})
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	chain := filter.BuildInboundChain(filter.ChainConfig{Engine: engine, AuditStore: store, Logger: logger})
+	proxy, err := NewProxy(backendURL, chain, logger, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return proxy
+}
+
+func TestHTTPProxy_Sessions(t *testing.T) {
+	var methods []string
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		methods = append(methods, r.Method)
+		if r.Header.Get("Mcp-Session-Id") == "" {
+			w.Header().Set("Mcp-Session-Id", "s1")
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":{}}`))
+	}))
+	defer backend.Close()
+	proxy := newSessionProxy(t, backend.URL)
+
+	send := func(method, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/", strings.NewReader(body))
+		if !strings.Contains(body, "initialize") {
+			req.Header.Set("Mcp-Session-Id", "s1")
+		}
+		w := httptest.NewRecorder()
+		proxy.ServeHTTP(w, req)
+		return w
+	}
+
+	send("POST", `{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"clientInfo":{"name":"test-client"}}}`)
+	send("POST", `{"jsonrpc":"2.0","id":2,"method":"tools/list"}`)
+	sessions := proxy.Sessions()
+	if len(sessions) != 1 || sessions[0].ID != "s1" || sessions[0].ClientName != "test-client" || sessions[0].Requests != 1 {
+		t.Fatalf("expected session s1 from test-client with one request, got %+v", sessions)
+	}
+
+	if w := send("GET", ""); w.Code != http.StatusForbidden {
+		t.Errorf("expected GET stream denied by policy, got %d", w.Code)
+	}
+	if sessions := proxy.Sessions(); sessions[0].Denied != 1 {
+		t.Errorf("expected the denied stream counted, got %+v", sessions[0])
+	}
+
+	if w := send("DELETE", ""); w.Code != http.StatusOK {
+		t.Errorf("expected DELETE forwarded, got %d", w.Code)
+	}
+	if sessions := proxy.Sessions(); len(sessions) != 0 {
+		t.Errorf("expected terminated session forgotten, got %+v", sessions)
+	}
+	if strings.Join(methods, ",") != "POST,POST,DELETE" {
+		t.Errorf("expected the GET never to reach the server, got %v", methods)
+	}
+}
+
+func TestHTTPProxy_SessionExpires(t *testing.T) {
+	calls := 0
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":{}}`))
+	}))
+	defer backend.Close()
+	proxy := newSessionProxy(t, backend.URL, WithSessionIdleTimeout(20*time.Millisecond))
+
+	send := func() int {
+		req := httptest.NewRequest("POST", "/", strings.NewReader(`{"jsonrpc":"2.0","id":1,"method":"ping"}`))
+		req.Header.Set("Mcp-Session-Id", "s1")
+		w := httptest.NewRecorder()
+		proxy.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	if code := send(); code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", code)
+	}
+	time.Sleep(40 * time.Millisecond)
+	if code := send(); code != http.StatusNotFound {
+		t.Errorf("expected 404 for an expired session, got %d", code)
+	}
+	if calls != 1 {
+		t.Errorf("expected requests for an expired session not forwarded, got %d calls", calls)
+	}
+	if sessions := proxy.Sessions(); len(sessions) != 0 {
+		t.Errorf("expected no active sessions, got %+v", sessions)
+	}
+}
+
+func TestHTTPProxy_PerClientRateLimit(t *testing.T) {
+	sessions := 0
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Mcp-Session-Id") == "" {
+			sessions++
+			w.Header().Set("Mcp-Session-Id", fmt.Sprintf("s%d", sessions))
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":{}}`))
+	}))
+	defer backend.Close()
+
+	engine, _ := policy.NewYAMLEngineFromPolicy(&policy.PolicyFile{
+		Version:  1,
+		Settings: policy.Settings{DefaultAction: api.VerdictAllow},
+	})
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	store, _ := audit.NewJSONLStore(t.TempDir())
+	t.Cleanup(func() { store.Close() })
+	chain := filter.BuildInboundChain(filter.ChainConfig{
+		Engine:     engine,
+		AuditStore: store,
+		Logger:     logger,
+		RateLimit:  &filter.RateLimitConfig{PerClient: &filter.RateLimit{Max: 1, Window: time.Minute}},
+	})
+	proxy, err := NewProxy(backend.URL, chain, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	send := func(session, body string) string {
+		req := httptest.NewRequest("POST", "/", strings.NewReader(body))
+		if session != "" {
+			req.Header.Set("Mcp-Session-Id", session)
+		}
+		w := httptest.NewRecorder()
+		proxy.ServeHTTP(w, req)
+		return w.Body.String()
+	}
+	initialize := `{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"clientInfo":{"name":"test-client"}}}`
+	call := `{"jsonrpc":"2.0","id":2,"method":"tools/call","params":{"name":"search"}}`
+
+	// Two sessions of one client share its limit
+	send("", initialize)
+	send("", initialize)
+	if resp := send("s1", call); strings.Contains(resp, "error") {
+		t.Fatalf("expected the first call through, got %s", resp)
+	}
+	if resp := send("s2", call); !strings.Contains(resp, "rate_limit:client") {
+		t.Errorf("expected the client limit to deny the second session's call, got %s", resp)
+	}
+}
+
+func TestHTTPProxy_EndedSessionNotFound(t *testing.T) {
+	calls := 0
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if r.Header.Get("Mcp-Session-Id") == "forged" {
+			http.Error(w, "unknown session", http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":{}}`))
+	}))
+	defer backend.Close()
+	proxy := newSessionProxy(t, backend.URL)
+
+	send := func(method, session string) int {
+		req := httptest.NewRequest(method, "/", strings.NewReader(`{"jsonrpc":"2.0","id":1,"method":"ping"}`))
+		req.Header.Set("Mcp-Session-Id", session)
+		w := httptest.NewRecorder()
+		proxy.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	// The server rejects an ID it never issued, and the proxy doesn't adopt it
+	if code := send("POST", "forged"); code != http.StatusNotFound {
+		t.Fatalf("expected the server's 404, got %d", code)
+	}
+	if sessions := proxy.Sessions(); len(sessions) != 0 {
+		t.Fatalf("expected the rejected session not tracked, got %+v", sessions)
+	}
+
+	if code := send("POST", "s1"); code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", code)
+	}
+	if code := send("DELETE", "s1"); code != http.StatusOK {
+		t.Fatalf("expected DELETE forwarded, got %d", code)
+	}
+	calls = 0
+	if code := send("POST", "s1"); code != http.StatusNotFound {
+		t.Errorf("expected 404 for a terminated session, got %d", code)
+	}
+	if calls != 0 {
+		t.Errorf("expected requests for a terminated session not forwarded, got %d calls", calls)
+	}
+	if sessions := proxy.Sessions(); len(sessions) != 0 {
+		t.Errorf("expected the terminated session not re-created, got %+v", sessions)
+	}
+}
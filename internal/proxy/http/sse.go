@@ -0,0 +1,96 @@
+package http
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+)
+
+// sseFilter rewrites an SSE stream one event at a time, passing the data
+// of each message event through filter. Every other field (id, event,
+// retry, comments) is kept, so clients can still resume the stream with
+// Last-Event-ID. A message the filter drops keeps its id but loses its
+// data, which clients don't dispatch.
+type sseFilter struct {
+	src    *bufio.Reader
+	body   io.Closer
+	filter func(data []byte) []byte
+	out    bytes.Buffer
+	err    error
+}
+
+func newSSEFilter(body io.ReadCloser, filter func(data []byte) []byte) *sseFilter {
+	return &sseFilter{
+		src:    bufio.NewReaderSize(body, 64*1024),
+		body:   body,
+		filter: filter,
+	}
+}
+
+// Read returns the rewritten stream, reading no further than the end of
+// the next event so that each event reaches the client as soon as the
+// server sends it.
+func (s *sseFilter) Read(p []byte) (int, error) {
+	for s.out.Len() == 0 {
+		if s.err != nil {
+			return 0, s.err
+		}
+		s.err = s.next()
+	}
+	return s.out.Read(p)
+}
+
+func (s *sseFilter) Close() error {
+	return s.body.Close()
+}
+
+// next reads one event and writes its rewritten form to s.out. An event
+// cut short by the end of the stream is discarded, as clients would.
+func (s *sseFilter) next() error {
+	var fields [][]byte
+	var data [][]byte
+	kind := ""
+	for {
+		line, err := s.src.ReadBytes('\n')
+		if err != nil {
+			return err
+		}
+		line = bytes.TrimSuffix(bytes.TrimSuffix(line, []byte("\n")), []byte("\r"))
+		if len(line) == 0 {
+			break
+		}
+
+		name, value := line, []byte(nil)
+		if i := bytes.IndexByte(line, ':'); i >= 0 {
+			name, value = line[:i], bytes.TrimPrefix(line[i+1:], []byte(" "))
+		}
+		switch string(name) {
+		case "data":
+			data = append(data, value)
+			continue
+		case "event":
+			kind = string(value)
+		}
+		fields = append(fields, line)
+	}
+
+	for _, f := range fields {
+		s.out.Write(f)
+		s.out.WriteByte('\n')
+	}
+	if data != nil {
+		payload := bytes.Join(data, []byte("\n"))
+		if kind == "" || kind == "message" {
+			payload = s.filter(payload)
+		}
+		if payload != nil {
+			for _, line := range bytes.Split(payload, []byte("\n")) {
+				s.out.WriteString("data: ")
+				s.out.Write(bytes.TrimSuffix(line, []byte("\r")))
+				s.out.WriteByte('\n')
+			}
+		}
+	}
+	s.out.WriteByte('\n')
+	return nil
+}
@@ -2,17 +2,20 @@ package stdio
 
 import (
 	"bufio"
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"log/slog"
 	"os"
+	"sync"
 
 	"github.com/tkingovr/agent-guard/api"
 	"github.com/tkingovr/agent-guard/internal/approval"
 	"github.com/tkingovr/agent-guard/internal/filter"
 	"github.com/tkingovr/agent-guard/internal/jsonrpc"
+	"github.com/tkingovr/agent-guard/internal/relay"
 )
 
 // Proxy is the stdio MITM proxy that sits between the AI host and the real MCP server.
@@ -20,17 +23,83 @@ type Proxy struct {
 	logger        *slog.Logger
 	inboundChain  *filter.Chain
 	outboundChain *filter.Chain
-	approvalQueue *approval.Queue
+	approvals     *relay.Approvals // nil without an approval queue
+
+	// A stdio proxy serves exactly one client session.
+	sessionID  string
+	clientName string
+
+	// client writes to the host's stdout, shared by both pipes.
+	client *relay.LineWriter
+
+	// server writes to the server's stdin: client messages, and the
+	// proxy's answers to server requests the policy blocked.
+	server *relay.LineWriter
+
+	ids      *relay.CorrelationIDs
+	requests *relay.Requests // forwarded requests awaiting a response
+	inflight *relay.Inflight // requests pending approval or held
+
+	mu      sync.Mutex
+	batches map[string]*pendingBatch // request ID → client batch
+}
+
+// maxPendingRequests bounds the requests awaiting a response.
+const maxPendingRequests = 4096
+
+// inboundBatch sorts the messages of a client batch into those forwarded
+// to the server and the responses the proxy gives itself.
+type inboundBatch struct {
+	forward []*filter.FilterContext
+	local   [][]byte
+}
+
+// add queues an allowed message, or its local response if a filter
+// produced one.
+func (b *inboundBatch) add(fc *filter.FilterContext) {
+	if fc.Response != nil {
+		fc.Finish()
+		b.local = append(b.local, fc.Response)
+		return
+	}
+	b.forward = append(b.forward, fc)
+}
+
+// respond adds a response from the proxy; nil is ignored.
+func (b *inboundBatch) respond(msg *api.JSONRPCMessage) {
+	if msg == nil {
+		return
+	}
+	if data, err := json.Marshal(msg); err == nil {
+		b.local = append(b.local, data)
+	}
+}
+
+// pendingBatch is a client batch forwarded in part, holding the responses
+// the proxy gave so they join the server's batch response.
+type pendingBatch struct {
+	ids   []string
+	local [][]byte
 }
 
 // NewProxy creates a new stdio proxy with the given filter chains.
 func NewProxy(logger *slog.Logger, inbound, outbound *filter.Chain, aq *approval.Queue) *Proxy {
-	return &Proxy{
+	sessionID := relay.NewSessionID()
+	p := &Proxy{
 		logger:        logger,
 		inboundChain:  inbound,
 		outboundChain: outbound,
-		approvalQueue: aq,
+		sessionID:     sessionID,
+		client:        relay.NewLineWriter(os.Stdout),
+		ids:           relay.NewCorrelationIDs(sessionID),
+		requests:      relay.NewRequests(maxPendingRequests),
+		inflight:      relay.NewInflight(),
+		batches:       make(map[string]*pendingBatch),
+	}
+	if aq != nil {
+		p.approvals = relay.NewApprovals(aq, logger)
 	}
+	return p
 }
 
 // Run starts the proxy, spawning the subprocess and bridging stdin/stdout.
@@ -48,14 +117,16 @@ func (p *Proxy) Run(ctx context.Context, command string, args []string) error {
 
 	errCh := make(chan error, 2)
 
+	p.server = relay.NewLineWriter(proc.Stdin())
+
 	// Inbound: our stdin → filter chain → subprocess stdin
 	go func() {
-		errCh <- p.pipeInbound(ctx, os.Stdin, proc.Stdin())
+		errCh <- p.pipeInbound(ctx, os.Stdin)
 	}()
 
 	// Outbound: subprocess stdout → filter chain → our stdout
 	go func() {
-		errCh <- p.pipeOutbound(ctx, proc.Stdout(), os.Stdout)
+		errCh <- p.pipeOutbound(ctx, proc.Stdout())
 	}()
 
 	// Wait for either pipe to end or subprocess to exit
@@ -68,76 +139,304 @@ func (p *Proxy) Run(ctx context.Context, command string, args []string) error {
 	}
 }
 
-func (p *Proxy) pipeInbound(ctx context.Context, src io.Reader, dst io.WriteCloser) error {
+func (p *Proxy) pipeInbound(ctx context.Context, src io.Reader) error {
 	scanner := bufio.NewScanner(src)
 	scanner.Buffer(make([]byte, 0, 1024*1024), 10*1024*1024) // 10MB max message
 
+	server := p.server
+
+	// Requests pending approval or held by a filter are finished in their
+	// own goroutines, so other messages keep flowing while they wait.
+	var waiting sync.WaitGroup
+	defer waiting.Wait()
+
 	for scanner.Scan() {
-		line := scanner.Bytes()
-		if len(line) == 0 {
+		if len(scanner.Bytes()) == 0 {
 			continue
 		}
+		// Copied, since the message may outlive this iteration
+		line := bytes.Clone(scanner.Bytes())
 
-		fc := filter.NewFilterContext(line, api.DirectionInbound)
-		if err := p.inboundChain.Process(ctx, fc); err != nil {
-			p.logger.Error("inbound filter error", "error", err)
-			continue
+		// Each message of a batch is filtered on its own. A batch that
+		// doesn't split is handled as one message, which gets the error.
+		if jsonrpc.IsBatch(line) {
+			if msgs, err := jsonrpc.SplitBatch(line); err == nil {
+				p.handleBatch(ctx, msgs, server, &waiting)
+				continue
+			}
 		}
 
+		fc := p.filterInbound(ctx, line)
 		switch fc.Verdict {
 		case api.VerdictDeny:
-			p.logger.Warn("request denied",
-				"method", fc.Method,
-				"tool", fc.Tool,
-				"rule", fc.MatchedRule,
-				"message", fc.VerdictMessage,
-			)
-			// Send error response back to client
-			if fc.Message != nil && fc.Message.ID != nil {
-				errResp := jsonrpc.NewDenyResponse(fc.Message.ID, fc.VerdictMessage)
-				if err := writeLine(os.Stdout, errResp); err != nil {
+			if resp := p.deny(fc); resp != nil {
+				if err := p.client.WriteMessage(resp); err != nil {
 					return fmt.Errorf("writing deny response: %w", err)
 				}
 			}
 			continue
 
 		case api.VerdictAsk:
-			p.logger.Info("request pending approval",
-				"method", fc.Method,
-				"tool", fc.Tool,
-				"rule", fc.MatchedRule,
-			)
-			if p.approvalQueue != nil {
-				verdict, err := p.approvalQueue.Submit(ctx, fc.Method, fc.Tool, fc.MatchedRule, fc.VerdictMessage, fc.Arguments)
-				if err != nil || verdict == api.VerdictDeny {
-					msg := "request denied by approver"
-					if err != nil {
-						msg = "approval error: " + err.Error()
-					}
-					if fc.Message != nil && fc.Message.ID != nil {
-						errResp := jsonrpc.NewDenyResponse(fc.Message.ID, msg)
-						if err := writeLine(os.Stdout, errResp); err != nil {
-							return fmt.Errorf("writing deny response: %w", err)
-						}
+			if p.approvals != nil {
+				reqCtx, done := p.inflight.Start(ctx, p.sessionID, fc.Message.ID)
+				waiting.Add(1)
+				go func() {
+					defer waiting.Done()
+					defer done()
+					if err := p.awaitApproval(reqCtx, fc, server); err != nil {
+						p.logger.Error("approved request not delivered", "error", err)
 					}
-					continue
-				}
+				}()
+				continue
 			}
 		}
 
-		// Forward allowed/logged messages to subprocess
-		if _, err := dst.Write(line); err != nil {
-			return fmt.Errorf("writing to subprocess: %w", err)
+		if fc.Held() {
+			// Registered before the next read, so a cancel finds it
+			reqCtx, done := p.inflight.Start(ctx, p.sessionID, fc.Message.ID)
+			waiting.Add(1)
+			go func() {
+				defer waiting.Done()
+				defer done()
+				if err := p.admit(reqCtx, fc, server); err != nil {
+					p.logger.Error("held request not delivered", "error", err)
+				}
+			}()
+			continue
 		}
-		if _, err := dst.Write([]byte("\n")); err != nil {
-			return fmt.Errorf("writing newline to subprocess: %w", err)
+
+		if err := p.forward(fc, server); err != nil {
+			return err
 		}
 	}
 
 	return scanner.Err()
 }
 
-func (p *Proxy) pipeOutbound(ctx context.Context, src io.Reader, dst io.Writer) error {
+// filterInbound runs a message from the client through the inbound chain.
+func (p *Proxy) filterInbound(ctx context.Context, raw []byte) *filter.FilterContext {
+	fc := filter.NewFilterContext(raw, api.DirectionInbound)
+	fc.SessionID = p.sessionID
+	fc.ClientName = p.clientName
+	fc.CorrelationID = p.ids.Next()
+	// A failed filter leaves a deny (or, failing open, an allow) verdict
+	if err := p.inboundChain.Process(ctx, fc); err != nil {
+		p.logger.Error("inbound filter error", "error", err)
+	}
+	if p.clientName == "" && fc.ClientName != "" {
+		p.clientName = fc.ClientName
+	}
+	// Withdraw a cancelled request still pending approval or held,
+	// whatever the policy says about the notification itself
+	if id := jsonrpc.CancelledRequestID(fc.Message); id != nil {
+		p.inflight.Cancel(p.sessionID, id)
+	}
+	if fc.Verdict == api.VerdictAsk {
+		p.logger.Info("request pending approval",
+			"method", fc.Method,
+			"tool", fc.Tool,
+			"rule", fc.MatchedRule,
+		)
+	}
+	return fc
+}
+
+// deny finishes a denied message and returns the error response for the
+// client, or nil for a notification. A message that didn't parse gets one
+// too, with the ID it had, if any.
+func (p *Proxy) deny(fc *filter.FilterContext) *api.JSONRPCMessage {
+	p.logger.Warn("request denied",
+		"method", fc.Method,
+		"tool", fc.Tool,
+		"rule", fc.MatchedRule,
+		"message", fc.VerdictMessage,
+	)
+	fc.Finish()
+	if fc.Message == nil || fc.Message.ID != nil {
+		return fc.DenyResponse()
+	}
+	return nil
+}
+
+// awaitApproval blocks until the request pending approval is decided, then
+// forwards it or answers the client with a deny. A request the client
+// cancelled is dropped without a response.
+func (p *Proxy) awaitApproval(ctx context.Context, fc *filter.FilterContext, server *relay.LineWriter) error {
+	approved, resp := p.approvals.Decide(ctx, fc, p.client.WriteMessage)
+	if approved {
+		return p.admit(ctx, fc, server)
+	}
+	if resp != nil {
+		if err := p.client.WriteMessage(resp); err != nil {
+			return fmt.Errorf("writing deny response: %w", err)
+		}
+	}
+	return nil
+}
+
+// admit forwards a request once the waits filters held it for are over,
+// or answers the client with a deny. A request the client cancelled
+// meanwhile is dropped without a response.
+func (p *Proxy) admit(ctx context.Context, fc *filter.FilterContext, server *relay.LineWriter) error {
+	admitted, resp := p.admitted(ctx, fc)
+	if admitted {
+		return p.forward(fc, server)
+	}
+	if resp != nil {
+		if err := p.client.WriteMessage(resp); err != nil {
+			return fmt.Errorf("writing deny response: %w", err)
+		}
+	}
+	return nil
+}
+
+// admitted runs the waits filters held the request for. If they deny it,
+// it is finished and its deny response returned, or nil if the client
+// cancelled it.
+func (p *Proxy) admitted(ctx context.Context, fc *filter.FilterContext) (bool, *api.JSONRPCMessage) {
+	if err := p.inboundChain.Admit(ctx, fc); err != nil {
+		if ctx.Err() != nil {
+			fc.Finish()
+			return false, nil
+		}
+		p.logger.Error("inbound filter error", "error", err)
+	}
+	if fc.Verdict == api.VerdictDeny {
+		return false, p.deny(fc)
+	}
+	return true, nil
+}
+
+// forward sends an allowed message to the server, or answers it locally
+// when a filter produced the response.
+func (p *Proxy) forward(fc *filter.FilterContext, server *relay.LineWriter) error {
+	// Answer locally (e.g., decoy resources) instead of forwarding
+	if fc.Response != nil {
+		fc.Finish()
+		if err := p.client.WriteLine(fc.Response); err != nil {
+			return fmt.Errorf("writing local response: %w", err)
+		}
+		return nil
+	}
+
+	// Track before forwarding so the response can't arrive first
+	p.requests.Track(fc)
+
+	// Forward allowed/logged messages to subprocess, possibly rewritten
+	if err := server.WriteLine(fc.Output()); err != nil {
+		return fmt.Errorf("writing to subprocess: %w", err)
+	}
+	return nil
+}
+
+// handleBatch filters each message of a client batch, forwards the allowed
+// ones to the server as a smaller batch, and answers the rest itself. If
+// any message needs approval or is held, the batch is sent once all are
+// decided.
+func (p *Proxy) handleBatch(ctx context.Context, msgs []json.RawMessage, server *relay.LineWriter, waiting *sync.WaitGroup) {
+	b := &inboundBatch{}
+	type wait struct {
+		fc   *filter.FilterContext
+		ctx  context.Context
+		done func()
+	}
+	var waits []wait
+	for _, raw := range msgs {
+		fc := p.filterInbound(ctx, raw)
+		if fc.Verdict == api.VerdictDeny {
+			b.respond(p.deny(fc))
+			continue
+		}
+		if (fc.Verdict == api.VerdictAsk && p.approvals != nil) || fc.Held() {
+			reqCtx, done := p.inflight.Start(ctx, p.sessionID, fc.Message.ID)
+			waits = append(waits, wait{fc, reqCtx, done})
+			continue
+		}
+		b.add(fc)
+	}
+
+	if len(waits) == 0 {
+		if err := p.sendBatch(b, server); err != nil {
+			p.logger.Error("batch not delivered", "error", err)
+		}
+		return
+	}
+	waiting.Add(1)
+	go func() {
+		defer waiting.Done()
+		approved := make([]bool, len(waits))
+		denials := make([]*api.JSONRPCMessage, len(waits))
+		var wg sync.WaitGroup
+		for i, a := range waits {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				defer a.done()
+				approved[i] = true
+				if a.fc.Verdict == api.VerdictAsk && p.approvals != nil {
+					approved[i], denials[i] = p.approvals.Decide(a.ctx, a.fc, p.client.WriteMessage)
+				}
+				if approved[i] {
+					approved[i], denials[i] = p.admitted(a.ctx, a.fc)
+				}
+			}()
+		}
+		wg.Wait()
+		for i, a := range waits {
+			if approved[i] {
+				b.add(a.fc)
+			} else {
+				b.respond(denials[i])
+			}
+		}
+		if err := p.sendBatch(b, server); err != nil {
+			p.logger.Error("batch not delivered", "error", err)
+		}
+	}()
+}
+
+// sendBatch forwards the allowed messages of a client batch. The server
+// answers a batch only if it holds a request, so the proxy's own responses
+// are held to be merged into that answer, or else sent at once.
+func (p *Proxy) sendBatch(b *inboundBatch, server *relay.LineWriter) error {
+	var out [][]byte
+	var ids []string
+	for _, fc := range b.forward {
+		// Track before forwarding so the response can't arrive first
+		if fc.Message != nil && fc.Message.IsRequest() {
+			p.requests.Track(fc)
+			ids = append(ids, string(fc.Message.ID))
+		}
+		out = append(out, fc.Output())
+	}
+
+	if len(ids) > 0 && len(b.local) > 0 {
+		pb := &pendingBatch{ids: ids, local: b.local}
+		p.mu.Lock()
+		if len(p.batches) >= maxPendingRequests {
+			// Responses lost in transit never claim their batch
+			p.batches = make(map[string]*pendingBatch)
+		}
+		for _, id := range ids {
+			p.batches[id] = pb
+		}
+		p.mu.Unlock()
+	}
+
+	if len(out) > 0 {
+		if err := server.WriteLine(jsonrpc.JoinBatch(out)); err != nil {
+			return fmt.Errorf("writing to subprocess: %w", err)
+		}
+	}
+	if len(ids) == 0 && len(b.local) > 0 {
+		if err := p.client.WriteLine(jsonrpc.JoinBatch(b.local)); err != nil {
+			return fmt.Errorf("writing local response: %w", err)
+		}
+	}
+	return nil
+}
+
+func (p *Proxy) pipeOutbound(ctx context.Context, src io.Reader) error {
 	scanner := bufio.NewScanner(src)
 	scanner.Buffer(make([]byte, 0, 1024*1024), 10*1024*1024)
 
@@ -147,33 +446,114 @@ func (p *Proxy) pipeOutbound(ctx context.Context, src io.Reader, dst io.Writer)
 			continue
 		}
 
-		if p.outboundChain != nil {
-			fc := filter.NewFilterContext(line, api.DirectionOutbound)
-			if err := p.outboundChain.Process(ctx, fc); err != nil {
-				p.logger.Error("outbound filter error", "error", err)
-			}
+		var msgs []json.RawMessage
+		if jsonrpc.IsBatch(line) {
+			msgs, _ = jsonrpc.SplitBatch(line)
+		}
+		var out []byte
+		if msgs != nil {
+			out = p.filterOutboundBatch(ctx, msgs)
+		} else {
+			out = p.filterOutbound(ctx, line)
+		}
+		if out == nil {
+			continue
 		}
 
-		// Always forward outbound (responses from server)
-		if _, err := dst.Write(line); err != nil {
+		// Forward outbound (responses from server), possibly rewritten
+		if err := p.client.WriteLine(out); err != nil {
 			return fmt.Errorf("writing to stdout: %w", err)
 		}
-		if _, err := dst.Write([]byte("\n")); err != nil {
-			return fmt.Errorf("writing newline to stdout: %w", err)
-		}
 	}
 
 	return scanner.Err()
 }
 
-func writeLine(w io.Writer, msg *api.JSONRPCMessage) error {
-	data, err := json.Marshal(msg)
+// filterOutbound runs a message from the server through the outbound
+// chain. It returns what to send the client: the message, possibly
+// rewritten, an error in place of a blocked response, or nil to drop it.
+// A blocked server request is answered with the error in the client's
+// place, so the server isn't left waiting.
+func (p *Proxy) filterOutbound(ctx context.Context, raw []byte) []byte {
+	if p.outboundChain == nil {
+		return raw
+	}
+	fc := filter.NewFilterContext(raw, api.DirectionOutbound)
+	fc.SessionID = p.sessionID
+	p.requests.Correlate(fc)
+	if err := p.outboundChain.Process(ctx, fc); err != nil {
+		p.logger.Error("outbound filter error", "error", err)
+	}
+	if fc.Verdict != api.VerdictDeny {
+		return fc.Output()
+	}
+
+	if fc.Message != nil && fc.Message.IsRequest() {
+		p.logger.Warn("server request denied",
+			"method", fc.Method,
+			"rule", fc.MatchedRule,
+			"message", fc.VerdictMessage,
+		)
+		if err := p.server.WriteMessage(fc.DenyResponse()); err != nil {
+			p.logger.Error("answering server request", "error", err)
+		}
+		return nil
+	}
+
+	p.logger.Warn("response blocked",
+		"rule", fc.MatchedRule,
+		"message", fc.VerdictMessage,
+	)
+	// Replace a blocked response with an error so the client isn't left
+	// waiting; other blocked messages are dropped.
+	if fc.Message == nil || !fc.Message.IsResponse() {
+		return nil
+	}
+	data, err := json.Marshal(fc.DenyResponse())
 	if err != nil {
-		return err
+		p.logger.Error("encoding deny response", "error", err)
+		return nil
 	}
-	if _, err := w.Write(data); err != nil {
-		return err
+	return data
+}
+
+// filterOutboundBatch filters each message of a server batch and merges
+// in the responses the proxy gave to the client batch it answers.
+func (p *Proxy) filterOutboundBatch(ctx context.Context, msgs []json.RawMessage) []byte {
+	var out [][]byte
+	var batch *pendingBatch
+	for _, raw := range msgs {
+		if batch == nil {
+			batch = p.takeBatch(raw)
+		}
+		if data := p.filterOutbound(ctx, raw); data != nil {
+			out = append(out, data)
+		}
+	}
+	if batch != nil {
+		out = append(out, batch.local...)
+	}
+	if len(out) == 0 {
+		return nil
+	}
+	return jsonrpc.JoinBatch(out)
+}
+
+// takeBatch returns the client batch that the response raw answers, if
+// the proxy holds responses for it, and forgets it.
+func (p *Proxy) takeBatch(raw []byte) *pendingBatch {
+	msg, err := jsonrpc.Parse(raw)
+	if err != nil || !msg.IsResponse() {
+		return nil
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	pb, ok := p.batches[string(msg.ID)]
+	if !ok {
+		return nil
+	}
+	for _, id := range pb.ids {
+		delete(p.batches, id)
 	}
-	_, err = w.Write([]byte("\n"))
-	return err
+	return pb
 }
@@ -0,0 +1,428 @@
+package stdio
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tkingovr/agent-guard/api"
+	"github.com/tkingovr/agent-guard/internal/approval"
+	"github.com/tkingovr/agent-guard/internal/audit"
+	"github.com/tkingovr/agent-guard/internal/filter"
+	"github.com/tkingovr/agent-guard/internal/policy"
+	"github.com/tkingovr/agent-guard/internal/relay"
+)
+
+// lineSink collects each line written to it.
+type lineSink chan string
+
+func (s lineSink) Write(p []byte) (int, error) {
+	s <- strings.TrimSuffix(string(p), "\n")
+	return len(p), nil
+}
+
+func TestProxy_CorrelatesResponses(t *testing.T) {
+	store, err := audit.NewJSONLStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	engine, err := policy.NewYAMLEngineFromPolicy(&policy.PolicyFile{
+		Version:  1,
+		Settings: policy.Settings{DefaultAction: api.VerdictAllow},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	cfg := filter.ChainConfig{Engine: engine, AuditStore: store, Logger: logger}
+	p := NewProxy(logger, filter.BuildInboundChain(cfg), filter.BuildOutboundChain(cfg), nil)
+
+	ctx := context.Background()
+	var toServer bytes.Buffer
+	in := `{"jsonrpc":"2.0","id":3,"method":"tools/call","params":{"name":"read_file","arguments":{"path":"/tmp/x"}}}` + "\n"
+	p.server = relay.NewLineWriter(&toServer)
+	if err := p.pipeInbound(ctx, strings.NewReader(in)); err != nil {
+		t.Fatal(err)
+	}
+	out := `{"jsonrpc":"2.0","id":3,"error":{"code":-32602,"message":"no such file"}}` + "\n" +
+		`{"jsonrpc":"2.0","id":99,"result":{}}` + "\n"
+	var toClient bytes.Buffer
+	p.client = relay.NewLineWriter(&toClient)
+	if err := p.pipeOutbound(ctx, strings.NewReader(out)); err != nil {
+		t.Fatal(err)
+	}
+
+	records, err := store.Query(ctx, api.QueryFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 3 {
+		t.Fatalf("expected 3 audit records, got %d", len(records))
+	}
+	req, resp, stray := records[0], records[1], records[2]
+	if req.CorrelationID == "" || resp.CorrelationID != req.CorrelationID {
+		t.Errorf("expected request and response to share a correlation ID, got %q and %q", req.CorrelationID, resp.CorrelationID)
+	}
+	if resp.Method != "tools/call" || resp.Tool != "read_file" {
+		t.Errorf("expected response joined to tools/call read_file, got %q %q", resp.Method, resp.Tool)
+	}
+	if resp.Latency <= 0 {
+		t.Error("expected response latency to be recorded")
+	}
+	if resp.ErrorCode != -32602 || resp.ErrorMessage != "no such file" {
+		t.Errorf("expected server error on response record, got %d %q", resp.ErrorCode, resp.ErrorMessage)
+	}
+	if stray.CorrelationID != "" || stray.Tool != "" {
+		t.Errorf("unmatched response should not be correlated, got %+v", stray)
+	}
+}
+
+func TestProxy_DeniesServerRequests(t *testing.T) {
+	store, err := audit.NewJSONLStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	engine, err := policy.NewYAMLEngineFromPolicy(&policy.PolicyFile{
+		Version:  1,
+		Settings: policy.Settings{DefaultAction: api.VerdictAllow},
+		Rules: []policy.Rule{
+			{Name: "no-sampling", Match: policy.RuleMatch{Method: "sampling/createMessage"}, Action: "deny", Message: "sampling is disabled"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	cfg := filter.ChainConfig{Engine: engine, AuditStore: store, Logger: logger}
+	p := NewProxy(logger, filter.BuildInboundChain(cfg), filter.BuildOutboundChain(cfg), nil)
+	client := make(lineSink, 4)
+	server := make(lineSink, 4)
+	p.client = relay.NewLineWriter(client)
+	p.server = relay.NewLineWriter(server)
+
+	out := `{"jsonrpc":"2.0","id":"s1","method":"sampling/createMessage","params":{"messages":[]}}` + "\n" +
+		`{"jsonrpc":"2.0","id":"s2","method":"roots/list"}` + "\n"
+	if err := p.pipeOutbound(context.Background(), strings.NewReader(out)); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(client) != 1 {
+		t.Fatalf("expected only the allowed server request passed on, got %d lines", len(client))
+	}
+	if line := <-client; !strings.Contains(line, "roots/list") {
+		t.Errorf("expected roots/list passed on, got %s", line)
+	}
+	if len(server) != 1 {
+		t.Fatalf("expected the server answered once, got %d lines", len(server))
+	}
+	if line := <-server; !strings.Contains(line, `"id":"s1"`) || !strings.Contains(line, `"code":-32001`) || !strings.Contains(line, "sampling is disabled") {
+		t.Errorf("expected a policy error for the sampling request, got %s", line)
+	}
+
+	records, err := store.Query(context.Background(), api.QueryFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 || records[0].Verdict != api.VerdictDeny || records[0].Method != "sampling/createMessage" {
+		t.Errorf("expected the denied server request audited, got %+v", records)
+	}
+}
+
+// newAskProxy returns a proxy whose policy asks for approval of write_file
+// calls, with client output going to client.
+func newAskProxy(t *testing.T, client io.Writer) (*Proxy, *approval.Queue) {
+	t.Helper()
+	engine, err := policy.NewYAMLEngineFromPolicy(&policy.PolicyFile{
+		Version:  1,
+		Settings: policy.Settings{DefaultAction: api.VerdictAllow},
+		Rules: []policy.Rule{
+			{Name: "ask-write", Match: policy.RuleMatch{Method: "tools/call", Tool: "write_file"}, Action: "ask"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	store, err := audit.NewJSONLStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	cfg := filter.ChainConfig{Engine: engine, AuditStore: store, Logger: logger}
+	queue := approval.NewQueue(time.Minute)
+	p := NewProxy(logger, filter.BuildInboundChain(cfg), nil, queue)
+	p.client = relay.NewLineWriter(client)
+	return p, queue
+}
+
+// waitPending polls until the queue holds n pending approvals.
+func waitPending(t *testing.T, queue *approval.Queue, n int) []*approval.Request {
+	t.Helper()
+	var pending []*approval.Request
+	for deadline := time.Now().Add(2 * time.Second); len(pending) != n && time.Now().Before(deadline); {
+		time.Sleep(5 * time.Millisecond)
+		pending = queue.Pending()
+	}
+	if len(pending) != n {
+		t.Fatalf("expected %d pending approvals, got %d", n, len(pending))
+	}
+	return pending
+}
+
+func TestProxy_ApprovalDoesNotBlockOtherMessages(t *testing.T) {
+	p, queue := newAskProxy(t, io.Discard)
+
+	src, stdin := io.Pipe()
+	server := make(lineSink, 4)
+	p.server = relay.NewLineWriter(server)
+	done := make(chan error, 1)
+	go func() { done <- p.pipeInbound(context.Background(), src) }()
+
+	io.WriteString(stdin, `{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"write_file","arguments":{}}}`+"\n")
+	io.WriteString(stdin, `{"jsonrpc":"2.0","id":2,"method":"ping"}`+"\n")
+
+	select {
+	case line := <-server:
+		if !strings.Contains(line, `"ping"`) {
+			t.Fatalf("expected ping forwarded first, got %s", line)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("ping stalled behind a pending approval")
+	}
+
+	pending := waitPending(t, queue, 1)
+	if err := queue.Approve(pending[0].ID); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case line := <-server:
+		if !strings.Contains(line, `"write_file"`) {
+			t.Fatalf("expected approved write_file forwarded, got %s", line)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("approved request was not forwarded")
+	}
+
+	stdin.Close()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestProxy_CancelPendingApproval(t *testing.T) {
+	client := make(lineSink, 16)
+	p, queue := newAskProxy(t, client)
+	p.approvals = relay.NewApprovals(queue, p.logger, relay.WithProgressInterval(10*time.Millisecond))
+
+	src, stdin := io.Pipe()
+	server := make(lineSink, 4)
+	p.server = relay.NewLineWriter(server)
+	done := make(chan error, 1)
+	go func() { done <- p.pipeInbound(context.Background(), src) }()
+
+	io.WriteString(stdin, `{"jsonrpc":"2.0","id":5,"method":"tools/call","params":{"name":"write_file","arguments":{},"_meta":{"progressToken":"tok"}}}`+"\n")
+	pending := waitPending(t, queue, 1)
+
+	select {
+	case line := <-client:
+		if !strings.Contains(line, `"notifications/progress"`) || !strings.Contains(line, `"progressToken":"tok"`) {
+			t.Fatalf("expected a progress notification, got %s", line)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("no progress sent while awaiting approval")
+	}
+
+	io.WriteString(stdin, `{"jsonrpc":"2.0","method":"notifications/cancelled","params":{"requestId":5}}`+"\n")
+	waitPending(t, queue, 0)
+
+	stdin.Close()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if pending[0].Status != approval.StatusCancelled {
+		t.Errorf("expected status cancelled, got %s", pending[0].Status)
+	}
+	close(server)
+	for line := range server {
+		if strings.Contains(line, "write_file") {
+			t.Errorf("cancelled request was forwarded: %s", line)
+		}
+	}
+	close(client)
+	for line := range client {
+		if strings.Contains(line, `"id":5`) {
+			t.Errorf("cancelled request should get no response, got %s", line)
+		}
+	}
+}
+
+func TestProxy_ThrottledRequestDoesNotBlock(t *testing.T) {
+	engine, err := policy.NewYAMLEngineFromPolicy(&policy.PolicyFile{
+		Version:  1,
+		Settings: policy.Settings{DefaultAction: api.VerdictAllow},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	store, err := audit.NewJSONLStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	inbound := filter.BuildInboundChain(filter.ChainConfig{
+		Engine:     engine,
+		AuditStore: store,
+		Logger:     logger,
+		RateLimit: &filter.RateLimitConfig{
+			PerTool:  map[string]*filter.RateLimit{"search": {Max: 1, Window: time.Minute}},
+			OnExceed: filter.OnExceedDelay,
+			MaxWait:  2 * time.Minute,
+		},
+	})
+	client := make(lineSink, 4)
+	p := NewProxy(logger, inbound, nil, nil)
+	p.client = relay.NewLineWriter(client)
+
+	src, stdin := io.Pipe()
+	server := make(lineSink, 4)
+	p.server = relay.NewLineWriter(server)
+	done := make(chan error, 1)
+	go func() { done <- p.pipeInbound(context.Background(), src) }()
+
+	io.WriteString(stdin, `{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"search","arguments":{}}}`+"\n")
+	io.WriteString(stdin, `{"jsonrpc":"2.0","id":2,"method":"tools/call","params":{"name":"search","arguments":{}}}`+"\n")
+	io.WriteString(stdin, `{"jsonrpc":"2.0","id":3,"method":"ping"}`+"\n")
+
+	for _, want := range []string{`"id":1`, `"ping"`} {
+		select {
+		case line := <-server:
+			if !strings.Contains(line, want) {
+				t.Fatalf("expected %s forwarded, got %s", want, line)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatal("ping stalled behind a throttled request")
+		}
+	}
+
+	// The cancel is read while the request is held, and withdraws it
+	io.WriteString(stdin, `{"jsonrpc":"2.0","method":"notifications/cancelled","params":{"requestId":2}}`+"\n")
+	stdin.Close()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("cancelled request still held")
+	}
+	close(server)
+	for line := range server {
+		if strings.Contains(line, `"id":2`) {
+			t.Errorf("cancelled request was forwarded: %s", line)
+		}
+	}
+	close(client)
+	for line := range client {
+		t.Errorf("cancelled request should get no response, got %s", line)
+	}
+}
+
+func TestProxy_MalformedLineGetsError(t *testing.T) {
+	client := make(lineSink, 4)
+	p, _ := newAskProxy(t, client)
+
+	server := make(lineSink, 4)
+	p.server = relay.NewLineWriter(server)
+	if err := p.pipeInbound(context.Background(), strings.NewReader("{oops\n")); err != nil {
+		t.Fatal(err)
+	}
+	if len(server) != 0 {
+		t.Error("malformed message should not be forwarded")
+	}
+	select {
+	case line := <-client:
+		if !strings.Contains(line, `"id":null`) || !strings.Contains(line, `"code":-32700`) {
+			t.Errorf("expected parse error with null id, got %s", line)
+		}
+	default:
+		t.Fatal("client got no response for a malformed message")
+	}
+}
+
+func TestProxy_BatchPartialDenial(t *testing.T) {
+	engine, err := policy.NewYAMLEngineFromPolicy(&policy.PolicyFile{
+		Version:  1,
+		Settings: policy.Settings{DefaultAction: api.VerdictAllow},
+		Rules: []policy.Rule{
+			{Name: "no-delete", Match: policy.RuleMatch{Method: "tools/call", Tool: "delete_file"}, Action: "deny"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	store, err := audit.NewJSONLStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	cfg := filter.ChainConfig{Engine: engine, AuditStore: store, Logger: logger}
+	p := NewProxy(logger, filter.BuildInboundChain(cfg), filter.BuildOutboundChain(cfg), nil)
+	client := make(lineSink, 4)
+	p.client = relay.NewLineWriter(client)
+
+	ctx := context.Background()
+	server := make(lineSink, 4)
+	in := `[{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"read_file","arguments":{}}},` +
+		`{"jsonrpc":"2.0","id":2,"method":"tools/call","params":{"name":"delete_file","arguments":{}}},` +
+		`{"jsonrpc":"2.0","method":"notifications/initialized"}]` + "\n" +
+		`[{"jsonrpc":"2.0","id":3,"method":"tools/call","params":{"name":"delete_file","arguments":{}}}]` + "\n"
+	p.server = relay.NewLineWriter(server)
+	if err := p.pipeInbound(ctx, strings.NewReader(in)); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(server) != 1 {
+		t.Fatalf("expected one batch forwarded, got %d lines", len(server))
+	}
+	forwarded := <-server
+	if !strings.HasPrefix(forwarded, "[") || !strings.Contains(forwarded, `"id":1`) || !strings.Contains(forwarded, "notifications/initialized") {
+		t.Errorf("expected allowed call and notification forwarded as a batch, got %s", forwarded)
+	}
+	if strings.Contains(forwarded, "delete_file") {
+		t.Errorf("denied call was forwarded: %s", forwarded)
+	}
+
+	// The all-denied batch is answered at once
+	select {
+	case line := <-client:
+		if !strings.HasPrefix(line, "[") || !strings.Contains(line, `"id":3`) || !strings.Contains(line, `"code":-32001`) {
+			t.Errorf("expected batch of one deny for id 3, got %s", line)
+		}
+	default:
+		t.Fatal("all-denied batch got no response")
+	}
+
+	out := `[{"jsonrpc":"2.0","id":1,"result":{"content":[]}}]` + "\n"
+	if err := p.pipeOutbound(ctx, strings.NewReader(out)); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case line := <-client:
+		if !strings.HasPrefix(line, "[") || !strings.Contains(line, `"id":1,"result"`) || !strings.Contains(line, `"id":2,"error"`) {
+			t.Errorf("expected server result merged with the deny for id 2, got %s", line)
+		}
+	default:
+		t.Fatal("batch response not delivered")
+	}
+	if len(p.batches) != 0 {
+		t.Errorf("expected merged batch to be forgotten, %d left", len(p.batches))
+	}
+}
@@ -0,0 +1,121 @@
+package relay
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/tkingovr/agent-guard/api"
+	"github.com/tkingovr/agent-guard/internal/approval"
+	"github.com/tkingovr/agent-guard/internal/filter"
+	"github.com/tkingovr/agent-guard/internal/jsonrpc"
+)
+
+// DefaultProgressInterval keeps hosts that reset their request timeout on
+// progress from giving up during long approvals.
+const DefaultProgressInterval = 10 * time.Second
+
+// Approvals holds requests with an ask verdict in an approval queue until
+// an approver decides.
+type Approvals struct {
+	queue    *approval.Queue
+	logger   *slog.Logger
+	interval time.Duration
+	toolName func(*filter.FilterContext) string
+}
+
+// ApprovalsOption configures Approvals.
+type ApprovalsOption func(*Approvals)
+
+// WithProgressInterval sets how often a request pending approval that
+// carries a progressToken gets a notifications/progress. Default is 10s.
+func WithProgressInterval(d time.Duration) ApprovalsOption {
+	return func(a *Approvals) { a.interval = d }
+}
+
+// WithToolName sets how the approver is shown a request's tool, e.g. as
+// the client names it. Default is fc.Tool.
+func WithToolName(name func(*filter.FilterContext) string) ApprovalsOption {
+	return func(a *Approvals) { a.toolName = name }
+}
+
+func NewApprovals(queue *approval.Queue, logger *slog.Logger, opts ...ApprovalsOption) *Approvals {
+	a := &Approvals{
+		queue:    queue,
+		logger:   logger,
+		interval: DefaultProgressInterval,
+		toolName: func(fc *filter.FilterContext) string { return fc.Tool },
+	}
+	for _, opt := range opts {
+		opt(a)
+	}
+	return a
+}
+
+// Decide enqueues fc for approval and waits for the decision. If the
+// request carries a progressToken and progress isn't nil, progress is
+// given a notifications/progress every interval meanwhile; an error from
+// it stops them. A rejected request is finished and its deny response
+// returned. One whose ctx ends first (the client cancelled it or went
+// away) is withdrawn from the queue and gets no response.
+func (a *Approvals) Decide(ctx context.Context, fc *filter.FilterContext, progress func(*api.JSONRPCMessage) error) (approved bool, resp *api.JSONRPCMessage) {
+	req := a.queue.Enqueue(fc.Method, a.toolName(fc), fc.MatchedRule, fc.VerdictMessage, fc.DisplayArguments())
+
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	if token := jsonrpc.ProgressToken(fc.Message); token != nil && progress != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ticker := time.NewTicker(a.interval)
+			defer ticker.Stop()
+			for n := 1; ; n++ {
+				select {
+				case <-stop:
+					return
+				case <-ticker.C:
+					if err := progress(jsonrpc.NewProgressNotification(token, n, "awaiting human approval")); err != nil {
+						a.logger.Error("writing progress notification", "error", err)
+						return
+					}
+				}
+			}
+		}()
+	}
+
+	verdict, err := a.queue.Await(ctx, req)
+
+	// No progress may follow the response
+	close(stop)
+	wg.Wait()
+
+	if err == nil && verdict != api.VerdictDeny {
+		return true, nil
+	}
+
+	fc.Finish()
+	if errors.Is(err, approval.ErrCancelled) || ctx.Err() != nil {
+		// Withdrawn from the queue, since nobody waits for the decision
+		if ctx.Err() != nil {
+			if err := a.queue.Cancel(req.ID); err != nil {
+				a.logger.Debug("cancelling approval", "id", req.ID, "error", err)
+			}
+		}
+		a.logger.Info("pending request cancelled by client",
+			"method", fc.Method,
+			"server", fc.Server,
+			"tool", fc.Tool,
+		)
+		return false, nil
+	}
+	msg := "request denied by approver"
+	if err != nil {
+		msg = "approval error: " + err.Error()
+	}
+	if fc.Message != nil && fc.Message.ID != nil {
+		return false, jsonrpc.NewDenyResponse(fc.Message.ID, msg)
+	}
+	return false, nil
+}
@@ -0,0 +1,70 @@
+// Package relay holds what the stdio proxy, the HTTP proxy and the gateway
+// share in relaying MCP messages between a client and its servers: whole
+// line writes, correlation of responses with their requests, cancellation
+// of requests in flight, and holding requests for approval.
+package relay
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+	"sync/atomic"
+
+	"github.com/tkingovr/agent-guard/api"
+)
+
+// NewSessionID returns a random ID for a client session.
+func NewSessionID() string {
+	var b [8]byte
+	_, _ = rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+// CorrelationIDs hands out the IDs "<prefix>-<n>" that tie a request's
+// audit record to its response's.
+type CorrelationIDs struct {
+	prefix string
+	seq    atomic.Uint64
+}
+
+func NewCorrelationIDs(prefix string) *CorrelationIDs {
+	return &CorrelationIDs{prefix: prefix}
+}
+
+// Next returns the next correlation ID.
+func (c *CorrelationIDs) Next() string {
+	return fmt.Sprintf("%s-%d", c.prefix, c.seq.Add(1))
+}
+
+// LineWriter writes whole lines, so lines written by concurrent goroutines
+// (both pipes and pending approvals) never interleave.
+type LineWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func NewLineWriter(w io.Writer) *LineWriter {
+	return &LineWriter{w: w}
+}
+
+// WriteMessage writes msg as one line of JSON.
+func (lw *LineWriter) WriteMessage(msg *api.JSONRPCMessage) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	return lw.WriteLine(data)
+}
+
+// WriteLine writes data and a newline in a single write.
+func (lw *LineWriter) WriteLine(data []byte) error {
+	lw.mu.Lock()
+	defer lw.mu.Unlock()
+	line := make([]byte, 0, len(data)+1)
+	line = append(append(line, data...), '\n')
+	_, err := lw.w.Write(line)
+	return err
+}
@@ -0,0 +1,160 @@
+package relay
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/tkingovr/agent-guard/api"
+	"github.com/tkingovr/agent-guard/internal/approval"
+	"github.com/tkingovr/agent-guard/internal/filter"
+)
+
+func newTestLogger() *slog.Logger {
+	return slog.New(slog.NewTextHandler(io.Discard, nil))
+}
+
+// request returns the context of an inbound request after parsing.
+func request(t *testing.T, raw string) *filter.FilterContext {
+	t.Helper()
+	fc := filter.NewFilterContext([]byte(raw), api.DirectionInbound)
+	if err := filter.NewParseFilter().Process(context.Background(), fc); err != nil {
+		t.Fatal(err)
+	}
+	return fc
+}
+
+func TestRequests_Correlate(t *testing.T) {
+	requests := NewRequests(2)
+	for i, tool := range []string{"a", "b", "c"} {
+		fc := request(t, `{"jsonrpc":"2.0","id":`+strconv.Itoa(i+1)+`,"method":"tools/call","params":{"name":"`+tool+`"}}`)
+		fc.CorrelationID = "x-" + tool
+		fc.StartTime = time.Now().Add(time.Duration(i) * time.Millisecond)
+		requests.Track(fc)
+	}
+
+	for raw, tool := range map[string]string{
+		`{"jsonrpc":"2.0","id":1,"result":{}}`: "", // evicted as the oldest
+		`{"jsonrpc":"2.0","id":3,"result":{}}`: "c",
+	} {
+		fc := filter.NewFilterContext([]byte(raw), api.DirectionOutbound)
+		requests.Correlate(fc)
+		if fc.Tool != tool || (tool != "" && fc.CorrelationID != "x-"+tool) {
+			t.Errorf("%s: expected tool %q, got %q (%q)", raw, tool, fc.Tool, fc.CorrelationID)
+		}
+	}
+
+	// A response is joined once
+	fc := filter.NewFilterContext([]byte(`{"jsonrpc":"2.0","id":3,"result":{}}`), api.DirectionOutbound)
+	requests.Correlate(fc)
+	if fc.Tool != "" {
+		t.Errorf("expected the request forgotten after its response, got %q", fc.Tool)
+	}
+}
+
+func TestInflight_Cancel(t *testing.T) {
+	inflight := NewInflight()
+	id := json.RawMessage(`7`)
+	ctx, done := inflight.Start(context.Background(), "alice", id)
+
+	inflight.Cancel("bob", id)
+	if ctx.Err() != nil {
+		t.Fatal("another session's cancel stopped the request")
+	}
+	inflight.Cancel("alice", id)
+	if ctx.Err() == nil {
+		t.Fatal("expected the request cancelled")
+	}
+	done()
+
+	// A request reusing the ID isn't forgotten when the first is done
+	_, done1 := inflight.Start(context.Background(), "alice", id)
+	ctx2, done2 := inflight.Start(context.Background(), "alice", id)
+	defer done2()
+	done1()
+	inflight.Cancel("alice", id)
+	if ctx2.Err() == nil {
+		t.Error("expected the request reusing the ID cancelled")
+	}
+}
+
+// waitPending polls until the queue holds a pending approval.
+func waitPending(t *testing.T, queue *approval.Queue) *approval.Request {
+	t.Helper()
+	for deadline := time.Now().Add(2 * time.Second); time.Now().Before(deadline); time.Sleep(5 * time.Millisecond) {
+		if pending := queue.Pending(); len(pending) > 0 {
+			return pending[0]
+		}
+	}
+	t.Fatal("request never reached the approval queue")
+	return nil
+}
+
+func TestApprovals_Decide(t *testing.T) {
+	queue := approval.NewQueue(time.Minute)
+	approvals := NewApprovals(queue, newTestLogger(), WithProgressInterval(5*time.Millisecond),
+		WithToolName(func(fc *filter.FilterContext) string { return "files." + fc.Tool }))
+	call := `{"jsonrpc":"2.0","id":4,"method":"tools/call","params":{"name":"write","_meta":{"progressToken":"tok"}}}`
+
+	var mu sync.Mutex
+	var progress []string
+	record := func(msg *api.JSONRPCMessage) error {
+		data, _ := json.Marshal(msg)
+		mu.Lock()
+		progress = append(progress, string(data))
+		mu.Unlock()
+		return nil
+	}
+
+	// Approved, with progress while pending
+	result := make(chan bool)
+	go func() {
+		approved, _ := approvals.Decide(context.Background(), request(t, call), record)
+		result <- approved
+	}()
+	req := waitPending(t, queue)
+	if req.Tool != "files.write" {
+		t.Errorf("expected the approver shown files.write, got %q", req.Tool)
+	}
+	time.Sleep(30 * time.Millisecond)
+	queue.Approve(req.ID)
+	if !<-result {
+		t.Fatal("expected approval")
+	}
+	mu.Lock()
+	if len(progress) == 0 || !strings.Contains(progress[0], `"progressToken":"tok"`) {
+		t.Errorf("expected progress notifications while pending, got %v", progress)
+	}
+	mu.Unlock()
+
+	// Denied
+	go func() {
+		_, resp := approvals.Decide(context.Background(), request(t, call), nil)
+		result <- resp != nil && strings.Contains(resp.Error.Message, "denied by approver")
+	}()
+	queue.Deny(waitPending(t, queue).ID)
+	if !<-result {
+		t.Error("expected a deny response")
+	}
+
+	// Cancelled by the client: withdrawn, with no response
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		approved, resp := approvals.Decide(ctx, request(t, call), nil)
+		result <- !approved && resp == nil
+	}()
+	req = waitPending(t, queue)
+	cancel()
+	if !<-result {
+		t.Error("expected no response for a cancelled request")
+	}
+	if req.Status != approval.StatusCancelled {
+		t.Errorf("expected the approval withdrawn, got %s", req.Status)
+	}
+}
@@ -0,0 +1,127 @@
+package relay
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+
+	"github.com/tkingovr/agent-guard/internal/filter"
+	"github.com/tkingovr/agent-guard/internal/jsonrpc"
+)
+
+// Requests remembers forwarded requests by JSON-RPC ID until their
+// responses come back, so each response is audited with its request's
+// method, tool, and correlation ID.
+type Requests struct {
+	max int
+
+	mu      sync.Mutex
+	pending map[string]*filter.FilterContext // request ID → request
+}
+
+// NewRequests returns a tracker holding at most max requests, forgetting
+// the oldest past that; 0 means no limit.
+func NewRequests(max int) *Requests {
+	return &Requests{max: max, pending: make(map[string]*filter.FilterContext)}
+}
+
+// Track records fc if it is a request. Call it before forwarding, so the
+// response can't arrive first.
+func (r *Requests) Track(fc *filter.FilterContext) {
+	if fc.Message == nil || !fc.Message.IsRequest() {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.max > 0 && len(r.pending) >= r.max {
+		var oldest string
+		for id, req := range r.pending {
+			if oldest == "" || req.StartTime.Before(r.pending[oldest].StartTime) {
+				oldest = id
+			}
+		}
+		delete(r.pending, oldest)
+	}
+	// Only what Join needs is kept
+	r.pending[string(fc.Message.ID)] = &filter.FilterContext{
+		Method:        fc.Method,
+		Tool:          fc.Tool,
+		CorrelationID: fc.CorrelationID,
+		StartTime:     fc.StartTime,
+	}
+}
+
+// Correlate joins the response fc to the request that caused it, if
+// tracked, and forgets the request.
+func (r *Requests) Correlate(fc *filter.FilterContext) {
+	msg, err := jsonrpc.Parse(fc.Raw)
+	if err != nil || !msg.IsResponse() {
+		return
+	}
+	r.mu.Lock()
+	req, ok := r.pending[string(msg.ID)]
+	delete(r.pending, string(msg.ID))
+	r.mu.Unlock()
+	if ok {
+		Join(fc, req)
+	}
+}
+
+// Join gives the response fc the method, tool and correlation ID of the
+// request req it answers, and the latency between them.
+func Join(fc, req *filter.FilterContext) {
+	fc.Method = req.Method
+	fc.Tool = req.Tool
+	fc.CorrelationID = req.CorrelationID
+	fc.Latency = fc.StartTime.Sub(req.StartTime)
+}
+
+// Inflight holds a cancel function for each request of a client still
+// being handled, so a notifications/cancelled from the client can stop it.
+type Inflight struct {
+	mu      sync.Mutex
+	cancels map[string]*context.CancelFunc // session + request ID → cancel
+}
+
+func NewInflight() *Inflight {
+	return &Inflight{cancels: make(map[string]*context.CancelFunc)}
+}
+
+// Start registers request id of session and returns the context to handle
+// it in, which Cancel ends, and done to call once it is handled. Call it
+// before reading the client's next message, so a cancel that follows
+// finds the request. A notification (nil id) can't be cancelled.
+func (in *Inflight) Start(ctx context.Context, session string, id json.RawMessage) (reqCtx context.Context, done func()) {
+	if id == nil {
+		return ctx, func() {}
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	key := inflightKey(session, id)
+	entry := &cancel
+	in.mu.Lock()
+	in.cancels[key] = entry
+	in.mu.Unlock()
+	return ctx, func() {
+		cancel()
+		in.mu.Lock()
+		// A request reusing the ID may have taken the entry over
+		if in.cancels[key] == entry {
+			delete(in.cancels, key)
+		}
+		in.mu.Unlock()
+	}
+}
+
+// Cancel stops request id of session, if it is still in flight.
+func (in *Inflight) Cancel(session string, id json.RawMessage) {
+	in.mu.Lock()
+	cancel, ok := in.cancels[inflightKey(session, id)]
+	in.mu.Unlock()
+	if ok {
+		(*cancel)()
+	}
+}
+
+func inflightKey(session string, id json.RawMessage) string {
+	return session + "\x00" + string(id)
+}
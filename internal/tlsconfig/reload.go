@@ -0,0 +1,82 @@
+package tlsconfig
+
+import (
+	"crypto/tls"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+)
+
+// reloadInterval is how often the certificate files are checked for
+// changes, at most.
+const reloadInterval = time.Second
+
+// certReloader serves a certificate and key from files, loading them again
+// when either file's modification time changes. A reload that fails (e.g.
+// the key was written but not yet the certificate) keeps the previous
+// certificate and is retried at the next check.
+type certReloader struct {
+	certFile string
+	keyFile  string
+	logger   *slog.Logger
+
+	mu      sync.Mutex
+	cert    *tls.Certificate
+	certMod time.Time
+	keyMod  time.Time
+	checked time.Time
+}
+
+func newCertReloader(certFile, keyFile string, logger *slog.Logger) (*certReloader, error) {
+	r := &certReloader{certFile: certFile, keyFile: keyFile, logger: logger}
+	if err := r.load(); err != nil {
+		return nil, err
+	}
+	r.checked = time.Now()
+	return r, nil
+}
+
+// get returns the current certificate, reloading it first if the files
+// changed.
+func (r *certReloader) get() *tls.Certificate {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if time.Since(r.checked) < reloadInterval {
+		return r.cert
+	}
+	r.checked = time.Now()
+
+	certMod, keyMod := modTime(r.certFile), modTime(r.keyFile)
+	if certMod.Equal(r.certMod) && keyMod.Equal(r.keyMod) {
+		return r.cert
+	}
+	if err := r.load(); err != nil {
+		r.logger.Error("reloading TLS certificate", "cert", r.certFile, "error", err)
+		return r.cert
+	}
+	r.logger.Info("TLS certificate reloaded", "cert", r.certFile)
+	return r.cert
+}
+
+// load reads the certificate and key. Callers other than the constructor
+// must hold r.mu.
+func (r *certReloader) load() error {
+	certMod, keyMod := modTime(r.certFile), modTime(r.keyFile)
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return fmt.Errorf("loading TLS certificate: %w", err)
+	}
+	r.cert = &cert
+	r.certMod, r.keyMod = certMod, keyMod
+	return nil
+}
+
+func modTime(path string) time.Time {
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
@@ -0,0 +1,84 @@
+// Package tlsconfig builds the TLS configurations of the HTTP proxy: its
+// listener, which may require client certificates (mTLS), and its
+// connections to the target.
+package tlsconfig
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log/slog"
+	"os"
+
+	"github.com/tkingovr/agent-guard/internal/policy"
+)
+
+// Server returns the listener's TLS configuration. The certificate is
+// reloaded when its files change, so a renewal needs no restart.
+func Server(s *policy.TLSSettings, logger *slog.Logger) (*tls.Config, error) {
+	certs, err := newCertReloader(s.CertFile, s.KeyFile, logger)
+	if err != nil {
+		return nil, err
+	}
+	cfg := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			return certs.get(), nil
+		},
+	}
+	if s.MinVersion == "1.3" {
+		cfg.MinVersion = tls.VersionTLS13
+	}
+
+	if s.ClientCAFile != "" {
+		pool, err := loadCertPool(s.ClientCAFile)
+		if err != nil {
+			return nil, err
+		}
+		cfg.ClientCAs = pool
+		cfg.ClientAuth = tls.RequireAndVerifyClientCert
+		if s.ClientAuth == "optional" {
+			cfg.ClientAuth = tls.VerifyClientCertIfGiven
+		}
+	}
+	return cfg, nil
+}
+
+// Client returns the TLS configuration for connections to the target: the
+// CAs trusted in place of the system roots, a client certificate
+// (reloaded like the server's), and the server name to send and verify.
+func Client(s *policy.UpstreamTLSSettings, logger *slog.Logger) (*tls.Config, error) {
+	cfg := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		ServerName: s.ServerName,
+	}
+	if s.CAFile != "" {
+		pool, err := loadCertPool(s.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		cfg.RootCAs = pool
+	}
+	if s.CertFile != "" {
+		certs, err := newCertReloader(s.CertFile, s.KeyFile, logger)
+		if err != nil {
+			return nil, err
+		}
+		cfg.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			return certs.get(), nil
+		}
+	}
+	return cfg, nil
+}
+
+func loadCertPool(path string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading CA bundle: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("CA bundle %s has no PEM certificates", path)
+	}
+	return pool, nil
+}
@@ -0,0 +1,181 @@
+package tlsconfig
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"log/slog"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/tkingovr/agent-guard/internal/policy"
+)
+
+// testCA issues certificates for the tests.
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+func newTestCA(t *testing.T) *testCA {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	return &testCA{cert: cert, key: key, pem: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})}
+}
+
+// issue writes a certificate for cn (also its DNS SAN) and its key to dir,
+// returning their paths.
+func (ca *testCA) issue(t *testing.T, dir, cn string, usage x509.ExtKeyUsage) (certFile, keyFile string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serial, _ := rand.Int(rand.Reader, big.NewInt(1<<62))
+	tmpl := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: cn, Organization: []string{"Acme"}},
+		DNSNames:     []string{cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, _ := x509.MarshalECPrivateKey(key)
+	certFile, keyFile = filepath.Join(dir, cn+".crt"), filepath.Join(dir, cn+".key")
+	write(t, certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+	write(t, keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}))
+	return certFile, keyFile
+}
+
+func write(t *testing.T, path string, data []byte) {
+	t.Helper()
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMutualTLS(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCA(t)
+	caFile := filepath.Join(dir, "ca.pem")
+	write(t, caFile, ca.pem)
+	serverCert, serverKey := ca.issue(t, dir, "mcp.internal", x509.ExtKeyUsageServerAuth)
+	clientCert, clientKey := ca.issue(t, dir, "agent-1", x509.ExtKeyUsageClientAuth)
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	serverTLS, err := Server(&policy.TLSSettings{CertFile: serverCert, KeyFile: serverKey, ClientCAFile: caFile}, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var peer string
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		peer = r.TLS.PeerCertificates[0].Subject.CommonName
+	}))
+	srv.TLS = serverTLS
+	srv.StartTLS()
+	defer srv.Close()
+
+	// The server is reached by IP, so the name to verify is set explicitly
+	get := func(s *policy.UpstreamTLSSettings) error {
+		clientTLS, err := Client(s, logger)
+		if err != nil {
+			t.Fatal(err)
+		}
+		client := &http.Client{Transport: &http.Transport{TLSClientConfig: clientTLS}}
+		resp, err := client.Get(srv.URL)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		return nil
+	}
+
+	if err := get(&policy.UpstreamTLSSettings{CAFile: caFile, CertFile: clientCert, KeyFile: clientKey, ServerName: "mcp.internal"}); err != nil {
+		t.Fatal(err)
+	}
+	if peer != "agent-1" {
+		t.Errorf("expected the server to see client agent-1, got %q", peer)
+	}
+	if err := get(&policy.UpstreamTLSSettings{CAFile: caFile, ServerName: "mcp.internal"}); err == nil {
+		t.Error("expected a client without a certificate to be rejected")
+	}
+	if err := get(&policy.UpstreamTLSSettings{CAFile: caFile, CertFile: clientCert, KeyFile: clientKey, ServerName: "other.internal"}); err == nil {
+		t.Error("expected a server name mismatch to be rejected")
+	}
+}
+
+func TestCertReloader(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCA(t)
+	certFile, keyFile := ca.issue(t, dir, "first", x509.ExtKeyUsageServerAuth)
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	r, err := newCertReloader(certFile, keyFile, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf := func() string {
+		cert, _ := x509.ParseCertificate(r.get().Certificate[0])
+		return cert.Subject.CommonName
+	}
+
+	// Renew in place: write a new pair over the old files
+	newCert, newKey := ca.issue(t, t.TempDir(), "second", x509.ExtKeyUsageServerAuth)
+	for src, dst := range map[string]string{newCert: certFile, newKey: keyFile} {
+		data, _ := os.ReadFile(src)
+		write(t, dst, data)
+		later := time.Now().Add(time.Minute)
+		os.Chtimes(dst, later, later)
+	}
+	if got := leaf(); got != "first" {
+		t.Errorf("files are checked at most every %s; expected first, got %s", reloadInterval, got)
+	}
+
+	r.mu.Lock()
+	r.checked = time.Time{}
+	r.mu.Unlock()
+	if got := leaf(); got != "second" {
+		t.Errorf("expected the renewed certificate, got %s", got)
+	}
+
+	// A broken pair keeps the current certificate
+	write(t, keyFile, []byte("not a key"))
+	r.mu.Lock()
+	r.checked = time.Time{}
+	r.mu.Unlock()
+	if got := leaf(); got != "second" {
+		t.Errorf("expected the current certificate to be kept, got %s", got)
+	}
+}